@@ -0,0 +1,94 @@
+// Package blobstore stores binary objects such as uploaded images outside the
+// database, either on the local filesystem or in an S3-compatible bucket.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned when the requested object does not exist.
+var ErrNotExist = errors.New("blob does not exist")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore stores objects under slash-separated keys and serves them by URL.
+// Writing an existing key replaces its content.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+	// Walk calls fn for every object whose key starts with prefix, in no
+	// particular order, stopping at the first error fn returns.
+	Walk(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+	// URL returns the address clients fetch key from.
+	URL(key string) string
+	// Key reverses URL, reporting false for URLs this store did not produce.
+	Key(url string) (string, bool)
+}
+
+// NewFromEnv builds the BlobStore selected by BLOB_BACKEND ("local", the
+// default, or "s3").
+func NewFromEnv() (BlobStore, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("BLOB_BACKEND"))); backend {
+	case "", "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = "./media"
+		}
+		baseURL := os.Getenv("BLOB_PUBLIC_URL")
+		if baseURL == "" {
+			baseURL = "/media"
+		}
+		return NewLocal(dir, baseURL)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			UseSSL:    os.Getenv("S3_USE_SSL") != "false",
+			PublicURL: os.Getenv("BLOB_PUBLIC_URL"),
+		})
+	default:
+		return nil, fmt.Errorf("blobstore: unknown BLOB_BACKEND %q (use local or s3)", backend)
+	}
+}
+
+// validKey rejects keys that could escape the store's root.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("blobstore: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("blobstore: invalid key %q", key)
+		}
+	}
+	return nil
+}
+
+// keyFromURL strips baseURL from url, returning the key it addresses.
+func keyFromURL(baseURL, url string) (string, bool) {
+	prefix := strings.TrimRight(baseURL, "/") + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(url, prefix)
+	if validKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
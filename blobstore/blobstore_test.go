@@ -0,0 +1,177 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// runBlobStoreContract runs the behaviour every BlobStore must share.
+// newStore must return an empty store for each call.
+func runBlobStoreContract(t *testing.T, newStore func(t *testing.T) BlobStore) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, s BlobStore)
+	}{
+		{"PutGetDelete", testPutGetDelete},
+		{"MissingKey", testMissingKey},
+		{"InvalidKeys", testInvalidKeys},
+		{"URLRoundTrip", testURLRoundTrip},
+		{"Walk", testWalk},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newStore(t))
+		})
+	}
+}
+
+func testPutGetDelete(t *testing.T, s BlobStore) {
+	ctx := context.Background()
+	body := "not really a jpeg"
+	if err := s.Put(ctx, "images/abc.jpg", strings.NewReader(body), int64(len(body)), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	ok, err := s.Exists(ctx, "images/abc.jpg")
+	if err != nil || !ok {
+		t.Fatalf("Exists after Put = %v, %v; want true", ok, err)
+	}
+	rc, err := s.Get(ctx, "images/abc.jpg")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != body {
+		t.Fatalf("Get = %q, %v; want %q", got, err, body)
+	}
+
+	if err := s.Delete(ctx, "images/abc.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if ok, _ := s.Exists(ctx, "images/abc.jpg"); ok {
+		t.Fatal("Exists after Delete = true")
+	}
+	if err := s.Delete(ctx, "images/abc.jpg"); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+}
+
+func testMissingKey(t *testing.T, s BlobStore) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "images/missing.png"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Get of missing key: got %v, want ErrNotExist", err)
+	}
+	if ok, err := s.Exists(ctx, "images/missing.png"); err != nil || ok {
+		t.Fatalf("Exists of missing key = %v, %v; want false", ok, err)
+	}
+}
+
+func testInvalidKeys(t *testing.T, s BlobStore) {
+	ctx := context.Background()
+	for _, key := range []string{"", "/abs", "../escape", "images/../../escape", "images//x", `images\x`} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+}
+
+func testURLRoundTrip(t *testing.T, s BlobStore) {
+	url := s.URL("images/abc.jpg")
+	key, ok := s.Key(url)
+	if !ok || key != "images/abc.jpg" {
+		t.Fatalf("Key(URL(images/abc.jpg)) = %q, %v", key, ok)
+	}
+	for _, foreign := range []string{"https://elsewhere.example.com/images/abc.jpg", "data:image/png;base64,AAAA", url + "/../x"} {
+		if _, ok := s.Key(foreign); ok {
+			t.Errorf("Key(%q) claimed a foreign URL", foreign)
+		}
+	}
+}
+
+func TestLocalContract(t *testing.T) {
+	runBlobStoreContract(t, func(t *testing.T) BlobStore {
+		s, err := NewLocal(t.TempDir(), "/media")
+		if err != nil {
+			t.Fatalf("NewLocal: %v", err)
+		}
+		return s
+	})
+}
+
+// TestS3Contract runs against TEST_S3_ENDPOINT in throwaway buckets named
+// after TEST_S3_BUCKET, skipping when unset. A local MinIO works, e.g.
+//
+//	docker run --rm -p 9000:9000 minio/minio server /data
+//	TEST_S3_ENDPOINT=localhost:9000 TEST_S3_BUCKET=test TEST_S3_ACCESS_KEY=minioadmin TEST_S3_SECRET_KEY=minioadmin go test ./blobstore/
+func TestS3Contract(t *testing.T) {
+	endpoint, bucket := os.Getenv("TEST_S3_ENDPOINT"), os.Getenv("TEST_S3_BUCKET")
+	if endpoint == "" || bucket == "" {
+		t.Skip("TEST_S3_ENDPOINT/TEST_S3_BUCKET not set; skipping S3 tests")
+	}
+	runBlobStoreContract(t, func(t *testing.T) BlobStore {
+		// A fresh bucket per case keeps cases independent.
+		name := fmt.Sprintf("%s-%d", bucket, time.Now().UnixNano())
+		s, err := NewS3(S3Config{
+			Endpoint:  endpoint,
+			Bucket:    name,
+			AccessKey: os.Getenv("TEST_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("TEST_S3_SECRET_KEY"),
+			UseSSL:    os.Getenv("TEST_S3_USE_SSL") == "true",
+		})
+		if err != nil {
+			t.Fatalf("NewS3: %v", err)
+		}
+		ctx := context.Background()
+		if err := s.client.MakeBucket(ctx, name, minio.MakeBucketOptions{}); err != nil {
+			t.Fatalf("create bucket %s: %v", name, err)
+		}
+		t.Cleanup(func() {
+			for obj := range s.client.ListObjects(ctx, name, minio.ListObjectsOptions{Recursive: true}) {
+				_ = s.client.RemoveObject(ctx, name, obj.Key, minio.RemoveObjectOptions{})
+			}
+			_ = s.client.RemoveBucket(ctx, name)
+		})
+		return s
+	})
+}
+
+func testWalk(t *testing.T, s BlobStore) {
+	ctx := context.Background()
+	for _, key := range []string{"images/a.jpg", "images/a/w400.jpg", "other/b.txt"} {
+		if err := s.Put(ctx, key, strings.NewReader(key), int64(len(key)), "text/plain"); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	seen := map[string]int64{}
+	err := s.Walk(ctx, "images/", func(o ObjectInfo) error {
+		if o.ModTime.IsZero() {
+			t.Errorf("%s has no ModTime", o.Key)
+		}
+		seen[o.Key] = o.Size
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	if len(seen) != 2 || seen["images/a.jpg"] != int64(len("images/a.jpg")) || seen["images/a/w400.jpg"] == 0 {
+		t.Fatalf("Walk(images/) saw %v", seen)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = s.Walk(ctx, "", func(ObjectInfo) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("Walk did not stop at the first error: %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+
+	"lucys-beauty-parlour-backend/blobstore"
+	"lucys-beauty-parlour-backend/database"
+	"lucys-beauty-parlour-backend/maintenance"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
+)
+
+const usage = `usage:
+  lucys-beauty-parlour-backend                  start the API server
+  lucys-beauty-parlour-backend migrate up       apply all pending migrations
+  lucys-beauty-parlour-backend migrate down [N] revert the last N migrations (default 1)
+  lucys-beauty-parlour-backend migrate status   list migrations and whether they are applied
+  lucys-beauty-parlour-backend images migrate-inline [-dry-run] [-batch N]
+                                                move inline data-URI portfolio images to blob storage
+  lucys-beauty-parlour-backend images gc [-dry-run] [-grace 24h]
+                                                delete stored images no item references
+  lucys-beauty-parlour-backend import menu-items|services [-dry-run] FILE.csv
+                                                create or update menu items or services from CSV`
+
+// runCommand executes a CLI subcommand instead of starting the server.
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "images":
+		return runImages(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate action\n%s", usage)
+	}
+
+	db, err := database.OpenFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx, db)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := database.MigrateDown(ctx, db, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+		return nil
+	case "status":
+		states, err := database.MigrationStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, st := range states {
+			status, at := "pending", ""
+			if st.Applied {
+				status = "applied"
+				at = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", st.Version, st.Name, status, at)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%s", args[0], usage)
+	}
+}
+
+func runImages(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing images action\n%s", usage)
+	}
+	switch args[0] {
+	case "migrate-inline":
+		return runImagesMigrateInline(args[1:])
+	case "gc":
+		return runImagesGC(args[1:])
+	default:
+		return fmt.Errorf("unknown images action %q\n%s", args[0], usage)
+	}
+}
+
+// openImageStore connects to the database and opens the configured image store.
+func openImageStore() (*sql.DB, *utils.ImageStore, blobstore.BlobStore, error) {
+	db, err := database.OpenFromEnv()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	blobs, err := blobstore.NewFromEnv()
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, fmt.Errorf("failed to open blob storage: %w", err)
+	}
+	imageCfg, err := utils.ImageConfigFromEnv()
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	return db, utils.NewImageStore(blobs, imageCfg), blobs, nil
+}
+
+func runImagesMigrateInline(args []string) error {
+	fs := flag.NewFlagSet("images migrate-inline", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be migrated without writing anything")
+	batch := fs.Int("batch", 50, "rows to read per query")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	db, images, _, err := openImageStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Stop between rows on Ctrl-C; rerunning picks up where this left off.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rep, err := maintenance.MigrateInlineImages(ctx, db, images, maintenance.InlineImageOptions{
+		DryRun:    *dryRun,
+		BatchSize: *batch,
+		Out:       os.Stdout,
+	})
+	prefix := ""
+	if *dryRun {
+		prefix = "dry run: "
+	}
+	fmt.Printf("%s%d row(s) scanned, %d updated, %d skipped; %d image(s) moved, %d left inline; %d bytes reclaimed\n",
+		prefix, rep.RowsScanned, rep.RowsUpdated, rep.RowsSkipped, rep.ImagesMigrated, rep.ImagesFailed, rep.BytesReclaimed())
+	return err
+}
+
+func runImagesGC(args []string) error {
+	fs := flag.NewFlagSet("images gc", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list orphaned images without deleting them")
+	grace := fs.Duration("grace", maintenance.DefaultOrphanGrace, "keep orphans modified more recently than this")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	db, images, blobs, err := openImageStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	uploads, err := blobstore.NewLocal("./uploads", "/uploads")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rep, err := maintenance.SweepOrphans(ctx, db, images, blobs, maintenance.OrphanOptions{
+		DryRun:  *dryRun,
+		Grace:   *grace,
+		Uploads: uploads,
+		Out:     os.Stdout,
+	})
+	prefix := ""
+	if *dryRun {
+		prefix = "dry run: "
+	}
+	fmt.Printf("%s%d file(s) scanned, %d orphan(s) past the grace period, %d within it; %d deleted, %d bytes freed\n",
+		prefix, rep.FilesScanned, len(rep.Orphans), rep.InGrace, rep.Deleted, rep.BytesFreed)
+	return err
+}
+
+func runImport(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing import kind\n%s", usage)
+	}
+	var importFn func(context.Context, storage.Store, io.Reader, maintenance.ImportOptions) (maintenance.ImportReport, error)
+	switch args[0] {
+	case "menu-items":
+		importFn = maintenance.ImportMenuItems
+	case "services":
+		importFn = maintenance.ImportServiceItems
+	default:
+		return fmt.Errorf("unknown import kind %q\n%s", args[0], usage)
+	}
+	fs := flag.NewFlagSet("import "+args[0], flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "check every row and report what would change without writing anything")
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one CSV file\n%s", usage)
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	currency, err := money.DefaultCurrencyFromEnv()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.OpenFromEnv()
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	defer db.Close()
+
+	rep, err := importFn(context.Background(), storage.NewPostgresStore(db), f, maintenance.ImportOptions{
+		DryRun:   *dryRun,
+		Currency: currency,
+	})
+	if err != nil {
+		return err
+	}
+	for _, e := range rep.Errors {
+		column := ""
+		if e.Column != "" {
+			column = " (" + e.Column + ")"
+		}
+		fmt.Printf("line %d%s: %s\n", e.Line, column, e.Error)
+	}
+	prefix := ""
+	if *dryRun {
+		prefix = "dry run: "
+	}
+	if len(rep.Errors) > 0 {
+		return fmt.Errorf("%s%d row(s) read, %d problem(s) found; nothing was imported", prefix, rep.Rows, len(rep.Errors))
+	}
+	fmt.Printf("%s%d row(s) read; %d created, %d updated\n", prefix, rep.Rows, rep.Created, rep.Updated)
+	return nil
+}
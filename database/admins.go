@@ -0,0 +1,51 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func ValidateAdminCredentials(db *sql.DB, email, password string) (bool, error) {
+	var hash string
+	err := db.QueryRow(`SELECT password_hash FROM admins WHERE email = $1`, strings.TrimSpace(email)).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
+
+func AdminExists(db *sql.DB, email string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM admins WHERE email = $1)`, strings.TrimSpace(email)).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func UpdateAdminPassword(db *sql.DB, email, newPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(`UPDATE admins SET password_hash = $1, updated_at = NOW() WHERE email = $2`, string(hash), strings.TrimSpace(email))
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
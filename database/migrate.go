@@ -1,235 +1,272 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"embed"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
-
-	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
-type seedService struct {
-	ID           int64
-	Service      string
-	Name         string
-	Descriptions []string
-	Rating       float64
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the advisory lock held while migrations run so
+// that two instances starting at once don't apply the same migration twice.
+const migrationLockKey int64 = 4_207_310_526
+
+// Migration is a numbered schema change loaded from database/migrations.
+// Files are named NNNN_description.up.sql and NNNN_description.down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
 }
 
-var defaultServices = []seedService{
-	{ID: 1, Service: "hair", Name: "Knotless Braids", Descriptions: []string{"Small", "Medium", "Large"}, Rating: 0},
-	{ID: 2, Service: "hair", Name: "Wig Install", Descriptions: []string{"Closure", "Frontal"}, Rating: 0},
-	{ID: 3, Service: "nails", Name: "Stick ons with Gel", Descriptions: []string{"Day", "Evening"}, Rating: 0},
-	{ID: 4, Service: "nails", Name: "Gel Builder on Natural Nails", Descriptions: []string{"Bride", "Bridesmaid"}, Rating: 0},
-	{ID: 5, Service: "nails", Name: "Gel Manicure", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 6, Service: "nails", Name: "Nail Clipping", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 7, Service: "hair", Name: "Senegalese Twists", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 8, Service: "hair", Name: "Soft Locs", Descriptions: []string{"Shoulder Length", "Mid-back", "Waist Length"}, Rating: 0},
-	{ID: 9, Service: "hair", Name: "Butterfly Locs", Descriptions: []string{"Shoulder Length", "Mid-back", "Waist Length"}, Rating: 0},
-	{ID: 10, Service: "hair", Name: "French Curls", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 11, Service: "hair", Name: "Cornrows (All Back)", Descriptions: []string{"4 Lines", "6 Lines", "8+ Lines"}, Rating: 0},
-	{ID: 12, Service: "hair", Name: "Stitch Cornrows", Descriptions: []string{"4 Lines", "6 Lines", "8+ Lines"}, Rating: 0},
-	{ID: 13, Service: "hair", Name: "Fulani Cornrows", Descriptions: []string{"Classic", "With Beads"}, Rating: 0},
-	{ID: 14, Service: "hair", Name: "Passion Twists", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 15, Service: "hair", Name: "Kinky Twists", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 16, Service: "hair", Name: "Hermaid Braids", Descriptions: []string{"Small", "Medium", "Large"}, Rating: 0},
-	{ID: 17, Service: "hair", Name: "Italy Curls", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 18, Service: "hair", Name: "Jayda Wayda", Descriptions: []string{"Short", "Medium", "Long"}, Rating: 0},
-	{ID: 19, Service: "hair", Name: "Gypsy Locs", Descriptions: []string{}, Rating: 0},
-	{ID: 20, Service: "hair", Name: "Sew-ins", Descriptions: []string{}, Rating: 0},
-	{ID: 21, Service: "hair", Name: "Fulani Passion Twists", Descriptions: []string{}, Rating: 0},
-	{ID: 22, Service: "makeup", Name: "Eyebrow Trimming", Descriptions: []string{}, Rating: 0},
-	{ID: 23, Service: "nails", Name: "Gel Builder(Tips)", Descriptions: []string{}, Rating: 0},
-	{ID: 24, Service: "nails", Name: "Refill Builder", Descriptions: []string{}, Rating: 0},
-	{ID: 25, Service: "nails", Name: "3D Glass", Descriptions: []string{}, Rating: 0},
-	{ID: 26, Service: "nails", Name: "Gel on Toes", Descriptions: []string{}, Rating: 0},
-	{ID: 27, Service: "nails", Name: "Builder on Natural Toes", Descriptions: []string{}, Rating: 0},
-	{ID: 28, Service: "nails", Name: "Foot Scrub", Descriptions: []string{}, Rating: 0},
-	{ID: 29, Service: "nails", Name: "Gel Soak Off", Descriptions: []string{}, Rating: 0},
-	{ID: 30, Service: "nails", Name: "Builder Soak Off", Descriptions: []string{}, Rating: 0},
+// MigrationState reports whether a migration has been applied.
+type MigrationState struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
 }
 
-func Migrate(db *sql.DB) error {
-	stmts := []string{
-		`CREATE TABLE IF NOT EXISTS admins (
-			id BIGSERIAL PRIMARY KEY,
-			email TEXT NOT NULL UNIQUE,
-			password_hash TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);`,
-		`CREATE TABLE IF NOT EXISTS service_items (
-			id BIGINT PRIMARY KEY,
-			service TEXT NOT NULL,
-			name TEXT NOT NULL,
-			descriptions JSONB NOT NULL DEFAULT '[]'::jsonb,
-			rating DOUBLE PRECISION NOT NULL DEFAULT 0
-		);`,
-		`CREATE TABLE IF NOT EXISTS portfolio_items (
-			id BIGSERIAL PRIMARY KEY,
-			category TEXT NOT NULL,
-			style TEXT NOT NULL,
-			images JSONB NOT NULL DEFAULT '[]'::jsonb,
-			description TEXT NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		);`,
-		`CREATE TABLE IF NOT EXISTS menu_items (
-			id BIGSERIAL PRIMARY KEY,
-			category TEXT NOT NULL,
-			name TEXT NOT NULL,
-			currency TEXT,
-			price_cents BIGINT NOT NULL,
-			duration_minutes INT NOT NULL
-		);`,
-		`CREATE TABLE IF NOT EXISTS appointments (
-			id BIGSERIAL PRIMARY KEY,
-			customer_name TEXT NOT NULL,
-			customer_email TEXT NOT NULL,
-			customer_phone TEXT NOT NULL,
-			staff_name TEXT,
-			appointment_date DATE NOT NULL,
-			appointment_time TIME NOT NULL,
-			service_id BIGINT NOT NULL REFERENCES service_items(id) ON DELETE RESTRICT,
-			service_description TEXT NOT NULL,
-			currency TEXT,
-			price_cents BIGINT NOT NULL DEFAULT 0,
-			notes TEXT,
-			status TEXT NOT NULL DEFAULT 'pending'
-		);`,
-		`CREATE INDEX IF NOT EXISTS idx_appointments_date_status ON appointments(appointment_date, status);`,
-		`CREATE INDEX IF NOT EXISTS idx_service_items_service ON service_items(service);`,
-		`CREATE INDEX IF NOT EXISTS idx_portfolio_items_category ON portfolio_items(category);`,
-		`CREATE INDEX IF NOT EXISTS idx_menu_items_category ON menu_items(category);`,
-	}
-
-	for _, stmt := range stmts {
-		if _, err := db.Exec(stmt); err != nil {
-			return err
-		}
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
 	}
 
-	// Migrate portfolio_items schema if it exists with old structure
-	// Check if 'title' column exists and rename it to 'style'
-	var columnExists bool
-	err := db.QueryRow(`
-		SELECT EXISTS (
-			SELECT 1 
-			FROM information_schema.columns 
-			WHERE table_name = 'portfolio_items' 
-			AND column_name = 'title'
-		);
-	`).Scan(&columnExists)
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		file := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", file)
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join("migrations", file))
+		if err != nil {
+			return nil, err
+		}
 
-	if err == nil && columnExists {
-		// Rename title to style
-		if _, err := db.Exec(`ALTER TABLE portfolio_items RENAME COLUMN title TO style;`); err != nil {
-			return err
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
 		}
-		// Make description NOT NULL if it isn't already
-		if _, err := db.Exec(`ALTER TABLE portfolio_items ALTER COLUMN description SET NOT NULL;`); err != nil {
-			// Ignore error if it's already NOT NULL
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
 		}
 	}
 
-	return nil
-}
-
-func Seed(db *sql.DB) error {
-	if err := seedAdmin(db); err != nil {
-		return err
-	}
-	if err := seedServices(db); err != nil {
-		return err
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up script", m.Version, m.Name)
+		}
+		out = append(out, *m)
 	}
-	return nil
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
 }
 
-func seedAdmin(db *sql.DB) error {
-	email := strings.TrimSpace(os.Getenv("ADMIN_EMAIL"))
-	password := os.Getenv("ADMIN_PASSWORD")
-	if email == "" || password == "" {
-		return fmt.Errorf("ADMIN_EMAIL and ADMIN_PASSWORD are required for admin seeding")
-	}
+// Migrate applies all pending migrations. It is run on every server start.
+func Migrate(db *sql.DB) error {
+	_, err := MigrateUp(context.Background(), db)
+	return err
+}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+// MigrateUp applies every pending migration in order and returns the ones applied.
+func MigrateUp(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	migrations, err := loadMigrations()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = db.Exec(`
-		INSERT INTO admins (email, password_hash)
-		VALUES ($1, $2)
-		ON CONFLICT (email)
-		DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = NOW();
-	`, email, string(hash))
-	return err
-}
-
-func seedServices(db *sql.DB) error {
-	for _, s := range defaultServices {
-		descriptionsJSON, err := json.Marshal(s.Descriptions)
+	applied := make([]Migration, 0)
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
 		if err != nil {
 			return err
 		}
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, m.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
 
-		_, err = db.Exec(`
-			INSERT INTO service_items (id, service, name, descriptions, rating)
-			VALUES ($1, $2, $3, $4::jsonb, $5)
-			ON CONFLICT (id)
-			DO UPDATE SET
-				service = EXCLUDED.service,
-				name = EXCLUDED.name,
-				descriptions = EXCLUDED.descriptions,
-				rating = EXCLUDED.rating;
-		`, s.ID, s.Service, s.Name, string(descriptionsJSON), s.Rating)
+// MigrateDown reverts the most recently applied migrations, up to steps of them.
+func MigrateDown(ctx context.Context, db *sql.DB, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive")
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := make([]Migration, 0)
+	err = withMigrationLock(ctx, db, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
 		if err != nil {
 			return err
 		}
-	}
-	return nil
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if strings.TrimSpace(m.Down) == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+			}
+			if err := runMigration(ctx, conn, m.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
 }
 
-func ValidateAdminCredentials(db *sql.DB, email, password string) (bool, error) {
-	var hash string
-	err := db.QueryRow(`SELECT password_hash FROM admins WHERE email = $1`, strings.TrimSpace(email)).Scan(&hash)
-	if err == sql.ErrNoRows {
-		return false, nil
+// MigrationStatus lists every known migration and whether it has been applied.
+func MigrationStatus(ctx context.Context, db *sql.DB) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
 	}
+
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
-		return false, nil
+	defer conn.Close()
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return nil, err
 	}
-	return true, nil
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		st := MigrationState{Version: m.Version, Name: m.Name}
+		if at, ok := done[m.Version]; ok {
+			st.Applied = true
+			appliedAt := at
+			st.AppliedAt = &appliedAt
+		}
+		out = append(out, st)
+	}
+	return out, nil
 }
 
-func AdminExists(db *sql.DB, email string) (bool, error) {
-	var exists bool
-	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM admins WHERE email = $1)`, strings.TrimSpace(email)).Scan(&exists)
+// withMigrationLock runs fn on a single connection holding a session-level
+// advisory lock, creating the schema_migrations table first if needed.
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		return false, err
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
 	}
-	return exists, nil
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+	`)
+	return err
 }
 
-func UpdateAdminPassword(db *sql.DB, email, newPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	res, err := db.Exec(`UPDATE admins SET password_hash = $1, updated_at = NOW() WHERE email = $2`, string(hash), strings.TrimSpace(email))
+	defer rows.Close()
+
+	out := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		out[version] = at
+	}
+	return out, rows.Err()
+}
+
+// runMigration executes script and the bookkeeping in record inside one transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, script string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	affected, err := res.RowsAffected()
-	if err != nil {
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
 		return err
 	}
-	if affected == 0 {
-		return sql.ErrNoRows
+	if err := record(tx); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS appointments;
+DROP TABLE IF EXISTS menu_items;
+DROP TABLE IF EXISTS portfolio_items;
+DROP TABLE IF EXISTS service_items;
+DROP TABLE IF EXISTS admins;
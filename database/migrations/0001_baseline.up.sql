@@ -0,0 +1,73 @@
+CREATE TABLE IF NOT EXISTS admins (
+	id BIGSERIAL PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS service_items (
+	id BIGINT PRIMARY KEY,
+	service TEXT NOT NULL,
+	name TEXT NOT NULL,
+	descriptions JSONB NOT NULL DEFAULT '[]'::jsonb,
+	rating DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS portfolio_items (
+	id BIGSERIAL PRIMARY KEY,
+	category TEXT NOT NULL,
+	style TEXT NOT NULL,
+	images JSONB NOT NULL DEFAULT '[]'::jsonb,
+	description TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS menu_items (
+	id BIGSERIAL PRIMARY KEY,
+	category TEXT NOT NULL,
+	name TEXT NOT NULL,
+	currency TEXT,
+	price_cents BIGINT NOT NULL,
+	duration_minutes INT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS appointments (
+	id BIGSERIAL PRIMARY KEY,
+	customer_name TEXT NOT NULL,
+	customer_email TEXT NOT NULL,
+	customer_phone TEXT NOT NULL,
+	staff_name TEXT,
+	appointment_date DATE NOT NULL,
+	appointment_time TIME NOT NULL,
+	service_id BIGINT NOT NULL REFERENCES service_items(id) ON DELETE RESTRICT,
+	service_description TEXT NOT NULL,
+	currency TEXT,
+	price_cents BIGINT NOT NULL DEFAULT 0,
+	notes TEXT,
+	status TEXT NOT NULL DEFAULT 'pending'
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointments_date_status ON appointments(appointment_date, status);
+CREATE INDEX IF NOT EXISTS idx_service_items_service ON service_items(service);
+CREATE INDEX IF NOT EXISTS idx_portfolio_items_category ON portfolio_items(category);
+CREATE INDEX IF NOT EXISTS idx_menu_items_category ON menu_items(category);
+
+-- Databases created before portfolio items had a style used a title column instead.
+DO $$
+BEGIN
+	IF EXISTS (
+		SELECT 1
+		FROM information_schema.columns
+		WHERE table_name = 'portfolio_items'
+		AND column_name = 'title'
+	) THEN
+		ALTER TABLE portfolio_items RENAME COLUMN title TO style;
+		BEGIN
+			ALTER TABLE portfolio_items ALTER COLUMN description SET NOT NULL;
+		EXCEPTION WHEN not_null_violation THEN
+			-- Leave the column nullable if legacy rows have no description.
+			NULL;
+		END;
+	END IF;
+END $$;
@@ -0,0 +1,13 @@
+-- Rows still in the trash would reappear as live records, so purge them first.
+-- Deleted services that live bookings still reference have to stay.
+DELETE FROM appointments WHERE deleted_at IS NOT NULL;
+DELETE FROM portfolio_items WHERE deleted_at IS NOT NULL;
+DELETE FROM menu_items WHERE deleted_at IS NOT NULL;
+DELETE FROM service_items s
+WHERE s.deleted_at IS NOT NULL
+AND NOT EXISTS (SELECT 1 FROM appointments a WHERE a.service_id = s.id);
+
+ALTER TABLE appointments DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE service_items DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE menu_items DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1 @@
+ALTER TABLE service_items DROP COLUMN IF EXISTS image;
@@ -0,0 +1 @@
+ALTER TABLE service_items ADD COLUMN IF NOT EXISTS image TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_portfolio_items_gallery_order;
+DROP INDEX IF EXISTS idx_portfolio_items_service_item_id;
+DROP INDEX IF EXISTS idx_portfolio_items_tags;
+
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS sort_order;
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS featured;
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS tags;
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS service_item_id;
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS before_after;
+ALTER TABLE portfolio_items DROP COLUMN IF EXISTS captions;
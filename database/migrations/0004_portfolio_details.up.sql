@@ -0,0 +1,11 @@
+ALTER TABLE portfolio_items ADD COLUMN IF NOT EXISTS captions JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE portfolio_items ADD COLUMN IF NOT EXISTS before_after JSONB NOT NULL DEFAULT '[]'::jsonb;
+-- Purging a service from the trash unlinks the looks it produced.
+ALTER TABLE portfolio_items ADD COLUMN IF NOT EXISTS service_item_id BIGINT REFERENCES service_items(id) ON DELETE SET NULL;
+ALTER TABLE portfolio_items ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE portfolio_items ADD COLUMN IF NOT EXISTS featured BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE portfolio_items ADD COLUMN IF NOT EXISTS sort_order INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_portfolio_items_tags ON portfolio_items USING GIN (tags);
+CREATE INDEX IF NOT EXISTS idx_portfolio_items_service_item_id ON portfolio_items(service_item_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_items_gallery_order ON portfolio_items(featured DESC, sort_order, created_at DESC, id DESC) WHERE deleted_at IS NULL;
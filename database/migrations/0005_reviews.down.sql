@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_service_items_rating;
+ALTER TABLE service_items DROP COLUMN IF EXISTS review_count;
+
+DROP TABLE IF EXISTS reviews;
+DROP TABLE IF EXISTS review_invites;
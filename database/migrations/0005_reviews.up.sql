@@ -0,0 +1,28 @@
+-- One-time review links. Only a hash of the token is stored.
+CREATE TABLE IF NOT EXISTS review_invites (
+	token_hash TEXT PRIMARY KEY,
+	appointment_id BIGINT NOT NULL UNIQUE REFERENCES appointments(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS reviews (
+	id BIGSERIAL PRIMARY KEY,
+	-- Reviews outlive their appointment being purged from the trash.
+	appointment_id BIGINT UNIQUE REFERENCES appointments(id) ON DELETE SET NULL,
+	service_id BIGINT NOT NULL REFERENCES service_items(id) ON DELETE CASCADE,
+	author TEXT NOT NULL,
+	rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+	comment TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_service_status ON reviews(service_id, status);
+CREATE INDEX IF NOT EXISTS idx_reviews_status_created_at ON reviews(status, created_at DESC);
+
+-- Ratings are now computed from approved reviews; admin-entered values go.
+ALTER TABLE service_items ADD COLUMN IF NOT EXISTS review_count INTEGER NOT NULL DEFAULT 0;
+UPDATE service_items SET rating = 0;
+CREATE INDEX IF NOT EXISTS idx_service_items_rating ON service_items(rating);
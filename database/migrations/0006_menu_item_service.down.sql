@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_menu_items_service_variant_name;
+DROP INDEX IF EXISTS idx_menu_items_service_item_id;
+ALTER TABLE menu_items DROP COLUMN IF EXISTS service_item_id;
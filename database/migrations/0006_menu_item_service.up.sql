@@ -0,0 +1,9 @@
+-- Menu items linked to a service are its priced variants; they go with it
+-- when the service is purged from the trash.
+ALTER TABLE menu_items ADD COLUMN IF NOT EXISTS service_item_id BIGINT REFERENCES service_items(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_menu_items_service_item_id ON menu_items(service_item_id);
+-- A service cannot list two live variants with the same name.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_menu_items_service_variant_name
+	ON menu_items(service_item_id, LOWER(name))
+	WHERE service_item_id IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE menu_items DROP CONSTRAINT IF EXISTS menu_items_category_fkey;
+ALTER TABLE portfolio_items DROP CONSTRAINT IF EXISTS portfolio_items_category_fkey;
+ALTER TABLE service_items DROP CONSTRAINT IF EXISTS service_items_service_fkey;
+
+DROP TABLE IF EXISTS categories;
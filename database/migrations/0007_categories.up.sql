@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS categories (
+	slug TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	icon TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO categories (slug, name, sort_order) VALUES
+	('hair', 'Hair', 1),
+	('makeup', 'Makeup', 2),
+	('nails', 'Nails', 3)
+ON CONFLICT (slug) DO NOTHING;
+
+-- Menu categories were free text. Fold every category into a slug and
+-- create the ones that are missing, so existing rows satisfy the foreign keys.
+UPDATE service_items SET service = COALESCE(NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(service), '[^a-z0-9]+', '-', 'g')), ''), 'other');
+UPDATE portfolio_items SET category = COALESCE(NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(category), '[^a-z0-9]+', '-', 'g')), ''), 'other');
+UPDATE menu_items SET category = COALESCE(NULLIF(TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(category), '[^a-z0-9]+', '-', 'g')), ''), 'other');
+
+INSERT INTO categories (slug, name, sort_order)
+SELECT slug, INITCAP(REPLACE(slug, '-', ' ')), 100
+FROM (
+	SELECT service AS slug FROM service_items
+	UNION SELECT category FROM portfolio_items
+	UNION SELECT category FROM menu_items
+) used
+ON CONFLICT (slug) DO NOTHING;
+
+-- Renaming a category renames it everywhere; one in use cannot be deleted.
+ALTER TABLE service_items ADD CONSTRAINT service_items_service_fkey
+	FOREIGN KEY (service) REFERENCES categories(slug) ON UPDATE CASCADE;
+ALTER TABLE portfolio_items ADD CONSTRAINT portfolio_items_category_fkey
+	FOREIGN KEY (category) REFERENCES categories(slug) ON UPDATE CASCADE;
+ALTER TABLE menu_items ADD CONSTRAINT menu_items_category_fkey
+	FOREIGN KEY (category) REFERENCES categories(slug) ON UPDATE CASCADE;
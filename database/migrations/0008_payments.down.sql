@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payments;
+
+ALTER TABLE appointments DROP COLUMN IF EXISTS deposit_cents;
+ALTER TABLE service_items DROP COLUMN IF EXISTS deposit_percent;
@@ -0,0 +1,23 @@
+-- Share of a service's price paid up front to secure a booking.
+ALTER TABLE service_items ADD COLUMN IF NOT EXISTS deposit_percent SMALLINT NOT NULL DEFAULT 0
+	CHECK (deposit_percent BETWEEN 0 AND 100);
+
+-- Deposit due on a booking, fixed when it is made.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS deposit_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS payments (
+	id BIGSERIAL PRIMARY KEY,
+	appointment_id BIGINT NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	provider_ref TEXT NOT NULL,
+	amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+	currency TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+	failure_reason TEXT NOT NULL DEFAULT '',
+	checkout_url TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (provider, provider_ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_appointment ON payments(appointment_id);
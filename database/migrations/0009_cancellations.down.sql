@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS refunds;
+
+ALTER TABLE appointments
+	DROP COLUMN IF EXISTS cancel_token_hash,
+	DROP COLUMN IF EXISTS cancelled_at,
+	DROP COLUMN IF EXISTS cancellation_fee_cents,
+	DROP COLUMN IF EXISTS cancellation_reason,
+	DROP COLUMN IF EXISTS cancelled_by;
@@ -0,0 +1,23 @@
+-- How a booking was cancelled, and what the cancellation policy kept.
+ALTER TABLE appointments
+	ADD COLUMN IF NOT EXISTS cancelled_by TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS cancellation_reason TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS cancellation_fee_cents BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ,
+	-- Hash of the link a customer cancels their own booking with.
+	ADD COLUMN IF NOT EXISTS cancel_token_hash TEXT UNIQUE;
+
+-- Money owed back to customers, paid out by the salon.
+CREATE TABLE IF NOT EXISTS refunds (
+	id BIGSERIAL PRIMARY KEY,
+	appointment_id BIGINT NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+	payment_id BIGINT NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+	amount_cents BIGINT NOT NULL CHECK (amount_cents > 0),
+	currency TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	paid_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_appointment ON refunds(appointment_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_status_created_at ON refunds(status, created_at DESC);
@@ -0,0 +1,17 @@
+-- Numbered invoices for completed appointments. Each records the amounts
+-- as they were when it was issued, so a receipt reads the same every time
+-- it is downloaded.
+CREATE TABLE IF NOT EXISTS invoices (
+	id BIGSERIAL PRIMARY KEY,
+	number TEXT NOT NULL UNIQUE,
+	appointment_id BIGINT NOT NULL UNIQUE REFERENCES appointments(id) ON DELETE CASCADE,
+	customer_name TEXT NOT NULL,
+	customer_email TEXT NOT NULL,
+	service_name TEXT NOT NULL DEFAULT '',
+	service_description TEXT NOT NULL DEFAULT '',
+	appointment_date DATE NOT NULL,
+	currency TEXT NOT NULL DEFAULT '',
+	total_cents BIGINT NOT NULL,
+	deposit_paid_cents BIGINT NOT NULL DEFAULT 0,
+	issued_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,19 @@
+ALTER TABLE appointments
+	DROP CONSTRAINT IF EXISTS appointments_currency_iso,
+	ALTER COLUMN currency DROP NOT NULL;
+ALTER TABLE menu_items
+	DROP CONSTRAINT IF EXISTS menu_items_currency_iso,
+	ALTER COLUMN currency DROP NOT NULL;
+
+UPDATE invoices SET
+	total_cents = total_cents / 100,
+	deposit_paid_cents = deposit_paid_cents / 100
+WHERE UPPER(currency) IN ('KES', 'TZS');
+UPDATE refunds SET amount_cents = amount_cents / 100 WHERE UPPER(currency) IN ('KES', 'TZS');
+UPDATE payments SET amount_cents = amount_cents / 100 WHERE UPPER(currency) IN ('KES', 'TZS');
+UPDATE appointments SET
+	price_cents = price_cents / 100,
+	deposit_cents = deposit_cents / 100,
+	cancellation_fee_cents = cancellation_fee_cents / 100
+WHERE currency IN ('KES', 'TZS');
+UPDATE menu_items SET price_cents = price_cents / 100 WHERE currency IN ('KES', 'TZS');
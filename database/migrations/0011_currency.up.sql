@@ -0,0 +1,26 @@
+-- Every menu item and booking has an ISO 4217 currency. Bookings made
+-- before currencies were recorded were in the historic default, UGX.
+UPDATE menu_items SET currency = COALESCE(NULLIF(UPPER(TRIM(currency)), ''), 'UGX');
+UPDATE appointments SET currency = COALESCE(NULLIF(UPPER(TRIM(currency)), ''), 'UGX');
+
+-- KES and TZS amounts were stored in whole shillings. ISO 4217 gives both
+-- two decimals, so they are now kept in cents like every other currency.
+UPDATE menu_items SET price_cents = price_cents * 100 WHERE currency IN ('KES', 'TZS');
+UPDATE appointments SET
+	price_cents = price_cents * 100,
+	deposit_cents = deposit_cents * 100,
+	cancellation_fee_cents = cancellation_fee_cents * 100
+WHERE currency IN ('KES', 'TZS');
+UPDATE payments SET amount_cents = amount_cents * 100 WHERE UPPER(currency) IN ('KES', 'TZS');
+UPDATE refunds SET amount_cents = amount_cents * 100 WHERE UPPER(currency) IN ('KES', 'TZS');
+UPDATE invoices SET
+	total_cents = total_cents * 100,
+	deposit_paid_cents = deposit_paid_cents * 100
+WHERE UPPER(currency) IN ('KES', 'TZS');
+
+ALTER TABLE menu_items
+	ALTER COLUMN currency SET NOT NULL,
+	ADD CONSTRAINT menu_items_currency_iso CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE appointments
+	ALTER COLUMN currency SET NOT NULL,
+	ADD CONSTRAINT appointments_currency_iso CHECK (currency ~ '^[A-Z]{3}$');
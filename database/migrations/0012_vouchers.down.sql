@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_appointments_voucher;
+
+ALTER TABLE appointments
+	DROP COLUMN IF EXISTS discount_cents,
+	DROP COLUMN IF EXISTS promo_code,
+	DROP COLUMN IF EXISTS voucher_id;
+
+DROP TABLE IF EXISTS vouchers;
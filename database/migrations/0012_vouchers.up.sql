@@ -0,0 +1,25 @@
+-- Gift vouchers and promo codes. A fixed voucher takes value minor units of
+-- its currency off a booking, a percent voucher value percent.
+CREATE TABLE IF NOT EXISTS vouchers (
+	id BIGSERIAL PRIMARY KEY,
+	code TEXT NOT NULL UNIQUE CHECK (code = UPPER(code)),
+	kind TEXT NOT NULL CHECK (kind IN ('fixed', 'percent')),
+	value BIGINT NOT NULL CHECK (value > 0),
+	currency TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMPTZ,
+	-- 0 means no limit.
+	max_uses INTEGER NOT NULL DEFAULT 0 CHECK (max_uses >= 0),
+	uses INTEGER NOT NULL DEFAULT 0,
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	CHECK (kind = 'fixed' AND currency <> '' OR kind = 'percent' AND value <= 100)
+);
+
+-- The voucher a booking redeemed, and what it took off the price.
+ALTER TABLE appointments
+	ADD COLUMN IF NOT EXISTS voucher_id BIGINT REFERENCES vouchers(id),
+	ADD COLUMN IF NOT EXISTS promo_code TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_appointments_voucher ON appointments(voucher_id) WHERE voucher_id IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE appointments DROP COLUMN IF EXISTS points_redeemed;
+
+DROP TABLE IF EXISTS loyalty_entries;
+DROP TABLE IF EXISTS loyalty_settings;
@@ -0,0 +1,29 @@
+-- How customers earn and redeem loyalty points. There is a single row; a
+-- rate of 0 turns earning or redeeming off.
+CREATE TABLE IF NOT EXISTS loyalty_settings (
+	id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+	currency TEXT NOT NULL DEFAULT 'UGX' CHECK (currency ~ '^[A-Z]{3}$'),
+	-- Minor units of a completed booking's price that earn one point.
+	spend_per_point BIGINT NOT NULL DEFAULT 0 CHECK (spend_per_point >= 0),
+	-- Minor units one point takes off a booking.
+	point_value_cents BIGINT NOT NULL DEFAULT 0 CHECK (point_value_cents >= 0)
+);
+
+INSERT INTO loyalty_settings (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
+
+-- Every change to a customer's points. Customers are known by their
+-- lower-case email, and a balance is the sum of their entries.
+CREATE TABLE IF NOT EXISTS loyalty_entries (
+	id BIGSERIAL PRIMARY KEY,
+	customer_email TEXT NOT NULL CHECK (customer_email = LOWER(customer_email)),
+	appointment_id BIGINT REFERENCES appointments(id) ON DELETE SET NULL,
+	kind TEXT NOT NULL CHECK (kind IN ('earned', 'redeemed')),
+	points BIGINT NOT NULL CHECK (points <> 0),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_entries_customer ON loyalty_entries(customer_email, id DESC);
+-- A booking earns points once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_entries_earned ON loyalty_entries(appointment_id) WHERE kind = 'earned';
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS points_redeemed BIGINT NOT NULL DEFAULT 0;
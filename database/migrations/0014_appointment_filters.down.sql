@@ -0,0 +1,9 @@
+-- pg_trgm is left installed; other objects may have come to use it.
+DROP INDEX IF EXISTS idx_appointments_customer_phone_digits_trgm;
+DROP INDEX IF EXISTS idx_appointments_customer_phone_trgm;
+DROP INDEX IF EXISTS idx_appointments_customer_email_trgm;
+DROP INDEX IF EXISTS idx_appointments_customer_name_trgm;
+DROP INDEX IF EXISTS idx_appointments_date_time;
+DROP INDEX IF EXISTS idx_appointments_staff_date;
+DROP INDEX IF EXISTS idx_appointments_service_date;
+DROP INDEX IF EXISTS idx_appointments_status_date;
@@ -0,0 +1,24 @@
+-- Indexes for the admin appointment list's filters. Trashed appointments
+-- are never listed, so they are left out.
+CREATE INDEX IF NOT EXISTS idx_appointments_status_date
+	ON appointments(status, appointment_date) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_service_date
+	ON appointments(service_id, appointment_date) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_staff_date
+	ON appointments(LOWER(staff_name), appointment_date) WHERE deleted_at IS NULL;
+-- Sorting by date and time pages through this index.
+CREATE INDEX IF NOT EXISTS idx_appointments_date_time
+	ON appointments(appointment_date, appointment_time, id) WHERE deleted_at IS NULL;
+
+-- Customer search matches any part of a name, email or phone number, which
+-- only trigram indexes can serve. pg_trgm is a trusted extension, so the
+-- database owner can create it.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS idx_appointments_customer_name_trgm
+	ON appointments USING GIN (LOWER(customer_name) gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_customer_email_trgm
+	ON appointments USING GIN (LOWER(customer_email) gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_customer_phone_trgm
+	ON appointments USING GIN (LOWER(customer_phone) gin_trgm_ops) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_appointments_customer_phone_digits_trgm
+	ON appointments USING GIN (REGEXP_REPLACE(customer_phone, '[^0-9]', '', 'g') gin_trgm_ops) WHERE deleted_at IS NULL;
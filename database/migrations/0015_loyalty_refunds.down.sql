@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_loyalty_entries_refunded;
+
+-- Giving the points back is undone too, so balances drop by what was refunded.
+DELETE FROM loyalty_entries WHERE kind = 'refunded';
+ALTER TABLE loyalty_entries DROP CONSTRAINT IF EXISTS loyalty_entries_kind_check;
+ALTER TABLE loyalty_entries ADD CONSTRAINT loyalty_entries_kind_check
+	CHECK (kind IN ('earned', 'redeemed'));
@@ -0,0 +1,7 @@
+-- Points redeemed on a booking that is cancelled are given back with a
+-- 'refunded' entry, at most once per booking.
+ALTER TABLE loyalty_entries DROP CONSTRAINT IF EXISTS loyalty_entries_kind_check;
+ALTER TABLE loyalty_entries ADD CONSTRAINT loyalty_entries_kind_check
+	CHECK (kind IN ('earned', 'redeemed', 'refunded'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loyalty_entries_refunded ON loyalty_entries(appointment_id) WHERE kind = 'refunded';
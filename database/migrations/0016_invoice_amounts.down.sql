@@ -0,0 +1,5 @@
+ALTER TABLE invoices
+	DROP COLUMN IF EXISTS deposit_cents,
+	DROP COLUMN IF EXISTS points_redeemed,
+	DROP COLUMN IF EXISTS promo_code,
+	DROP COLUMN IF EXISTS discount_cents;
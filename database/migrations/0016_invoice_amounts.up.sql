@@ -0,0 +1,7 @@
+-- What a receipt itemises besides the total: the discount taken off the
+-- price and what it came from, and the deposit the booking asked for.
+ALTER TABLE invoices
+	ADD COLUMN IF NOT EXISTS discount_cents BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS promo_code TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS points_redeemed BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS deposit_cents BIGINT NOT NULL DEFAULT 0;
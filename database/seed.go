@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type seedService struct {
+	ID           int64
+	Service      string
+	Name         string
+	Descriptions []string
+}
+
+var defaultServices = []seedService{
+	{ID: 1, Service: "hair", Name: "Knotless Braids", Descriptions: []string{"Small", "Medium", "Large"}},
+	{ID: 2, Service: "hair", Name: "Wig Install", Descriptions: []string{"Closure", "Frontal"}},
+	{ID: 3, Service: "nails", Name: "Stick ons with Gel", Descriptions: []string{"Day", "Evening"}},
+	{ID: 4, Service: "nails", Name: "Gel Builder on Natural Nails", Descriptions: []string{"Bride", "Bridesmaid"}},
+	{ID: 5, Service: "nails", Name: "Gel Manicure", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 6, Service: "nails", Name: "Nail Clipping", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 7, Service: "hair", Name: "Senegalese Twists", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 8, Service: "hair", Name: "Soft Locs", Descriptions: []string{"Shoulder Length", "Mid-back", "Waist Length"}},
+	{ID: 9, Service: "hair", Name: "Butterfly Locs", Descriptions: []string{"Shoulder Length", "Mid-back", "Waist Length"}},
+	{ID: 10, Service: "hair", Name: "French Curls", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 11, Service: "hair", Name: "Cornrows (All Back)", Descriptions: []string{"4 Lines", "6 Lines", "8+ Lines"}},
+	{ID: 12, Service: "hair", Name: "Stitch Cornrows", Descriptions: []string{"4 Lines", "6 Lines", "8+ Lines"}},
+	{ID: 13, Service: "hair", Name: "Fulani Cornrows", Descriptions: []string{"Classic", "With Beads"}},
+	{ID: 14, Service: "hair", Name: "Passion Twists", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 15, Service: "hair", Name: "Kinky Twists", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 16, Service: "hair", Name: "Hermaid Braids", Descriptions: []string{"Small", "Medium", "Large"}},
+	{ID: 17, Service: "hair", Name: "Italy Curls", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 18, Service: "hair", Name: "Jayda Wayda", Descriptions: []string{"Short", "Medium", "Long"}},
+	{ID: 19, Service: "hair", Name: "Gypsy Locs", Descriptions: []string{}},
+	{ID: 20, Service: "hair", Name: "Sew-ins", Descriptions: []string{}},
+	{ID: 21, Service: "hair", Name: "Fulani Passion Twists", Descriptions: []string{}},
+	{ID: 22, Service: "makeup", Name: "Eyebrow Trimming", Descriptions: []string{}},
+	{ID: 23, Service: "nails", Name: "Gel Builder(Tips)", Descriptions: []string{}},
+	{ID: 24, Service: "nails", Name: "Refill Builder", Descriptions: []string{}},
+	{ID: 25, Service: "nails", Name: "3D Glass", Descriptions: []string{}},
+	{ID: 26, Service: "nails", Name: "Gel on Toes", Descriptions: []string{}},
+	{ID: 27, Service: "nails", Name: "Builder on Natural Toes", Descriptions: []string{}},
+	{ID: 28, Service: "nails", Name: "Foot Scrub", Descriptions: []string{}},
+	{ID: 29, Service: "nails", Name: "Gel Soak Off", Descriptions: []string{}},
+	{ID: 30, Service: "nails", Name: "Builder Soak Off", Descriptions: []string{}},
+}
+
+func Seed(db *sql.DB) error {
+	if err := seedAdmin(db); err != nil {
+		return err
+	}
+	if err := seedServices(db); err != nil {
+		return err
+	}
+	return nil
+}
+
+func seedAdmin(db *sql.DB) error {
+	email := strings.TrimSpace(os.Getenv("ADMIN_EMAIL"))
+	password := os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		return fmt.Errorf("ADMIN_EMAIL and ADMIN_PASSWORD are required for admin seeding")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO admins (email, password_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (email)
+		DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = NOW();
+	`, email, string(hash))
+	return err
+}
+
+func seedServices(db *sql.DB) error {
+	for _, s := range defaultServices {
+		descriptionsJSON, err := json.Marshal(s.Descriptions)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO service_items (id, service, name, descriptions)
+			VALUES ($1, $2, $3, $4::jsonb)
+			ON CONFLICT (id)
+			DO UPDATE SET
+				service = EXCLUDED.service,
+				name = EXCLUDED.name,
+				descriptions = EXCLUDED.descriptions;
+		`, s.ID, s.Service, s.Name, string(descriptionsJSON))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
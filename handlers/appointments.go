@@ -1,13 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/payments"
 	"lucys-beauty-parlour-backend/storage"
 	"lucys-beauty-parlour-backend/utils"
 
@@ -33,6 +38,16 @@ type createAppointmentRequest struct {
 	PriceCents           int64   `json:"price_cents" binding:"required"`
 	Notes                string  `json:"notes,omitempty"`
 	Status               string  `json:"status"`
+	// PaymentPhone is the mobile money number the deposit is requested
+	// from, if not the customer's phone.
+	PaymentPhone string `json:"payment_phone,omitempty"`
+	// PromoCode redeems a voucher against price_cents.
+	PromoCode string `json:"promo_code,omitempty"`
+	// RedeemPoints spends loyalty points on the booking. ManageToken, from
+	// the manage-booking link of an earlier booking, shows they are the
+	// customer's.
+	RedeemPoints int64  `json:"redeem_points,omitempty"`
+	ManageToken  string `json:"manage_token,omitempty"`
 }
 
 type updateAppointmentRequest struct {
@@ -52,6 +67,16 @@ type updateAppointmentRequest struct {
 	Status               *string  `json:"status"`
 }
 
+// firstNonNilIDs returns the first of the ID lists that was sent.
+func firstNonNilIDs(lists ...*[]int64) *[]int64 {
+	for _, l := range lists {
+		if l != nil {
+			return l
+		}
+	}
+	return nil
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
@@ -112,7 +137,28 @@ func normalizeAppointmentTime(raw string) (string, error) {
 }
 
 type AppHandlers struct {
-	Store storage.Store
+	Store  storage.Store
+	Images *utils.ImageStore
+	// Payments collects deposits; nil if no provider is configured.
+	Payments payments.Provider
+	// Cancellation is the refund policy; nil means
+	// DefaultCancellationPolicy.
+	Cancellation *CancellationPolicy
+	// Currency is the shop's currency, used when a price names none; the
+	// zero value means UGX.
+	Currency money.Currency
+}
+
+// bookingResponse is a new appointment with the deposit payment requested
+// for it, if any.
+type bookingResponse struct {
+	*models.Appointment
+	Payment *models.Payment `json:"payment,omitempty"`
+	// PaymentError says why the deposit could not be requested; the salon
+	// can request it again.
+	PaymentError string `json:"payment_error,omitempty"`
+	// CancelURL lets the customer cancel the booking themselves.
+	CancelURL string `json:"cancel_url,omitempty"`
 }
 
 func (h *AppHandlers) CreateAppointment(c *gin.Context) {
@@ -144,22 +190,31 @@ func (h *AppHandlers) CreateAppointment(c *gin.Context) {
 		Time:               clock,
 		ServiceID:          req.ServiceID,
 		ServiceDescription: req.ServiceDescription,
-		Currency:           strings.TrimSpace(req.Currency),
 		PriceCents:         req.PriceCents,
 		Notes:              req.Notes,
 		Status:             strings.TrimSpace(req.Status),
 	}
+	currency, ok := h.resolveCurrency(c, strings.TrimSpace(req.Currency))
+	if !ok {
+		return
+	}
+	appointment.Currency = currency.Code
 
 	// Validate service exists by ServiceID (foreign key)
 	if appointment.ServiceID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "service_id is required and must be positive"})
 		return
 	}
-	svc, err := h.Store.GetServiceItem(appointment.ServiceID)
-	if err != nil {
+	ctx := c.Request.Context()
+	svc, err := h.Store.GetServiceItem(ctx, appointment.ServiceID)
+	if errors.Is(err, storage.ErrNotFound) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_id: service not found"})
 		return
 	}
+	if err != nil {
+		respondStoreError(c, err, "failed to look up service")
+		return
+	}
 
 	// Validate description is provided; allow arbitrary text from frontend
 	if strings.TrimSpace(appointment.ServiceDescription) == "" {
@@ -167,28 +222,46 @@ func (h *AppHandlers) CreateAppointment(c *gin.Context) {
 		return
 	}
 
-	// Frontend provides the total price.
+	// Frontend provides the total price, in the currency of every option.
 	if appointment.PriceCents < 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "price_cents must be >= 0"})
 		return
 	}
-
-	// Check if the date has availability (max 15 confirmed appointments per day)
-	if !h.Store.IsAppointmentSlotAvailable(appointment.Date) {
-		c.JSON(http.StatusConflict, gin.H{"error": "No slots available for the requested date. Maximum appointments reached for the day."})
+	optionIDs := req.SelectedOptionIDs
+	if len(optionIDs) == 0 {
+		optionIDs = req.SelectedOptionIDsAlt
+	}
+	if !h.checkOptionCurrencies(c, currency, optionIDs) {
+		return
+	}
+	if strings.TrimSpace(req.PromoCode) != "" && !h.applyPromoCode(c, &appointment, req.PromoCode) {
+		return
+	}
+	if req.RedeemPoints != 0 && !h.applyLoyaltyPoints(c, &appointment, req.ManageToken, req.RedeemPoints) {
 		return
 	}
 
-	// Set default status to "pending" if not provided
-	if appointment.Status == "" {
+	// Set default status to "pending" if not provided. A booking that needs
+	// a deposit stays pending until the deposit is paid.
+	appointment.DepositCents = depositFor(appointment.PriceCents, svc.DepositPercent)
+	if appointment.Status == "" || appointment.DepositCents > 0 {
 		appointment.Status = "pending"
 	}
 
-	created := h.Store.CreateAppointment(&appointment)
-	if created == nil {
+	cancelToken := generateToken(32)
+	if cancelToken == "" {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create appointment"})
 		return
 	}
+	appointment.CancelTokenHash = hashToken(cancelToken)
+
+	// The store rejects the booking with ErrSlotUnavailable if the date is
+	// full (max 15 confirmed appointments per day), atomically with the insert.
+	created, err := h.Store.CreateAppointment(ctx, &appointment)
+	if err != nil {
+		respondStoreError(c, err, "failed to create appointment")
+		return
+	}
 
 	// Lookup service name for notifications
 	svcName := svc.Name
@@ -200,7 +273,15 @@ func (h *AppHandlers) CreateAppointment(c *gin.Context) {
 		}
 	}(created, svcName)
 
-	c.JSON(http.StatusCreated, created)
+	resp := bookingResponse{Appointment: created, CancelURL: utils.CancelLink(cancelToken)}
+	if created.DepositCents > 0 && h.Payments != nil {
+		phone := firstNonEmpty(req.PaymentPhone, created.CustomerPhone)
+		if resp.Payment, err = h.requestDeposit(ctx, created, phone); err != nil {
+			log.Printf("request deposit for appointment %d: %v", created.ID, err)
+			resp.PaymentError = "the deposit could not be requested; the salon will contact you"
+		}
+	}
+	c.JSON(http.StatusCreated, resp)
 }
 
 func (h *AppHandlers) ListAppointments(c *gin.Context) {
@@ -221,7 +302,25 @@ func (h *AppHandlers) ListAppointments(c *gin.Context) {
 		return
 	}
 
-	appointments, totalCount := h.Store.GetAppointmentsWithPagination(offset, limit)
+	f, ok := appointmentFilter(c)
+	if !ok {
+		return
+	}
+	sort := storage.AppointmentSort(c.DefaultQuery("sort", string(storage.AppointmentsNewest)))
+	if !slices.Contains(storage.AppointmentSorts, sort) {
+		names := make([]string, len(storage.AppointmentSorts))
+		for i, s := range storage.AppointmentSorts {
+			names[i] = string(s)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sort. Use one of: " + strings.Join(names, ", ")})
+		return
+	}
+
+	appointments, totalCount, err := h.Store.GetAppointmentsWithPagination(c.Request.Context(), f, sort, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list appointments")
+		return
+	}
 
 	// has_more should be computed from the actual returned slice length
 	hasMore := offset+len(appointments) < totalCount
@@ -235,6 +334,33 @@ func (h *AppHandlers) ListAppointments(c *gin.Context) {
 	})
 }
 
+// appointmentFilter reads the filters of an appointment list: status, from
+// and to dates, service_id, category, staff and q, a customer search. It
+// responds with 400 and returns false if they are invalid.
+func appointmentFilter(c *gin.Context) (storage.AppointmentFilter, bool) {
+	dates, ok := reportFilter(c)
+	if !ok {
+		return storage.AppointmentFilter{}, false
+	}
+	f := storage.AppointmentFilter{
+		Status:    strings.ToLower(strings.TrimSpace(c.Query("status"))),
+		From:      dates.From,
+		To:        dates.To,
+		Category:  strings.ToLower(strings.TrimSpace(c.Query("category"))),
+		StaffName: strings.TrimSpace(c.Query("staff")),
+		Query:     strings.TrimSpace(c.Query("q")),
+	}
+	if raw := c.Query("service_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_id"})
+			return f, false
+		}
+		f.ServiceID = id
+	}
+	return f, true
+}
+
 func (h *AppHandlers) GetAppointment(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -242,9 +368,10 @@ func (h *AppHandlers) GetAppointment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	a, err := h.Store.GetAppointment(id)
+	ctx := c.Request.Context()
+	a, err := h.Store.GetAppointment(ctx, id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to load appointment")
 		return
 	}
 
@@ -252,7 +379,7 @@ func (h *AppHandlers) GetAppointment(c *gin.Context) {
 	serviceName := ""
 	var serviceDetails *models.ServiceItem
 	if a.ServiceID > 0 {
-		if svc, err := h.Store.GetServiceItem(a.ServiceID); err == nil {
+		if svc, err := h.Store.GetServiceItem(ctx, a.ServiceID); err == nil {
 			serviceName = svc.Name
 			serviceDetails = svc
 		}
@@ -272,14 +399,32 @@ func (h *AppHandlers) GetAppointment(c *gin.Context) {
 		"service_description": a.ServiceDescription,
 		"currency":            a.Currency,
 		"price_cents":         a.PriceCents,
+		"deposit_cents":       a.DepositCents,
 		"notes":               a.Notes,
 		"status":              a.Status,
 	}
+	if a.DiscountCents > 0 {
+		response["promo_code"] = a.PromoCode
+		response["points_redeemed"] = a.PointsRedeemed
+		response["discount_cents"] = a.DiscountCents
+	}
+	if a.CancelledAt != "" {
+		response["cancelled_by"] = a.CancelledBy
+		response["cancellation_reason"] = a.CancellationReason
+		response["cancellation_fee_cents"] = a.CancellationFeeCents
+		response["cancelled_at"] = a.CancelledAt
+	}
 
 	// Include full service details if available
 	if serviceDetails != nil {
 		response["service_details"] = serviceDetails
 	}
+	if list, err := h.Store.ListPayments(ctx, a.ID); err == nil {
+		response["payments"] = list
+	}
+	if list, _, err := h.Store.ListRefunds(ctx, storage.RefundFilter{AppointmentID: a.ID}, 0, 100); err == nil {
+		response["refunds"] = list
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -292,9 +437,10 @@ func (h *AppHandlers) UpdateAppointment(c *gin.Context) {
 		return
 	}
 	// Merge semantics: fetch current appointment first.
-	curr, err := h.Store.GetAppointment(id)
-	if err != nil || curr == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	ctx := c.Request.Context()
+	curr, err := h.Store.GetAppointment(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
 		return
 	}
 
@@ -339,15 +485,53 @@ func (h *AppHandlers) UpdateAppointment(c *gin.Context) {
 	if req.ServiceDescription != nil {
 		merged.ServiceDescription = strings.TrimSpace(*req.ServiceDescription)
 	}
-	// Ignore selected_option_ids for now (frontend-calculated total price is what we persist).
+	// Only the currency of selected_option_ids is checked; the
+	// frontend-calculated total price is what we persist.
 	if req.Notes != nil {
 		merged.Notes = *req.Notes
 	}
 	if req.Status != nil {
 		merged.Status = strings.TrimSpace(*req.Status)
+		// Cancelling goes through the cancellation policy, which charges
+		// fees, records refunds and emails the customer. Reopening would keep
+		// the refund, the voucher use and the points it gave back.
+		if merged.Status != curr.Status {
+			if curr.Status == "cancelled" || curr.Status == "no_show" {
+				c.JSON(http.StatusConflict, gin.H{"error": "a cancelled or no-show appointment cannot be reopened; book a new appointment instead"})
+				return
+			}
+			if merged.Status == "cancelled" || merged.Status == "no_show" {
+				c.JSON(http.StatusConflict, gin.H{"error": "use PUT /admin/appointments/:id/cancel to cancel an appointment or mark it a no-show"})
+				return
+			}
+		}
 	}
 	if req.Currency != nil {
-		merged.Currency = strings.TrimSpace(*req.Currency)
+		currency, ok := h.resolveCurrency(c, strings.TrimSpace(*req.Currency))
+		if !ok {
+			return
+		}
+		merged.Currency = currency.Code
+		if merged.Currency != curr.Currency {
+			other, err := h.hasPaymentsInOtherCurrency(ctx, curr, currency)
+			if err != nil {
+				respondStoreError(c, err, "failed to load payments")
+				return
+			}
+			if other {
+				c.JSON(http.StatusConflict, gin.H{"error": "the appointment has payments in " + curr.Currency + "; its currency cannot change"})
+				return
+			}
+		}
+	}
+	if options := firstNonNilIDs(req.SelectedOptionIDs, req.SelectedOptionIDsAlt); options != nil {
+		currency, err := money.ParseCurrency(merged.Currency)
+		if err != nil {
+			currency = h.shopCurrency()
+		}
+		if !h.checkOptionCurrencies(c, currency, *options) {
+			return
+		}
 	}
 	if req.PriceCents != nil {
 		if *req.PriceCents < 0 {
@@ -359,8 +543,12 @@ func (h *AppHandlers) UpdateAppointment(c *gin.Context) {
 
 	// If service or description are present, ensure service exists; allow arbitrary description text
 	if merged.ServiceID > 0 {
-		if _, err := h.Store.GetServiceItem(merged.ServiceID); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_id: service not found"})
+		if _, err := h.Store.GetServiceItem(ctx, merged.ServiceID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_id: service not found"})
+				return
+			}
+			respondStoreError(c, err, "failed to look up service")
 			return
 		}
 	}
@@ -368,18 +556,29 @@ func (h *AppHandlers) UpdateAppointment(c *gin.Context) {
 		merged.ServiceDescription = strings.TrimSpace(merged.ServiceDescription)
 	}
 
-	updated, err := h.Store.UpdateAppointment(id, &merged)
+	updated, err := h.Store.UpdateAppointment(ctx, id, &merged)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to update appointment")
 		return
 	}
 
 	// Lookup service name for emails
 	svcName := ""
-	if svc, err := h.Store.GetServiceItem(updated.ServiceID); err == nil {
+	if svc, err := h.Store.GetServiceItem(ctx, updated.ServiceID); err == nil {
 		svcName = svc.Name
 	}
 
+	// Completing an appointment earns loyalty points and invites the
+	// customer to review it instead.
+	if updated.Status == "completed" && curr.Status != "completed" {
+		h.earnLoyaltyPoints(ctx, updated)
+		if _, _, err := h.issueReviewInvite(ctx, updated); err != nil && !errors.Is(err, storage.ErrConflict) {
+			log.Printf("issue review link for appointment %d: %v", updated.ID, err)
+		}
+		c.JSON(http.StatusOK, updated)
+		return
+	}
+
 	// Send confirmation or update email to customer asynchronously
 	go func(app *models.Appointment, serviceName string) {
 		if app.Status == "confirmed" {
@@ -396,41 +595,6 @@ func (h *AppHandlers) UpdateAppointment(c *gin.Context) {
 	c.JSON(http.StatusOK, updated)
 }
 
-func (h *AppHandlers) CancelAppointment(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
-
-	// Fetch appointment before cancelling to get contact and service information
-	appointment, err := h.Store.GetAppointment(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
-		return
-	}
-
-	updated, err := h.Store.CancelAppointment(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel appointment"})
-		return
-	}
-
-	// Send cancellation email including service name
-	go func(appt *models.Appointment) {
-		serviceName := ""
-		if svc, err := h.Store.GetServiceItem(appt.ServiceID); err == nil && svc != nil {
-			serviceName = svc.Name
-		}
-		if err := utils.SendAppointmentRejectedEmail(appt, serviceName); err != nil {
-			fmt.Println("Error sending rejection email:", err)
-		}
-	}(appointment)
-
-	c.JSON(http.StatusOK, updated)
-}
-
 func (h *AppHandlers) DeleteAppointment(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -438,8 +602,8 @@ func (h *AppHandlers) DeleteAppointment(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	if err := h.Store.DeleteAppointment(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	if err := h.Store.DeleteAppointment(c.Request.Context(), id); err != nil {
+		respondStoreError(c, err, "failed to delete appointment")
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/payments"
+	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxCancellationReasonLength = 500
+
+// CancellationPolicy decides how much of what a customer paid is refunded
+// when their booking is cancelled, from how long before the appointment it
+// happens.
+type CancellationPolicy struct {
+	// FullRefundHours or more ahead, everything paid is refunded.
+	FullRefundHours int
+	// Under ForfeitHours ahead, the deposit is kept.
+	ForfeitHours int
+	// PartialRefundPercent of what was paid is refunded in between.
+	PartialRefundPercent int
+	// NoShowFeePercent of the price is charged when the customer does not
+	// turn up; what they paid counts towards it.
+	NoShowFeePercent int
+}
+
+// DefaultCancellationPolicy is used when the CANCEL_* variables are unset.
+var DefaultCancellationPolicy = CancellationPolicy{
+	FullRefundHours:      48,
+	ForfeitHours:         24,
+	PartialRefundPercent: 50,
+	NoShowFeePercent:     50,
+}
+
+// CancellationPolicyFromEnv reads CANCEL_FULL_REFUND_HOURS,
+// CANCEL_FORFEIT_HOURS, CANCEL_PARTIAL_REFUND_PERCENT and
+// NO_SHOW_FEE_PERCENT, falling back to DefaultCancellationPolicy.
+func CancellationPolicyFromEnv() (CancellationPolicy, error) {
+	p := DefaultCancellationPolicy
+	for _, v := range []struct {
+		name string
+		dst  *int
+		max  int
+	}{
+		{"CANCEL_FULL_REFUND_HOURS", &p.FullRefundHours, math.MaxInt32},
+		{"CANCEL_FORFEIT_HOURS", &p.ForfeitHours, math.MaxInt32},
+		{"CANCEL_PARTIAL_REFUND_PERCENT", &p.PartialRefundPercent, 100},
+		{"NO_SHOW_FEE_PERCENT", &p.NoShowFeePercent, 100},
+	} {
+		raw := strings.TrimSpace(os.Getenv(v.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > v.max {
+			return p, fmt.Errorf("invalid %s %q (want 0 to %d)", v.name, raw, v.max)
+		}
+		*v.dst = n
+	}
+	if p.ForfeitHours > p.FullRefundHours {
+		return p, fmt.Errorf("CANCEL_FORFEIT_HOURS (%d) is more than CANCEL_FULL_REFUND_HOURS (%d)", p.ForfeitHours, p.FullRefundHours)
+	}
+	return p, nil
+}
+
+// cancellationOutcome is what the policy decided for one cancellation.
+type cancellationOutcome struct {
+	// Rule is full_refund, partial_refund, deposit_forfeited, no_show or
+	// fee_waived.
+	Rule        string `json:"rule"`
+	PaidCents   int64  `json:"paid_cents"`
+	RefundCents int64  `json:"refund_cents"`
+	FeeCents    int64  `json:"fee_cents"`
+	// OwedCents is the part of a no-show fee that payments do not cover.
+	OwedCents int64 `json:"owed_cents,omitempty"`
+}
+
+// apply decides the refund and fee for cancelling a, on which paidCents has
+// been paid, at now.
+func (p CancellationPolicy) apply(a *models.Appointment, paidCents int64, noShow bool, now time.Time) cancellationOutcome {
+	out := cancellationOutcome{PaidCents: paidCents}
+	if noShow {
+		out.Rule = "no_show"
+		out.FeeCents = (a.PriceCents*int64(p.NoShowFeePercent) + 99) / 100
+		out.RefundCents = max(paidCents-out.FeeCents, 0)
+		out.OwedCents = max(out.FeeCents-paidCents, 0)
+		return out
+	}
+	until := appointmentStart(a).Sub(now)
+	switch {
+	case until >= time.Duration(p.FullRefundHours)*time.Hour:
+		out.Rule, out.RefundCents = "full_refund", paidCents
+	case until >= time.Duration(p.ForfeitHours)*time.Hour:
+		out.Rule, out.RefundCents = "partial_refund", paidCents*int64(p.PartialRefundPercent)/100
+	default:
+		out.Rule = "deposit_forfeited"
+	}
+	out.FeeCents = paidCents - out.RefundCents
+	return out
+}
+
+// appointmentStart is when a begins, in the salon's local time.
+func appointmentStart(a *models.Appointment) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", a.Date+" "+a.Time, time.Local)
+	if err != nil {
+		// Stored dates are validated; treat anything else as far ahead.
+		return time.Now().AddDate(1, 0, 0)
+	}
+	return t
+}
+
+// cancellationPolicy is the configured policy, or the default.
+func (h *AppHandlers) cancellationPolicy() CancellationPolicy {
+	if h.Cancellation != nil {
+		return *h.Cancellation
+	}
+	return DefaultCancellationPolicy
+}
+
+// cancellationResponse is a cancelled appointment with the refunds owed on it.
+type cancellationResponse struct {
+	*models.Appointment
+	Outcome cancellationOutcome `json:"cancellation"`
+	Refunds []*models.Refund    `json:"refunds"`
+}
+
+// paidCents is what has been paid towards a, less anything refunded.
+func (h *AppHandlers) paidCents(ctx context.Context, a *models.Appointment) (int64, error) {
+	list, err := h.Store.ListPayments(ctx, a.ID)
+	if err != nil {
+		return 0, err
+	}
+	var paid int64
+	for _, p := range list {
+		if p.Status == payments.StatusSucceeded {
+			paid += p.AmountCents
+		}
+	}
+	refunds, _, err := h.Store.ListRefunds(ctx, storage.RefundFilter{AppointmentID: a.ID}, 0, 100)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range refunds {
+		paid -= r.AmountCents
+	}
+	return paid, nil
+}
+
+// cancelAppointment applies the cancellation policy to a, cancels it and
+// emails the customer the outcome in the background. waive refunds
+// everything paid instead.
+func (h *AppHandlers) cancelAppointment(ctx context.Context, a *models.Appointment, by, reason string, noShow, waive bool) (*cancellationResponse, error) {
+	var (
+		outcome cancellationOutcome
+		updated *models.Appointment
+		refunds []*models.Refund
+	)
+	// A payment settling meanwhile changes what is owed, so work it out again.
+	for attempt := 0; ; attempt++ {
+		paid, err := h.paidCents(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		outcome = h.cancellationPolicy().apply(a, paid, noShow, time.Now())
+		if waive {
+			outcome = cancellationOutcome{Rule: "fee_waived", PaidCents: paid, RefundCents: paid}
+		}
+		updated, refunds, err = h.Store.CancelAppointment(ctx, a.ID, models.Cancellation{
+			By:          by,
+			Reason:      reason,
+			NoShow:      noShow,
+			FeeCents:    outcome.FeeCents,
+			RefundCents: outcome.RefundCents,
+			PaidCents:   paid,
+		})
+		if errors.Is(err, storage.ErrPaymentsChanged) && attempt < 2 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	go func(appt *models.Appointment, refundCents int64) {
+		serviceName := ""
+		// The request context is done once the response is written.
+		if svc, err := h.Store.GetServiceItem(context.Background(), appt.ServiceID); err == nil && svc != nil {
+			serviceName = svc.Name
+		}
+		if err := utils.SendAppointmentRejectedEmail(appt, serviceName, refundCents); err != nil {
+			fmt.Println("Error sending cancellation email:", err)
+		}
+	}(updated, outcome.RefundCents)
+
+	return &cancellationResponse{Appointment: updated, Outcome: outcome, Refunds: refunds}, nil
+}
+
+// respondCancelError reports an appointment that can no longer be
+// cancelled, and otherwise responds like respondStoreError.
+func respondCancelError(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "only pending or confirmed appointments can be cancelled"})
+		return
+	}
+	if errors.Is(err, storage.ErrPaymentsChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a payment was being made while cancelling; please try again"})
+		return
+	}
+	respondStoreError(c, err, "failed to cancel appointment")
+}
+
+// Admin: cancel an appointment, or mark it a no-show, under the
+// cancellation policy; waive_fee refunds everything paid
+func (h *AppHandlers) CancelAppointment(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Reason   string `json:"reason"`
+		NoShow   bool   `json:"no_show"`
+		WaiveFee bool   `json:"waive_fee"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxCancellationReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reason must be at most %d characters", maxCancellationReasonLength)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	appointment, err := h.Store.GetAppointment(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return
+	}
+	resp, err := h.cancelAppointment(ctx, appointment, "admin", req.Reason, req.NoShow, req.WaiveFee)
+	if err != nil {
+		respondCancelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Public: what cancelling the booking behind a cancel link would refund,
+// with the customer's loyalty points
+func (h *AppHandlers) GetCancellationQuote(c *gin.Context) {
+	ctx := c.Request.Context()
+	a, err := h.Store.GetAppointmentByCancelToken(ctx, hashToken(c.Param("token")))
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return
+	}
+	paid, err := h.paidCents(ctx, a)
+	if err != nil {
+		respondStoreError(c, err, "failed to load payments")
+		return
+	}
+	loyalty, err := h.loyaltySummary(ctx, a.CustomerEmail)
+	if err != nil {
+		respondStoreError(c, err, "failed to load loyalty points")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"appointment_id": a.ID,
+		"date":           a.Date,
+		"time":           a.Time,
+		"status":         a.Status,
+		"currency":       a.Currency,
+		"cancellation":   h.cancellationPolicy().apply(a, paid, false, time.Now()),
+		"loyalty":        loyalty,
+	})
+}
+
+// Public: the customer cancels their booking through its cancel link
+func (h *AppHandlers) CancelAppointmentByToken(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxCancellationReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reason must be at most %d characters", maxCancellationReasonLength)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	a, err := h.Store.GetAppointmentByCancelToken(ctx, hashToken(c.Param("token")))
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return
+	}
+	if !appointmentStart(a).After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "the appointment has already started; please contact the salon"})
+		return
+	}
+	resp, err := h.cancelAppointment(ctx, a, "customer", req.Reason, false, false)
+	if err != nil {
+		respondCancelError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"appointment_id": resp.ID,
+		"status":         resp.Status,
+		"cancellation":   resp.Outcome,
+	})
+}
+
+// Admin: refunds to pay out, optionally by status or appointment
+func (h *AppHandlers) ListRefunds(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	f := storage.RefundFilter{Status: c.Query("status")}
+	if f.Status != "" && f.Status != "pending" && f.Status != "paid" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status. Use one of: pending, paid"})
+		return
+	}
+	if raw := c.Query("appointment_id"); raw != "" {
+		if f.AppointmentID, err = strconv.ParseInt(raw, 10, 64); err != nil || f.AppointmentID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid appointment_id"})
+			return
+		}
+	}
+	list, total, err := h.Store.ListRefunds(c.Request.Context(), f, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list refunds")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":     list,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+		"has_more": offset+len(list) < total,
+	})
+}
+
+// Admin: record that a refund has been paid out to the customer
+func (h *AppHandlers) MarkRefundPaid(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	r, err := h.Store.MarkRefundPaid(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "refund has already been paid"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to update refund")
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCategorySlugLength = 50
+	maxCategoryNameLength = 100
+	maxCategoryIconLength = 100
+)
+
+// categorySlugPattern allows lowercase words joined by single hyphens,
+// e.g. "lashes" or "brows-and-lashes".
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// resolveCategory normalises raw and checks it names a category. It writes
+// the error response, listing the valid slugs, and reports false if not.
+func (h *AppHandlers) resolveCategory(c *gin.Context, raw, field string) (string, bool) {
+	slug := strings.ToLower(strings.TrimSpace(raw))
+	ctx := c.Request.Context()
+	if slug != "" {
+		_, err := h.Store.GetCategory(ctx, slug)
+		if err == nil {
+			return slug, true
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			respondStoreError(c, err, "failed to look up category")
+			return "", false
+		}
+	}
+	cats, err := h.Store.ListCategories(ctx)
+	if err != nil {
+		respondStoreError(c, err, "failed to list categories")
+		return "", false
+	}
+	slugs := make([]string, len(cats))
+	for i, cat := range cats {
+		slugs[i] = cat.Slug
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + field + ". Use one of: " + strings.Join(slugs, ", ")})
+	return "", false
+}
+
+// normalizeCategoryRequest trims and validates a category from a request
+// body, returning an error message if it is invalid.
+func normalizeCategoryRequest(cat *models.Category) string {
+	cat.Slug = strings.ToLower(strings.TrimSpace(cat.Slug))
+	cat.Name = strings.TrimSpace(cat.Name)
+	cat.Icon = strings.TrimSpace(cat.Icon)
+	switch {
+	case len(cat.Slug) > maxCategorySlugLength || !categorySlugPattern.MatchString(cat.Slug):
+		return "slug must be lowercase letters and digits separated by single hyphens, at most 50 characters"
+	case cat.Name == "" || len(cat.Name) > maxCategoryNameLength:
+		return "name must be 1 to 100 characters"
+	case len(cat.Icon) > maxCategoryIconLength:
+		return "icon must be at most 100 characters"
+	}
+	return ""
+}
+
+// Public: list categories in display order
+func (h *AppHandlers) ListCategories(c *gin.Context) {
+	cats, err := h.Store.ListCategories(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "failed to list categories")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": cats})
+}
+
+// Admin: create
+func (h *AppHandlers) CreateCategory(c *gin.Context) {
+	var req models.Category
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := normalizeCategoryRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	created, err := h.Store.CreateCategory(c.Request.Context(), &req)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "category slug already exists"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to create category")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// Admin: update; changing the slug moves every item in the category
+func (h *AppHandlers) UpdateCategory(c *gin.Context) {
+	var req models.Category
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := normalizeCategoryRequest(&req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	upd, err := h.Store.UpdateCategory(c.Request.Context(), c.Param("slug"), &req)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "category slug already exists"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to update category")
+		return
+	}
+	c.JSON(http.StatusOK, upd)
+}
+
+// Admin: delete; only categories with no items, including trashed ones
+func (h *AppHandlers) DeleteCategory(c *gin.Context) {
+	err := h.Store.DeleteCategory(c.Request.Context(), c.Param("slug"))
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "category still has services, portfolio or menu items"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to delete category")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shopCurrency is the configured shop currency, or UGX.
+func (h *AppHandlers) shopCurrency() money.Currency {
+	if h.Currency.Code != "" {
+		return h.Currency
+	}
+	return money.Currency{Code: "UGX", MinorUnits: 0}
+}
+
+// resolveCurrency maps a requested ISO 4217 code onto its canonical form,
+// defaulting to the shop currency when empty. It responds with 400 and
+// returns ok=false for an unknown code.
+func (h *AppHandlers) resolveCurrency(c *gin.Context, raw string) (money.Currency, bool) {
+	if raw == "" {
+		return h.shopCurrency(), true
+	}
+	cur, err := money.ParseCurrency(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid currency %q: use an ISO 4217 code such as %s", raw, h.shopCurrency())})
+		return money.Currency{}, false
+	}
+	return cur, true
+}
+
+// checkOptionCurrencies checks that the menu items chosen for a booking can
+// be added up in its currency cur. It responds with 400 and returns false if
+// an option is missing or priced in another currency, so a booking never
+// mixes them.
+func (h *AppHandlers) checkOptionCurrencies(c *gin.Context, cur money.Currency, ids []int64) bool {
+	total := money.Money{Currency: cur}
+	for _, id := range ids {
+		it, err := h.Store.GetMenuItem(c.Request.Context(), id)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid selected option %d: menu item not found", id)})
+			return false
+		}
+		if err != nil {
+			respondStoreError(c, err, "failed to look up selected option")
+			return false
+		}
+		price, err := money.New(it.PriceCents, it.Currency)
+		if err == nil {
+			total, err = total.Add(price)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("selected option %q is priced in %s, but the booking is in %s", it.Name, it.Currency, cur)})
+			return false
+		}
+	}
+	return true
+}
+
+// hasPaymentsInOtherCurrency reports whether a has payments that are not
+// failed in a currency other than cur.
+func (h *AppHandlers) hasPaymentsInOtherCurrency(ctx context.Context, a *models.Appointment, cur money.Currency) (bool, error) {
+	list, err := h.Store.ListPayments(ctx, a.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range list {
+		if p.Status != "failed" && p.Currency != cur.Code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statusClientClosedRequest is the non-standard status recorded when the
+// client disconnects before the store finishes (nginx uses the same code).
+const statusClientClosedRequest = 499
+
+// respondStoreError maps a storage error onto the matching HTTP response.
+// failureMsg is returned to the client for unexpected failures, which are logged.
+func respondStoreError(c *gin.Context, err error, failureMsg string) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	case errors.Is(err, storage.ErrSlotUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "No slots available for the requested date. Maximum appointments reached for the day."})
+	case errors.Is(err, storage.ErrVoucherUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "the promo code has expired or been used up"})
+	case errors.Is(err, storage.ErrInsufficientPoints):
+		c.JSON(http.StatusConflict, gin.H{"error": "not enough loyalty points"})
+	case errors.Is(err, storage.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "conflicts with existing data"})
+	case errors.Is(err, context.Canceled):
+		c.AbortWithStatus(statusClientClosedRequest)
+	default:
+		log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failureMsg})
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startExport starts streaming an export named name (e.g. "appointments")
+// in the requested ?format=csv|xlsx, default csv. It responds with 400 and
+// returns false for an unknown format. Once rows are written the status is
+// sent, so later failures can only be logged.
+func startExport(c *gin.Context, name string) (utils.TableWriter, bool) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	var (
+		w           utils.TableWriter
+		contentType string
+		err         error
+	)
+	switch format {
+	case "csv":
+		w, contentType = utils.NewCSVWriter(c.Writer), "text/csv; charset=utf-8"
+	case "xlsx":
+		w, err = utils.NewXLSXWriter(c.Writer, name)
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format. Use one of: csv, xlsx"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start export"})
+		return nil, false
+	}
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("2006-01-02"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+	return w, true
+}
+
+// finishExport closes w, logging err or a failure to close it; the response
+// has already started, so neither can be reported to the client.
+func finishExport(name string, w utils.TableWriter, err error) {
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("export %s: %v", name, err)
+	}
+}
+
+// amount is minor in the currency with code, or the bare number if the code
+// is unknown.
+func amount(minor int64, code string) any {
+	m, err := money.New(minor, code)
+	if err != nil {
+		return minor
+	}
+	return m
+}
+
+// serviceNames looks up and caches the names of the services appointments
+// are for.
+type serviceNames struct {
+	store storage.Store
+	names map[int64]string
+}
+
+func (s *serviceNames) name(ctx context.Context, id int64) (string, error) {
+	if name, ok := s.names[id]; ok {
+		return name, nil
+	}
+	svc, err := s.store.GetServiceItem(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		// The service may have been deleted since.
+		s.names[id] = ""
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	s.names[id] = svc.Name
+	return svc.Name, nil
+}
+
+// Admin: export appointments, with the same filters as the appointment list
+func (h *AppHandlers) ExportAppointments(c *gin.Context) {
+	f, ok := appointmentFilter(c)
+	if !ok {
+		return
+	}
+	w, ok := startExport(c, "appointments")
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	services := &serviceNames{store: h.Store, names: map[int64]string{}}
+	err := w.WriteRow("ID", "Date", "Time", "Customer", "Email", "Phone", "Service", "Description", "Staff",
+		"Status", "Currency", "Price", "Discount", "Deposit", "Cancellation fee", "Promo code", "Points redeemed", "Cancelled at")
+	if err == nil {
+		err = h.Store.EachAppointment(ctx, f, func(a *models.Appointment) error {
+			service, err := services.name(ctx, a.ServiceID)
+			if err != nil {
+				return err
+			}
+			return w.WriteRow(a.ID, a.Date, a.Time, a.CustomerName, a.CustomerEmail, a.CustomerPhone, service,
+				a.ServiceDescription, a.StaffName, a.Status, a.Currency,
+				amount(a.PriceCents, a.Currency), amount(a.DiscountCents, a.Currency),
+				amount(a.DepositCents, a.Currency), amount(a.CancellationFeeCents, a.Currency),
+				a.PromoCode, a.PointsRedeemed, a.CancelledAt)
+		})
+	}
+	finishExport("appointments", w, err)
+}
+
+// Admin: export everyone who booked between ?from=&to=, with what they spent
+// in each currency
+func (h *AppHandlers) ExportCustomers(c *gin.Context) {
+	f, ok := reportFilter(c)
+	if !ok {
+		return
+	}
+	w, ok := startExport(c, "customers")
+	if !ok {
+		return
+	}
+	err := w.WriteRow("Email", "Name", "Phone", "Bookings", "Completed", "Cancelled", "No-shows",
+		"First visit", "Last visit", "Spent", "Loyalty points")
+	if err == nil {
+		err = h.Store.EachCustomer(c.Request.Context(), f, func(cu *models.Customer) error {
+			return w.WriteRow(cu.Email, cu.Name, cu.Phone, cu.Bookings, cu.Completed, cu.Cancelled, cu.NoShows,
+				cu.FirstVisit, cu.LastVisit, formatSpent(cu.SpentCents), cu.LoyaltyPoints)
+		})
+	}
+	finishExport("customers", w, err)
+}
+
+// formatSpent lists amounts per currency, e.g. "UGX 150,000; USD 25.00", as
+// they can't be added up.
+func formatSpent(spent map[string]int64) string {
+	codes := make([]string, 0, len(spent))
+	for code := range spent {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		if m, err := money.New(spent[code], code); err == nil {
+			parts[i] = m.String()
+		} else {
+			parts[i] = fmt.Sprintf("%s %d", code, spent[code])
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Admin: export revenue per ?period=day|week|month (default month) between
+// ?from=&to=, a row per currency
+func (h *AppHandlers) ExportRevenue(c *gin.Context) {
+	by := storage.ReportGrouping(c.DefaultQuery("period", "month"))
+	switch by {
+	case storage.ReportByDay, storage.ReportByWeek, storage.ReportByMonth:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid period. Use one of: day, week, month"})
+		return
+	}
+	f, ok := reportFilter(c)
+	if !ok {
+		return
+	}
+	rows, err := h.Store.ReportAppointments(c.Request.Context(), f, by)
+	if err != nil {
+		respondStoreError(c, err, "failed to compute report")
+		return
+	}
+	w, ok := startExport(c, "revenue")
+	if !ok {
+		return
+	}
+	err = w.WriteRow("Period", "Currency", "Bookings", "Completed", "Cancelled", "No-shows", "Revenue", "Fees")
+	for _, r := range rows {
+		if err != nil {
+			break
+		}
+		err = w.WriteRow(r.Label, r.Currency, r.Bookings, r.Completed, r.Cancelled, r.NoShows,
+			amount(r.RevenueCents, r.Currency), amount(r.FeesCents, r.Currency))
+	}
+	finishExport("revenue", w, err)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"lucys-beauty-parlour-backend/blobstore"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Public: serve a stored image, optionally resized (?w=) and converted (?format=jpeg)
+func (h *AppHandlers) GetImage(c *gin.Context) {
+	hash := c.Param("hash")
+	if !utils.IsImageHash(hash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	width := 0
+	if v := c.Query("w"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid w"})
+			return
+		}
+		width = h.Images.Config().SnapWidth(n)
+	}
+	format, ok := utils.NormalizeImageFormat(c.Query("format"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format. Use jpeg"})
+		return
+	}
+
+	// Content-addressed renditions never change, so caches can keep them forever.
+	etag := `"` + hash + "-" + strconv.Itoa(width) + "-" + format + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	rc, contentType, err := h.Images.Open(c.Request.Context(), hash, width, format)
+	if errors.Is(err, blobstore.ErrNotExist) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("GET /images/%s: %v", hash, err)
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load image"})
+		return
+	}
+	defer rc.Close()
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, rc)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lucys-beauty-parlour-backend/maintenance"
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportBytes bounds an import file; a full price list is a few
+// kilobytes.
+const maxImportBytes = 2 << 20
+
+// importFunc is maintenance.ImportMenuItems or maintenance.ImportServiceItems.
+type importFunc func(ctx context.Context, store storage.Store, r io.Reader, opts maintenance.ImportOptions) (maintenance.ImportReport, error)
+
+// runImport imports the CSV file sent as the "file" field of a multipart
+// form, or as the whole body, and responds with the import report.
+// ?dry_run=true only validates it.
+func (h *AppHandlers) runImport(c *gin.Context, what string, fn importFunc) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dry_run"})
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var file io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			respondImportError(c, what, err)
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			respondImportError(c, what, err)
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	rep, err := fn(c.Request.Context(), h.Store, file, maintenance.ImportOptions{DryRun: dryRun, Currency: h.shopCurrency()})
+	if err != nil {
+		respondImportError(c, what, err)
+		return
+	}
+	if len(rep.Errors) > 0 && !dryRun {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  fmt.Sprintf("%d problem(s) found; nothing was imported", len(rep.Errors)),
+			"report": rep,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, rep)
+}
+
+func respondImportError(c *gin.Context, what string, err error) {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytes):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file too large", "max_bytes": maxImportBytes})
+	case errors.Is(err, http.ErrMissingFile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing file field"})
+	case errors.Is(err, maintenance.ErrInvalidImportFile):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrConflict):
+		// The file was checked against items someone has changed since.
+		c.JSON(http.StatusConflict, gin.H{"error": what + " changed during the import; nothing was imported, try again"})
+	default:
+		respondStoreError(c, err, "failed to import "+what)
+	}
+}
+
+// Admin: create or update menu items from a CSV file (?dry_run=true to check it)
+func (h *AppHandlers) ImportMenuItems(c *gin.Context) {
+	h.runImport(c, "menu items", maintenance.ImportMenuItems)
+}
+
+// Admin: create or update services from a CSV file (?dry_run=true to check it)
+func (h *AppHandlers) ImportServiceItems(c *gin.Context) {
+	h.runImport(c, "services", maintenance.ImportServiceItems)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loyaltyPointsFor is what completing a earns under ls: a point for every
+// SpendPerPoint of its price, if it is in the loyalty currency.
+func loyaltyPointsFor(ls *models.LoyaltySettings, a *models.Appointment) int64 {
+	if ls.SpendPerPoint <= 0 || a.Currency != ls.Currency || a.PriceCents <= 0 {
+		return 0
+	}
+	return a.PriceCents / ls.SpendPerPoint
+}
+
+// earnLoyaltyPoints credits the customer of a completed appointment with the
+// points it earns. Failures are logged; the appointment is already updated.
+func (h *AppHandlers) earnLoyaltyPoints(ctx context.Context, a *models.Appointment) {
+	ls, err := h.Store.GetLoyaltySettings(ctx)
+	if err != nil {
+		log.Printf("load loyalty settings: %v", err)
+		return
+	}
+	points := loyaltyPointsFor(ls, a)
+	if points == 0 {
+		return
+	}
+	if _, err := h.Store.EarnLoyaltyPoints(ctx, a.ID, points); err != nil {
+		log.Printf("earn loyalty points for appointment %d: %v", a.ID, err)
+	}
+}
+
+// loyaltySummary is a customer's points balance and what it is worth.
+func (h *AppHandlers) loyaltySummary(ctx context.Context, email string) (gin.H, error) {
+	ls, err := h.Store.GetLoyaltySettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	points, err := h.Store.LoyaltyBalance(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"points":      points,
+		"currency":    ls.Currency,
+		"worth_cents": max(points, 0) * ls.PointValueCents,
+	}, nil
+}
+
+// applyLoyaltyPoints spends points of the customer's balance on a, taking
+// their value off a.PriceCents. manageToken, from the manage-booking link of
+// one of the customer's bookings, shows the points are theirs. It responds
+// with 400 and returns false if the points can't be redeemed; the store
+// spends them when a is created.
+func (h *AppHandlers) applyLoyaltyPoints(c *gin.Context, a *models.Appointment, manageToken string, points int64) bool {
+	if points < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "redeem_points must be >= 0"})
+		return false
+	}
+	ctx := c.Request.Context()
+	ls, err := h.Store.GetLoyaltySettings(ctx)
+	if err != nil {
+		respondStoreError(c, err, "failed to load loyalty settings")
+		return false
+	}
+	if ls.PointValueCents <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "loyalty points can't be redeemed at the moment"})
+		return false
+	}
+	if a.Currency != ls.Currency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "loyalty points can only be redeemed on bookings in " + ls.Currency})
+		return false
+	}
+
+	manageToken = strings.TrimSpace(manageToken)
+	if manageToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "manage_token is required to redeem points"})
+		return false
+	}
+	owner, err := h.Store.GetAppointmentByCancelToken(ctx, hashToken(manageToken))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid manage_token"})
+		return false
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return false
+	}
+	if !strings.EqualFold(strings.TrimSpace(owner.CustomerEmail), strings.TrimSpace(a.CustomerEmail)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "manage_token is for another customer's booking"})
+		return false
+	}
+
+	balance, err := h.Store.LoyaltyBalance(ctx, a.CustomerEmail)
+	if err != nil {
+		respondStoreError(c, err, "failed to load loyalty points")
+		return false
+	}
+	if points > balance {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("you have %d points", max(balance, 0))})
+		return false
+	}
+	value := points * ls.PointValueCents
+	if value > a.PriceCents {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d points can be redeemed on this booking", a.PriceCents/ls.PointValueCents)})
+		return false
+	}
+	a.PointsRedeemed = points
+	a.DiscountCents += value
+	a.PriceCents -= value
+	return true
+}
+
+// Admin: the loyalty earning and redemption rates
+func (h *AppHandlers) GetLoyaltySettings(c *gin.Context) {
+	ls, err := h.Store.GetLoyaltySettings(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "failed to load loyalty settings")
+		return
+	}
+	c.JSON(http.StatusOK, ls)
+}
+
+// Admin: change the loyalty rates; a rate of 0 turns earning or redeeming off
+func (h *AppHandlers) UpdateLoyaltySettings(c *gin.Context) {
+	var req models.LoyaltySettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currency, ok := h.resolveCurrency(c, strings.TrimSpace(req.Currency))
+	if !ok {
+		return
+	}
+	req.Currency = currency.Code
+	if req.SpendPerPoint < 0 || req.PointValueCents < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "spend_per_point and point_value_cents must be >= 0"})
+		return
+	}
+	upd, err := h.Store.UpdateLoyaltySettings(c.Request.Context(), &req)
+	if err != nil {
+		respondStoreError(c, err, "failed to update loyalty settings")
+		return
+	}
+	c.JSON(http.StatusOK, upd)
+}
+
+// Admin: a customer's points balance and history, newest first
+func (h *AppHandlers) GetCustomerLoyalty(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	ctx := c.Request.Context()
+	email := strings.ToLower(strings.TrimSpace(c.Param("email")))
+	summary, err := h.loyaltySummary(ctx, email)
+	if err != nil {
+		respondStoreError(c, err, "failed to load loyalty points")
+		return
+	}
+	list, total, err := h.Store.ListLoyaltyEntries(ctx, email, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list loyalty points")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"customer_email": email,
+		"balance":        summary,
+		"data":           list,
+		"total":          total,
+		"offset":         offset,
+		"limit":          limit,
+		"has_more":       offset+len(list) < total,
+	})
+}
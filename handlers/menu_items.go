@@ -1,26 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
-func normalizeMenuCategory(s string) string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return ""
-	}
-	return s
-}
-
 type createMenuItemRequest struct {
-	Category        string `json:"category" binding:"required"`
+	Category        string `json:"category"` // defaults to the service's category for variants
 	Name            string `json:"name" binding:"required"`
+	ServiceItemID   *int64 `json:"service_item_id"`
 	Currency        string `json:"currency"`
 	PriceCents      int64  `json:"price_cents" binding:"required"`
 	DurationMinutes int    `json:"duration_minutes" binding:"required"`
@@ -29,15 +24,36 @@ type createMenuItemRequest struct {
 type updateMenuItemRequest struct {
 	Category        *string `json:"category"`
 	Name            *string `json:"name"`
+	ServiceItemID   *int64  `json:"service_item_id"` // 0 unlinks the item from its service
 	Currency        *string `json:"currency"`
 	PriceCents      *int64  `json:"price_cents"`
 	DurationMinutes *int    `json:"duration_minutes"`
 }
 
+// menuItemService looks up the service a menu item is a variant of. It
+// writes the error response and returns false if the service does not exist.
+func (h *AppHandlers) menuItemService(c *gin.Context, id int64) (*models.ServiceItem, bool) {
+	svc, err := h.Store.GetServiceItem(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_item_id: service not found"})
+		return nil, false
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to look up service")
+		return nil, false
+	}
+	return svc, true
+}
+
 // Public: list menu items
 func (h *AppHandlers) ListMenuItems(c *gin.Context) {
 	category := c.Query("category")
-	category = normalizeMenuCategory(category)
+	if strings.TrimSpace(category) != "" {
+		var ok bool
+		if category, ok = h.resolveCategory(c, category, "category"); !ok {
+			return
+		}
+	}
 
 	q := strings.TrimSpace(c.Query("q"))
 
@@ -60,7 +76,11 @@ func (h *AppHandlers) ListMenuItems(c *gin.Context) {
 		}
 	}
 
-	items, total := h.Store.ListMenuItems(category, q, offset, limit)
+	items, total, err := h.Store.ListMenuItems(c.Request.Context(), category, q, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list menu items")
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"data":     items,
 		"total":    total,
@@ -78,9 +98,9 @@ func (h *AppHandlers) GetMenuItem(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
-	it, err := h.Store.GetMenuItem(id)
+	it, err := h.Store.GetMenuItem(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to load menu item")
 		return
 	}
 	c.JSON(http.StatusOK, it)
@@ -94,11 +114,24 @@ func (h *AppHandlers) CreateMenuItem(c *gin.Context) {
 		return
 	}
 
-	category := normalizeMenuCategory(req.Category)
+	category := strings.TrimSpace(req.Category)
+	if req.ServiceItemID != nil {
+		svc, ok := h.menuItemService(c, *req.ServiceItemID)
+		if !ok {
+			return
+		}
+		if category == "" {
+			category = svc.Service
+		}
+	}
 	if category == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "category is required"})
 		return
 	}
+	category, ok := h.resolveCategory(c, category, "category")
+	if !ok {
+		return
+	}
 
 	name := strings.TrimSpace(req.Name)
 	if name == "" {
@@ -116,17 +149,23 @@ func (h *AppHandlers) CreateMenuItem(c *gin.Context) {
 		return
 	}
 
+	currency, ok := h.resolveCurrency(c, strings.TrimSpace(req.Currency))
+	if !ok {
+		return
+	}
+
 	item := &models.MenuItem{
 		Category:        category,
 		Name:            name,
-		Currency:        strings.TrimSpace(req.Currency),
+		ServiceItemID:   req.ServiceItemID,
+		Currency:        currency.Code,
 		PriceCents:      req.PriceCents,
 		DurationMinutes: req.DurationMinutes,
 	}
 
-	created := h.Store.CreateMenuItem(item)
-	if created == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create menu item"})
+	created, err := h.Store.CreateMenuItem(c.Request.Context(), item)
+	if err != nil {
+		respondStoreError(c, err, "failed to create menu item")
 		return
 	}
 	c.JSON(http.StatusCreated, created)
@@ -141,9 +180,10 @@ func (h *AppHandlers) UpdateMenuItem(c *gin.Context) {
 		return
 	}
 
-	curr, err := h.Store.GetMenuItem(id)
-	if err != nil || curr == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	ctx := c.Request.Context()
+	curr, err := h.Store.GetMenuItem(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load menu item")
 		return
 	}
 
@@ -155,9 +195,8 @@ func (h *AppHandlers) UpdateMenuItem(c *gin.Context) {
 
 	merged := *curr
 	if req.Category != nil {
-		merged.Category = normalizeMenuCategory(*req.Category)
-		if merged.Category == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "category must be non-empty"})
+		var ok bool
+		if merged.Category, ok = h.resolveCategory(c, *req.Category, "category"); !ok {
 			return
 		}
 	}
@@ -168,8 +207,22 @@ func (h *AppHandlers) UpdateMenuItem(c *gin.Context) {
 			return
 		}
 	}
+	if req.ServiceItemID != nil {
+		if *req.ServiceItemID == 0 {
+			merged.ServiceItemID = nil
+		} else {
+			if _, ok := h.menuItemService(c, *req.ServiceItemID); !ok {
+				return
+			}
+			merged.ServiceItemID = req.ServiceItemID
+		}
+	}
 	if req.Currency != nil {
-		merged.Currency = strings.TrimSpace(*req.Currency)
+		currency, ok := h.resolveCurrency(c, strings.TrimSpace(*req.Currency))
+		if !ok {
+			return
+		}
+		merged.Currency = currency.Code
 	}
 	if req.PriceCents != nil {
 		if *req.PriceCents < 0 {
@@ -186,9 +239,9 @@ func (h *AppHandlers) UpdateMenuItem(c *gin.Context) {
 		merged.DurationMinutes = *req.DurationMinutes
 	}
 
-	upd, err := h.Store.UpdateMenuItem(id, &merged)
+	upd, err := h.Store.UpdateMenuItem(ctx, id, &merged)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to update menu item")
 		return
 	}
 	c.JSON(http.StatusOK, upd)
@@ -203,8 +256,8 @@ func (h *AppHandlers) DeleteMenuItem(c *gin.Context) {
 		return
 	}
 
-	if err := h.Store.DeleteMenuItem(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	if err := h.Store.DeleteMenuItem(c.Request.Context(), id); err != nil {
+		respondStoreError(c, err, "failed to delete menu item")
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/payments"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBody bounds the payment webhooks read into memory.
+const maxWebhookBody = 1 << 20
+
+var (
+	// errDepositPaid is returned when nothing is left to pay on a deposit.
+	errDepositPaid = errors.New("deposit already paid")
+	// errPaymentProvider wraps failures of the payment provider itself.
+	errPaymentProvider = errors.New("payment provider failed")
+)
+
+// depositFor is the deposit due on price at percent, rounded up.
+func depositFor(priceCents int64, percent int) int64 {
+	if priceCents <= 0 || percent <= 0 {
+		return 0
+	}
+	return (priceCents*int64(percent) + 99) / 100
+}
+
+// paymentCurrency is the currency a booking is paid in: its own, or the
+// shop's for bookings made before every booking had one.
+func (h *AppHandlers) paymentCurrency(a *models.Appointment) string {
+	if c, err := money.ParseCurrency(a.Currency); err == nil {
+		return c.Code
+	}
+	return h.shopCurrency().Code
+}
+
+// requestDeposit asks the customer, through the configured provider, for
+// what is still owed on the appointment's deposit. Payments still pending
+// count as owed, so a customer who ignored a prompt can be asked again.
+func (h *AppHandlers) requestDeposit(ctx context.Context, a *models.Appointment, phone string) (*models.Payment, error) {
+	existing, err := h.Store.ListPayments(ctx, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	due := a.DepositCents
+	for _, p := range existing {
+		if p.Status == payments.StatusSucceeded {
+			due -= p.AmountCents
+		}
+	}
+	if due <= 0 {
+		return nil, errDepositPaid
+	}
+
+	currency := h.paymentCurrency(a)
+	ref := generateToken(12)
+	if ref == "" {
+		return nil, errors.New("generate payment reference")
+	}
+	charge, err := h.Payments.RequestPayment(ctx, payments.Request{
+		Reference:   fmt.Sprintf("appt-%d-%s", a.ID, ref),
+		AmountCents: due,
+		Currency:    currency,
+		Phone:       phone,
+		Email:       a.CustomerEmail,
+		Name:        a.CustomerName,
+		Description: fmt.Sprintf("Deposit for booking #%d on %s", a.ID, a.Date),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errPaymentProvider, err)
+	}
+	return h.Store.CreatePayment(ctx, &models.Payment{
+		AppointmentID: a.ID,
+		Provider:      h.Payments.Name(),
+		ProviderRef:   charge.ProviderRef,
+		AmountCents:   due,
+		Currency:      currency,
+		CheckoutURL:   charge.CheckoutURL,
+	})
+}
+
+// Admin: payments towards an appointment
+func (h *AppHandlers) ListAppointmentPayments(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx := c.Request.Context()
+	if _, err := h.Store.GetAppointment(ctx, id); err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return
+	}
+	list, err := h.Store.ListPayments(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to list payments")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// Admin: ask the customer again for the rest of the deposit, optionally on
+// another phone
+func (h *AppHandlers) RequestAppointmentDeposit(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if h.Payments == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no payment provider is configured"})
+		return
+	}
+	ctx := c.Request.Context()
+	a, err := h.Store.GetAppointment(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return
+	}
+	if a.Status != "pending" && a.Status != "confirmed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "appointment is " + a.Status})
+		return
+	}
+	p, err := h.requestDeposit(ctx, a, firstNonEmpty(req.Phone, a.CustomerPhone))
+	if errors.Is(err, errDepositPaid) {
+		c.JSON(http.StatusConflict, gin.H{"error": "no deposit is owed on this appointment"})
+		return
+	}
+	if err != nil {
+		respondPaymentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, p)
+}
+
+// respondPaymentError reports a provider that failed to take a payment
+// request, and otherwise responds like respondStoreError.
+func respondPaymentError(c *gin.Context, err error) {
+	if errors.Is(err, errPaymentProvider) {
+		log.Printf("request payment: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "payment provider did not accept the request"})
+		return
+	}
+	respondStoreError(c, err, "failed to record payment")
+}
+
+// Public: payment outcomes from the provider. The provider's own check
+// (signature, or a signed callback URL) authenticates the request.
+func (h *AppHandlers) PaymentWebhook(c *gin.Context) {
+	if h.Payments == nil || c.Param("provider") != h.Payments.Name() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown payment provider"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		return
+	}
+	ctx := c.Request.Context()
+	ev, err := h.Payments.ParseWebhook(ctx, c.Request, body)
+	if errors.Is(err, payments.ErrInvalidSignature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signature"})
+		return
+	}
+	if err != nil {
+		log.Printf("payment webhook: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook"})
+		return
+	}
+
+	provider := h.Payments.Name()
+	p, err := h.Store.GetPaymentByRef(ctx, provider, ev.ProviderRef)
+	if err != nil {
+		respondStoreError(c, err, "failed to load payment")
+		return
+	}
+	if ev.Status == payments.StatusPending {
+		c.JSON(http.StatusOK, gin.H{"status": p.Status})
+		return
+	}
+	status, reason := ev.Status, ev.Reason
+	if status == payments.StatusSucceeded && ev.AmountCents != 0 &&
+		(ev.AmountCents != p.AmountCents || !strings.EqualFold(ev.Currency, p.Currency)) {
+		status, reason = payments.StatusFailed, fmt.Sprintf("paid %d %s, expected %d %s", ev.AmountCents, ev.Currency, p.AmountCents, p.Currency)
+	}
+	settled, confirmed, err := h.Store.SettlePayment(ctx, provider, ev.ProviderRef, status, reason)
+	if err != nil {
+		respondStoreError(c, err, "failed to settle payment")
+		return
+	}
+
+	if confirmed {
+		// The request context is done once the response is written.
+		go func(appointmentID int64) {
+			bg := context.Background()
+			appt, err := h.Store.GetAppointment(bg, appointmentID)
+			if err != nil {
+				log.Printf("load confirmed appointment %d: %v", appointmentID, err)
+				return
+			}
+			serviceName := ""
+			if svc, err := h.Store.GetServiceItem(bg, appt.ServiceID); err == nil {
+				serviceName = svc.Name
+			}
+			if err := utils.SendAppointmentConfirmedEmail(appt, serviceName); err != nil {
+				fmt.Println("Error sending confirmation email:", err)
+			}
+		}(settled.AppointmentID)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": settled.Status, "appointment_confirmed": confirmed})
+}
@@ -1,27 +1,94 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/storage"
 	"lucys-beauty-parlour-backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Allowed portfolio categories: hair | makeup | nails
-func normalizeCategory(s string) string {
-	switch s {
-	case "hair", "makeup", "nails":
-		return s
-	default:
-		return ""
+const (
+	maxImagesPerPortfolio = 10
+	maxCaptionLength      = 200
+	maxTagsPerPortfolio   = 20
+	maxTagLength          = 40
+)
+
+// normalizeTag lower-cases and trims a tag so filters match regardless of case.
+func normalizeTag(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// normalizePortfolioDetails cleans up tags and captions and checks that
+// captions and before/after pairs fit the item's images. It returns a
+// message describing the first problem, or "" if the item is valid.
+func normalizePortfolioDetails(it *models.PortfolioItem) string {
+	if len(it.Captions) > len(it.Images) {
+		return "more captions than images"
 	}
+	for i, caption := range it.Captions {
+		it.Captions[i] = strings.TrimSpace(caption)
+		if len(it.Captions[i]) > maxCaptionLength {
+			return "caption too long"
+		}
+	}
+
+	paired := make(map[int]bool, 2*len(it.BeforeAfter))
+	for _, p := range it.BeforeAfter {
+		for _, idx := range []int{p.Before, p.After} {
+			if idx < 0 || idx >= len(it.Images) {
+				return "before/after index out of range"
+			}
+			if paired[idx] {
+				return "image used in more than one before/after pair"
+			}
+			paired[idx] = true
+		}
+	}
+
+	tags := make([]string, 0, len(it.Tags))
+	seen := make(map[string]bool, len(it.Tags))
+	for _, t := range it.Tags {
+		t = normalizeTag(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if len(t) > maxTagLength {
+			return "tag too long"
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	if len(tags) > maxTagsPerPortfolio {
+		return "too many tags"
+	}
+	it.Tags = tags
+	return ""
 }
 
-const maxImagesPerPortfolio = 10
+// checkPortfolioService verifies that a linked service exists. It writes the
+// error response and reports false if it does not.
+func (h *AppHandlers) checkPortfolioService(c *gin.Context, id *int64) bool {
+	if id == nil {
+		return true
+	}
+	if _, err := h.Store.GetServiceItem(c.Request.Context(), *id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(400, gin.H{"error": "unknown service_item_id"})
+		} else {
+			respondStoreError(c, err, "failed to load service item")
+		}
+		return false
+	}
+	return true
+}
 
 func isPersistedImageRef(s string) bool {
 	v := strings.ToLower(strings.TrimSpace(s))
@@ -29,22 +96,69 @@ func isPersistedImageRef(s string) bool {
 	return strings.HasPrefix(v, "data:image/") || strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")
 }
 
+// storeImages saves base64 uploads to the image store, replacing them with
+// their URLs, and keeps existing references as they are. It writes the error
+// response and reports false if any image is invalid.
+func (h *AppHandlers) storeImages(c *gin.Context, images []string) ([]string, bool) {
+	stored := make([]string, 0, len(images))
+	for i, img := range images {
+		if isValidBase64Image(img) {
+			url, err := h.Images.SaveBase64(c.Request.Context(), img)
+			if errors.Is(err, utils.ErrUnsupportedImage) || errors.Is(err, utils.ErrImageDimensions) || errors.Is(err, utils.ErrImageTooLarge) {
+				c.JSON(400, gin.H{"error": err.Error(), "index": i})
+				return nil, false
+			}
+			if err != nil {
+				log.Printf("store portfolio image %d: %v", i, err)
+				c.JSON(500, gin.H{"error": "failed to store image", "index": i})
+				return nil, false
+			}
+			stored = append(stored, url)
+			continue
+		}
+		if h.Images.Owns(img) || isPersistedImageRef(img) {
+			stored = append(stored, img)
+			continue
+		}
+		c.JSON(400, gin.H{"error": "invalid image at index", "index": i})
+		return nil, false
+	}
+	return stored, true
+}
+
 func isLocalUploadPath(s string) bool {
 	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), "/uploads/")
 }
 
-// Public: list with filters (category, search query, pagination)
+// Public: list with filters (category, search query, tag, service, featured, pagination)
 func (h *AppHandlers) ListPortfolioItems(c *gin.Context) {
-	category := c.Query("category")
-	if category != "" {
-		category = normalizeCategory(category)
-		if category == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category. Use one of: hair, makeup, nails"})
+	f := storage.PortfolioFilter{
+		Category: c.Query("category"),
+		Query:    c.Query("q"),
+		Tag:      normalizeTag(c.Query("tag")),
+	}
+	if f.Category != "" {
+		var ok bool
+		if f.Category, ok = h.resolveCategory(c, f.Category, "category"); !ok {
 			return
 		}
 	}
-
-	q := c.Query("q")
+	if v := c.Query("service_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_id"})
+			return
+		}
+		f.ServiceItemID = n
+	}
+	if v := c.Query("featured"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid featured"})
+			return
+		}
+		f.FeaturedOnly = b
+	}
 
 	offset := 0
 	if v := c.Query("offset"); v != "" {
@@ -65,7 +179,14 @@ func (h *AppHandlers) ListPortfolioItems(c *gin.Context) {
 		}
 	}
 
-	items, total := h.Store.ListPortfolioItems(category, q, offset, limit)
+	items, total, err := h.Store.ListPortfolioItems(c.Request.Context(), f, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list portfolio items")
+		return
+	}
+	for _, it := range items {
+		it.ImageSets = h.Images.ImageSets(it.Images)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"data":     items,
 		"total":    total,
@@ -83,11 +204,12 @@ func (h *AppHandlers) GetPortfolioItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid id"})
 		return
 	}
-	it, err := h.Store.GetPortfolioItem(id)
+	it, err := h.Store.GetPortfolioItem(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to load portfolio item")
 		return
 	}
+	it.ImageSets = h.Images.ImageSets(it.Images)
 	c.JSON(200, it)
 }
 
@@ -98,12 +220,11 @@ func (h *AppHandlers) CreatePortfolioItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	req.Category = normalizeCategory(req.Category)
-	if req.Category == "" {
-		c.JSON(400, gin.H{"error": "invalid category. Use one of: hair, makeup, nails"})
+	var ok bool
+	if req.Category, ok = h.resolveCategory(c, req.Category, "category"); !ok {
 		return
 	}
-	// Validate images and persist as durable data URIs (or keep existing refs)
+	// Validate images and save uploads to blob storage (or keep existing refs)
 	if len(req.Images) == 0 {
 		c.JSON(400, gin.H{"error": "images are required"})
 		return
@@ -112,30 +233,24 @@ func (h *AppHandlers) CreatePortfolioItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "too many images", "max": maxImagesPerPortfolio})
 		return
 	}
-	stored := make([]string, 0, len(req.Images))
-	for i, img := range req.Images {
-		if isValidBase64Image(img) {
-			dataURI, err := utils.Base64ImageToDataURI(img)
-			if err != nil {
-				c.JSON(500, gin.H{"error": "failed to store image", "index": i})
-				return
-			}
-			stored = append(stored, dataURI)
-			continue
-		}
-		if isPersistedImageRef(img) {
-			stored = append(stored, img)
-			continue
-		}
-		c.JSON(400, gin.H{"error": "invalid image at index", "index": i})
+	stored, ok := h.storeImages(c, req.Images)
+	if !ok {
 		return
 	}
 	req.Images = stored
-	created := h.Store.CreatePortfolioItem(&req)
-	if created == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create portfolio item"})
+	if msg := normalizePortfolioDetails(&req); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	if !h.checkPortfolioService(c, req.ServiceItemID) {
+		return
+	}
+	created, err := h.Store.CreatePortfolioItem(c.Request.Context(), &req)
+	if err != nil {
+		respondStoreError(c, err, "failed to create portfolio item")
 		return
 	}
+	created.ImageSets = h.Images.ImageSets(created.Images)
 	c.JSON(201, created)
 }
 
@@ -152,13 +267,11 @@ func (h *AppHandlers) UpdatePortfolioItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	if req.Category != "" {
-		req.Category = normalizeCategory(req.Category)
-		if req.Category == "" {
-			c.JSON(400, gin.H{"error": "invalid category. Use one of: hair, makeup, nails"})
-			return
-		}
+	var ok bool
+	if req.Category, ok = h.resolveCategory(c, req.Category, "category"); !ok {
+		return
 	}
+	ctx := c.Request.Context()
 	// Validate & persist images if provided, otherwise retain existing
 	if req.Images != nil {
 		if len(req.Images) > maxImagesPerPortfolio {
@@ -166,57 +279,61 @@ func (h *AppHandlers) UpdatePortfolioItem(c *gin.Context) {
 			return
 		}
 		// fetch current to compute cleanup diff
-		curr, _ := h.Store.GetPortfolioItem(id)
-		stored := make([]string, 0, len(req.Images))
-		for i, img := range req.Images {
-			if isValidBase64Image(img) {
-				dataURI, err := utils.Base64ImageToDataURI(img)
-				if err != nil {
-					c.JSON(500, gin.H{"error": "failed to store image", "index": i})
-					return
-				}
-				stored = append(stored, dataURI)
-				continue
-			}
-			if isPersistedImageRef(img) {
-				stored = append(stored, img)
-				continue
-			}
-			c.JSON(400, gin.H{"error": "invalid image at index", "index": i})
+		curr, err := h.Store.GetPortfolioItem(ctx, id)
+		if err != nil {
+			respondStoreError(c, err, "failed to load portfolio item")
+			return
+		}
+		stored, ok := h.storeImages(c, req.Images)
+		if !ok {
 			return
 		}
 		req.Images = stored
 		// cleanup old files not present anymore
-		if curr != nil {
-			old := make(map[string]bool, len(curr.Images))
-			for _, p := range curr.Images {
-				if isLocalUploadPath(p) {
-					old[p] = true
-				}
-			}
-			for _, p := range stored {
-				delete(old, p)
-			}
-			for p := range old {
-				_ = utils.DeleteImageAndThumbnail(p)
+		old := make(map[string]bool, len(curr.Images))
+		for _, p := range curr.Images {
+			if isLocalUploadPath(p) {
+				old[p] = true
 			}
 		}
+		for _, p := range stored {
+			delete(old, p)
+		}
+		for p := range old {
+			_ = utils.DeleteImageAndThumbnail(p)
+		}
 	} else {
-		// retain existing images when not provided
-		curr, err := h.Store.GetPortfolioItem(id)
-		if err == nil && curr != nil {
-			req.Images = curr.Images
+		// retain existing images, and unless replaced their captions and pairs
+		curr, err := h.Store.GetPortfolioItem(ctx, id)
+		if err != nil {
+			respondStoreError(c, err, "failed to load portfolio item")
+			return
+		}
+		req.Images = curr.Images
+		if req.Captions == nil {
+			req.Captions = curr.Captions
+		}
+		if req.BeforeAfter == nil {
+			req.BeforeAfter = curr.BeforeAfter
 		}
 	}
-	upd, err := h.Store.UpdatePortfolioItem(id, &req)
+	if msg := normalizePortfolioDetails(&req); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return
+	}
+	if !h.checkPortfolioService(c, req.ServiceItemID) {
+		return
+	}
+	upd, err := h.Store.UpdatePortfolioItem(ctx, id, &req)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to update portfolio item")
 		return
 	}
+	upd.ImageSets = h.Images.ImageSets(upd.Images)
 	c.JSON(200, upd)
 }
 
-// Admin: delete
+// Admin: move to trash
 func (h *AppHandlers) DeletePortfolioItem(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -224,18 +341,34 @@ func (h *AppHandlers) DeletePortfolioItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid id"})
 		return
 	}
-	// fetch to cleanup images
-	curr, _ := h.Store.GetPortfolioItem(id)
-	if err := h.Store.DeletePortfolioItem(id); err != nil {
-		c.JSON(404, gin.H{"error": "not found"})
+	// Images stay on disk until the item is purged from the trash.
+	if err := h.Store.DeletePortfolioItem(c.Request.Context(), id); err != nil {
+		respondStoreError(c, err, "failed to delete portfolio item")
 		return
 	}
-	if curr != nil {
-		for _, p := range curr.Images {
-			if isLocalUploadPath(p) {
-				_ = utils.DeleteImageAndThumbnail(p)
-			}
+	c.Status(204)
+}
+
+// Admin: set the gallery order; items are listed in the order of ids
+func (h *AppHandlers) ReorderPortfolioItems(c *gin.Context) {
+	var req struct {
+		IDs []int64 `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	seen := make(map[int64]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			c.JSON(400, gin.H{"error": "duplicate id", "id": id})
+			return
 		}
+		seen[id] = true
+	}
+	if err := h.Store.ReorderPortfolioItems(c.Request.Context(), req.IDs); err != nil {
+		respondStoreError(c, err, "failed to reorder portfolio items")
+		return
 	}
 	c.Status(204)
 }
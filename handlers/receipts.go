@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// issueReceipt numbers the invoice for a completed appointment, the first
+// time it is asked for, and renders it. It responds itself and returns
+// ok=false on failure.
+func (h *AppHandlers) issueReceipt(c *gin.Context) (inv *models.Invoice, receipt []byte, ok bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, nil, false
+	}
+	ctx := c.Request.Context()
+	a, err := h.Store.GetAppointment(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return nil, nil, false
+	}
+	if a.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "receipts are only issued for completed appointments"})
+		return nil, nil, false
+	}
+	serviceName := ""
+	if svc, err := h.Store.GetServiceItem(ctx, a.ServiceID); err == nil {
+		serviceName = svc.Name
+	}
+	paid, err := h.paidCents(ctx, a)
+	if err != nil {
+		respondStoreError(c, err, "failed to load payments")
+		return nil, nil, false
+	}
+
+	inv, err = h.Store.IssueInvoice(ctx, &models.Invoice{
+		AppointmentID:      a.ID,
+		CustomerName:       a.CustomerName,
+		CustomerEmail:      a.CustomerEmail,
+		ServiceName:        serviceName,
+		ServiceDescription: a.ServiceDescription,
+		AppointmentDate:    a.Date,
+		Currency:           a.Currency,
+		TotalCents:         a.PriceCents,
+		DiscountCents:      a.DiscountCents,
+		PromoCode:          a.PromoCode,
+		PointsRedeemed:     a.PointsRedeemed,
+		DepositCents:       a.DepositCents,
+		DepositPaidCents:   paid,
+	})
+	if err != nil {
+		respondStoreError(c, err, "failed to issue invoice")
+		return nil, nil, false
+	}
+	receipt, err = utils.RenderReceiptPDF(inv)
+	if err != nil {
+		log.Printf("render receipt for appointment %d: %v", a.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render receipt"})
+		return nil, nil, false
+	}
+	return inv, receipt, true
+}
+
+// Admin: download the numbered PDF receipt for a completed appointment
+func (h *AppHandlers) GetAppointmentReceipt(c *gin.Context) {
+	inv, receipt, ok := h.issueReceipt(c)
+	if !ok {
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, inv.Number))
+	c.Header("X-Invoice-Number", inv.Number)
+	c.Data(http.StatusOK, "application/pdf", receipt)
+}
+
+// Admin: email the PDF receipt for a completed appointment to the customer
+func (h *AppHandlers) EmailAppointmentReceipt(c *gin.Context) {
+	inv, receipt, ok := h.issueReceipt(c)
+	if !ok {
+		return
+	}
+	go func(inv *models.Invoice, receipt []byte) {
+		if err := utils.SendReceiptEmail(inv, receipt); err != nil {
+			fmt.Println("Error sending receipt email:", err)
+		}
+	}(inv, receipt)
+	c.JSON(http.StatusAccepted, gin.H{"number": inv.Number, "sent_to": inv.CustomerEmail})
+}
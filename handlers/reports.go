@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportFilter reads a report's from and to dates, both inclusive and
+// optional. It responds with 400 and returns false if they are invalid.
+func reportFilter(c *gin.Context) (storage.ReportFilter, bool) {
+	f := storage.ReportFilter{From: c.Query("from"), To: c.Query("to")}
+	for _, d := range []struct{ name, value string }{{"from", f.From}, {"to", f.To}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d.value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + d.name + "; expected YYYY-MM-DD"})
+			return f, false
+		}
+	}
+	if f.From != "" && f.To != "" && f.From > f.To {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return f, false
+	}
+	return f, true
+}
+
+// respondReport responds with the appointments in the request's date range
+// grouped by.
+func (h *AppHandlers) respondReport(c *gin.Context, by storage.ReportGrouping) {
+	f, ok := reportFilter(c)
+	if !ok {
+		return
+	}
+	rows, err := h.Store.ReportAppointments(c.Request.Context(), f, by)
+	if err != nil {
+		respondStoreError(c, err, "failed to compute report")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"from": f.From, "to": f.To, "group_by": by, "data": rows})
+}
+
+// Admin: bookings and revenue per day, week or month (?period=, default day)
+func (h *AppHandlers) ReportBookings(c *gin.Context) {
+	by := storage.ReportGrouping(c.DefaultQuery("period", "day"))
+	switch by {
+	case storage.ReportByDay, storage.ReportByWeek, storage.ReportByMonth:
+		h.respondReport(c, by)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid period. Use one of: day, week, month"})
+	}
+}
+
+// Admin: bookings and revenue per service, best earning first
+func (h *AppHandlers) ReportServices(c *gin.Context) {
+	h.respondReport(c, storage.ReportByService)
+}
+
+// Admin: bookings and revenue per category, best earning first
+func (h *AppHandlers) ReportCategories(c *gin.Context) {
+	h.respondReport(c, storage.ReportByCategory)
+}
+
+// Admin: bookings and revenue per staff member, best earning first
+func (h *AppHandlers) ReportStaff(c *gin.Context) {
+	h.respondReport(c, storage.ReportByStaff)
+}
+
+// Admin: bookings per hour of the day they start
+func (h *AppHandlers) ReportHours(c *gin.Context) {
+	h.respondReport(c, storage.ReportByHour)
+}
+
+// rate is part/whole to four decimal places, or 0 for an empty whole.
+func rate(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 10000
+}
+
+// Admin: cancellation and no-show rates, with the fees kept per currency
+func (h *AppHandlers) ReportCancellations(c *gin.Context) {
+	f, ok := reportFilter(c)
+	if !ok {
+		return
+	}
+	rows, err := h.Store.ReportAppointments(c.Request.Context(), f, storage.ReportTotal)
+	if err != nil {
+		respondStoreError(c, err, "failed to compute report")
+		return
+	}
+	var bookings, cancelled, noShows int
+	fees := make([]gin.H, 0, len(rows))
+	for _, r := range rows {
+		bookings += r.Bookings
+		cancelled += r.Cancelled
+		noShows += r.NoShows
+		fees = append(fees, gin.H{"currency": r.Currency, "fees_cents": r.FeesCents})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":              f.From,
+		"to":                f.To,
+		"bookings":          bookings,
+		"cancelled":         cancelled,
+		"no_shows":          noShows,
+		"cancellation_rate": rate(cancelled, bookings),
+		"no_show_rate":      rate(noShows, bookings),
+		"fees":              fees,
+	})
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// reviewInviteTTL is how long a review link stays valid.
+	reviewInviteTTL        = 30 * 24 * time.Hour
+	maxReviewCommentLength = 2000
+)
+
+// hashToken is what the store keeps in place of a one-time link token, such
+// as a review or cancel link, so a database leak does not hand out working
+// links.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// reviewAuthor shortens a customer's name for public display: "Jane Doe"
+// becomes "Jane D.".
+func reviewAuthor(name string) string {
+	parts := strings.Fields(name)
+	switch len(parts) {
+	case 0:
+		return "Customer"
+	case 1:
+		return parts[0]
+	default:
+		last := []rune(parts[len(parts)-1])
+		return parts[0] + " " + strings.ToUpper(string(last[0])) + "."
+	}
+}
+
+func normalizeReviewStatus(s string) string {
+	switch s {
+	case "pending", "approved", "rejected":
+		return s
+	default:
+		return ""
+	}
+}
+
+// issueReviewInvite creates a one-time review link for a completed
+// appointment and emails it to the customer in the background.
+func (h *AppHandlers) issueReviewInvite(ctx context.Context, appt *models.Appointment) (token string, expiresAt time.Time, err error) {
+	token = generateToken(32)
+	if token == "" {
+		return "", time.Time{}, errors.New("generate review token")
+	}
+	expiresAt = time.Now().Add(reviewInviteTTL).UTC()
+	if err := h.Store.CreateReviewInvite(ctx, appt.ID, hashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	go func(appt *models.Appointment) {
+		serviceName := ""
+		// The request context is done once the response is written.
+		if svc, err := h.Store.GetServiceItem(context.Background(), appt.ServiceID); err == nil {
+			serviceName = svc.Name
+		}
+		if err := utils.SendReviewRequestEmail(appt, serviceName, token); err != nil {
+			fmt.Println("Error sending review request email:", err)
+		}
+	}(appt)
+	return token, expiresAt, nil
+}
+
+// Admin: (re)issue the review link for a completed appointment
+func (h *AppHandlers) CreateReviewLink(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx := c.Request.Context()
+	appt, err := h.Store.GetAppointment(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load appointment")
+		return
+	}
+	if appt.Status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "only completed appointments can be reviewed"})
+		return
+	}
+	token, expiresAt, err := h.issueReviewInvite(ctx, appt)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "appointment has already been reviewed"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to create review link")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"url":        utils.ReviewLink(token),
+		"expires_at": expiresAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// Public: describe the appointment a review link is for
+func (h *AppHandlers) GetReviewInvite(c *gin.Context) {
+	ctx := c.Request.Context()
+	inv, err := h.Store.GetReviewInvite(ctx, hashToken(c.Param("token")))
+	if err != nil {
+		respondReviewLinkError(c, err, "failed to load review link")
+		return
+	}
+	resp := gin.H{
+		"service_id": inv.ServiceID,
+		"date":       inv.Date,
+		"author":     reviewAuthor(inv.CustomerName),
+		"expires_at": inv.ExpiresAt,
+	}
+	if svc, err := h.Store.GetServiceItem(ctx, inv.ServiceID); err == nil {
+		resp["service_name"] = svc.Name
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Public: submit a review with a one-time link
+func (h *AppHandlers) SubmitReview(c *gin.Context) {
+	var req struct {
+		Rating  int    `json:"rating" binding:"required,min=1,max=5"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rating must be a whole number from 1 to 5"})
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if len(req.Comment) > maxReviewCommentLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "comment too long", "max": maxReviewCommentLength})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tokenHash := hashToken(c.Param("token"))
+	inv, err := h.Store.GetReviewInvite(ctx, tokenHash)
+	if err != nil {
+		respondReviewLinkError(c, err, "failed to load review link")
+		return
+	}
+	created, err := h.Store.SubmitReview(ctx, tokenHash, &models.Review{
+		Author:  reviewAuthor(inv.CustomerName),
+		Rating:  req.Rating,
+		Comment: req.Comment,
+	})
+	if err != nil {
+		respondReviewLinkError(c, err, "failed to submit review")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// respondReviewLinkError explains an unusable review link, and otherwise
+// responds like respondStoreError.
+func respondReviewLinkError(c *gin.Context, err error, failureMsg string) {
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "review link is invalid, expired or already used"})
+		return
+	}
+	respondStoreError(c, err, failureMsg)
+}
+
+// Public: approved reviews of a service
+func (h *AppHandlers) ListServiceReviews(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	h.listReviews(c, storage.ReviewFilter{ServiceID: id, Status: "approved"})
+}
+
+// Admin: list reviews, optionally by status and service
+func (h *AppHandlers) ListReviews(c *gin.Context) {
+	var f storage.ReviewFilter
+	if v := c.Query("status"); v != "" {
+		f.Status = normalizeReviewStatus(v)
+		if f.Status == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status. Use one of: pending, approved, rejected"})
+			return
+		}
+	}
+	if v := c.Query("service_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service_id"})
+			return
+		}
+		f.ServiceID = n
+	}
+	h.listReviews(c, f)
+}
+
+func (h *AppHandlers) listReviews(c *gin.Context, f storage.ReviewFilter) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	reviews, total, err := h.Store.ListReviews(c.Request.Context(), f, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list reviews")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":     reviews,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+		"has_more": offset+len(reviews) < total,
+	})
+}
+
+// Admin: approve or reject a review
+func (h *AppHandlers) ModerateReview(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	status := normalizeReviewStatus(strings.TrimSpace(req.Status))
+	if status == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status. Use one of: pending, approved, rejected"})
+		return
+	}
+	r, err := h.Store.ModerateReview(c.Request.Context(), id, status)
+	if err != nil {
+		respondStoreError(c, err, "failed to moderate review")
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
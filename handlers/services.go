@@ -11,16 +11,6 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Allowed services: hair | makeup | nails
-func normalizeService(s string) string {
-	switch s {
-	case "hair", "makeup", "nails":
-		return s
-	default:
-		return ""
-	}
-}
-
 // isValidBase64Image checks whether the provided string is valid base64 data.
 // Supports optional data URI prefix like: data:image/png;base64,XXXXX
 func isValidBase64Image(s string) bool {
@@ -41,13 +31,33 @@ func isValidBase64Image(s string) bool {
 	return true
 }
 
+// storeServiceImage validates the optional image, saving base64 uploads to
+// the image store. It writes the error response and reports false if invalid.
+func (h *AppHandlers) storeServiceImage(c *gin.Context, it *models.ServiceItem) bool {
+	if strings.TrimSpace(it.Image) == "" {
+		it.Image = ""
+		return true
+	}
+	stored, ok := h.storeImages(c, []string{it.Image})
+	if !ok {
+		return false
+	}
+	it.Image = stored[0]
+	return true
+}
+
+func (h *AppHandlers) setServiceImageSet(it *models.ServiceItem) {
+	if it.Image != "" {
+		it.ImageSet = &h.Images.ImageSets([]string{it.Image})[0]
+	}
+}
+
 // Public: list with filters (category, min_rating, pagination)
 func (h *AppHandlers) ListServiceItems(c *gin.Context) {
 	category := c.Query("category")
 	if category != "" {
-		category = normalizeService(category)
-		if category == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category. Use one of: hair, makeup, nails"})
+		var ok bool
+		if category, ok = h.resolveCategory(c, category, "category"); !ok {
 			return
 		}
 	}
@@ -83,7 +93,14 @@ func (h *AppHandlers) ListServiceItems(c *gin.Context) {
 		}
 	}
 
-	items, total := h.Store.ListServiceItems(category, minRating, q, offset, limit)
+	items, total, err := h.Store.ListServiceItems(c.Request.Context(), category, minRating, q, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list service items")
+		return
+	}
+	for _, it := range items {
+		h.setServiceImageSet(it)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"data":     items,
 		"total":    total,
@@ -93,7 +110,7 @@ func (h *AppHandlers) ListServiceItems(c *gin.Context) {
 	})
 }
 
-// Public: get single
+// Public: get single, with its priced variants
 func (h *AppHandlers) GetServiceItem(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -101,11 +118,17 @@ func (h *AppHandlers) GetServiceItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid id"})
 		return
 	}
-	it, err := h.Store.GetServiceItem(id)
+	ctx := c.Request.Context()
+	it, err := h.Store.GetServiceItem(ctx, id)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to load service item")
+		return
+	}
+	if it.Variants, err = h.Store.ListServiceVariants(ctx, id); err != nil {
+		respondStoreError(c, err, "failed to load service variants")
 		return
 	}
+	h.setServiceImageSet(it)
 	c.JSON(200, it)
 }
 
@@ -116,20 +139,23 @@ func (h *AppHandlers) CreateServiceItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	req.Service = normalizeService(req.Service)
-	if req.Service == "" {
-		c.JSON(400, gin.H{"error": "invalid service. Use one of: hair, makeup, nails"})
+	var ok bool
+	if req.Service, ok = h.resolveCategory(c, req.Service, "service"); !ok {
+		return
+	}
+	if req.DepositPercent < 0 || req.DepositPercent > 100 {
+		c.JSON(400, gin.H{"error": "deposit_percent must be between 0 and 100"})
 		return
 	}
-	if req.Rating < 0 || req.Rating > 5 {
-		c.JSON(400, gin.H{"error": "rating must be between 0 and 5"})
+	if !h.storeServiceImage(c, &req) {
 		return
 	}
-	created := h.Store.CreateServiceItem(&req)
-	if created == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create service item"})
+	created, err := h.Store.CreateServiceItem(c.Request.Context(), &req)
+	if err != nil {
+		respondStoreError(c, err, "failed to create service item")
 		return
 	}
+	h.setServiceImageSet(created)
 	c.JSON(201, created)
 }
 
@@ -146,22 +172,23 @@ func (h *AppHandlers) UpdateServiceItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
-	if req.Service != "" {
-		req.Service = normalizeService(req.Service)
-		if req.Service == "" {
-			c.JSON(400, gin.H{"error": "invalid service. Use one of: hair, makeup, nails"})
-			return
-		}
+	var ok bool
+	if req.Service, ok = h.resolveCategory(c, req.Service, "service"); !ok {
+		return
+	}
+	if req.DepositPercent < 0 || req.DepositPercent > 100 {
+		c.JSON(400, gin.H{"error": "deposit_percent must be between 0 and 100"})
+		return
 	}
-	if req.Rating < 0 || req.Rating > 5 {
-		c.JSON(400, gin.H{"error": "rating must be between 0 and 5"})
+	if !h.storeServiceImage(c, &req) {
 		return
 	}
-	upd, err := h.Store.UpdateServiceItem(id, &req)
+	upd, err := h.Store.UpdateServiceItem(c.Request.Context(), id, &req)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "not found"})
+		respondStoreError(c, err, "failed to update service item")
 		return
 	}
+	h.setServiceImageSet(upd)
 	c.JSON(200, upd)
 }
 
@@ -173,8 +200,8 @@ func (h *AppHandlers) DeleteServiceItem(c *gin.Context) {
 		c.JSON(400, gin.H{"error": "invalid id"})
 		return
 	}
-	if err := h.Store.DeleteServiceItem(id); err != nil {
-		c.JSON(404, gin.H{"error": "not found"})
+	if err := h.Store.DeleteServiceItem(c.Request.Context(), id); err != nil {
+		respondStoreError(c, err, "failed to delete service item")
 		return
 	}
 	c.Status(204)
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTrashKind validates a trash type from the query or path. Empty is
+// accepted only when allowAll is set and means every type.
+func parseTrashKind(c *gin.Context, raw string, allowAll bool) (storage.TrashKind, bool) {
+	kind := storage.TrashKind(raw)
+	if (raw == "" && allowAll) || kind.Valid() {
+		return kind, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid type. Use one of: appointments, services, portfolio, menu-items"})
+	return "", false
+}
+
+// Admin: list deleted items, optionally of one type
+func (h *AppHandlers) ListTrash(c *gin.Context) {
+	kind, ok := parseTrashKind(c, c.Query("type"), true)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	items, total, err := h.Store.ListTrash(c.Request.Context(), kind, offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list trash")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":     items,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+		"has_more": offset+len(items) < total,
+	})
+}
+
+// Admin: restore a deleted item
+func (h *AppHandlers) RestoreFromTrash(c *gin.Context) {
+	kind, ok := parseTrashKind(c, c.Param("type"), false)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := h.Store.RestoreFromTrash(c.Request.Context(), kind, id); err != nil {
+		respondStoreError(c, err, "failed to restore item")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Admin: permanently delete an item from the trash
+func (h *AppHandlers) PurgeFromTrash(c *gin.Context) {
+	kind, ok := parseTrashKind(c, c.Param("type"), false)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	purged, err := h.Store.PurgeFromTrash(c.Request.Context(), kind, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to purge item")
+		return
+	}
+	// Uploaded files are kept while an item is in the trash so it can be restored.
+	for _, p := range purged.Images {
+		if isLocalUploadPath(p) {
+			_ = utils.DeleteImageAndThumbnail(p)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
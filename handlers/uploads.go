@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"lucys-beauty-parlour-backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadRequestBytes bounds the whole multipart body: one image plus
+// room for part headers and small form fields.
+const maxUploadRequestBytes = utils.MaxImageBytes + 64<<10
+
+// Admin: upload one image as multipart/form-data (field "file"). The returned
+// url can be used in portfolio images and service item image fields.
+func (h *AppHandlers) UploadImage(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadRequestBytes)
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart/form-data body"})
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing file field"})
+			return
+		}
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		data, err := utils.ReadImage(part)
+		part.Close()
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		url, err := h.Images.Save(c.Request.Context(), data)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"url":       url,
+			"image_set": h.Images.ImageSets([]string{url})[0],
+		})
+		return
+	}
+}
+
+func respondUploadError(c *gin.Context, err error) {
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.Is(err, utils.ErrImageTooLarge), errors.As(err, &maxBytes):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "image too large", "max_bytes": utils.MaxImageBytes})
+	case errors.Is(err, utils.ErrImageDimensions):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "image dimensions too large", "max_dimension": utils.MaxImageDimension, "max_pixels": utils.MaxImagePixels})
+	case errors.Is(err, utils.ErrUnsupportedImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported or corrupt image. Use JPEG, PNG, GIF or WebP"})
+	default:
+		log.Printf("POST /admin/uploads: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store image"})
+	}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxVoucherCodeLength = 32
+	// Generated codes are this long, from an alphabet without look-alike
+	// characters so they can be read out over the phone.
+	voucherCodeLength   = 10
+	voucherCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// voucherCodePattern allows uppercase words joined by single hyphens, e.g.
+// "GIFT-AMINA" or "SPRING10".
+var voucherCodePattern = regexp.MustCompile(`^[A-Z0-9]+(-[A-Z0-9]+)*$`)
+
+// voucherRequest creates a voucher, or changes the fields sent.
+type voucherRequest struct {
+	Code      *string `json:"code"`
+	Kind      *string `json:"kind"`
+	Value     *int64  `json:"value"`
+	Currency  *string `json:"currency"`
+	ExpiresAt *string `json:"expires_at"`
+	MaxUses   *int    `json:"max_uses"`
+	Active    *bool   `json:"active"`
+	Note      *string `json:"note"`
+}
+
+// generateVoucherCode returns a random code for a voucher issued without one.
+func generateVoucherCode() (string, error) {
+	b := make([]byte, voucherCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = voucherCodeAlphabet[int(b[i])%len(voucherCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// parseVoucherExpiry reads an expiry as an RFC 3339 time, or as a date the
+// voucher is good through, and returns it in UTC.
+func parseVoucherExpiry(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		day, derr := time.ParseInLocation("2006-01-02", raw, time.Local)
+		if derr != nil {
+			return "", errors.New("invalid expires_at; expected YYYY-MM-DD or an RFC 3339 time")
+		}
+		t = day.AddDate(0, 0, 1)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// voucherUnavailable says why a booking made at now can't redeem v, or
+// returns "" if it can.
+func voucherUnavailable(v *models.Voucher, now time.Time) string {
+	switch {
+	case !v.Active:
+		return "the promo code is no longer active"
+	case v.MaxUses > 0 && v.Uses >= v.MaxUses:
+		return "the promo code has been used up"
+	}
+	if v.ExpiresAt != "" {
+		if expires, err := time.Parse(time.RFC3339, v.ExpiresAt); err != nil || !now.Before(expires) {
+			return "the promo code has expired"
+		}
+	}
+	return ""
+}
+
+// voucherDiscount is what v takes off a price, never more than the price.
+// Percentages round down.
+func voucherDiscount(v *models.Voucher, priceCents int64) int64 {
+	var off int64
+	switch v.Kind {
+	case "fixed":
+		off = v.Value
+	case "percent":
+		off = priceCents * v.Value / 100
+	}
+	return min(off, priceCents)
+}
+
+// applyPromoCode redeems the voucher with code against a, taking its
+// discount off a.PriceCents. It responds with 400 and returns false if the
+// code can't be used; the store counts the use when a is created.
+func (h *AppHandlers) applyPromoCode(c *gin.Context, a *models.Appointment, code string) bool {
+	v, err := h.Store.GetVoucherByCode(c.Request.Context(), strings.ToUpper(strings.TrimSpace(code)))
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown promo code"})
+		return false
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to look up promo code")
+		return false
+	}
+	if msg := voucherUnavailable(v, time.Now()); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return false
+	}
+	if v.Kind == "fixed" && v.Currency != a.Currency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the promo code is for bookings in " + v.Currency})
+		return false
+	}
+	a.VoucherID = v.ID
+	a.PromoCode = v.Code
+	a.DiscountCents = voucherDiscount(v, a.PriceCents)
+	a.PriceCents -= a.DiscountCents
+	return true
+}
+
+// mergeVoucherRequest applies req to v and validates the result. It
+// responds with 400 and returns false if the voucher is invalid.
+func (h *AppHandlers) mergeVoucherRequest(c *gin.Context, v *models.Voucher, req *voucherRequest) bool {
+	if req.Kind != nil {
+		v.Kind = strings.ToLower(strings.TrimSpace(*req.Kind))
+	}
+	if req.Value != nil {
+		v.Value = *req.Value
+	}
+	if req.Currency != nil {
+		v.Currency = strings.TrimSpace(*req.Currency)
+	}
+	if req.ExpiresAt != nil {
+		expires, err := parseVoucherExpiry(*req.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		v.ExpiresAt = expires
+	}
+	if req.MaxUses != nil {
+		v.MaxUses = *req.MaxUses
+	}
+	if req.Active != nil {
+		v.Active = *req.Active
+	}
+	if req.Note != nil {
+		v.Note = strings.TrimSpace(*req.Note)
+	}
+
+	switch v.Kind {
+	case "fixed":
+		currency, ok := h.resolveCurrency(c, v.Currency)
+		if !ok {
+			return false
+		}
+		v.Currency = currency.Code
+		if v.Value <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "value must be a positive amount in minor units of the currency"})
+			return false
+		}
+	case "percent":
+		v.Currency = ""
+		if v.Value < 1 || v.Value > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "value must be a percentage between 1 and 100"})
+			return false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid kind. Use one of: fixed, percent"})
+		return false
+	}
+	if v.MaxUses < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_uses must be >= 0"})
+		return false
+	}
+	return true
+}
+
+// Admin: list vouchers, newest first
+func (h *AppHandlers) ListVouchers(c *gin.Context) {
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	list, total, err := h.Store.ListVouchers(c.Request.Context(), offset, limit)
+	if err != nil {
+		respondStoreError(c, err, "failed to list vouchers")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data":     list,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+		"has_more": offset+len(list) < total,
+	})
+}
+
+// Admin: get one voucher with its uses
+func (h *AppHandlers) GetVoucher(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	v, err := h.Store.GetVoucher(c.Request.Context(), id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load voucher")
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
+
+// Admin: issue a voucher; a random code is generated if none is given
+func (h *AppHandlers) CreateVoucher(c *gin.Context) {
+	var req voucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	v := &models.Voucher{Active: true}
+	if req.Code != nil {
+		v.Code = strings.ToUpper(strings.TrimSpace(*req.Code))
+	}
+	if v.Code == "" {
+		code, err := generateVoucherCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create voucher"})
+			return
+		}
+		v.Code = code
+	}
+	if len(v.Code) > maxVoucherCodeLength || !voucherCodePattern.MatchString(v.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code must be letters and digits separated by single hyphens, at most 32 characters"})
+		return
+	}
+	if !h.mergeVoucherRequest(c, v, &req) {
+		return
+	}
+
+	created, err := h.Store.CreateVoucher(c.Request.Context(), v)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "voucher code already exists"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to create voucher")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// Admin: change a voucher's terms; its code can't change
+func (h *AppHandlers) UpdateVoucher(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	ctx := c.Request.Context()
+	curr, err := h.Store.GetVoucher(ctx, id)
+	if err != nil {
+		respondStoreError(c, err, "failed to load voucher")
+		return
+	}
+	var req voucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code != nil && strings.ToUpper(strings.TrimSpace(*req.Code)) != curr.Code {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code cannot change; issue a new voucher instead"})
+		return
+	}
+	merged := *curr
+	if !h.mergeVoucherRequest(c, &merged, &req) {
+		return
+	}
+	upd, err := h.Store.UpdateVoucher(ctx, id, &merged)
+	if err != nil {
+		respondStoreError(c, err, "failed to update voucher")
+		return
+	}
+	c.JSON(http.StatusOK, upd)
+}
+
+// Admin: delete a voucher no booking has redeemed
+func (h *AppHandlers) DeleteVoucher(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	err = h.Store.DeleteVoucher(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "the voucher has been redeemed; set active to false instead"})
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "failed to delete voucher")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
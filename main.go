@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
+	"lucys-beauty-parlour-backend/blobstore"
 	"lucys-beauty-parlour-backend/database"
 	"lucys-beauty-parlour-backend/handlers"
+	"lucys-beauty-parlour-backend/maintenance"
 	"lucys-beauty-parlour-backend/middleware"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/payments"
 	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -18,6 +27,13 @@ import (
 func main() {
 	_ = godotenv.Load()
 
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Allow Gin mode to be controlled via GIN_MODE env, default to release.
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
@@ -49,8 +65,39 @@ func main() {
 	// Serve uploaded files statically
 	r.Static("/uploads", "./uploads")
 
+	blobs, err := blobstore.NewFromEnv()
+	if err != nil {
+		log.Fatalf("failed to open blob storage: %v", err)
+	}
+	// Serve locally stored blobs when they live under this server's URL space
+	if local, ok := blobs.(*blobstore.Local); ok && strings.HasPrefix(local.BaseURL(), "/") {
+		r.Static(local.BaseURL(), local.Dir())
+	}
+
+	imageCfg, err := utils.ImageConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid image configuration: %v", err)
+	}
+
+	images := utils.NewImageStore(blobs, imageCfg)
 	store := storage.NewPostgresStore(db)
-	h := &handlers.AppHandlers{Store: store}
+	provider, err := payments.NewFromEnv()
+	if err != nil {
+		log.Fatalf("invalid payment configuration: %v", err)
+	}
+	policy, err := handlers.CancellationPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid cancellation policy: %v", err)
+	}
+	shopCurrency, err := money.DefaultCurrencyFromEnv()
+	if err != nil {
+		log.Fatalf("invalid currency configuration: %v", err)
+	}
+	h := &handlers.AppHandlers{Store: store, Images: images, Payments: provider, Cancellation: &policy, Currency: shopCurrency}
+
+	if err := startImageGC(db, images, blobs); err != nil {
+		log.Fatalf("invalid image GC configuration: %v", err)
+	}
 
 	refreshStore := storage.NewRefreshStore()
 	handlers.RefreshDB = refreshStore
@@ -63,15 +110,29 @@ func main() {
 	r.POST("/admin/forgot-password", handlers.ForgotPassword)
 	r.POST("/admin/change-password", handlers.ChangePassword)
 	r.POST("/appointments", h.CreateAppointment)
+	// Customers cancel their own booking via the link returned when booking (public)
+	r.GET("/appointments/cancel/:token", h.GetCancellationQuote)
+	r.POST("/appointments/cancel/:token", h.CancelAppointmentByToken)
+	// Payment provider webhooks (public, verified per provider)
+	r.POST("/payments/webhook/:provider", h.PaymentWebhook)
+	r.PUT("/payments/webhook/:provider", h.PaymentWebhook)
+	// Categories (public)
+	r.GET("/categories", h.ListCategories)
 	// Services blog (public)
 	r.GET("/services", h.ListServiceItems)
 	r.GET("/services/:id", h.GetServiceItem)
+	r.GET("/services/:id/reviews", h.ListServiceReviews)
+	// Reviews via one-time links (public)
+	r.GET("/reviews/:token", h.GetReviewInvite)
+	r.POST("/reviews/:token", h.SubmitReview)
 	// Portfolio (public)
 	r.GET("/portfolio", h.ListPortfolioItems)
 	r.GET("/portfolio/:id", h.GetPortfolioItem)
 	// Menu items (public)
 	r.GET("/menu-items", h.ListMenuItems)
 	r.GET("/menu-items/:id", h.GetMenuItem)
+	// Stored images and their resized renditions (public)
+	r.GET("/images/:hash", h.GetImage)
 	r.GET("/health", handlers.Health)
 
 	// Protected routes (admin only)
@@ -82,21 +143,74 @@ func main() {
 		admin.PUT("/appointments/:id", h.UpdateAppointment)
 		admin.PUT("/appointments/:id/cancel", h.CancelAppointment)
 		admin.DELETE("/appointments/:id", h.DeleteAppointment)
+		admin.POST("/appointments/:id/review-link", h.CreateReviewLink)
+		admin.GET("/appointments/:id/payments", h.ListAppointmentPayments)
+		admin.POST("/appointments/:id/payments", h.RequestAppointmentDeposit)
+		admin.GET("/appointments/:id/receipt", h.GetAppointmentReceipt)
+		admin.POST("/appointments/:id/receipt/email", h.EmailAppointmentReceipt)
+		// Refunds owed under the cancellation policy
+		admin.GET("/refunds", h.ListRefunds)
+		admin.PUT("/refunds/:id/paid", h.MarkRefundPaid)
+
+		// Reports over appointments, optionally ?from=&to=YYYY-MM-DD
+		admin.GET("/reports/bookings", h.ReportBookings)
+		admin.GET("/reports/services", h.ReportServices)
+		admin.GET("/reports/categories", h.ReportCategories)
+		admin.GET("/reports/staff", h.ReportStaff)
+		admin.GET("/reports/hours", h.ReportHours)
+		admin.GET("/reports/cancellations", h.ReportCancellations)
+
+		// CSV or Excel downloads (?format=csv|xlsx)
+		admin.GET("/exports/appointments", h.ExportAppointments)
+		admin.GET("/exports/customers", h.ExportCustomers)
+		admin.GET("/exports/revenue", h.ExportRevenue)
+
+		// Loyalty points
+		admin.GET("/loyalty/settings", h.GetLoyaltySettings)
+		admin.PUT("/loyalty/settings", h.UpdateLoyaltySettings)
+		admin.GET("/loyalty/customers/:email", h.GetCustomerLoyalty)
+
+		// Gift vouchers and promo codes
+		admin.GET("/vouchers", h.ListVouchers)
+		admin.GET("/vouchers/:id", h.GetVoucher)
+		admin.POST("/vouchers", h.CreateVoucher)
+		admin.PUT("/vouchers/:id", h.UpdateVoucher)
+		admin.DELETE("/vouchers/:id", h.DeleteVoucher)
+
+		// Reviews (moderation)
+		admin.GET("/reviews", h.ListReviews)
+		admin.PUT("/reviews/:id", h.ModerateReview)
+
+		// Categories (admin CRUD)
+		admin.POST("/categories", h.CreateCategory)
+		admin.PUT("/categories/:slug", h.UpdateCategory)
+		admin.DELETE("/categories/:slug", h.DeleteCategory)
 
 		// Services blog (admin CRUD)
 		admin.POST("/services", h.CreateServiceItem)
+		admin.POST("/services/import", h.ImportServiceItems)
 		admin.PUT("/services/:id", h.UpdateServiceItem)
 		admin.DELETE("/services/:id", h.DeleteServiceItem)
 
 		// Portfolio (admin CRUD)
 		admin.POST("/portfolio", h.CreatePortfolioItem)
+		admin.PUT("/portfolio/order", h.ReorderPortfolioItems)
 		admin.PUT("/portfolio/:id", h.UpdatePortfolioItem)
 		admin.DELETE("/portfolio/:id", h.DeletePortfolioItem)
 
 		// Menu items (admin CRUD)
 		admin.POST("/menu-items", h.CreateMenuItem)
+		admin.POST("/menu-items/import", h.ImportMenuItems)
 		admin.PUT("/menu-items/:id", h.UpdateMenuItem)
 		admin.DELETE("/menu-items/:id", h.DeleteMenuItem)
+
+		// Image uploads (multipart)
+		admin.POST("/uploads", h.UploadImage)
+
+		// Trash (soft-deleted items)
+		admin.GET("/trash", h.ListTrash)
+		admin.POST("/trash/:type/:id/restore", h.RestoreFromTrash)
+		admin.DELETE("/trash/:type/:id", h.PurgeFromTrash)
 	}
 
 	port := os.Getenv("PORT")
@@ -105,3 +219,40 @@ func main() {
 	}
 	r.Run(":" + port)
 }
+
+// startImageGC sweeps orphaned images in the background every
+// IMAGE_GC_INTERVAL (e.g. "6h"); it is off when the variable is unset.
+// IMAGE_GC_GRACE overrides the default grace period.
+func startImageGC(db *sql.DB, images *utils.ImageStore, blobs blobstore.BlobStore) error {
+	v := os.Getenv("IMAGE_GC_INTERVAL")
+	if v == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("IMAGE_GC_INTERVAL: invalid duration %q", v)
+	}
+	opts := maintenance.OrphanOptions{Grace: maintenance.DefaultOrphanGrace}
+	if v := os.Getenv("IMAGE_GC_GRACE"); v != "" {
+		if opts.Grace, err = time.ParseDuration(v); err != nil || opts.Grace <= 0 {
+			return fmt.Errorf("IMAGE_GC_GRACE: invalid duration %q", v)
+		}
+	}
+	if opts.Uploads, err = blobstore.NewLocal("./uploads", "/uploads"); err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			rep, err := maintenance.SweepOrphans(context.Background(), db, images, blobs, opts)
+			if err != nil {
+				log.Printf("image gc: %v", err)
+				continue
+			}
+			if rep.Deleted > 0 {
+				log.Printf("image gc: deleted %d orphaned image(s), %d bytes freed", rep.Deleted, rep.BytesFreed)
+			}
+		}
+	}()
+	return nil
+}
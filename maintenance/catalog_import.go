@@ -0,0 +1,561 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/storage"
+)
+
+// ErrInvalidImportFile is returned for an import file that can't be read
+// as CSV or whose header is wrong; problems in single rows are reported in
+// ImportReport.Errors instead.
+var ErrInvalidImportFile = errors.New("invalid import file")
+
+// ImportOptions configures ImportMenuItems and ImportServiceItems.
+type ImportOptions struct {
+	// DryRun validates every row and reports what would be created and
+	// updated without writing anything.
+	DryRun bool
+	// Currency is what menu items without a currency are priced in.
+	Currency money.Currency
+}
+
+// ImportRowError is a problem with one row of an import file.
+type ImportRowError struct {
+	// Line is the row's line in the file; the header is line 1.
+	Line   int    `json:"line"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// ImportReport summarises an import. Nothing is written unless Errors is
+// empty.
+type ImportReport struct {
+	DryRun  bool             `json:"dry_run"`
+	Rows    int              `json:"rows"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Errors  []ImportRowError `json:"errors"`
+}
+
+func (rep *ImportReport) reject(line int, column, format string, args ...any) {
+	rep.Errors = append(rep.Errors, ImportRowError{Line: line, Column: column, Error: fmt.Sprintf(format, args...)})
+}
+
+// importTable reads the rows of a CSV file whose header names its columns.
+type importTable struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+// importRow is a row of an importTable.
+type importRow struct {
+	line    int
+	cells   []string
+	columns map[string]int
+	// invalid says why the row can't be read, if it can't.
+	invalid string
+}
+
+// readImportHeader reads the header of r, allowing only the known columns
+// and requiring the required ones. Column names are case-insensitive, and
+// spaces in them may stand for underscores.
+func readImportHeader(r io.Reader, known, required []string) (*importTable, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImportFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImportFile, err)
+	}
+	t := &importTable{r: cr, columns: make(map[string]int, len(header))}
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheets often start a UTF-8 file with a byte order mark.
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("%w: unknown column %q; use some of: %s", ErrInvalidImportFile, name, strings.Join(known, ", "))
+		}
+		if _, ok := t.columns[name]; ok {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidImportFile, name)
+		}
+		t.columns[name] = i
+	}
+	for _, name := range required {
+		if _, ok := t.columns[name]; !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidImportFile, name)
+		}
+	}
+	return t, nil
+}
+
+// next returns the next row that isn't blank, or io.EOF after the last.
+func (t *importTable) next() (importRow, error) {
+	for {
+		cells, err := t.r.Read()
+		var perr *csv.ParseError
+		if errors.As(err, &perr) && errors.Is(perr.Err, csv.ErrFieldCount) {
+			return importRow{line: perr.StartLine, invalid: fmt.Sprintf("has %d cells, but the header has %d", len(cells), len(t.columns))}, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return importRow{}, err
+		}
+		if err != nil {
+			return importRow{}, fmt.Errorf("%w: %w", ErrInvalidImportFile, err)
+		}
+		if strings.TrimSpace(strings.Join(cells, "")) != "" {
+			line, _ := t.r.FieldPos(0)
+			return importRow{line: line, cells: cells, columns: t.columns}, nil
+		}
+	}
+}
+
+// get returns the trimmed cell in column, and whether the file has it.
+func (row importRow) get(column string) (string, bool) {
+	i, ok := row.columns[column]
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(row.cells[i]), true
+}
+
+// rowID looks up the item with the row's id in byID, or returns the zero
+// value for a row without an id. It rejects the row and returns false for
+// an id that isn't in byID.
+func rowID[T any](rep *ImportReport, row importRow, byID map[int64]T, kind string) (T, bool) {
+	var zero T
+	raw, _ := row.get("id")
+	if raw == "" {
+		return zero, true
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		rep.reject(row.line, "id", "invalid id %q", raw)
+		return zero, false
+	}
+	v, ok := byID[id]
+	if !ok {
+		rep.reject(row.line, "id", "no %s has id %d", kind, id)
+		return zero, false
+	}
+	return v, true
+}
+
+var menuItemImportColumns = []string{"id", "category", "name", "service", "currency", "price", "duration_minutes"}
+
+// ImportMenuItems reads menu items from CSV with a header row naming some of
+// the columns id, category, name, service, currency, price and
+// duration_minutes, and creates or updates them all at once.
+//
+// A row updates the menu item with its id, or else the one with its name in
+// its category, or among the variants of its service; otherwise it creates a
+// menu item. Prices are decimals in their currency, e.g. "25.50" for USD.
+// The service is a service's ID or its name. An empty category is the
+// service's, and an empty currency is the item's current one, or
+// opts.Currency for a new item; columns the file leaves out keep their
+// current values.
+func ImportMenuItems(ctx context.Context, store storage.Store, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	rep := ImportReport{DryRun: opts.DryRun, Errors: []ImportRowError{}}
+	t, err := readImportHeader(r, menuItemImportColumns, []string{"name", "price", "duration_minutes"})
+	if err != nil {
+		return rep, err
+	}
+	categories, err := categorySlugs(ctx, store)
+	if err != nil {
+		return rep, err
+	}
+	services, err := allServiceItems(ctx, store)
+	if err != nil {
+		return rep, err
+	}
+	existing, err := allMenuItems(ctx, store)
+	if err != nil {
+		return rep, err
+	}
+	servicesByID := make(map[int64]*models.ServiceItem, len(services))
+	for _, svc := range services {
+		servicesByID[svc.ID] = svc
+	}
+	byID := make(map[int64]*models.MenuItem, len(existing))
+	byKey := make(map[string][]*models.MenuItem)
+	for _, it := range existing {
+		byID[it.ID] = it
+		byKey[menuItemKey(it)] = append(byKey[menuItemKey(it)], it)
+	}
+
+	var items []*models.MenuItem
+	seen := make(map[string]int)
+	for {
+		row, err := t.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rep, err
+		}
+		rep.Rows++
+		if row.invalid != "" {
+			rep.reject(row.line, "", "%s", row.invalid)
+			continue
+		}
+		curr, ok := rowID(&rep, row, byID, "menu item")
+		if !ok {
+			continue
+		}
+		it := &models.MenuItem{}
+		if curr != nil {
+			*it = *curr
+		}
+		valid := len(rep.Errors)
+
+		it.Name, _ = row.get("name")
+		if it.Name == "" {
+			rep.reject(row.line, "name", "name is required")
+		}
+		if raw, ok := row.get("service"); ok {
+			it.ServiceItemID = nil
+			if raw != "" {
+				if svc := findService(&rep, row, services, servicesByID, raw); svc != nil {
+					it.ServiceItemID = &svc.ID
+				}
+			}
+		}
+		if raw, ok := row.get("category"); ok {
+			it.Category = strings.ToLower(raw)
+		}
+		if it.Category == "" && it.ServiceItemID != nil {
+			it.Category = servicesByID[*it.ServiceItemID].Service
+		}
+		switch {
+		case it.Category == "":
+			rep.reject(row.line, "category", "category is required for menu items that aren't a service's variant")
+		case !slices.Contains(categories, it.Category):
+			rep.reject(row.line, "category", "unknown category %q; use one of: %s", it.Category, strings.Join(categories, ", "))
+		}
+
+		// A row without an id updates the item it names, if there is one.
+		if curr == nil && len(rep.Errors) == valid {
+			switch matches := byKey[menuItemKey(it)]; len(matches) {
+			case 0:
+			case 1:
+				curr = matches[0]
+				it.ID, it.Currency = curr.ID, curr.Currency
+			default:
+				rep.reject(row.line, "name", "%d menu items are called %q here; add an id column to say which", len(matches), it.Name)
+			}
+		}
+		if raw, _ := row.get("currency"); raw != "" {
+			it.Currency = strings.ToUpper(raw)
+		}
+		if it.Currency == "" {
+			it.Currency = opts.Currency.Code
+		}
+		currency, err := money.ParseCurrency(it.Currency)
+		if err != nil {
+			rep.reject(row.line, "currency", "unknown currency %q; use an ISO 4217 code such as %s", it.Currency, opts.Currency)
+		} else {
+			raw, _ := row.get("price")
+			if it.PriceCents, err = parsePrice(currency, raw); err != nil {
+				rep.reject(row.line, "price", "%v", err)
+			}
+		}
+		raw, _ := row.get("duration_minutes")
+		if it.DurationMinutes, err = strconv.Atoi(raw); err != nil || it.DurationMinutes <= 0 || it.DurationMinutes > 24*60 {
+			rep.reject(row.line, "duration_minutes", "duration_minutes must be a whole number between 1 and 1440")
+		}
+		if len(rep.Errors) > valid {
+			continue
+		}
+
+		// A service can't have two variants with the same name.
+		if it.ServiceItemID != nil {
+			for _, other := range byKey[menuItemKey(it)] {
+				if other.ID != it.ID {
+					rep.reject(row.line, "name", "the service already has a variant called %q", other.Name)
+				}
+			}
+		}
+		for _, key := range []string{menuItemKey(it), fmt.Sprintf("#%d", it.ID)} {
+			if key == "#0" {
+				continue
+			}
+			if line, ok := seen[key]; ok {
+				rep.reject(row.line, "", "is the same menu item as line %d", line)
+				break
+			}
+			seen[key] = row.line
+		}
+		if len(rep.Errors) > valid {
+			continue
+		}
+		items = append(items, it)
+		if it.ID == 0 {
+			rep.Created++
+		} else {
+			rep.Updated++
+		}
+	}
+
+	if len(rep.Errors) > 0 {
+		rep.Created, rep.Updated = 0, 0
+		return rep, nil
+	}
+	if opts.DryRun || len(items) == 0 {
+		return rep, nil
+	}
+	return rep, store.ImportMenuItems(ctx, items)
+}
+
+// menuItemKey identifies a menu item by name among its service's variants,
+// or among the items of its category that aren't variants.
+func menuItemKey(it *models.MenuItem) string {
+	if it.ServiceItemID != nil {
+		return fmt.Sprintf("service %d/%s", *it.ServiceItemID, strings.ToLower(it.Name))
+	}
+	return "category " + it.Category + "/" + strings.ToLower(it.Name)
+}
+
+// findService looks a service up by its ID or its name, rejecting the row if
+// there is no such service or more than one has the name.
+func findService(rep *ImportReport, row importRow, services []*models.ServiceItem, byID map[int64]*models.ServiceItem, raw string) *models.ServiceItem {
+	if id, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		if svc, ok := byID[id]; ok {
+			return svc
+		}
+		rep.reject(row.line, "service", "no service has id %d", id)
+		return nil
+	}
+	var found []*models.ServiceItem
+	for _, svc := range services {
+		if strings.EqualFold(svc.Name, raw) {
+			found = append(found, svc)
+		}
+	}
+	switch len(found) {
+	case 0:
+		rep.reject(row.line, "service", "no service is called %q", raw)
+	case 1:
+		return found[0]
+	default:
+		rep.reject(row.line, "service", "%d services are called %q; use the id of the one you mean", len(found), raw)
+	}
+	return nil
+}
+
+// parsePrice reads a non-negative decimal price in cur, with no more
+// decimal places than cur has.
+func parsePrice(cur money.Currency, raw string) (int64, error) {
+	if raw == "" {
+		return 0, errors.New("price is required")
+	}
+	if _, frac, _ := strings.Cut(raw, "."); len(frac) > cur.MinorUnits {
+		if cur.MinorUnits == 0 {
+			return 0, fmt.Errorf("%s prices have no decimal places", cur)
+		}
+		return 0, fmt.Errorf("%s prices have at most %d decimal places", cur, cur.MinorUnits)
+	}
+	minor, err := cur.ParseDecimal(raw)
+	if err != nil || minor < 0 {
+		return 0, fmt.Errorf("invalid price %q; use a number such as %s", raw, cur.Decimal(150000))
+	}
+	return minor, nil
+}
+
+var serviceItemImportColumns = []string{"id", "category", "name", "descriptions", "deposit_percent"}
+
+// ImportServiceItems reads services from CSV with a header row naming some
+// of the columns id, category, name, descriptions and deposit_percent, and
+// creates or updates them all at once.
+//
+// A row updates the service with its id, or else the one with its name in
+// its category; otherwise it creates a service. Descriptions are separated
+// by "|". Columns the file leaves out keep their current values, and
+// images are never changed.
+func ImportServiceItems(ctx context.Context, store storage.Store, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	rep := ImportReport{DryRun: opts.DryRun, Errors: []ImportRowError{}}
+	t, err := readImportHeader(r, serviceItemImportColumns, []string{"name"})
+	if err != nil {
+		return rep, err
+	}
+	categories, err := categorySlugs(ctx, store)
+	if err != nil {
+		return rep, err
+	}
+	existing, err := allServiceItems(ctx, store)
+	if err != nil {
+		return rep, err
+	}
+	byID := make(map[int64]*models.ServiceItem, len(existing))
+	byKey := make(map[string][]*models.ServiceItem)
+	for _, svc := range existing {
+		byID[svc.ID] = svc
+		byKey[serviceItemKey(svc)] = append(byKey[serviceItemKey(svc)], svc)
+	}
+
+	var items []*models.ServiceItem
+	seen := make(map[string]int)
+	for {
+		row, err := t.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return rep, err
+		}
+		rep.Rows++
+		if row.invalid != "" {
+			rep.reject(row.line, "", "%s", row.invalid)
+			continue
+		}
+		curr, ok := rowID(&rep, row, byID, "service")
+		if !ok {
+			continue
+		}
+		svc := &models.ServiceItem{Descriptions: []string{}}
+		if curr != nil {
+			*svc = *curr
+		}
+		valid := len(rep.Errors)
+
+		svc.Name, _ = row.get("name")
+		if svc.Name == "" {
+			rep.reject(row.line, "name", "name is required")
+		}
+		if raw, ok := row.get("category"); ok {
+			svc.Service = strings.ToLower(raw)
+		}
+		switch {
+		case svc.Service == "":
+			rep.reject(row.line, "category", "category is required")
+		case !slices.Contains(categories, svc.Service):
+			rep.reject(row.line, "category", "unknown category %q; use one of: %s", svc.Service, strings.Join(categories, ", "))
+		}
+		if raw, ok := row.get("descriptions"); ok {
+			svc.Descriptions = []string{}
+			for _, d := range strings.Split(raw, "|") {
+				if d = strings.TrimSpace(d); d != "" {
+					svc.Descriptions = append(svc.Descriptions, d)
+				}
+			}
+		}
+		if raw, ok := row.get("deposit_percent"); ok {
+			svc.DepositPercent = 0
+			if raw != "" {
+				if svc.DepositPercent, err = strconv.Atoi(strings.TrimSuffix(raw, "%")); err != nil || svc.DepositPercent < 0 || svc.DepositPercent > 100 {
+					rep.reject(row.line, "deposit_percent", "deposit_percent must be a whole number between 0 and 100")
+				}
+			}
+		}
+		if len(rep.Errors) > valid {
+			continue
+		}
+
+		if curr == nil {
+			switch matches := byKey[serviceItemKey(svc)]; len(matches) {
+			case 0:
+			case 1:
+				keep := *matches[0]
+				keep.Name, keep.Service = svc.Name, svc.Service
+				if _, ok := row.get("descriptions"); ok {
+					keep.Descriptions = svc.Descriptions
+				}
+				if _, ok := row.get("deposit_percent"); ok {
+					keep.DepositPercent = svc.DepositPercent
+				}
+				svc = &keep
+			default:
+				rep.reject(row.line, "name", "%d services are called %q in %s; add an id column to say which", len(matches), svc.Name, svc.Service)
+				continue
+			}
+		}
+		for _, key := range []string{serviceItemKey(svc), fmt.Sprintf("#%d", svc.ID)} {
+			if key == "#0" {
+				continue
+			}
+			if line, ok := seen[key]; ok {
+				rep.reject(row.line, "", "is the same service as line %d", line)
+				break
+			}
+			seen[key] = row.line
+		}
+		if len(rep.Errors) > valid {
+			continue
+		}
+		items = append(items, svc)
+		if svc.ID == 0 {
+			rep.Created++
+		} else {
+			rep.Updated++
+		}
+	}
+
+	if len(rep.Errors) > 0 {
+		rep.Created, rep.Updated = 0, 0
+		return rep, nil
+	}
+	if opts.DryRun || len(items) == 0 {
+		return rep, nil
+	}
+	return rep, store.ImportServiceItems(ctx, items)
+}
+
+// serviceItemKey identifies a service by name within its category.
+func serviceItemKey(svc *models.ServiceItem) string {
+	return svc.Service + "/" + strings.ToLower(svc.Name)
+}
+
+// categorySlugs lists the slugs of every category.
+func categorySlugs(ctx context.Context, store storage.Store) ([]string, error) {
+	cats, err := store.ListCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slugs := make([]string, len(cats))
+	for i, cat := range cats {
+		slugs[i] = cat.Slug
+	}
+	return slugs, nil
+}
+
+// allServiceItems lists every live service, a page at a time.
+func allServiceItems(ctx context.Context, store storage.Store) ([]*models.ServiceItem, error) {
+	var all []*models.ServiceItem
+	for {
+		list, total, err := store.ListServiceItems(ctx, "", 0, "", len(all), 100)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, list...)
+		if len(list) == 0 || len(all) >= total {
+			return all, nil
+		}
+	}
+}
+
+// allMenuItems lists every live menu item, a page at a time.
+func allMenuItems(ctx context.Context, store storage.Store) ([]*models.MenuItem, error) {
+	var all []*models.MenuItem
+	for {
+		list, total, err := store.ListMenuItems(ctx, "", "", len(all), 100)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, list...)
+		if len(list) == 0 || len(all) >= total {
+			return all, nil
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
+	"lucys-beauty-parlour-backend/storage"
+)
+
+// newCatalogStore returns a store with the service "Knotless Braids" (id 1)
+// in hair, its variant "Medium" (id 1) at UGX 150,000, and the nails menu
+// item "Manicure" (id 2) at USD 25.00.
+func newCatalogStore(t *testing.T) storage.Store {
+	t.Helper()
+	ctx := context.Background()
+	s := storage.NewInMemoryStore()
+	svc, err := s.CreateServiceItem(ctx, &models.ServiceItem{Service: "hair", Name: "Knotless Braids", Descriptions: []string{"Medium"}})
+	if err != nil {
+		t.Fatalf("CreateServiceItem: %v", err)
+	}
+	for _, it := range []*models.MenuItem{
+		{Category: "hair", Name: "Medium", ServiceItemID: &svc.ID, Currency: "UGX", PriceCents: 150000, DurationMinutes: 240},
+		{Category: "nails", Name: "Manicure", Currency: "USD", PriceCents: 2500, DurationMinutes: 45},
+	} {
+		if _, err := s.CreateMenuItem(ctx, it); err != nil {
+			t.Fatalf("CreateMenuItem: %v", err)
+		}
+	}
+	return s
+}
+
+var ugxOptions = ImportOptions{Currency: money.Currency{Code: "UGX", MinorUnits: 0}}
+
+// rowErrors lists each error as "line:column".
+func rowErrors(rep ImportReport) []string {
+	out := make([]string, len(rep.Errors))
+	for i, e := range rep.Errors {
+		out[i] = fmt.Sprintf("%d:%s", e.Line, e.Column)
+	}
+	return out
+}
+
+func TestImportMenuItems(t *testing.T) {
+	cases := []struct {
+		name    string
+		csv     string
+		dryRun  bool
+		wantErr error
+		// rows, created and updated are the report's counts.
+		rows, created, updated int
+		// errors are the rejected rows, as "line:column".
+		errors []string
+	}{
+		{
+			name: "byte order mark and spaced header",
+			csv:  "\ufeffName,Category,Price,Duration Minutes\nPedicure,nails,30000,60\n",
+			rows: 1, created: 1,
+		},
+		{
+			name: "updates by id and by name",
+			csv:  "id,name,service,category,price,duration_minutes\n1,Medium,1,,160000,240\n,Manicure,,nails,27.50,45\n",
+			rows: 2, updated: 2,
+		},
+		{
+			name: "service by name",
+			csv:  "name,service,price,duration_minutes\nLong,knotless braids,200000,300\n",
+			rows: 1, created: 1,
+		},
+		{
+			name: "blank lines are skipped",
+			csv:  "name,category,price,duration_minutes\n\nPedicure,nails,30000,60\n,,,\n",
+			rows: 1, created: 1,
+		},
+		{name: "empty file", csv: "", wantErr: ErrInvalidImportFile},
+		{name: "unknown column", csv: "name,category,price,duration_minutes,colour\n", wantErr: ErrInvalidImportFile},
+		{name: "duplicate column", csv: "name,price,Price,duration_minutes\n", wantErr: ErrInvalidImportFile},
+		{name: "missing column", csv: "name,category,price\nPedicure,nails,30000\n", wantErr: ErrInvalidImportFile},
+		{name: "unbalanced quotes", csv: "name,category,price,duration_minutes\n\"Pedicure,nails,30000,60\n", wantErr: ErrInvalidImportFile},
+		{
+			name:   "wrong field count",
+			csv:    "name,category,price,duration_minutes\nPedicure,nails,30000\nGel,nails,40000,60,extra\n",
+			rows:   2,
+			errors: []string{"2:", "3:"},
+		},
+		{
+			name:   "decimals in a zero-decimal currency",
+			csv:    "name,category,currency,price,duration_minutes\nPedicure,nails,UGX,30000.50,60\n",
+			rows:   1,
+			errors: []string{"2:price"},
+		},
+		{
+			name:   "too many decimals",
+			csv:    "name,category,currency,price,duration_minutes\nPedicure,nails,USD,30.505,60\n",
+			rows:   1,
+			errors: []string{"2:price"},
+		},
+		{
+			name:   "negative, missing and garbled prices",
+			csv:    "name,category,price,duration_minutes\nA,nails,-5,60\nB,nails,,60\nC,nails,abc,60\n",
+			rows:   3,
+			errors: []string{"2:price", "3:price", "4:price"},
+		},
+		{
+			name:   "unknown currency",
+			csv:    "name,category,currency,price,duration_minutes\nPedicure,nails,XYZ,30000,60\n",
+			rows:   1,
+			errors: []string{"2:currency"},
+		},
+		{
+			name:   "bad durations",
+			csv:    "name,category,price,duration_minutes\nA,nails,1,0\nB,nails,1,1441\nC,nails,1,1.5\n",
+			rows:   3,
+			errors: []string{"2:duration_minutes", "3:duration_minutes", "4:duration_minutes"},
+		},
+		{
+			name:   "unknown id",
+			csv:    "id,name,category,price,duration_minutes\n99,Pedicure,nails,30000,60\nx,Gel,nails,30000,60\n",
+			rows:   2,
+			errors: []string{"2:id", "3:id"},
+		},
+		{
+			name:   "unknown service",
+			csv:    "name,service,category,price,duration_minutes\nLong,Box Braids,hair,200000,300\nShort,42,hair,100000,120\n",
+			rows:   2,
+			errors: []string{"2:service", "3:service"},
+		},
+		{
+			name:   "unknown or missing category",
+			csv:    "name,category,price,duration_minutes\nPedicure,feet,30000,60\nGel,,30000,60\n",
+			rows:   2,
+			errors: []string{"2:category", "3:category"},
+		},
+		{
+			name:   "same item twice",
+			csv:    "name,category,price,duration_minutes\nPedicure,nails,30000,60\npedicure,nails,35000,60\n",
+			rows:   2,
+			errors: []string{"3:"},
+		},
+		{
+			name:   "dry run counts",
+			csv:    "name,category,price,duration_minutes\nPedicure,nails,30000,60\nManicure,nails,26.00,45\n",
+			dryRun: true,
+			rows:   2, created: 1, updated: 1,
+		},
+		{
+			name:   "a bad row cancels the counts",
+			csv:    "name,category,price,duration_minutes\nPedicure,nails,30000,60\nManicure,nails,26.00,45\nGel,nails,oops,60\n",
+			rows:   3,
+			errors: []string{"4:price"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ugxOptions
+			opts.DryRun = tc.dryRun
+			rep, err := ImportMenuItems(context.Background(), newCatalogStore(t), strings.NewReader(tc.csv), opts)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("got %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportMenuItems: %v", err)
+			}
+			if rep.Rows != tc.rows || rep.Created != tc.created || rep.Updated != tc.updated || rep.DryRun != tc.dryRun {
+				t.Errorf("report = %d rows, %d created, %d updated, dry run %v; want %d, %d, %d, %v",
+					rep.Rows, rep.Created, rep.Updated, rep.DryRun, tc.rows, tc.created, tc.updated, tc.dryRun)
+			}
+			if got := rowErrors(rep); !slices.Equal(got, tc.errors) {
+				t.Errorf("errors = %v (%+v); want %v", got, rep.Errors, tc.errors)
+			}
+		})
+	}
+}
+
+func TestImportMenuItemsWrites(t *testing.T) {
+	ctx := context.Background()
+	s := newCatalogStore(t)
+	csv := "id,name,service,category,currency,price,duration_minutes\n" +
+		"1,Medium,Knotless Braids,,,160000,240\n" +
+		",Manicure,,nails,,27.50,50\n" +
+		",Pedicure,,nails,,30000,60\n"
+	if _, err := ImportMenuItems(ctx, s, strings.NewReader(csv), ugxOptions); err != nil {
+		t.Fatalf("ImportMenuItems: %v", err)
+	}
+	items, err := allMenuItems(ctx, s)
+	if err != nil {
+		t.Fatalf("list menu items: %v", err)
+	}
+	got := make(map[string]models.MenuItem, len(items))
+	for _, it := range items {
+		got[it.Name] = *it
+	}
+	if len(got) != 3 {
+		t.Fatalf("menu items = %v; want Medium, Manicure and Pedicure", got)
+	}
+	// An empty category is the service's, and an empty currency keeps the
+	// item's own, or is the shop's for a new item.
+	if m := got["Medium"]; m.PriceCents != 160000 || m.Category != "hair" || m.Currency != "UGX" {
+		t.Errorf("Medium = %+v", m)
+	}
+	if m := got["Manicure"]; m.ID != 2 || m.PriceCents != 2750 || m.Currency != "USD" || m.DurationMinutes != 50 {
+		t.Errorf("Manicure = %+v", m)
+	}
+	if m := got["Pedicure"]; m.PriceCents != 30000 || m.Currency != "UGX" || m.Category != "nails" {
+		t.Errorf("Pedicure = %+v", m)
+	}
+}
+
+func TestImportMenuItemsWritesNothing(t *testing.T) {
+	cases := []struct {
+		name   string
+		csv    string
+		dryRun bool
+	}{
+		{"dry run", "name,category,price,duration_minutes\nPedicure,nails,30000,60\nManicure,nails,26.00,45\n", true},
+		{"a bad row", "name,category,price,duration_minutes\nPedicure,nails,30000,60\nManicure,nails,26.00,45\nGel,nails,30000,0\n", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newCatalogStore(t)
+			before, _ := allMenuItems(ctx, s)
+			opts := ugxOptions
+			opts.DryRun = tc.dryRun
+			if _, err := ImportMenuItems(ctx, s, strings.NewReader(tc.csv), opts); err != nil {
+				t.Fatalf("ImportMenuItems: %v", err)
+			}
+			after, _ := allMenuItems(ctx, s)
+			if len(after) != len(before) {
+				t.Fatalf("%d menu items after the import, want %d", len(after), len(before))
+			}
+			for i := range after {
+				if a, b := *after[i], *before[i]; a.Name != b.Name || a.Category != b.Category || a.Currency != b.Currency ||
+					a.PriceCents != b.PriceCents || a.DurationMinutes != b.DurationMinutes {
+					t.Errorf("menu item changed to %+v from %+v", a, b)
+				}
+			}
+		})
+	}
+}
+
+func TestImportServiceItems(t *testing.T) {
+	cases := []struct {
+		name                   string
+		csv                    string
+		dryRun                 bool
+		wantErr                error
+		rows, created, updated int
+		errors                 []string
+	}{
+		{
+			name: "creates and updates by name",
+			csv:  "\ufeffcategory,name,descriptions,deposit_percent\nhair,Knotless Braids,Medium | Long,30%\nnails,Gel,,\n",
+			rows: 2, created: 1, updated: 1,
+		},
+		{name: "unknown column", csv: "category,name,image\n", wantErr: ErrInvalidImportFile},
+		{name: "missing name column", csv: "category,descriptions\nhair,Long\n", wantErr: ErrInvalidImportFile},
+		{
+			name:   "wrong field count",
+			csv:    "category,name\nhair\nnails,Gel\n",
+			rows:   2,
+			errors: []string{"2:"},
+		},
+		{
+			name:   "bad deposit",
+			csv:    "category,name,deposit_percent\nhair,Cornrows,101\nhair,Twists,ten\n",
+			rows:   2,
+			errors: []string{"2:deposit_percent", "3:deposit_percent"},
+		},
+		{
+			name:   "unknown id and category",
+			csv:    "id,category,name\n9,hair,Cornrows\n,feet,Massage\n",
+			rows:   2,
+			errors: []string{"2:id", "3:category"},
+		},
+		{
+			name:   "same service twice",
+			csv:    "id,category,name\n1,hair,Knotless\n,hair,knotless\n",
+			rows:   2,
+			errors: []string{"3:"},
+		},
+		{
+			name:   "dry run counts",
+			csv:    "category,name\nhair,Knotless Braids\nhair,Cornrows\n",
+			dryRun: true,
+			rows:   2, created: 1, updated: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newCatalogStore(t)
+			before, _ := allServiceItems(ctx, s)
+			rep, err := ImportServiceItems(ctx, s, strings.NewReader(tc.csv), ImportOptions{DryRun: tc.dryRun})
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("got %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ImportServiceItems: %v", err)
+			}
+			if rep.Rows != tc.rows || rep.Created != tc.created || rep.Updated != tc.updated {
+				t.Errorf("report = %d rows, %d created, %d updated; want %d, %d, %d",
+					rep.Rows, rep.Created, rep.Updated, tc.rows, tc.created, tc.updated)
+			}
+			if got := rowErrors(rep); !slices.Equal(got, tc.errors) {
+				t.Errorf("errors = %v (%+v); want %v", got, rep.Errors, tc.errors)
+			}
+			// Only a clean, real import writes.
+			after, _ := allServiceItems(ctx, s)
+			if wrote := len(after) != len(before); wrote != (len(tc.errors) == 0 && !tc.dryRun && tc.created > 0) {
+				t.Errorf("%d services after the import, %d before", len(after), len(before))
+			}
+		})
+	}
+}
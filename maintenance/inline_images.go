@@ -0,0 +1,179 @@
+// Package maintenance holds one-off and periodic data maintenance jobs that
+// are run from the command line, and bulk imports also offered to admins
+// through the API.
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"lucys-beauty-parlour-backend/utils"
+)
+
+// InlineImageOptions configures MigrateInlineImages.
+type InlineImageOptions struct {
+	// DryRun decodes and validates every inline image without writing blobs
+	// or rows, so the report shows what a real run would do.
+	DryRun bool
+	// BatchSize is how many rows are read per query (default 50).
+	BatchSize int
+	// Out receives one progress line per row; nil discards them.
+	Out io.Writer
+}
+
+// InlineImageReport summarises a MigrateInlineImages run.
+type InlineImageReport struct {
+	RowsScanned    int
+	RowsUpdated    int
+	RowsSkipped    int // edited concurrently; picked up by the next run
+	ImagesMigrated int
+	ImagesFailed   int
+	BytesBefore    int64 // size of the images JSON of the rows touched
+	BytesAfter     int64
+}
+
+// BytesReclaimed is how much smaller the images column of the touched rows got.
+func (r InlineImageReport) BytesReclaimed() int64 {
+	return r.BytesBefore - r.BytesAfter
+}
+
+// MigrateInlineImages moves data:image/... URIs stored in portfolio_items
+// into the image store and rewrites each row to reference the stored URLs.
+//
+// Each row is rewritten on its own and only if nobody changed it meanwhile,
+// so the job can be interrupted and run again: migrated rows no longer match
+// and images are content-addressed, so re-saving one is harmless. Images that
+// fail to decode are left inline and counted in ImagesFailed. Trashed rows are
+// migrated too, since they may still be restored.
+func MigrateInlineImages(ctx context.Context, db *sql.DB, images *utils.ImageStore, opts InlineImageOptions) (InlineImageReport, error) {
+	var rep InlineImageReport
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 50
+	}
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+
+	var lastID int64
+	for {
+		rows, err := loadInlineImageRows(ctx, db, lastID, opts.BatchSize)
+		if err != nil {
+			return rep, err
+		}
+		if len(rows) == 0 {
+			return rep, nil
+		}
+		for _, row := range rows {
+			lastID = row.id
+			if err := migrateInlineImageRow(ctx, db, images, row, opts, &rep); err != nil {
+				return rep, err
+			}
+		}
+	}
+}
+
+type inlineImageRow struct {
+	id  int64
+	raw []byte
+}
+
+func loadInlineImageRows(ctx context.Context, db *sql.DB, afterID int64, limit int) ([]inlineImageRow, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, images
+		FROM portfolio_items
+		WHERE id > $1 AND images::text ILIKE '%"data:image/%'
+		ORDER BY id
+		LIMIT $2
+	`, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("load portfolio items: %w", err)
+	}
+	defer rows.Close()
+
+	out := make([]inlineImageRow, 0, limit)
+	for rows.Next() {
+		var r inlineImageRow
+		if err := rows.Scan(&r.id, &r.raw); err != nil {
+			return nil, fmt.Errorf("scan portfolio item: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load portfolio items: %w", err)
+	}
+	return out, nil
+}
+
+func migrateInlineImageRow(ctx context.Context, db *sql.DB, images *utils.ImageStore, row inlineImageRow, opts InlineImageOptions, rep *InlineImageReport) error {
+	rep.RowsScanned++
+	var refs []string
+	if err := json.Unmarshal(row.raw, &refs); err != nil {
+		fmt.Fprintf(opts.Out, "portfolio item %d: unreadable images column: %v\n", row.id, err)
+		rep.ImagesFailed++
+		return nil
+	}
+
+	migrated, failed := 0, 0
+	for i, ref := range refs {
+		if !utils.IsDataURI(ref) {
+			continue
+		}
+		var (
+			url string
+			err error
+		)
+		if opts.DryRun {
+			var data []byte
+			if data, err = utils.ParseBase64Image(ref); err == nil {
+				url, err = images.URLFor(data)
+			}
+		} else {
+			url, err = images.SaveBase64(ctx, ref)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fmt.Fprintf(opts.Out, "portfolio item %d: image %d left inline: %v\n", row.id, i, err)
+			failed++
+			continue
+		}
+		refs[i] = url
+		migrated++
+	}
+	rep.ImagesFailed += failed
+	if migrated == 0 {
+		return nil
+	}
+
+	updated, err := json.Marshal(refs)
+	if err != nil {
+		return fmt.Errorf("portfolio item %d: %w", row.id, err)
+	}
+	if !opts.DryRun {
+		res, err := db.ExecContext(ctx, `
+			UPDATE portfolio_items SET images = $1::jsonb
+			WHERE id = $2 AND images = $3::jsonb
+		`, string(updated), row.id, string(row.raw))
+		if err != nil {
+			return fmt.Errorf("update portfolio item %d: %w", row.id, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("update portfolio item %d: %w", row.id, err)
+		} else if n == 0 {
+			fmt.Fprintf(opts.Out, "portfolio item %d: changed during migration, skipped\n", row.id)
+			rep.RowsSkipped++
+			return nil
+		}
+	}
+
+	rep.RowsUpdated++
+	rep.ImagesMigrated += migrated
+	rep.BytesBefore += int64(len(row.raw))
+	rep.BytesAfter += int64(len(updated))
+	fmt.Fprintf(opts.Out, "portfolio item %d: %d image(s) moved, %d -> %d bytes\n", row.id, migrated, len(row.raw), len(updated))
+	return nil
+}
@@ -0,0 +1,275 @@
+package maintenance
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"lucys-beauty-parlour-backend/blobstore"
+	"lucys-beauty-parlour-backend/database"
+	"lucys-beauty-parlour-backend/utils"
+
+	_ "github.com/lib/pq"
+)
+
+// testSchema keeps these tests' tables apart from the storage package's, so
+// both can run against the same TEST_DATABASE_URL at once.
+const testSchema = "maintenance_test"
+
+// openTestDB connects to the database named by TEST_DATABASE_URL, in its own
+// schema, and applies all migrations, skipping the test when no database is
+// configured. See storage/postgres_test.go.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set; skipping Postgres tests")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	defer admin.Close()
+	if _, err := admin.Exec(`CREATE SCHEMA IF NOT EXISTS ` + testSchema); err != nil {
+		t.Fatalf("create test schema: %v", err)
+	}
+
+	searchPath := testSchema + ",public"
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", searchPath)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + searchPath
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	if _, err := db.Exec(`TRUNCATE portfolio_items, categories RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatalf("reset test database: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO categories (slug, name, sort_order) VALUES ('hair', 'Hair', 0)`); err != nil {
+		t.Fatalf("seed categories: %v", err)
+	}
+	return db
+}
+
+// pngDataURI returns a data URI holding a small PNG filled with c.
+func pngDataURI(t *testing.T, c color.Color) (uri string, data []byte) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode PNG: %v", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), buf.Bytes()
+}
+
+// notAnImage is a data URI whose payload does not decode as an image.
+var notAnImage = "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("not an image"))
+
+func insertPortfolioItem(t *testing.T, db *sql.DB, refs ...string) int64 {
+	t.Helper()
+	raw, err := json.Marshal(refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	err = db.QueryRow(`
+		INSERT INTO portfolio_items (category, style, images, description)
+		VALUES ('hair', 'Braids', $1::jsonb, '')
+		RETURNING id
+	`, string(raw)).Scan(&id)
+	if err != nil {
+		t.Fatalf("insert portfolio item: %v", err)
+	}
+	return id
+}
+
+// portfolioImages returns the images column of item id as stored and decoded.
+func portfolioImages(t *testing.T, db *sql.DB, id int64) (raw string, refs []string) {
+	t.Helper()
+	if err := db.QueryRow(`SELECT images FROM portfolio_items WHERE id = $1`, id).Scan(&raw); err != nil {
+		t.Fatalf("load portfolio item %d: %v", id, err)
+	}
+	if err := json.Unmarshal([]byte(raw), &refs); err != nil {
+		t.Fatalf("portfolio item %d: %v", id, err)
+	}
+	return raw, refs
+}
+
+func newInlineImageStore(t *testing.T) (*utils.ImageStore, *blobstore.Local) {
+	t.Helper()
+	blobs, err := blobstore.NewLocal(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	return utils.NewImageStore(blobs, utils.ImageConfig{}), blobs
+}
+
+func mustURLFor(t *testing.T, images *utils.ImageStore, data []byte) string {
+	t.Helper()
+	u, err := images.URLFor(data)
+	if err != nil {
+		t.Fatalf("URLFor: %v", err)
+	}
+	return u
+}
+
+func TestMigrateInlineImagesDryRun(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	images, blobs := newInlineImageStore(t)
+	red, redData := pngDataURI(t, color.RGBA{R: 255, A: 255})
+	id := insertPortfolioItem(t, db, red, "https://cdn.example.com/a.jpg")
+	insertPortfolioItem(t, db, "https://cdn.example.com/b.jpg")
+	before, _ := portfolioImages(t, db, id)
+
+	rep, err := MigrateInlineImages(ctx, db, images, InlineImageOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("MigrateInlineImages: %v", err)
+	}
+	after, _ := json.Marshal([]string{mustURLFor(t, images, redData), "https://cdn.example.com/a.jpg"})
+	want := InlineImageReport{
+		RowsScanned: 1, RowsUpdated: 1, ImagesMigrated: 1,
+		BytesBefore: int64(len(before)), BytesAfter: int64(len(after)),
+	}
+	if rep != want {
+		t.Fatalf("report = %+v, want %+v", rep, want)
+	}
+	if rep.BytesReclaimed() <= 0 {
+		t.Fatalf("BytesReclaimed = %d, want the data URI's size saved", rep.BytesReclaimed())
+	}
+
+	// Nothing was written.
+	if got, _ := portfolioImages(t, db, id); got != before {
+		t.Fatalf("images after a dry run = %s, want %s", got, before)
+	}
+	if written, _ := filepath.Glob(filepath.Join(blobs.Dir(), "*")); len(written) != 0 {
+		t.Fatalf("dry run wrote %q", written)
+	}
+}
+
+func TestMigrateInlineImagesMixedRows(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	images, blobs := newInlineImageStore(t)
+	red, redData := pngDataURI(t, color.RGBA{R: 255, A: 255})
+	blue, blueData := pngDataURI(t, color.RGBA{B: 255, A: 255})
+	mixed := insertPortfolioItem(t, db, red, "https://cdn.example.com/a.jpg", blue, "/uploads/legacy.jpg")
+	broken := insertPortfolioItem(t, db, "/uploads/kept.jpg", notAnImage)
+	_, brokenRefs := portfolioImages(t, db, broken)
+
+	var out strings.Builder
+	rep, err := MigrateInlineImages(ctx, db, images, InlineImageOptions{Out: &out})
+	if err != nil {
+		t.Fatalf("MigrateInlineImages: %v", err)
+	}
+	if rep.RowsScanned != 2 || rep.RowsUpdated != 1 || rep.ImagesMigrated != 2 || rep.ImagesFailed != 1 || rep.RowsSkipped != 0 {
+		t.Fatalf("report = %+v", rep)
+	}
+
+	// URLs are kept in place around the migrated images.
+	redURL, blueURL := mustURLFor(t, images, redData), mustURLFor(t, images, blueData)
+	if _, refs := portfolioImages(t, db, mixed); !slices.Equal(refs, []string{redURL, "https://cdn.example.com/a.jpg", blueURL, "/uploads/legacy.jpg"}) {
+		t.Fatalf("migrated images = %q", refs)
+	}
+	for _, u := range []string{redURL, blueURL} {
+		key, ok := blobs.Key(u)
+		if !ok {
+			t.Fatalf("Key(%q) failed", u)
+		}
+		if found, err := blobs.Exists(ctx, key); err != nil || !found {
+			t.Fatalf("blob %s stored = %v, %v", key, found, err)
+		}
+	}
+	// An image that does not decode is left inline.
+	if _, refs := portfolioImages(t, db, broken); !slices.Equal(refs, brokenRefs) {
+		t.Fatalf("broken row = %q, want it unchanged", refs)
+	}
+	if !strings.Contains(out.String(), "image 1 left inline") {
+		t.Fatalf("progress = %q, want the broken image reported", out.String())
+	}
+
+	// Running again finds only the row still holding a data URI.
+	rep, err = MigrateInlineImages(ctx, db, images, InlineImageOptions{})
+	if err != nil {
+		t.Fatalf("MigrateInlineImages again: %v", err)
+	}
+	if rep != (InlineImageReport{RowsScanned: 1, ImagesFailed: 1}) {
+		t.Fatalf("second report = %+v", rep)
+	}
+}
+
+// cancelOnWrite cancels a run once it reports its first row.
+type cancelOnWrite struct{ cancel context.CancelFunc }
+
+func (w cancelOnWrite) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+func TestMigrateInlineImagesResumes(t *testing.T) {
+	db := openTestDB(t)
+	images, _ := newInlineImageStore(t)
+	red, redData := pngDataURI(t, color.RGBA{R: 255, A: 255})
+	blue, blueData := pngDataURI(t, color.RGBA{B: 255, A: 255})
+	first := insertPortfolioItem(t, db, red)
+	broken := insertPortfolioItem(t, db, notAnImage)
+	last := insertPortfolioItem(t, db, blue)
+
+	// The first run is interrupted after one row.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rep, err := MigrateInlineImages(ctx, db, images, InlineImageOptions{BatchSize: 1, Out: cancelOnWrite{cancel}})
+	if err == nil {
+		t.Fatal("interrupted run returned no error")
+	}
+	if rep.RowsUpdated != 1 || rep.ImagesMigrated != 1 {
+		t.Fatalf("interrupted report = %+v", rep)
+	}
+	if _, refs := portfolioImages(t, db, last); refs[0] != blue {
+		t.Fatalf("last row migrated before the interruption: %q", refs)
+	}
+
+	// The next run picks up where it stopped, and moves past the row whose
+	// image stays inline instead of reading it again.
+	rep, err = MigrateInlineImages(context.Background(), db, images, InlineImageOptions{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("MigrateInlineImages: %v", err)
+	}
+	if rep.RowsScanned != 2 || rep.RowsUpdated != 1 || rep.ImagesMigrated != 1 || rep.ImagesFailed != 1 {
+		t.Fatalf("resumed report = %+v", rep)
+	}
+	for id, want := range map[int64]string{
+		first:  mustURLFor(t, images, redData),
+		broken: notAnImage,
+		last:   mustURLFor(t, images, blueData),
+	} {
+		if _, refs := portfolioImages(t, db, id); len(refs) != 1 || refs[0] != want {
+			t.Fatalf("portfolio item %d images = %q, want %q", id, refs, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package maintenance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"lucys-beauty-parlour-backend/blobstore"
+	"lucys-beauty-parlour-backend/storage"
+	"lucys-beauty-parlour-backend/utils"
+)
+
+// DefaultOrphanGrace is how old an unreferenced file must be before it is
+// deleted, leaving time to attach a fresh upload to an item.
+const DefaultOrphanGrace = 24 * time.Hour
+
+// OrphanOptions configures SweepOrphans.
+type OrphanOptions struct {
+	// DryRun reports orphans without deleting them.
+	DryRun bool
+	// Grace protects files modified more recently than this (default DefaultOrphanGrace).
+	Grace time.Duration
+	// Uploads is the legacy /uploads directory store, if any.
+	Uploads blobstore.BlobStore
+	// Out receives one line per orphan; nil discards them.
+	Out io.Writer
+}
+
+// Orphan is a stored image no record references, together with its
+// thumbnail or renditions.
+type Orphan struct {
+	Keys    []string
+	Bytes   int64
+	ModTime time.Time // of the most recently modified key
+	Deleted bool
+}
+
+// OrphanReport summarises a SweepOrphans run.
+type OrphanReport struct {
+	FilesScanned int
+	Orphans      []Orphan
+	InGrace      int // orphans kept because they are newer than the grace period
+	Deleted      int
+	BytesFreed   int64
+}
+
+// SweepOrphans finds images in the blob store (and the legacy uploads
+// directory) that no portfolio or service item references, trashed items
+// included, and deletes those older than the grace period.
+//
+// Files are listed before references are loaded, so an image uploaded and
+// attached during the sweep is never seen as an orphan.
+func SweepOrphans(ctx context.Context, db *sql.DB, images *utils.ImageStore, blobs blobstore.BlobStore, opts OrphanOptions) (OrphanReport, error) {
+	return sweepOrphans(ctx, func(ctx context.Context) ([]string, error) {
+		return loadImageReferences(ctx, db)
+	}, images, blobs, opts)
+}
+
+// sweepOrphans is SweepOrphans with the references loaded by loadRefs.
+func sweepOrphans(ctx context.Context, loadRefs func(context.Context) ([]string, error), images *utils.ImageStore, blobs blobstore.BlobStore, opts OrphanOptions) (OrphanReport, error) {
+	var rep OrphanReport
+	if opts.Grace <= 0 {
+		opts.Grace = DefaultOrphanGrace
+	}
+	if opts.Out == nil {
+		opts.Out = io.Discard
+	}
+
+	// Group each image with its derived files, keyed by what references name.
+	blobGroups, n, err := groupObjects(ctx, blobs, utils.ImageKeyPrefix, utils.ImageHashFromKey)
+	if err != nil {
+		return rep, err
+	}
+	rep.FilesScanned += n
+	var uploadGroups map[string]*Orphan
+	if opts.Uploads != nil {
+		uploadGroups, n, err = groupObjects(ctx, opts.Uploads, "", legacyUploadGroup)
+		if err != nil {
+			return rep, err
+		}
+		rep.FilesScanned += n
+	}
+
+	refs, err := loadRefs(ctx)
+	if err != nil {
+		return rep, err
+	}
+	for _, ref := range refs {
+		// Older rows may store paths without the leading slash the store
+		// adds when reading them.
+		ref = storage.NormalizeImagePath(ref)
+		if hash, ok := images.HashOf(ref); ok {
+			delete(blobGroups, hash)
+		} else if group, ok := legacyUploadReference(ref); ok {
+			delete(uploadGroups, group)
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.Grace)
+	sweep := func(store blobstore.BlobStore, groups map[string]*Orphan) error {
+		for _, group := range sortedGroups(groups) {
+			o := groups[group]
+			if o.ModTime.After(cutoff) {
+				rep.InGrace++
+				fmt.Fprintf(opts.Out, "orphan %s: %d file(s), %d bytes, within grace period\n", group, len(o.Keys), o.Bytes)
+				continue
+			}
+			if !opts.DryRun {
+				for _, key := range o.Keys {
+					if err := store.Delete(ctx, key); err != nil {
+						return err
+					}
+				}
+				o.Deleted = true
+				rep.Deleted++
+				rep.BytesFreed += o.Bytes
+			}
+			fmt.Fprintf(opts.Out, "orphan %s: %d file(s), %d bytes, last modified %s, deleted=%v\n", group, len(o.Keys), o.Bytes, o.ModTime.Format(time.RFC3339), o.Deleted)
+			rep.Orphans = append(rep.Orphans, *o)
+		}
+		return nil
+	}
+	if err := sweep(blobs, blobGroups); err != nil {
+		return rep, err
+	}
+	if opts.Uploads != nil {
+		if err := sweep(opts.Uploads, uploadGroups); err != nil {
+			return rep, err
+		}
+	}
+	return rep, nil
+}
+
+// groupObjects lists the objects under prefix, grouped by groupOf. Objects
+// groupOf does not recognise are left alone.
+func groupObjects(ctx context.Context, store blobstore.BlobStore, prefix string, groupOf func(key string) (string, bool)) (map[string]*Orphan, int, error) {
+	groups := make(map[string]*Orphan)
+	n := 0
+	err := store.Walk(ctx, prefix, func(obj blobstore.ObjectInfo) error {
+		n++
+		group, ok := groupOf(obj.Key)
+		if !ok {
+			return nil
+		}
+		o := groups[group]
+		if o == nil {
+			o = &Orphan{}
+			groups[group] = o
+		}
+		o.Keys = append(o.Keys, obj.Key)
+		o.Bytes += obj.Size
+		if obj.ModTime.After(o.ModTime) {
+			o.ModTime = obj.ModTime
+		}
+		return nil
+	})
+	return groups, n, err
+}
+
+// legacyUploadGroup groups a file in the uploads directory with its
+// thumbnail: "<name>.<ext>" and "<name>_thumb.jpg" both belong to "<name>".
+func legacyUploadGroup(key string) (string, bool) {
+	if strings.Contains(key, "/") {
+		return "", false
+	}
+	name := strings.TrimSuffix(key, "_thumb.jpg")
+	if name == key {
+		name = strings.TrimSuffix(key, path.Ext(key))
+	}
+	return name, name != ""
+}
+
+// legacyUploadReference returns the group of the uploads directory file ref
+// names, if it names one.
+func legacyUploadReference(ref string) (string, bool) {
+	name, ok := strings.CutPrefix(ref, "/uploads/")
+	if !ok {
+		return "", false
+	}
+	return legacyUploadGroup(name)
+}
+
+func sortedGroups(groups map[string]*Orphan) []string {
+	out := make([]string, 0, len(groups))
+	for g := range groups {
+		out = append(out, g)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// loadImageReferences returns every image URL stored in the database.
+func loadImageReferences(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT jsonb_array_elements_text(images) FROM portfolio_items WHERE jsonb_typeof(images) = 'array'
+		UNION
+		SELECT image FROM service_items WHERE image <> ''
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("load image references: %w", err)
+	}
+	defer rows.Close()
+
+	refs := make([]string, 0)
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return nil, fmt.Errorf("scan image reference: %w", err)
+		}
+		refs = append(refs, strings.TrimSpace(ref))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load image references: %w", err)
+	}
+	return refs, nil
+}
@@ -0,0 +1,170 @@
+package maintenance
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"lucys-beauty-parlour-backend/blobstore"
+	"lucys-beauty-parlour-backend/utils"
+)
+
+var (
+	keptHash   = strings.Repeat("a", 64)
+	orphanHash = strings.Repeat("b", 64)
+)
+
+// newOrphanStores returns a blob store holding two images with renditions,
+// and an uploads directory holding two legacy files with thumbnails.
+func newOrphanStores(t *testing.T) (images *utils.ImageStore, blobs, uploads blobstore.BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+	b, err := blobstore.NewLocal(t.TempDir(), "/media")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	u, err := blobstore.NewLocal(t.TempDir(), "/uploads")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	put := func(s blobstore.BlobStore, keys ...string) {
+		for _, key := range keys {
+			if err := s.Put(ctx, key, strings.NewReader("x"), 1, "image/jpeg"); err != nil {
+				t.Fatalf("Put %s: %v", key, err)
+			}
+		}
+	}
+	put(b, utils.ImageKeyPrefix+keptHash+".jpg", utils.ImageKeyPrefix+keptHash+"/thumb.jpg",
+		utils.ImageKeyPrefix+orphanHash+".jpg", utils.ImageKeyPrefix+orphanHash+"/thumb.jpg")
+	put(u, "kept.jpg", "kept_thumb.jpg", "stale.png", "stale_thumb.jpg")
+	return utils.NewImageStore(b, utils.DefaultImageConfig), b, u
+}
+
+func staticRefs(refs ...string) func(context.Context) ([]string, error) {
+	return func(context.Context) ([]string, error) { return refs, nil }
+}
+
+func orphanKeys(rep OrphanReport) []string {
+	var keys []string
+	for _, o := range rep.Orphans {
+		keys = append(keys, o.Keys...)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestLegacyUploadReference(t *testing.T) {
+	cases := []struct {
+		ref   string
+		group string
+		ok    bool
+	}{
+		{"/uploads/kept.jpg", "kept", true},
+		{"/uploads/kept_thumb.jpg", "kept", true},
+		{"/uploads/sub/kept.jpg", "", false},
+		{"uploads/kept.jpg", "", false},
+		{"/media/images/kept.jpg", "", false},
+		{"https://cdn.example.com/uploads/kept.jpg", "", false},
+	}
+	for _, tc := range cases {
+		group, ok := legacyUploadReference(tc.ref)
+		if group != tc.group || ok != tc.ok {
+			t.Errorf("legacyUploadReference(%q) = %q, %v; want %q, %v", tc.ref, group, ok, tc.group, tc.ok)
+		}
+	}
+}
+
+func TestSweepOrphansMatchesLegacyPaths(t *testing.T) {
+	images, blobs, uploads := newOrphanStores(t)
+	// Older rows store paths without their leading slash.
+	refs := staticRefs("media/images/"+keptHash+".jpg", "uploads/kept.jpg")
+	rep, err := sweepOrphans(context.Background(), refs, images, blobs, OrphanOptions{DryRun: true, Grace: time.Nanosecond, Uploads: uploads})
+	if err != nil {
+		t.Fatalf("sweepOrphans: %v", err)
+	}
+	want := []string{utils.ImageKeyPrefix + orphanHash + ".jpg", utils.ImageKeyPrefix + orphanHash + "/thumb.jpg", "stale.png", "stale_thumb.jpg"}
+	if got := orphanKeys(rep); !slices.Equal(got, want) {
+		t.Fatalf("orphans = %v; want %v", got, want)
+	}
+	if rep.FilesScanned != 8 {
+		t.Fatalf("FilesScanned = %d, want 8", rep.FilesScanned)
+	}
+}
+
+func TestSweepOrphansDryRun(t *testing.T) {
+	ctx := context.Background()
+	images, blobs, uploads := newOrphanStores(t)
+	refs := staticRefs("/media/images/"+keptHash+".jpg", "/uploads/kept.jpg")
+	var out strings.Builder
+	rep, err := sweepOrphans(ctx, refs, images, blobs, OrphanOptions{DryRun: true, Grace: time.Nanosecond, Uploads: uploads, Out: &out})
+	if err != nil {
+		t.Fatalf("sweepOrphans: %v", err)
+	}
+	if len(rep.Orphans) != 2 || rep.Deleted != 0 || rep.BytesFreed != 0 {
+		t.Fatalf("dry run report = %+v; want 2 orphans, none deleted", rep)
+	}
+	if strings.Count(out.String(), "deleted=false") != 2 {
+		t.Fatalf("dry run output = %q", out.String())
+	}
+	for _, key := range []string{utils.ImageKeyPrefix + orphanHash + ".jpg", utils.ImageKeyPrefix + orphanHash + "/thumb.jpg"} {
+		if ok, _ := blobs.Exists(ctx, key); !ok {
+			t.Errorf("dry run deleted %s", key)
+		}
+	}
+	if ok, _ := uploads.Exists(ctx, "stale.png"); !ok {
+		t.Error("dry run deleted stale.png")
+	}
+}
+
+func TestSweepOrphansDeletes(t *testing.T) {
+	ctx := context.Background()
+	images, blobs, uploads := newOrphanStores(t)
+	refs := staticRefs("/media/images/"+keptHash+".jpg", "/uploads/kept.jpg")
+	rep, err := sweepOrphans(ctx, refs, images, blobs, OrphanOptions{Grace: time.Nanosecond, Uploads: uploads})
+	if err != nil {
+		t.Fatalf("sweepOrphans: %v", err)
+	}
+	if rep.Deleted != 2 || rep.BytesFreed != 4 {
+		t.Fatalf("report = %+v; want 2 orphans deleted, 4 bytes freed", rep)
+	}
+	exists := func(s blobstore.BlobStore, key string) bool {
+		ok, err := s.Exists(ctx, key)
+		if err != nil {
+			t.Fatalf("Exists %s: %v", key, err)
+		}
+		return ok
+	}
+	for _, key := range []string{utils.ImageKeyPrefix + keptHash + ".jpg", utils.ImageKeyPrefix + keptHash + "/thumb.jpg"} {
+		if !exists(blobs, key) {
+			t.Errorf("referenced %s was deleted", key)
+		}
+	}
+	for _, key := range []string{"kept.jpg", "kept_thumb.jpg"} {
+		if !exists(uploads, key) {
+			t.Errorf("referenced %s was deleted", key)
+		}
+	}
+	for _, key := range []string{utils.ImageKeyPrefix + orphanHash + ".jpg", utils.ImageKeyPrefix + orphanHash + "/thumb.jpg"} {
+		if exists(blobs, key) {
+			t.Errorf("orphan %s was kept", key)
+		}
+	}
+	for _, key := range []string{"stale.png", "stale_thumb.jpg"} {
+		if exists(uploads, key) {
+			t.Errorf("orphan %s was kept", key)
+		}
+	}
+}
+
+func TestSweepOrphansKeepsRecentFiles(t *testing.T) {
+	images, blobs, uploads := newOrphanStores(t)
+	rep, err := sweepOrphans(context.Background(), staticRefs(), images, blobs, OrphanOptions{Uploads: uploads})
+	if err != nil {
+		t.Fatalf("sweepOrphans: %v", err)
+	}
+	if rep.InGrace != 4 || rep.Deleted != 0 || len(rep.Orphans) != 0 {
+		t.Fatalf("report = %+v; want all 4 groups kept within the grace period", rep)
+	}
+}
@@ -13,7 +13,26 @@ type Appointment struct {
 
 	Currency   string `json:"currency,omitempty"`
 	PriceCents int64  `json:"price_cents"`
+	// DepositCents is due before the booking is confirmed automatically. It
+	// is fixed from the service's deposit percentage when the booking is made.
+	DepositCents int64 `json:"deposit_cents"`
+	// Set when the booking redeemed a voucher or loyalty points. PriceCents
+	// is what is left to pay after DiscountCents is taken off.
+	VoucherID      int64  `json:"voucher_id,omitempty"`
+	PromoCode      string `json:"promo_code,omitempty"`
+	PointsRedeemed int64  `json:"points_redeemed,omitempty"`
+	DiscountCents  int64  `json:"discount_cents,omitempty"`
 
 	Notes  string `json:"notes,omitempty"`
 	Status string `json:"status"`
+
+	// Set when the appointment is cancelled or marked a no-show.
+	CancelledBy          string `json:"cancelled_by,omitempty"`
+	CancellationReason   string `json:"cancellation_reason,omitempty"`
+	CancellationFeeCents int64  `json:"cancellation_fee_cents,omitempty"`
+	CancelledAt          string `json:"cancelled_at,omitempty"`
+
+	// CancelTokenHash is stored with a new appointment so the customer can
+	// cancel it by link; it is never read back.
+	CancelTokenHash string `json:"-"`
 }
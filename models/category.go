@@ -0,0 +1,9 @@
+package models
+
+// Category groups services, portfolio items and menu items, e.g. "hair".
+type Category struct {
+	Slug      string `json:"slug" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+	SortOrder int    `json:"sort_order"`
+	Icon      string `json:"icon,omitempty"`
+}
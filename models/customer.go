@@ -0,0 +1,21 @@
+package models
+
+// Customer is someone who has booked, known by their lower-case email, with
+// totals over their appointments.
+type Customer struct {
+	Email string `json:"email"`
+	// Name and Phone are from their latest appointment.
+	Name      string `json:"name"`
+	Phone     string `json:"phone"`
+	Bookings  int    `json:"bookings"`
+	Completed int    `json:"completed"`
+	Cancelled int    `json:"cancelled"`
+	NoShows   int    `json:"no_shows"`
+	// FirstVisit and LastVisit are the dates of their first and latest
+	// appointments.
+	FirstVisit string `json:"first_visit"`
+	LastVisit  string `json:"last_visit"`
+	// SpentCents is the price of their completed appointments per currency.
+	SpentCents    map[string]int64 `json:"spent_cents"`
+	LoyaltyPoints int64            `json:"loyalty_points"`
+}
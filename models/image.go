@@ -0,0 +1,8 @@
+package models
+
+// ImageSet lists the responsive renditions of one image for use in srcset.
+type ImageSet struct {
+	Src    string `json:"src"`
+	Thumb  string `json:"thumb,omitempty"`
+	Srcset string `json:"srcset,omitempty"`
+}
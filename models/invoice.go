@@ -0,0 +1,26 @@
+package models
+
+// Invoice is the numbered receipt for a completed appointment, with the
+// amounts as they stood when it was issued.
+type Invoice struct {
+	ID                 int64  `json:"id"`
+	Number             string `json:"number"`
+	AppointmentID      int64  `json:"appointment_id"`
+	CustomerName       string `json:"customer_name"`
+	CustomerEmail      string `json:"customer_email"`
+	ServiceName        string `json:"service_name"`
+	ServiceDescription string `json:"service_description"`
+	AppointmentDate    string `json:"appointment_date"`
+	Currency           string `json:"currency"`
+	// TotalCents is the price after DiscountCents was taken off.
+	TotalCents int64 `json:"total_cents"`
+	// DiscountCents came off with PromoCode and PointsRedeemed.
+	DiscountCents  int64  `json:"discount_cents"`
+	PromoCode      string `json:"promo_code,omitempty"`
+	PointsRedeemed int64  `json:"points_redeemed,omitempty"`
+	// DepositCents is the deposit the booking asked for.
+	DepositCents int64 `json:"deposit_cents"`
+	// DepositPaidCents was paid online ahead of the visit, net of refunds.
+	DepositPaidCents int64  `json:"deposit_paid_cents"`
+	IssuedAt         string `json:"issued_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// LoyaltySettings are the rates at which customers earn and redeem loyalty
+// points. A rate of 0 turns earning or redeeming off.
+type LoyaltySettings struct {
+	// Currency is the only currency points are earned and redeemed in.
+	Currency string `json:"currency"`
+	// SpendPerPoint is how many minor units of a completed booking's price
+	// earn one point.
+	SpendPerPoint int64 `json:"spend_per_point"`
+	// PointValueCents is how many minor units one point takes off a booking.
+	PointValueCents int64 `json:"point_value_cents"`
+}
+
+// LoyaltyEntry is a change to a customer's points balance.
+type LoyaltyEntry struct {
+	ID            int64  `json:"id"`
+	CustomerEmail string `json:"customer_email"`
+	// AppointmentID is nil once the appointment is purged.
+	AppointmentID *int64 `json:"appointment_id,omitempty"`
+	// Kind is "earned", with positive Points, "redeemed", with negative, or
+	// "refunded", giving back what a cancelled booking redeemed.
+	Kind      string `json:"kind"`
+	Points    int64  `json:"points"`
+	CreatedAt string `json:"created_at"`
+}
@@ -1,9 +1,12 @@
 package models
 
 type MenuItem struct {
-	ID              int64  `json:"id"`
-	Category        string `json:"category"`
-	Name            string `json:"name"`
+	ID       int64  `json:"id"`
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	// ServiceItemID makes the item a priced variant of a service, such as the
+	// "Medium" of "Knotless Braids".
+	ServiceItemID   *int64 `json:"service_item_id,omitempty"`
 	Currency        string `json:"currency,omitempty"`
 	PriceCents      int64  `json:"price_cents"`
 	DurationMinutes int    `json:"duration_minutes"`
@@ -0,0 +1,21 @@
+package models
+
+// Payment is money requested from a customer through a payment provider,
+// such as the deposit that secures a booking.
+type Payment struct {
+	ID            int64  `json:"id"`
+	AppointmentID int64  `json:"appointment_id"`
+	Provider      string `json:"provider"`
+	// ProviderRef identifies the payment to the provider; webhooks use it.
+	ProviderRef string `json:"provider_ref"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+	// Status is pending, succeeded or failed.
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+	// CheckoutURL is where the customer pays, for providers that host a
+	// payment page; mobile money prompts the customer's phone instead.
+	CheckoutURL string `json:"checkout_url,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
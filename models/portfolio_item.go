@@ -2,9 +2,28 @@ package models
 
 type PortfolioItem struct {
 	ID          int64    `json:"id"`
-	Category    string   `json:"category" binding:"required"` // hair, makeup, nails
+	Category    string   `json:"category" binding:"required"` // category slug, e.g. hair
 	Style       string   `json:"style" binding:"required"`    // Box braids, Soft Glam, etc.
 	Images      []string `json:"images" binding:"required"`
 	Description string   `json:"description" binding:"required"`
-	CreatedAt   string   `json:"created_at"`
+	// Captions[i] captions Images[i]; it may be shorter than Images.
+	Captions []string `json:"captions,omitempty"`
+	// BeforeAfter pairs images, by index into Images, that show a transformation.
+	BeforeAfter []ImagePair `json:"before_after,omitempty"`
+	// ServiceItemID links the look to the service that produced it.
+	ServiceItemID *int64   `json:"service_item_id,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Featured      bool     `json:"featured"`
+	// SortOrder positions the item in the gallery; it is set by reordering.
+	SortOrder int    `json:"sort_order"`
+	CreatedAt string `json:"created_at"`
+
+	// ImageSets describes responsive renditions of Images; it is not stored.
+	ImageSets []ImageSet `json:"image_sets,omitempty"`
+}
+
+// ImagePair is a before/after pair of indexes into PortfolioItem.Images.
+type ImagePair struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
 }
@@ -0,0 +1,34 @@
+package models
+
+// Refund is money owed back to a customer from one of their payments. The
+// salon pays it out and then marks it paid.
+type Refund struct {
+	ID            int64  `json:"id"`
+	AppointmentID int64  `json:"appointment_id"`
+	PaymentID     int64  `json:"payment_id"`
+	AmountCents   int64  `json:"amount_cents"`
+	Currency      string `json:"currency"`
+	// Status is pending or paid.
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+	PaidAt    string `json:"paid_at,omitempty"`
+}
+
+// Cancellation is how an appointment is being cancelled, with the outcome
+// of the cancellation policy.
+type Cancellation struct {
+	// By is "admin" or "customer".
+	By     string
+	Reason string
+	// NoShow marks the customer as not having turned up, rather than the
+	// booking as cancelled.
+	NoShow bool
+	// FeeCents is what the salon keeps or charges.
+	FeeCents int64
+	// RefundCents is refunded from the appointment's payments.
+	RefundCents int64
+	// PaidCents is what the fee and refund were worked out from: the
+	// appointment's succeeded payments less its refunds. The cancellation
+	// fails with storage.ErrPaymentsChanged if that no longer holds.
+	PaidCents int64
+}
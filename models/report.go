@@ -0,0 +1,20 @@
+package models
+
+// ReportRow is one group of appointments in a report, e.g. a day, a
+// service or an hour of the day. Groups are split by currency so amounts
+// are never added across currencies.
+type ReportRow struct {
+	// Key identifies the group: a date, a service ID, a category slug, a
+	// staff name or an hour ("09"). Label is how to show it.
+	Key       string `json:"key"`
+	Label     string `json:"label"`
+	Currency  string `json:"currency"`
+	Bookings  int    `json:"bookings"`
+	Completed int    `json:"completed"`
+	Cancelled int    `json:"cancelled"`
+	NoShows   int    `json:"no_shows"`
+	// RevenueCents is the price of completed appointments, and FeesCents
+	// what was kept from cancellations and no-shows.
+	RevenueCents int64 `json:"revenue_cents"`
+	FeesCents    int64 `json:"fees_cents"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// Review is a customer's rating of a service after a completed appointment.
+// It is only shown publicly, and only counts towards the service's rating,
+// once an admin approves it.
+type Review struct {
+	ID            int64  `json:"id"`
+	AppointmentID *int64 `json:"appointment_id,omitempty"` // nil once the appointment is purged
+	ServiceID     int64  `json:"service_id"`
+	Author        string `json:"author"`
+	Rating        int    `json:"rating"`
+	Comment       string `json:"comment"`
+	Status        string `json:"status"` // pending, approved, rejected
+	CreatedAt     string `json:"created_at"`
+}
+
+// ReviewInvite describes the appointment a one-time review link was issued for.
+type ReviewInvite struct {
+	AppointmentID int64  `json:"appointment_id"`
+	ServiceID     int64  `json:"service_id"`
+	CustomerName  string `json:"customer_name"`
+	Date          string `json:"date"`
+	ExpiresAt     string `json:"expires_at"`
+}
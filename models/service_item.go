@@ -5,5 +5,17 @@ type ServiceItem struct {
 	Service      string   `json:"service" binding:"required"`
 	Name         string   `json:"name" binding:"required"`
 	Descriptions []string `json:"descriptions" binding:"required"`
-	Rating       float64  `json:"rating"`
+	// Rating averages the approved reviews, to one decimal place; it is
+	// computed, not written.
+	Rating      float64 `json:"rating"`
+	ReviewCount int     `json:"review_count"`
+	Image       string  `json:"image,omitempty"`
+	// DepositPercent of the price is paid up front to secure a booking.
+	DepositPercent int `json:"deposit_percent"`
+
+	// ImageSet describes responsive renditions of Image; it is not stored.
+	ImageSet *ImageSet `json:"image_set,omitempty"`
+	// Variants are the service's priced menu items; they are only filled in
+	// when a single service is fetched.
+	Variants []*MenuItem `json:"variants,omitempty"`
 }
@@ -0,0 +1,10 @@
+package models
+
+// TrashItem summarises a soft-deleted record awaiting restore or purge.
+type TrashItem struct {
+	Type      string   `json:"type"` // appointments, services, portfolio, menu-items
+	ID        int64    `json:"id"`
+	Label     string   `json:"label"`
+	Images    []string `json:"images,omitempty"`
+	DeletedAt string   `json:"deleted_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// Voucher is a gift voucher or promo code that takes money off a booking.
+type Voucher struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code"`
+	// Kind is "fixed", taking Value minor units of Currency off the price,
+	// or "percent", taking Value percent off.
+	Kind     string `json:"kind"`
+	Value    int64  `json:"value"`
+	Currency string `json:"currency,omitempty"`
+	// ExpiresAt is when the code stops working; empty means never.
+	ExpiresAt string `json:"expires_at,omitempty"`
+	// MaxUses caps how many bookings can redeem the code; 0 means no limit.
+	MaxUses int  `json:"max_uses"`
+	Uses    int  `json:"uses"`
+	Active  bool `json:"active"`
+	// Note is for the salon, e.g. who a gift voucher was sold to.
+	Note      string `json:"note,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
@@ -0,0 +1,167 @@
+// Package money represents amounts as integer minor units of an ISO 4217
+// currency, so that amounts in different currencies are never mixed and
+// each is formatted with the right number of decimals.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownCurrency is returned for codes that are not active ISO 4217
+	// currencies.
+	ErrUnknownCurrency = errors.New("money: unknown currency")
+	// ErrCurrencyMismatch is returned when combining amounts in different
+	// currencies.
+	ErrCurrencyMismatch = errors.New("money: currency mismatch")
+)
+
+// Currency is an ISO 4217 currency.
+type Currency struct {
+	Code string
+	// MinorUnits is the number of decimal places: 0 for UGX, 2 for USD.
+	MinorUnits int
+}
+
+// ParseCurrency looks up an ISO 4217 code, ignoring case and surrounding
+// space.
+func ParseCurrency(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	units, ok := minorUnits[code]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w %q", ErrUnknownCurrency, code)
+	}
+	return Currency{Code: code, MinorUnits: units}, nil
+}
+
+func (c Currency) String() string { return c.Code }
+
+// scale is 10 to the power of the currency's minor units.
+func (c Currency) scale() int64 {
+	s := int64(1)
+	for range c.MinorUnits {
+		s *= 10
+	}
+	return s
+}
+
+// Decimal renders an amount in minor units as a plain decimal, e.g. 2550 USD
+// as "25.50", the way payment providers expect it.
+func (c Currency) Decimal(minor int64) string {
+	if c.MinorUnits == 0 {
+		return strconv.FormatInt(minor, 10)
+	}
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/c.scale(), c.MinorUnits, minor%c.scale())
+}
+
+// ParseDecimal reads a decimal amount such as "25.5" into minor units,
+// rounding any further decimals half up.
+func (c Currency) ParseDecimal(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	for _, part := range []string{whole, frac} {
+		if strings.Trim(part, "0123456789") != "" {
+			return 0, fmt.Errorf("money: invalid amount %q", s)
+		}
+	}
+	var round bool
+	if len(frac) > c.MinorUnits {
+		round = frac[c.MinorUnits] >= '5'
+		frac = frac[:c.MinorUnits]
+	}
+	frac += strings.Repeat("0", c.MinorUnits-len(frac))
+	n, err := strconv.ParseInt(whole+frac, 10, 64)
+	if whole+frac == "" {
+		n, err = 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("money: invalid amount %q", s)
+	}
+	if round {
+		n++
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// Format renders an amount in minor units for people, with the code and
+// thousands separators: "UGX 150,000", "USD 1,250.50".
+func (c Currency) Format(minor int64) string {
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+	value := groupThousands(minor / c.scale())
+	if c.MinorUnits > 0 {
+		value += fmt.Sprintf(".%0*d", c.MinorUnits, minor%c.scale())
+	}
+	return fmt.Sprintf("%s %s%s", c.Code, sign, value)
+}
+
+func groupThousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Money is an amount in minor units of a currency.
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+// New is amount minor units of the currency with the given code.
+func New(amount int64, code string) (Money, error) {
+	c, err := ParseCurrency(code)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: c}, nil
+}
+
+func (m Money) String() string { return m.Currency.Format(m.Amount) }
+
+// Add sums two amounts in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// DefaultCurrencyFromEnv reads the shop's currency from SHOP_CURRENCY, or
+// the older PAYMENT_CURRENCY, defaulting to UGX.
+func DefaultCurrencyFromEnv() (Currency, error) {
+	code := strings.TrimSpace(os.Getenv("SHOP_CURRENCY"))
+	if code == "" {
+		code = strings.TrimSpace(os.Getenv("PAYMENT_CURRENCY"))
+	}
+	if code == "" {
+		code = "UGX"
+	}
+	c, err := ParseCurrency(code)
+	if err != nil {
+		return Currency{}, fmt.Errorf("invalid SHOP_CURRENCY: %w", err)
+	}
+	return c, nil
+}
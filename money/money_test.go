@@ -0,0 +1,112 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCurrency(t *testing.T) {
+	c, err := ParseCurrency(" ugx ")
+	if err != nil || c != (Currency{Code: "UGX", MinorUnits: 0}) {
+		t.Fatalf("ParseCurrency(ugx) = %+v, %v", c, err)
+	}
+	if c, _ := ParseCurrency("KWD"); c.MinorUnits != 3 {
+		t.Errorf("KWD minor units = %d, want 3", c.MinorUnits)
+	}
+	for _, code := range []string{"", "US", "XXX", "ABC"} {
+		if _, err := ParseCurrency(code); !errors.Is(err, ErrUnknownCurrency) {
+			t.Errorf("ParseCurrency(%q): got %v, want ErrUnknownCurrency", code, err)
+		}
+	}
+}
+
+func TestFormatAndDecimal(t *testing.T) {
+	ugx, _ := ParseCurrency("UGX")
+	usd, _ := ParseCurrency("USD")
+	kwd, _ := ParseCurrency("KWD")
+	cases := []struct {
+		c       Currency
+		minor   int64
+		format  string
+		decimal string
+	}{
+		{ugx, 150000, "UGX 150,000", "150000"},
+		{ugx, 0, "UGX 0", "0"},
+		{usd, 125050, "USD 1,250.50", "1250.50"},
+		{usd, 5, "USD 0.05", "0.05"},
+		{usd, -2550, "USD -25.50", "-25.50"},
+		{kwd, 1234567, "KWD 1,234.567", "1234.567"},
+	}
+	for _, tc := range cases {
+		if got := tc.c.Format(tc.minor); got != tc.format {
+			t.Errorf("%s.Format(%d) = %q, want %q", tc.c, tc.minor, got, tc.format)
+		}
+		if got := tc.c.Decimal(tc.minor); got != tc.decimal {
+			t.Errorf("%s.Decimal(%d) = %q, want %q", tc.c, tc.minor, got, tc.decimal)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	ugx, _ := ParseCurrency("UGX")
+	usd, _ := ParseCurrency("USD")
+	cases := []struct {
+		c    Currency
+		in   string
+		want int64
+	}{
+		{usd, "25.5", 2550},
+		{usd, "25.50", 2550},
+		{usd, "25", 2500},
+		{usd, ".5", 50},
+		{usd, "0.005", 1},
+		{usd, "19.994", 1999},
+		{ugx, "50000", 50000},
+		{ugx, "50000.00", 50000},
+		{ugx, "49999.5", 50000},
+	}
+	for _, tc := range cases {
+		got, err := tc.c.ParseDecimal(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("%s.ParseDecimal(%q) = %d, %v; want %d", tc.c, tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"", ".", "1e3", "12,000", "abc"} {
+		if _, err := usd.ParseDecimal(in); err == nil {
+			t.Errorf("ParseDecimal(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestAddRejectsMixedCurrencies(t *testing.T) {
+	a, _ := New(50000, "UGX")
+	b, _ := New(20000, "ugx")
+	sum, err := a.Add(b)
+	if err != nil || sum.String() != "UGX 70,000" {
+		t.Fatalf("Add = %v, %v; want UGX 70,000", sum, err)
+	}
+	usd, _ := New(2000, "USD")
+	if _, err := a.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Fatalf("Add(UGX, USD): got %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestDefaultCurrencyFromEnv(t *testing.T) {
+	t.Setenv("SHOP_CURRENCY", "")
+	t.Setenv("PAYMENT_CURRENCY", "")
+	if c, err := DefaultCurrencyFromEnv(); err != nil || c.Code != "UGX" {
+		t.Fatalf("default = %v, %v; want UGX", c, err)
+	}
+	t.Setenv("PAYMENT_CURRENCY", "kes")
+	if c, _ := DefaultCurrencyFromEnv(); c.Code != "KES" {
+		t.Fatalf("with PAYMENT_CURRENCY = %v, want KES", c)
+	}
+	t.Setenv("SHOP_CURRENCY", "usd")
+	if c, _ := DefaultCurrencyFromEnv(); c.Code != "USD" {
+		t.Fatalf("with SHOP_CURRENCY = %v, want USD", c)
+	}
+	t.Setenv("SHOP_CURRENCY", "dollars")
+	if _, err := DefaultCurrencyFromEnv(); !errors.Is(err, ErrUnknownCurrency) {
+		t.Fatalf("invalid SHOP_CURRENCY: got %v, want ErrUnknownCurrency", err)
+	}
+}
@@ -0,0 +1,78 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook's body.
+const FakeSignatureHeader = "X-Signature"
+
+// Fake accepts every payment request and settles payments only when told
+// to by a signed webhook, so the whole flow can be run locally:
+//
+//	body='{"provider_ref":"fake_…","status":"succeeded"}'
+//	curl -H "X-Signature: $(printf %s "$body" | openssl dgst -sha256 -hmac "$PAYMENT_WEBHOOK_SECRET" -r | cut -d' ' -f1)" \
+//		-d "$body" localhost:8080/payments/webhook/fake
+type Fake struct {
+	secret string
+}
+
+// FakeEvent is the body of a fake webhook.
+type FakeEvent struct {
+	ProviderRef string `json:"provider_ref"`
+	Status      string `json:"status"`
+	AmountCents int64  `json:"amount_cents,omitempty"`
+	Currency    string `json:"currency,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// NewFake returns a Fake whose webhooks are signed with secret.
+func NewFake(secret string) (*Fake, error) {
+	if secret == "" {
+		return nil, errors.New("payments: fake provider requires PAYMENT_WEBHOOK_SECRET")
+	}
+	return &Fake{secret: secret}, nil
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) RequestPayment(ctx context.Context, req Request) (*Charge, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Charge{ProviderRef: "fake_" + hex.EncodeToString(b)}, nil
+}
+
+// Sign returns the signature header value for a webhook body.
+func (f *Fake) Sign(body []byte) string {
+	return sign(f.secret, body)
+}
+
+func (f *Fake) ParseWebhook(ctx context.Context, r *http.Request, body []byte) (*Event, error) {
+	if !validSignature(f.secret, body, r.Header.Get(FakeSignatureHeader)) {
+		return nil, ErrInvalidSignature
+	}
+	var ev FakeEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, fmt.Errorf("payments: decode fake webhook: %w", err)
+	}
+	switch ev.Status {
+	case StatusPending, StatusSucceeded, StatusFailed:
+	default:
+		return nil, fmt.Errorf("payments: fake webhook has unknown status %q", ev.Status)
+	}
+	return &Event{
+		ProviderRef: ev.ProviderRef,
+		Status:      ev.Status,
+		AmountCents: ev.AmountCents,
+		Currency:    ev.Currency,
+		Reason:      ev.Reason,
+	}, nil
+}
@@ -0,0 +1,246 @@
+// Package payments takes deposits through a payment provider: MTN Mobile
+// Money, Airtel Money, card checkout, or a local fake for development.
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"lucys-beauty-parlour-backend/money"
+)
+
+// Payment statuses, as stored and as reported by webhooks.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ErrInvalidSignature is returned for webhooks that cannot be shown to come
+// from the provider.
+var ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+
+// Request asks a customer to pay.
+type Request struct {
+	// Reference is unique per request; providers echo it back where they can.
+	Reference   string
+	AmountCents int64
+	Currency    string
+	Phone       string
+	Email       string
+	Name        string
+	Description string
+}
+
+// Charge is a payment the provider has accepted and is waiting on.
+type Charge struct {
+	// ProviderRef identifies the payment in the provider's webhooks.
+	ProviderRef string
+	// CheckoutURL is the page the customer pays on, for card checkout.
+	CheckoutURL string
+}
+
+// Event is the outcome of a payment reported by a webhook.
+type Event struct {
+	ProviderRef string
+	Status      string
+	// AmountCents and Currency are what the provider collected, when the
+	// webhook says; AmountCents is 0 otherwise.
+	AmountCents int64
+	Currency    string
+	Reason      string
+}
+
+// Provider collects payments from customers.
+type Provider interface {
+	// Name identifies the provider in stored payments and webhook URLs.
+	Name() string
+	// RequestPayment asks the customer to pay: mobile money prompts their
+	// phone, card checkout returns a page to send them to.
+	RequestPayment(ctx context.Context, req Request) (*Charge, error)
+	// ParseWebhook authenticates a webhook request, whose body has already
+	// been read, and returns the outcome it reports. Requests that did not
+	// come from the provider give ErrInvalidSignature.
+	ParseWebhook(ctx context.Context, r *http.Request, body []byte) (*Event, error)
+}
+
+// NewFromEnv builds the Provider selected by PAYMENT_PROVIDER ("fake",
+// "mtn", "airtel" or "card"). It returns nil if PAYMENT_PROVIDER is unset,
+// in which case deposits are recorded but not collected.
+func NewFromEnv() (Provider, error) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("PAYMENT_PROVIDER"))); name {
+	case "":
+		return nil, nil
+	case "fake":
+		return NewFake(secret)
+	case "mtn":
+		return NewMTN(MTNConfig{
+			BaseURL:         os.Getenv("MTN_MOMO_BASE_URL"),
+			SubscriptionKey: os.Getenv("MTN_MOMO_SUBSCRIPTION_KEY"),
+			APIUser:         os.Getenv("MTN_MOMO_API_USER"),
+			APIKey:          os.Getenv("MTN_MOMO_API_KEY"),
+			Environment:     os.Getenv("MTN_MOMO_ENVIRONMENT"),
+			CallbackURL:     os.Getenv("PAYMENT_CALLBACK_URL"),
+			WebhookSecret:   secret,
+		})
+	case "airtel":
+		return NewAirtel(AirtelConfig{
+			BaseURL:       os.Getenv("AIRTEL_BASE_URL"),
+			ClientID:      os.Getenv("AIRTEL_CLIENT_ID"),
+			ClientSecret:  os.Getenv("AIRTEL_CLIENT_SECRET"),
+			Country:       os.Getenv("AIRTEL_COUNTRY"),
+			WebhookSecret: secret,
+		})
+	case "card":
+		return NewCard(CardConfig{
+			BaseURL:     os.Getenv("CARD_BASE_URL"),
+			SecretKey:   os.Getenv("CARD_SECRET_KEY"),
+			WebhookHash: secret,
+			RedirectURL: os.Getenv("CARD_REDIRECT_URL"),
+		})
+	default:
+		return nil, fmt.Errorf("payments: unknown PAYMENT_PROVIDER %q (use fake, mtn, airtel or card)", name)
+	}
+}
+
+// formatAmount renders minor units as the decimal amount providers expect.
+func formatAmount(minor int64, currency string) (string, error) {
+	c, err := money.ParseCurrency(currency)
+	if err != nil {
+		return "", fmt.Errorf("payments: %w", err)
+	}
+	return c.Decimal(minor), nil
+}
+
+// parseAmount reverses formatAmount, accepting any decimal a provider sends.
+func parseAmount(s, currency string) (int64, error) {
+	c, err := money.ParseCurrency(currency)
+	if err != nil {
+		return 0, fmt.Errorf("payments: %w", err)
+	}
+	return c.ParseDecimal(s)
+}
+
+// sign is the hex HMAC-SHA256 of msg under secret.
+func sign(secret string, msg []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(msg)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature compares a hex HMAC-SHA256 in constant time.
+func validSignature(secret string, msg []byte, sig string) bool {
+	want, err := hex.DecodeString(sig)
+	if err != nil || secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(msg)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// digits strips a phone number down to its digits.
+func digits(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// tokenCache holds an OAuth access token until shortly before it expires.
+type tokenCache struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// get returns the cached token, calling fetch for a new one when needed.
+func (c *tokenCache) get(ctx context.Context, fetch func(ctx context.Context) (string, time.Duration, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+	token, ttl, err := fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	// Leave a margin so a token does not expire mid-request.
+	c.token, c.expires = token, time.Now().Add(ttl-30*time.Second)
+	return token, nil
+}
+
+// expiresIn reads an OAuth expires_in, which providers send as a number or
+// a string of seconds, defaulting to a minute.
+func expiresIn(raw json.RawMessage) time.Duration {
+	n, err := strconv.Atoi(strings.Trim(string(raw), `"`))
+	if err != nil || n <= 0 {
+		return time.Minute
+	}
+	return time.Duration(n) * time.Second
+}
+
+// newJSONRequest builds a request with body, if not nil, encoded as JSON.
+func newJSONRequest(ctx context.Context, method, url string, body any) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// doJSON sends req and decodes a JSON response into out, which may be nil.
+// Responses outside 2xx are errors.
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("payments: %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("payments: decode %s response: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// defaultClient bounds calls to providers, which can hang under load.
+var defaultClient = &http.Client{Timeout: 30 * time.Second}
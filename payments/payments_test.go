@@ -0,0 +1,173 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func webhookRequest(t *testing.T, target string, body []byte) *http.Request {
+	t.Helper()
+	return httptest.NewRequest(http.MethodPost, target, strings.NewReader(string(body)))
+}
+
+func TestFakeWebhookSignature(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFake("s3cret")
+	if err != nil {
+		t.Fatalf("NewFake: %v", err)
+	}
+	charge, err := f.RequestPayment(ctx, Request{Reference: "r1", AmountCents: 50000, Currency: "UGX"})
+	if err != nil || !strings.HasPrefix(charge.ProviderRef, "fake_") {
+		t.Fatalf("RequestPayment = %+v, %v", charge, err)
+	}
+
+	body := []byte(`{"provider_ref":"` + charge.ProviderRef + `","status":"succeeded","amount_cents":50000,"currency":"UGX"}`)
+	r := webhookRequest(t, "/payments/webhook/fake", body)
+	r.Header.Set(FakeSignatureHeader, f.Sign(body))
+	ev, err := f.ParseWebhook(ctx, r, body)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	want := Event{ProviderRef: charge.ProviderRef, Status: StatusSucceeded, AmountCents: 50000, Currency: "UGX"}
+	if *ev != want {
+		t.Fatalf("event = %+v, want %+v", *ev, want)
+	}
+
+	tampered := []byte(strings.Replace(string(body), "50000", "5", 1))
+	r = webhookRequest(t, "/payments/webhook/fake", tampered)
+	r.Header.Set(FakeSignatureHeader, f.Sign(body))
+	if _, err := f.ParseWebhook(ctx, r, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("tampered webhook: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestMTNRequestAndCallback(t *testing.T) {
+	ctx := context.Background()
+	var ref, callback string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/collection/token/":
+			if user, key, _ := r.BasicAuth(); user != "user" || key != "key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, `{"access_token":"tok","expires_in":3600}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/collection/v1_0/requesttopay":
+			if r.Header.Get("Authorization") != "Bearer tok" || r.Header.Get("X-Target-Environment") != "sandbox" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var body struct {
+				Amount string `json:"amount"`
+				Payer  struct {
+					PartyID string `json:"partyId"`
+				} `json:"payer"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.Amount != "50000" || body.Payer.PartyID != "256772123456" {
+				t.Errorf("request to pay body = %+v", body)
+			}
+			ref, callback = r.Header.Get("X-Reference-Id"), r.Header.Get("X-Callback-Url")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodGet && r.URL.Path == "/collection/v1_0/requesttopay/"+ref:
+			io.WriteString(w, `{"amount":"50000","currency":"UGX","status":"SUCCESSFUL"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	m, err := NewMTN(MTNConfig{
+		BaseURL: srv.URL, SubscriptionKey: "sub", APIUser: "user", APIKey: "key",
+		CallbackURL: "https://api.example.com/payments/webhook/mtn", WebhookSecret: "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("NewMTN: %v", err)
+	}
+	charge, err := m.RequestPayment(ctx, Request{Reference: "r1", AmountCents: 50000, Currency: "UGX", Phone: "+256 772 123456"})
+	if err != nil {
+		t.Fatalf("RequestPayment: %v", err)
+	}
+	if charge.ProviderRef != ref || len(ref) != 36 {
+		t.Fatalf("provider ref = %q, reference id header = %q", charge.ProviderRef, ref)
+	}
+
+	u, err := url.Parse(callback)
+	if err != nil {
+		t.Fatalf("callback URL %q: %v", callback, err)
+	}
+	ev, err := m.ParseWebhook(ctx, webhookRequest(t, u.RequestURI(), []byte(`{"status":"FAILED"}`)), nil)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	// The outcome comes from the API, not the callback body.
+	if ev.ProviderRef != ref || ev.Status != StatusSucceeded || ev.AmountCents != 50000 {
+		t.Fatalf("event = %+v", *ev)
+	}
+
+	forged := "/payments/webhook/mtn?ref=" + ref + "&sig=00"
+	if _, err := m.ParseWebhook(ctx, webhookRequest(t, forged, nil), nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged callback: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestAirtelWebhookHash(t *testing.T) {
+	a, err := NewAirtel(AirtelConfig{BaseURL: "https://openapiuat.airtel.africa", ClientID: "id", ClientSecret: "secret", WebhookSecret: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewAirtel: %v", err)
+	}
+	if got := a.msisdn("+256 752 123456"); got != "752123456" {
+		t.Errorf("msisdn = %q, want 752123456", got)
+	}
+
+	tx := `{"id":"r1","message":"Paid UGX 50,000","status_code":"TS","airtel_money_id":"MP1"}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(tx))
+	body := []byte(`{"transaction":` + tx + `,"hash":"` + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `"}`)
+	ev, err := a.ParseWebhook(context.Background(), webhookRequest(t, "/payments/webhook/airtel", body), body)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if ev.ProviderRef != "r1" || ev.Status != StatusSucceeded {
+		t.Fatalf("event = %+v", *ev)
+	}
+
+	forged := []byte(strings.Replace(string(body), `"TS"`, `"TF"`, 1))
+	if _, err := a.ParseWebhook(context.Background(), webhookRequest(t, "/payments/webhook/airtel", forged), forged); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged webhook: got %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestCardWebhookHash(t *testing.T) {
+	c, err := NewCard(CardConfig{SecretKey: "sk", WebhookHash: "s3cret", RedirectURL: "https://example.com/booked"})
+	if err != nil {
+		t.Fatalf("NewCard: %v", err)
+	}
+	body := []byte(`{"event":"charge.completed","data":{"tx_ref":"r1","amount":25.5,"currency":"USD","status":"successful"}}`)
+	r := webhookRequest(t, "/payments/webhook/card", body)
+	r.Header.Set("verif-hash", "s3cret")
+	ev, err := c.ParseWebhook(context.Background(), r, body)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	want := Event{ProviderRef: "r1", Status: StatusSucceeded, AmountCents: 2550, Currency: "USD"}
+	if *ev != want {
+		t.Fatalf("event = %+v, want %+v", *ev, want)
+	}
+
+	r = webhookRequest(t, "/payments/webhook/card", body)
+	r.Header.Set("verif-hash", "guess")
+	if _, err := c.ParseWebhook(context.Background(), r, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("wrong hash: got %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,2105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"lucys-beauty-parlour-backend/models"
+)
+
+// runStoreContract runs the behaviour every Store implementation must share.
+// newStore must return an empty store for each call.
+func runStoreContract(t *testing.T, newStore func(t *testing.T) Store) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, s Store)
+	}{
+		{"AppointmentRoundTrip", testAppointmentRoundTrip},
+		{"AppointmentNotFound", testAppointmentNotFound},
+		{"AppointmentUnknownServiceConflicts", testAppointmentUnknownServiceConflicts},
+		{"AppointmentPagination", testAppointmentPagination},
+		{"AppointmentListFiltersAndSorts", testAppointmentListFiltersAndSorts},
+		{"AppointmentSlotAvailability", testAppointmentSlotAvailability},
+		{"ConcurrentBookingsRespectCapacity", testConcurrentBookingsRespectCapacity},
+		{"ConfirmingAtCapacityFails", testConfirmingAtCapacityFails},
+		{"CancelAppointment", testCancelAppointment},
+		{"UpdateCannotCancel", testUpdateCannotCancel},
+		{"ServiceItemCRUD", testServiceItemCRUD},
+		{"ServiceItemPurgeWithAppointmentsConflicts", testServiceItemPurgeWithAppointmentsConflicts},
+		{"ListServiceItemsFilters", testListServiceItemsFilters},
+		{"PortfolioItemCRUD", testPortfolioItemCRUD},
+		{"ListPortfolioItemsFilters", testListPortfolioItemsFilters},
+		{"PortfolioItemDetails", testPortfolioItemDetails},
+		{"PortfolioItemUnknownServiceConflicts", testPortfolioItemUnknownServiceConflicts},
+		{"ListPortfolioItemsGalleryFilters", testListPortfolioItemsGalleryFilters},
+		{"ReorderPortfolioItems", testReorderPortfolioItems},
+		{"MenuItemCRUD", testMenuItemCRUD},
+		{"ListMenuItemsFilters", testListMenuItemsFilters},
+		{"ServiceVariants", testServiceVariants},
+		{"ImportMenuItemsIsAtomic", testImportMenuItemsIsAtomic},
+		{"ImportServiceItemsIsAtomic", testImportServiceItemsIsAtomic},
+		{"CategoryCRUD", testCategoryCRUD},
+		{"CategoryRenameMovesItems", testCategoryRenameMovesItems},
+		{"UnknownCategoryConflicts", testUnknownCategoryConflicts},
+		{"ReviewLinkIsSingleUse", testReviewLinkIsSingleUse},
+		{"ReviewModerationComputesRating", testReviewModerationComputesRating},
+		{"PaymentsConfirmBookingOnceDepositPaid", testPaymentsConfirmBookingOnceDepositPaid},
+		{"PaymentSettlementRespectsCapacity", testPaymentSettlementRespectsCapacity},
+		{"CancellationRefundsPayments", testCancellationRefundsPayments},
+		{"LatePaymentIsRefunded", testLatePaymentIsRefunded},
+		{"InvoicesAreIssuedOnce", testInvoicesAreIssuedOnce},
+		{"VoucherCRUD", testVoucherCRUD},
+		{"VoucherRedemptionLimits", testVoucherRedemptionLimits},
+		{"LoyaltyPoints", testLoyaltyPoints},
+		{"ReportAppointments", testReportAppointments},
+		{"EachAppointmentFilters", testEachAppointmentFilters},
+		{"EachCustomer", testEachCustomer},
+		{"TrashHidesDeletedItems", testTrashHidesDeletedItems},
+		{"TrashRestoreAndPurge", testTrashRestoreAndPurge},
+		{"TrashRestoreRespectsCapacity", testTrashRestoreRespectsCapacity},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newStore(t))
+		})
+	}
+}
+
+func mustCreateService(t *testing.T, s Store, it *models.ServiceItem) *models.ServiceItem {
+	t.Helper()
+	created, err := s.CreateServiceItem(context.Background(), it)
+	if err != nil {
+		t.Fatalf("CreateServiceItem: %v", err)
+	}
+	return created
+}
+
+func newTestAppointment(serviceID int64, date, status string) *models.Appointment {
+	return &models.Appointment{
+		CustomerName:       "Amina N.",
+		CustomerEmail:      "amina@example.com",
+		CustomerPhone:      "+256700000000",
+		StaffName:          "Lucy",
+		Date:               date,
+		Time:               "10:30",
+		ServiceID:          serviceID,
+		ServiceDescription: "Medium",
+		Currency:           "UGX",
+		PriceCents:         150000,
+		Notes:              "",
+		Status:             status,
+	}
+}
+
+func mustCreateAppointment(t *testing.T, s Store, a *models.Appointment) *models.Appointment {
+	t.Helper()
+	created, err := s.CreateAppointment(context.Background(), a)
+	if err != nil {
+		t.Fatalf("CreateAppointment: %v", err)
+	}
+	return created
+}
+
+func testAppointmentRoundTrip(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Knotless Braids", Descriptions: []string{"Small", "Medium"}})
+	created := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "pending"))
+	if created.ID <= 0 {
+		t.Fatalf("expected an assigned ID, got %d", created.ID)
+	}
+
+	got, err := s.GetAppointment(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetAppointment: %v", err)
+	}
+	want := newTestAppointment(svc.ID, "2026-03-14", "pending")
+	want.ID = created.ID
+	if *got != *want {
+		t.Fatalf("GetAppointment = %+v, want %+v", *got, *want)
+	}
+
+	got.Status = "confirmed"
+	got.Time = "14:00"
+	if _, err := s.UpdateAppointment(ctx, got.ID, got); err != nil {
+		t.Fatalf("UpdateAppointment: %v", err)
+	}
+	again, err := s.GetAppointment(ctx, got.ID)
+	if err != nil {
+		t.Fatalf("GetAppointment after update: %v", err)
+	}
+	if again.Status != "confirmed" || again.Time != "14:00" {
+		t.Fatalf("update not persisted: %+v", *again)
+	}
+
+	if err := s.DeleteAppointment(ctx, got.ID); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+	if _, err := s.GetAppointment(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAppointment after delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func testAppointmentNotFound(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel Manicure", Descriptions: []string{}})
+
+	if _, err := s.GetAppointment(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAppointment: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.UpdateAppointment(ctx, 999, newTestAppointment(svc.ID, "2026-03-14", "pending")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateAppointment: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteAppointment(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteAppointment: got %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.CancelAppointment(ctx, 999, models.Cancellation{By: "admin"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CancelAppointment: got %v, want ErrNotFound", err)
+	}
+}
+
+func testAppointmentUnknownServiceConflicts(t *testing.T, s Store) {
+	_, err := s.CreateAppointment(context.Background(), newTestAppointment(4242, "2026-03-14", "pending"))
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreateAppointment with unknown service: got %v, want ErrConflict", err)
+	}
+}
+
+func testAppointmentPagination(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Soft Locs", Descriptions: []string{}})
+	ids := make([]int64, 0, 5)
+	for i := 0; i < 5; i++ {
+		ids = append(ids, mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "pending")).ID)
+	}
+
+	page, total, err := s.GetAppointmentsWithPagination(ctx, AppointmentFilter{}, "", 1, 2)
+	if err != nil {
+		t.Fatalf("GetAppointmentsWithPagination: %v", err)
+	}
+	if total != 5 {
+		t.Fatalf("total = %d, want 5", total)
+	}
+	if len(page) != 2 || page[0].ID != ids[3] || page[1].ID != ids[2] {
+		t.Fatalf("page = %v, want IDs %d,%d (newest first)", appointmentIDs(page), ids[3], ids[2])
+	}
+
+	all, total, err := s.GetAppointmentsWithPagination(ctx, AppointmentFilter{}, "", 0, 0)
+	if err != nil {
+		t.Fatalf("GetAppointmentsWithPagination(limit=0): %v", err)
+	}
+	if total != 5 || len(all) != 5 {
+		t.Fatalf("limit=0 returned %d of %d, want all 5", len(all), total)
+	}
+
+	listed, err := s.GetAllAppointments(ctx)
+	if err != nil {
+		t.Fatalf("GetAllAppointments: %v", err)
+	}
+	if fmt.Sprint(appointmentIDs(listed)) != fmt.Sprint(appointmentIDs(all)) {
+		t.Fatalf("GetAllAppointments order %v differs from paginated order %v", appointmentIDs(listed), appointmentIDs(all))
+	}
+}
+
+func appointmentIDs(in []*models.Appointment) []int64 {
+	out := make([]int64, 0, len(in))
+	for _, a := range in {
+		out = append(out, a.ID)
+	}
+	return out
+}
+
+func testAppointmentListFiltersAndSorts(t *testing.T, s Store) {
+	ctx := context.Background()
+	nails := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel", Descriptions: []string{}})
+	hair := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{}})
+	book := func(svc *models.ServiceItem, date, clock, status, name, phone string, price int64) int64 {
+		a := newTestAppointment(svc.ID, date, status)
+		a.Time, a.CustomerName, a.CustomerPhone, a.PriceCents = clock, name, phone, price
+		a.CustomerEmail = strings.ToLower(name) + "@example.com"
+		a.StaffName = "Grace"
+		return mustCreateAppointment(t, s, a).ID
+	}
+	zawadi := book(nails, "2026-05-04", "10:00", "pending", "Zawadi", "+256-700 111222", 30000)
+	amina := book(nails, "2026-05-05", "09:00", "pending", "Amina", "0755897061", 50000)
+	brenda := book(hair, "2026-05-04", "15:00", "pending", "Brenda", "0700333444", 40000)
+	later := book(nails, "2026-05-20", "09:00", "confirmed", "Amina", "0755897061", 20000)
+
+	list := func(f AppointmentFilter, sort AppointmentSort) []int64 {
+		t.Helper()
+		page, total, err := s.GetAppointmentsWithPagination(ctx, f, sort, 0, 0)
+		if err != nil {
+			t.Fatalf("GetAppointmentsWithPagination(%+v, %q): %v", f, sort, err)
+		}
+		if total != len(page) {
+			t.Fatalf("GetAppointmentsWithPagination(%+v) total = %d for %d appointments", f, total, len(page))
+		}
+		return appointmentIDs(page)
+	}
+	cases := []struct {
+		f    AppointmentFilter
+		sort AppointmentSort
+		want []int64
+	}{
+		{AppointmentFilter{}, "", []int64{later, brenda, amina, zawadi}},
+		{AppointmentFilter{}, AppointmentsOldest, []int64{zawadi, amina, brenda, later}},
+		{AppointmentFilter{}, AppointmentsByDate, []int64{zawadi, brenda, amina, later}},
+		{AppointmentFilter{}, AppointmentsByDateDesc, []int64{later, amina, brenda, zawadi}},
+		{AppointmentFilter{}, AppointmentsByCustomer, []int64{amina, later, brenda, zawadi}},
+		{AppointmentFilter{}, AppointmentsByPriceDesc, []int64{amina, brenda, zawadi, later}},
+		// "All pending nails bookings next week."
+		{AppointmentFilter{Status: "pending", Category: "nails", From: "2026-05-04", To: "2026-05-10"}, AppointmentsByDate, []int64{zawadi, amina}},
+		{AppointmentFilter{ServiceID: hair.ID, StaffName: "grace"}, "", []int64{brenda}},
+		{AppointmentFilter{Query: "AMI"}, AppointmentsByDate, []int64{amina, later}},
+		{AppointmentFilter{Query: "brenda@"}, "", []int64{brenda}},
+		{AppointmentFilter{Query: "700 111"}, "", []int64{zawadi}},
+		{AppointmentFilter{Query: "nobody"}, "", []int64{}},
+	}
+	for _, tc := range cases {
+		if got := list(tc.f, tc.sort); !slices.Equal(got, tc.want) {
+			t.Errorf("GetAppointmentsWithPagination(%+v, %q) = %v, want %v", tc.f, tc.sort, got, tc.want)
+		}
+	}
+
+	page, total, err := s.GetAppointmentsWithPagination(ctx, AppointmentFilter{Category: "nails"}, AppointmentsByDate, 1, 1)
+	if err != nil {
+		t.Fatalf("GetAppointmentsWithPagination: %v", err)
+	}
+	if total != 3 || len(page) != 1 || page[0].ID != amina {
+		t.Fatalf("second nails page = %v of %d, want [%d] of 3", appointmentIDs(page), total, amina)
+	}
+}
+
+func testAppointmentSlotAvailability(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Wig Install", Descriptions: []string{}})
+	for i := 0; i < maxConfirmedAppointmentsPerDay-1; i++ {
+		mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	}
+	// Pending and cancelled bookings do not use up capacity.
+	mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "pending"))
+	mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "cancelled"))
+
+	ok, err := s.IsAppointmentSlotAvailable(ctx, "2026-03-14")
+	if err != nil || !ok {
+		t.Fatalf("IsAppointmentSlotAvailable with %d confirmed = %v, %v; want true", maxConfirmedAppointmentsPerDay-1, ok, err)
+	}
+
+	mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	ok, err = s.IsAppointmentSlotAvailable(ctx, "2026-03-14")
+	if err != nil || ok {
+		t.Fatalf("IsAppointmentSlotAvailable at capacity = %v, %v; want false", ok, err)
+	}
+
+	ok, err = s.IsAppointmentSlotAvailable(ctx, "2026-03-15")
+	if err != nil || !ok {
+		t.Fatalf("IsAppointmentSlotAvailable on another day = %v, %v; want true", ok, err)
+	}
+}
+
+func testConcurrentBookingsRespectCapacity(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Butterfly Locs", Descriptions: []string{}})
+	// One slot is left; every parallel booking races for it.
+	for i := 0; i < maxConfirmedAppointmentsPerDay-1; i++ {
+		mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	}
+
+	const attempts = 20
+	var (
+		wg          sync.WaitGroup
+		start       = make(chan struct{})
+		errs        = make(chan error, attempts)
+		unavailable int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := s.CreateAppointment(ctx, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	booked := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			booked++
+		case errors.Is(err, ErrSlotUnavailable):
+			unavailable++
+		default:
+			t.Errorf("CreateAppointment: unexpected error %v", err)
+		}
+	}
+	if booked != 1 || unavailable != attempts-1 {
+		t.Fatalf("parallel bookings: %d booked, %d rejected; want 1 and %d", booked, unavailable, attempts-1)
+	}
+
+	confirmed := 0
+	all, err := s.GetAllAppointments(ctx)
+	if err != nil {
+		t.Fatalf("GetAllAppointments: %v", err)
+	}
+	for _, a := range all {
+		if a.Date == "2026-03-14" && a.Status == "confirmed" {
+			confirmed++
+		}
+	}
+	if confirmed != maxConfirmedAppointmentsPerDay {
+		t.Fatalf("%d confirmed appointments on the day, want exactly %d", confirmed, maxConfirmedAppointmentsPerDay)
+	}
+}
+
+func testConfirmingAtCapacityFails(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Refill Builder", Descriptions: []string{}})
+	pending := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "pending"))
+	for i := 0; i < maxConfirmedAppointmentsPerDay; i++ {
+		mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	}
+
+	if _, err := s.CreateAppointment(ctx, newTestAppointment(svc.ID, "2026-03-14", "pending")); !errors.Is(err, ErrSlotUnavailable) {
+		t.Errorf("CreateAppointment on a full day: got %v, want ErrSlotUnavailable", err)
+	}
+
+	pending.Status = "confirmed"
+	if _, err := s.UpdateAppointment(ctx, pending.ID, pending); !errors.Is(err, ErrSlotUnavailable) {
+		t.Fatalf("confirming on a full day: got %v, want ErrSlotUnavailable", err)
+	}
+
+	// Re-saving an already confirmed booking does not count against itself.
+	all, _ := s.GetAllAppointments(ctx)
+	for _, a := range all {
+		if a.Status == "confirmed" {
+			a.Notes = "bring own hair"
+			if _, err := s.UpdateAppointment(ctx, a.ID, a); err != nil {
+				t.Fatalf("updating a confirmed booking on a full day: %v", err)
+			}
+			break
+		}
+	}
+}
+
+func testCancelAppointment(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel on Toes", Descriptions: []string{}})
+	created := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+
+	cancelled, refunds, err := s.CancelAppointment(ctx, created.ID, models.Cancellation{By: "admin", Reason: "Stylist unwell"})
+	if err != nil {
+		t.Fatalf("CancelAppointment: %v", err)
+	}
+	if cancelled.Status != "cancelled" || cancelled.CustomerEmail != created.CustomerEmail || len(refunds) != 0 {
+		t.Fatalf("CancelAppointment returned %+v, %v", *cancelled, refunds)
+	}
+	got, err := s.GetAppointment(ctx, created.ID)
+	if err != nil || got.Status != "cancelled" || got.CancelledBy != "admin" || got.CancellationReason != "Stylist unwell" || got.CancelledAt == "" {
+		t.Fatalf("after cancel = %+v, %v; want cancelled by admin", got, err)
+	}
+	if _, _, err := s.CancelAppointment(ctx, created.ID, models.Cancellation{By: "admin"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("cancelling twice: got %v, want ErrConflict", err)
+	}
+
+	// Customers cancel through the link whose hash was stored at booking.
+	a := newTestAppointment(svc.ID, "2026-03-15", "pending")
+	a.CancelTokenHash = "cancel-hash"
+	booked := mustCreateAppointment(t, s, a)
+	byToken, err := s.GetAppointmentByCancelToken(ctx, "cancel-hash")
+	if err != nil || byToken.ID != booked.ID {
+		t.Fatalf("GetAppointmentByCancelToken = %v, %v; want appointment %d", byToken, err, booked.ID)
+	}
+	if _, err := s.GetAppointmentByCancelToken(ctx, "other-hash"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown cancel token: got %v, want ErrNotFound", err)
+	}
+	noShow, _, err := s.CancelAppointment(ctx, booked.ID, models.Cancellation{By: "admin", NoShow: true, FeeCents: 5000})
+	if err != nil || noShow.Status != "no_show" || noShow.CancellationFeeCents != 5000 {
+		t.Fatalf("no-show = %+v, %v", noShow, err)
+	}
+}
+
+func testUpdateCannotCancel(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel on Toes", Descriptions: []string{}})
+	created := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+
+	// Cancelling goes through CancelAppointment, which applies the policy.
+	for _, status := range []string{"cancelled", "no_show"} {
+		upd := *created
+		upd.Status = status
+		if _, err := s.UpdateAppointment(ctx, created.ID, &upd); !errors.Is(err, ErrConflict) {
+			t.Fatalf("UpdateAppointment to %s: got %v, want ErrConflict", status, err)
+		}
+	}
+	if got, _ := s.GetAppointment(ctx, created.ID); got.Status != "confirmed" {
+		t.Fatalf("status after refused updates = %q, want confirmed", got.Status)
+	}
+
+	// A cancelled appointment's other details can still be edited.
+	if _, _, err := s.CancelAppointment(ctx, created.ID, models.Cancellation{By: "admin"}); err != nil {
+		t.Fatalf("CancelAppointment: %v", err)
+	}
+	cancelled, _ := s.GetAppointment(ctx, created.ID)
+	cancelled.Notes = "Rebooked by phone"
+	if updated, err := s.UpdateAppointment(ctx, created.ID, cancelled); err != nil || updated.Notes != "Rebooked by phone" {
+		t.Fatalf("editing a cancelled appointment = %+v, %v", updated, err)
+	}
+
+	// Nor can an update reopen it, or turn it into a no-show, since the
+	// cancellation already gave its payments back.
+	noShow := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-15", "confirmed"))
+	if _, _, err := s.CancelAppointment(ctx, noShow.ID, models.Cancellation{By: "admin", NoShow: true}); err != nil {
+		t.Fatalf("CancelAppointment no-show: %v", err)
+	}
+	for _, id := range []int64{created.ID, noShow.ID} {
+		before, _ := s.GetAppointment(ctx, id)
+		for _, status := range []string{"pending", "confirmed", "completed", "cancelled", "no_show"} {
+			if status == before.Status {
+				continue
+			}
+			upd := *before
+			upd.Status = status
+			if _, err := s.UpdateAppointment(ctx, id, &upd); !errors.Is(err, ErrConflict) {
+				t.Fatalf("UpdateAppointment %s to %s: got %v, want ErrConflict", before.Status, status, err)
+			}
+		}
+		if got, _ := s.GetAppointment(ctx, id); got.Status != before.Status {
+			t.Fatalf("status after refused updates = %q, want %q", got.Status, before.Status)
+		}
+	}
+}
+
+func testServiceItemCRUD(t *testing.T, s Store) {
+	ctx := context.Background()
+	first := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "French Curls", Descriptions: []string{"Short", "Long"}, Rating: 4.5, Image: "/media/images/curls.jpg"})
+	if first.Rating != 0 {
+		t.Errorf("CreateServiceItem kept a written rating of %v; ratings come from reviews", first.Rating)
+	}
+	seeded := mustCreateService(t, s, &models.ServiceItem{ID: 40, Service: "makeup", Name: "Soft Glam", Descriptions: []string{}})
+	next := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "3D Glass", Descriptions: []string{}})
+	if seeded.ID != 40 {
+		t.Fatalf("explicit ID not kept: got %d", seeded.ID)
+	}
+	if next.ID <= seeded.ID || next.ID == first.ID {
+		t.Fatalf("generated ID %d should follow the highest existing ID %d", next.ID, seeded.ID)
+	}
+
+	got, err := s.GetServiceItem(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("GetServiceItem: %v", err)
+	}
+	if got.Name != "French Curls" || got.Rating != 0 || fmt.Sprint(got.Descriptions) != "[Short Long]" || got.Image != "/media/images/curls.jpg" {
+		t.Fatalf("GetServiceItem = %+v", *got)
+	}
+
+	got.Name = "French Curls (Bohemian)"
+	got.Descriptions = []string{"Medium"}
+	if _, err := s.UpdateServiceItem(ctx, got.ID, got); err != nil {
+		t.Fatalf("UpdateServiceItem: %v", err)
+	}
+	again, _ := s.GetServiceItem(ctx, got.ID)
+	if again.Name != "French Curls (Bohemian)" || fmt.Sprint(again.Descriptions) != "[Medium]" {
+		t.Fatalf("update not persisted: %+v", *again)
+	}
+
+	if _, err := s.UpdateServiceItem(ctx, 999, got); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateServiceItem missing: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteServiceItem(ctx, got.ID); err != nil {
+		t.Fatalf("DeleteServiceItem: %v", err)
+	}
+	if _, err := s.GetServiceItem(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetServiceItem after delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteServiceItem(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteServiceItem twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func testServiceItemPurgeWithAppointmentsConflicts(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Sew-ins", Descriptions: []string{}})
+	mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "pending"))
+	if err := s.DeleteServiceItem(ctx, svc.ID); err != nil {
+		t.Fatalf("DeleteServiceItem with bookings: %v", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashServices, svc.ID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("PurgeFromTrash of a booked service: got %v, want ErrConflict", err)
+	}
+}
+
+func testListServiceItemsFilters(t *testing.T, s Store) {
+	ctx := context.Background()
+	braids := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Knotless Braids", Descriptions: []string{"Small", "Large"}})
+	gel := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel Manicure", Descriptions: []string{"Short"}})
+	twists := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Passion Twists", Descriptions: []string{"Medium"}})
+	mustCreateService(t, s, &models.ServiceItem{Service: "makeup", Name: "Eyebrow Trimming", Descriptions: []string{}})
+	mustReview(t, s, braids.ID, 5, "approved")
+	mustReview(t, s, braids.ID, 4, "approved")
+	mustReview(t, s, gel.ID, 4, "approved")
+	mustReview(t, s, gel.ID, 3, "approved")
+	mustReview(t, s, twists.ID, 4, "approved")
+
+	names := func(items []*models.ServiceItem) string {
+		out := make([]string, 0, len(items))
+		for _, it := range items {
+			out = append(out, it.Name)
+		}
+		return fmt.Sprint(out)
+	}
+
+	tests := []struct {
+		category  string
+		minRating float64
+		q         string
+		offset    int
+		limit     int
+		want      string
+		wantTotal int
+	}{
+		{"", 0, "", 0, 0, "[Knotless Braids Gel Manicure Passion Twists Eyebrow Trimming]", 4},
+		{"hair", 0, "", 0, 10, "[Knotless Braids Passion Twists]", 2},
+		{"", 4.0, "", 0, 10, "[Knotless Braids Passion Twists]", 2},
+		{"", 0, "  LARGE ", 0, 10, "[Knotless Braids]", 1},
+		{"", 0, "gel", 0, 10, "[Gel Manicure]", 1},
+		{"", 0, "", 1, 2, "[Gel Manicure Passion Twists]", 4},
+		{"", 0, "", 10, 2, "[]", 4},
+	}
+	for _, tt := range tests {
+		items, total, err := s.ListServiceItems(ctx, tt.category, tt.minRating, tt.q, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("ListServiceItems(%q, %v, %q): %v", tt.category, tt.minRating, tt.q, err)
+		}
+		if got := names(items); got != tt.want || total != tt.wantTotal {
+			t.Errorf("ListServiceItems(%q, %v, %q, %d, %d) = %s (total %d), want %s (total %d)",
+				tt.category, tt.minRating, tt.q, tt.offset, tt.limit, got, total, tt.want, tt.wantTotal)
+		}
+	}
+}
+
+func testPortfolioItemCRUD(t *testing.T, s Store) {
+	ctx := context.Background()
+	created, err := s.CreatePortfolioItem(ctx, &models.PortfolioItem{
+		Category:    "hair",
+		Style:       "Box Braids",
+		Images:      []string{"https://cdn.example.com/a.jpg", "uploads/b.jpg"},
+		Description: "Waist length box braids",
+	})
+	if err != nil {
+		t.Fatalf("CreatePortfolioItem: %v", err)
+	}
+	if created.ID <= 0 || created.CreatedAt == "" {
+		t.Fatalf("CreatePortfolioItem did not assign ID/CreatedAt: %+v", *created)
+	}
+
+	got, err := s.GetPortfolioItem(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetPortfolioItem: %v", err)
+	}
+	if got.Style != "Box Braids" || fmt.Sprint(got.Images) != "[https://cdn.example.com/a.jpg /uploads/b.jpg]" {
+		t.Fatalf("GetPortfolioItem = %+v", *got)
+	}
+
+	got.Style = "Knotless Box Braids"
+	got.Images = []string{"https://cdn.example.com/c.jpg"}
+	upd, err := s.UpdatePortfolioItem(ctx, got.ID, got)
+	if err != nil {
+		t.Fatalf("UpdatePortfolioItem: %v", err)
+	}
+	if upd.CreatedAt != created.CreatedAt {
+		t.Errorf("UpdatePortfolioItem changed CreatedAt from %q to %q", created.CreatedAt, upd.CreatedAt)
+	}
+	again, _ := s.GetPortfolioItem(ctx, got.ID)
+	if again.Style != "Knotless Box Braids" || fmt.Sprint(again.Images) != "[https://cdn.example.com/c.jpg]" {
+		t.Fatalf("update not persisted: %+v", *again)
+	}
+
+	if _, err := s.UpdatePortfolioItem(ctx, 999, got); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdatePortfolioItem missing: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeletePortfolioItem(ctx, got.ID); err != nil {
+		t.Fatalf("DeletePortfolioItem: %v", err)
+	}
+	if _, err := s.GetPortfolioItem(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPortfolioItem after delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeletePortfolioItem(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeletePortfolioItem twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func testListPortfolioItemsFilters(t *testing.T, s Store) {
+	ctx := context.Background()
+	for _, it := range []*models.PortfolioItem{
+		{Category: "hair", Style: "Box Braids", Images: []string{"https://x/1.jpg"}, Description: "Classic look"},
+		{Category: "makeup", Style: "Soft Glam", Images: []string{"https://x/2.jpg"}, Description: "Bridal party"},
+		{Category: "hair", Style: "Fulani", Images: []string{"https://x/3.jpg"}, Description: "With beads for a bride"},
+	} {
+		if _, err := s.CreatePortfolioItem(ctx, it); err != nil {
+			t.Fatalf("CreatePortfolioItem: %v", err)
+		}
+	}
+
+	styles := func(items []*models.PortfolioItem) string {
+		out := make([]string, 0, len(items))
+		for _, it := range items {
+			out = append(out, it.Style)
+		}
+		return fmt.Sprint(out)
+	}
+
+	tests := []struct {
+		category  string
+		q         string
+		offset    int
+		limit     int
+		want      string
+		wantTotal int
+	}{
+		{"", "", 0, 0, "[Fulani Soft Glam Box Braids]", 3},
+		{"hair", "", 0, 10, "[Fulani Box Braids]", 2},
+		{"", "BRID", 0, 10, "[Fulani Soft Glam]", 2},
+		{"hair", "brid", 0, 10, "[Fulani]", 1},
+		{"", "", 1, 1, "[Soft Glam]", 3},
+	}
+	for _, tt := range tests {
+		items, total, err := s.ListPortfolioItems(ctx, PortfolioFilter{Category: tt.category, Query: tt.q}, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("ListPortfolioItems(%q, %q): %v", tt.category, tt.q, err)
+		}
+		if got := styles(items); got != tt.want || total != tt.wantTotal {
+			t.Errorf("ListPortfolioItems(%q, %q, %d, %d) = %s (total %d), want %s (total %d)",
+				tt.category, tt.q, tt.offset, tt.limit, got, total, tt.want, tt.wantTotal)
+		}
+	}
+}
+
+func testPortfolioItemDetails(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{"Any length"}})
+	created, err := s.CreatePortfolioItem(ctx, &models.PortfolioItem{
+		Category:      "hair",
+		Style:         "Silk Press",
+		Images:        []string{"https://x/before.jpg", "https://x/after.jpg"},
+		Description:   "Natural hair to silk press",
+		Captions:      []string{"Before", "After"},
+		BeforeAfter:   []models.ImagePair{{Before: 0, After: 1}},
+		ServiceItemID: &svc.ID,
+		Tags:          []string{"natural", "silk-press"},
+		Featured:      true,
+	})
+	if err != nil {
+		t.Fatalf("CreatePortfolioItem: %v", err)
+	}
+
+	got, err := s.GetPortfolioItem(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetPortfolioItem: %v", err)
+	}
+	if fmt.Sprint(got.Captions) != "[Before After]" || fmt.Sprint(got.BeforeAfter) != "[{0 1}]" ||
+		got.ServiceItemID == nil || *got.ServiceItemID != svc.ID || fmt.Sprint(got.Tags) != "[natural silk-press]" || !got.Featured {
+		t.Fatalf("GetPortfolioItem = %+v", *got)
+	}
+
+	got.ServiceItemID = nil
+	got.Tags = nil
+	got.Featured = false
+	if _, err := s.UpdatePortfolioItem(ctx, got.ID, got); err != nil {
+		t.Fatalf("UpdatePortfolioItem: %v", err)
+	}
+	again, _ := s.GetPortfolioItem(ctx, got.ID)
+	if again.ServiceItemID != nil || len(again.Tags) != 0 || again.Featured || len(again.Captions) != 2 {
+		t.Fatalf("update not persisted: %+v", *again)
+	}
+
+	// Purging the linked service unlinks the item rather than failing.
+	again.ServiceItemID = &svc.ID
+	if _, err := s.UpdatePortfolioItem(ctx, again.ID, again); err != nil {
+		t.Fatalf("UpdatePortfolioItem: %v", err)
+	}
+	if err := s.DeleteServiceItem(ctx, svc.ID); err != nil {
+		t.Fatalf("DeleteServiceItem: %v", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashServices, svc.ID); err != nil {
+		t.Fatalf("PurgeFromTrash: %v", err)
+	}
+	if after, _ := s.GetPortfolioItem(ctx, again.ID); after.ServiceItemID != nil {
+		t.Errorf("ServiceItemID after purging service = %d, want nil", *after.ServiceItemID)
+	}
+}
+
+func testPortfolioItemUnknownServiceConflicts(t *testing.T, s Store) {
+	missing := int64(999)
+	_, err := s.CreatePortfolioItem(context.Background(), &models.PortfolioItem{
+		Category: "hair", Style: "Locs", Images: []string{"https://x/1.jpg"}, Description: "Starter locs", ServiceItemID: &missing,
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreatePortfolioItem with unknown service: got %v, want ErrConflict", err)
+	}
+}
+
+func portfolioStyles(items []*models.PortfolioItem) string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.Style)
+	}
+	return fmt.Sprint(out)
+}
+
+func testListPortfolioItemsGalleryFilters(t *testing.T, s Store) {
+	ctx := context.Background()
+	braids := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{"Any length"}})
+	glam := mustCreateService(t, s, &models.ServiceItem{Service: "makeup", Name: "Glam", Descriptions: []string{"Full face"}})
+	for _, it := range []*models.PortfolioItem{
+		{Category: "hair", Style: "Box Braids", Images: []string{"https://x/1.jpg"}, Description: "Classic", ServiceItemID: &braids.ID, Tags: []string{"protective"}},
+		{Category: "makeup", Style: "Soft Glam", Images: []string{"https://x/2.jpg"}, Description: "Bridal", ServiceItemID: &glam.ID, Tags: []string{"bridal"}, Featured: true},
+		{Category: "hair", Style: "Fulani", Images: []string{"https://x/3.jpg"}, Description: "Beads", ServiceItemID: &braids.ID, Tags: []string{"protective", "bridal"}},
+	} {
+		if _, err := s.CreatePortfolioItem(ctx, it); err != nil {
+			t.Fatalf("CreatePortfolioItem: %v", err)
+		}
+	}
+
+	tests := []struct {
+		filter    PortfolioFilter
+		want      string
+		wantTotal int
+	}{
+		{PortfolioFilter{}, "[Soft Glam Fulani Box Braids]", 3},
+		{PortfolioFilter{Tag: "bridal"}, "[Soft Glam Fulani]", 2},
+		{PortfolioFilter{ServiceItemID: braids.ID}, "[Fulani Box Braids]", 2},
+		{PortfolioFilter{Tag: "protective", Query: "bead"}, "[Fulani]", 1},
+		{PortfolioFilter{FeaturedOnly: true}, "[Soft Glam]", 1},
+		{PortfolioFilter{Tag: "updo"}, "[]", 0},
+	}
+	for _, tt := range tests {
+		items, total, err := s.ListPortfolioItems(ctx, tt.filter, 0, 10)
+		if err != nil {
+			t.Fatalf("ListPortfolioItems(%+v): %v", tt.filter, err)
+		}
+		if got := portfolioStyles(items); got != tt.want || total != tt.wantTotal {
+			t.Errorf("ListPortfolioItems(%+v) = %s (total %d), want %s (total %d)", tt.filter, got, total, tt.want, tt.wantTotal)
+		}
+	}
+}
+
+func testReorderPortfolioItems(t *testing.T, s Store) {
+	ctx := context.Background()
+	ids := make([]int64, 0, 3)
+	for _, style := range []string{"A", "B", "C"} {
+		it, err := s.CreatePortfolioItem(ctx, &models.PortfolioItem{Category: "nails", Style: style, Images: []string{"https://x/1.jpg"}, Description: style})
+		if err != nil {
+			t.Fatalf("CreatePortfolioItem: %v", err)
+		}
+		ids = append(ids, it.ID)
+	}
+
+	if err := s.ReorderPortfolioItems(ctx, []int64{ids[1], ids[0], ids[2]}); err != nil {
+		t.Fatalf("ReorderPortfolioItems: %v", err)
+	}
+	items, _, _ := s.ListPortfolioItems(ctx, PortfolioFilter{}, 0, 10)
+	if got := portfolioStyles(items); got != "[B A C]" {
+		t.Errorf("order after reorder = %s, want [B A C]", got)
+	}
+
+	// Updates keep the position.
+	b := items[0]
+	b.Description = "Updated"
+	if upd, err := s.UpdatePortfolioItem(ctx, b.ID, b); err != nil || upd.SortOrder != 1 {
+		t.Fatalf("UpdatePortfolioItem = %+v, %v; want SortOrder 1", upd, err)
+	}
+
+	if err := s.ReorderPortfolioItems(ctx, []int64{ids[2], 999}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReorderPortfolioItems with missing id: got %v, want ErrNotFound", err)
+	}
+	items, _, _ = s.ListPortfolioItems(ctx, PortfolioFilter{}, 0, 10)
+	if got := portfolioStyles(items); got != "[B A C]" {
+		t.Errorf("order after failed reorder = %s, want [B A C]", got)
+	}
+}
+
+// mustReview books and completes an appointment for the service, reviews it
+// through a review link and moderates the review to status.
+func mustReview(t *testing.T, s Store, serviceID int64, rating int, status string) *models.Review {
+	t.Helper()
+	ctx := context.Background()
+	a := mustCreateAppointment(t, s, newTestAppointment(serviceID, "2026-02-10", "completed"))
+	token := fmt.Sprintf("token-%d", a.ID)
+	if err := s.CreateReviewInvite(ctx, a.ID, token, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateReviewInvite: %v", err)
+	}
+	r, err := s.SubmitReview(ctx, token, &models.Review{Author: "Amina N.", Rating: rating})
+	if err != nil {
+		t.Fatalf("SubmitReview: %v", err)
+	}
+	if status != "pending" {
+		if r, err = s.ModerateReview(ctx, r.ID, status); err != nil {
+			t.Fatalf("ModerateReview: %v", err)
+		}
+	}
+	return r
+}
+
+func testReviewLinkIsSingleUse(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Wig Install", Descriptions: []string{}})
+	a := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-02-11", "completed"))
+
+	if err := s.CreateReviewInvite(ctx, 999, "missing", time.Now().Add(time.Hour)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CreateReviewInvite for a missing appointment: got %v, want ErrNotFound", err)
+	}
+	if err := s.CreateReviewInvite(ctx, a.ID, "first", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateReviewInvite: %v", err)
+	}
+	// Reissuing replaces the earlier link.
+	if err := s.CreateReviewInvite(ctx, a.ID, "second", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateReviewInvite again: %v", err)
+	}
+	if _, err := s.GetReviewInvite(ctx, "first"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetReviewInvite of a replaced link: got %v, want ErrNotFound", err)
+	}
+	inv, err := s.GetReviewInvite(ctx, "second")
+	if err != nil {
+		t.Fatalf("GetReviewInvite: %v", err)
+	}
+	if inv.AppointmentID != a.ID || inv.ServiceID != svc.ID || inv.CustomerName != a.CustomerName || inv.Date != "2026-02-11" {
+		t.Errorf("GetReviewInvite = %+v", *inv)
+	}
+
+	r, err := s.SubmitReview(ctx, "second", &models.Review{Author: "Amina N.", Rating: 5, Comment: "Lovely"})
+	if err != nil {
+		t.Fatalf("SubmitReview: %v", err)
+	}
+	if r.ID <= 0 || r.Status != "pending" || r.ServiceID != svc.ID || r.AppointmentID == nil || *r.AppointmentID != a.ID || r.CreatedAt == "" {
+		t.Errorf("SubmitReview = %+v", *r)
+	}
+	if _, err := s.SubmitReview(ctx, "second", &models.Review{Author: "Amina N.", Rating: 1}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SubmitReview twice: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetReviewInvite(ctx, "second"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetReviewInvite after use: got %v, want ErrNotFound", err)
+	}
+	if err := s.CreateReviewInvite(ctx, a.ID, "third", time.Now().Add(time.Hour)); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateReviewInvite after review: got %v, want ErrConflict", err)
+	}
+
+	expired := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-02-11", "completed"))
+	if err := s.CreateReviewInvite(ctx, expired.ID, "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("CreateReviewInvite: %v", err)
+	}
+	if _, err := s.SubmitReview(ctx, "expired", &models.Review{Author: "Amina N.", Rating: 4}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SubmitReview with an expired link: got %v, want ErrNotFound", err)
+	}
+}
+
+func testReviewModerationComputesRating(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel on Toes", Descriptions: []string{}})
+	other := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Foot Scrub", Descriptions: []string{}})
+
+	rating := func() (float64, int) {
+		t.Helper()
+		got, err := s.GetServiceItem(ctx, svc.ID)
+		if err != nil {
+			t.Fatalf("GetServiceItem: %v", err)
+		}
+		return got.Rating, got.ReviewCount
+	}
+
+	five := mustReview(t, s, svc.ID, 5, "pending")
+	four := mustReview(t, s, svc.ID, 4, "pending")
+	mustReview(t, s, svc.ID, 4, "approved")
+	mustReview(t, s, other.ID, 1, "approved")
+	if r, n := rating(); r != 4 || n != 1 {
+		t.Fatalf("rating with one approved review = %v (%d), want 4 (1)", r, n)
+	}
+
+	if _, err := s.ModerateReview(ctx, five.ID, "approved"); err != nil {
+		t.Fatalf("ModerateReview: %v", err)
+	}
+	if _, err := s.ModerateReview(ctx, four.ID, "approved"); err != nil {
+		t.Fatalf("ModerateReview: %v", err)
+	}
+	if r, n := rating(); r != 4.3 || n != 3 {
+		t.Errorf("rating after approvals = %v (%d), want 4.3 (3)", r, n)
+	}
+	if _, err := s.ModerateReview(ctx, five.ID, "rejected"); err != nil {
+		t.Fatalf("ModerateReview: %v", err)
+	}
+	if r, n := rating(); r != 4 || n != 2 {
+		t.Errorf("rating after rejection = %v (%d), want 4 (2)", r, n)
+	}
+
+	// Updating the service does not overwrite the computed rating.
+	upd := &models.ServiceItem{Service: "nails", Name: "Gel on Toes", Descriptions: []string{}, Rating: 1}
+	if _, err := s.UpdateServiceItem(ctx, svc.ID, upd); err != nil {
+		t.Fatalf("UpdateServiceItem: %v", err)
+	}
+	if r, n := rating(); r != 4 || n != 2 {
+		t.Errorf("rating after update = %v (%d), want 4 (2)", r, n)
+	}
+
+	if _, err := s.ModerateReview(ctx, 999, "approved"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ModerateReview missing: got %v, want ErrNotFound", err)
+	}
+
+	tests := []struct {
+		filter    ReviewFilter
+		wantTotal int
+	}{
+		{ReviewFilter{}, 4},
+		{ReviewFilter{ServiceID: svc.ID}, 3},
+		{ReviewFilter{ServiceID: svc.ID, Status: "approved"}, 2},
+		{ReviewFilter{Status: "rejected"}, 1},
+		{ReviewFilter{Status: "pending"}, 0},
+	}
+	for _, tt := range tests {
+		items, total, err := s.ListReviews(ctx, tt.filter, 0, 10)
+		if err != nil {
+			t.Fatalf("ListReviews(%+v): %v", tt.filter, err)
+		}
+		if total != tt.wantTotal || len(items) != tt.wantTotal {
+			t.Errorf("ListReviews(%+v) = %d items (total %d), want %d", tt.filter, len(items), total, tt.wantTotal)
+		}
+	}
+}
+
+func testMenuItemCRUD(t *testing.T, s Store) {
+	ctx := context.Background()
+	created, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "hair", Name: "Knotless Braids - Medium", Currency: "UGX", PriceCents: 180000, DurationMinutes: 300})
+	if err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+	got, err := s.GetMenuItem(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetMenuItem: %v", err)
+	}
+	if *got != *created {
+		t.Fatalf("GetMenuItem = %+v, want %+v", *got, *created)
+	}
+
+	got.PriceCents = 200000
+	if _, err := s.UpdateMenuItem(ctx, got.ID, got); err != nil {
+		t.Fatalf("UpdateMenuItem: %v", err)
+	}
+	again, _ := s.GetMenuItem(ctx, got.ID)
+	if again.PriceCents != 200000 {
+		t.Fatalf("update not persisted: %+v", *again)
+	}
+
+	if _, err := s.UpdateMenuItem(ctx, 999, got); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateMenuItem missing: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteMenuItem(ctx, got.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+	if _, err := s.GetMenuItem(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetMenuItem after delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteMenuItem(ctx, got.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteMenuItem twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func testListMenuItemsFilters(t *testing.T, s Store) {
+	ctx := context.Background()
+	for _, it := range []*models.MenuItem{
+		{Category: "hair", Name: "Soft Locs", Currency: "UGX", PriceCents: 200000, DurationMinutes: 360},
+		{Category: "nails", Name: "Gel Soak Off", Currency: "UGX", PriceCents: 20000, DurationMinutes: 30},
+		{Category: "hair", Name: "Butterfly Locs", Currency: "UGX", PriceCents: 220000, DurationMinutes: 360},
+	} {
+		if _, err := s.CreateMenuItem(ctx, it); err != nil {
+			t.Fatalf("CreateMenuItem: %v", err)
+		}
+	}
+
+	names := func(items []*models.MenuItem) string {
+		out := make([]string, 0, len(items))
+		for _, it := range items {
+			out = append(out, it.Name)
+		}
+		return fmt.Sprint(out)
+	}
+
+	tests := []struct {
+		category  string
+		q         string
+		offset    int
+		limit     int
+		want      string
+		wantTotal int
+	}{
+		{"", "", 0, 0, "[Soft Locs Gel Soak Off Butterfly Locs]", 3},
+		{" hair ", "", 0, 10, "[Soft Locs Butterfly Locs]", 2},
+		{"", "LOCS", 0, 10, "[Soft Locs Butterfly Locs]", 2},
+		{"nails", "locs", 0, 10, "[]", 0},
+		{"", "", 2, 5, "[Butterfly Locs]", 3},
+	}
+	for _, tt := range tests {
+		items, total, err := s.ListMenuItems(ctx, tt.category, tt.q, tt.offset, tt.limit)
+		if err != nil {
+			t.Fatalf("ListMenuItems(%q, %q): %v", tt.category, tt.q, err)
+		}
+		if got := names(items); got != tt.want || total != tt.wantTotal {
+			t.Errorf("ListMenuItems(%q, %q, %d, %d) = %s (total %d), want %s (total %d)",
+				tt.category, tt.q, tt.offset, tt.limit, got, total, tt.want, tt.wantTotal)
+		}
+	}
+}
+
+func testServiceVariants(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Knotless Braids", Descriptions: []string{"Small", "Medium"}})
+	other := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Wig Install", Descriptions: []string{}})
+	variant := func(serviceID int64, name string, price int64) *models.MenuItem {
+		return &models.MenuItem{Category: "hair", Name: name, ServiceItemID: &serviceID, Currency: "UGX", PriceCents: price, DurationMinutes: 240}
+	}
+
+	small, err := s.CreateMenuItem(ctx, variant(svc.ID, "Small", 18000000))
+	if err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+	if _, err := s.CreateMenuItem(ctx, variant(svc.ID, "Medium", 15000000)); err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+	if _, err := s.CreateMenuItem(ctx, variant(other.ID, "Small", 9000000)); err != nil {
+		t.Fatalf("CreateMenuItem for another service: %v", err)
+	}
+	if _, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "hair", Name: "Wash", Currency: "UGX", PriceCents: 2000000, DurationMinutes: 30}); err != nil {
+		t.Fatalf("CreateMenuItem without service: %v", err)
+	}
+
+	names := func() string {
+		t.Helper()
+		items, err := s.ListServiceVariants(ctx, svc.ID)
+		if err != nil {
+			t.Fatalf("ListServiceVariants: %v", err)
+		}
+		out := make([]string, 0, len(items))
+		for _, it := range items {
+			out = append(out, fmt.Sprintf("%s:%d", it.Name, it.PriceCents))
+		}
+		return fmt.Sprint(out)
+	}
+	if got := names(); got != "[Small:18000000 Medium:15000000]" {
+		t.Errorf("ListServiceVariants = %s", got)
+	}
+
+	if got, _ := s.GetMenuItem(ctx, small.ID); got.ServiceItemID == nil || *got.ServiceItemID != svc.ID {
+		t.Errorf("GetMenuItem ServiceItemID = %v, want %d", got.ServiceItemID, svc.ID)
+	}
+	if _, err := s.CreateMenuItem(ctx, variant(svc.ID, "MEDIUM", 1)); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateMenuItem with a duplicate variant name: got %v, want ErrConflict", err)
+	}
+	if _, err := s.CreateMenuItem(ctx, variant(999, "Large", 1)); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateMenuItem for an unknown service: got %v, want ErrConflict", err)
+	}
+
+	// A trashed variant frees its name, and cannot come back while it is taken.
+	if err := s.DeleteMenuItem(ctx, small.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+	if _, err := s.CreateMenuItem(ctx, variant(svc.ID, "Small", 19000000)); err != nil {
+		t.Fatalf("CreateMenuItem reusing a trashed variant's name: %v", err)
+	}
+	if got := names(); got != "[Medium:15000000 Small:19000000]" {
+		t.Errorf("ListServiceVariants after replacing Small = %s", got)
+	}
+	if err := s.RestoreFromTrash(ctx, TrashMenuItems, small.ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("RestoreFromTrash of a variant whose name is taken: got %v, want ErrConflict", err)
+	}
+
+	// Purging the service takes its variants with it.
+	if err := s.DeleteServiceItem(ctx, svc.ID); err != nil {
+		t.Fatalf("DeleteServiceItem: %v", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashServices, svc.ID); err != nil {
+		t.Fatalf("PurgeFromTrash: %v", err)
+	}
+	if _, total, _ := s.ListMenuItems(ctx, "", "", 0, 10); total != 2 {
+		t.Errorf("menu items after purging the service = %d, want 2", total)
+	}
+	if err := s.RestoreFromTrash(ctx, TrashMenuItems, small.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("RestoreFromTrash of a purged service's variant: got %v, want ErrNotFound", err)
+	}
+}
+
+func testTrashHidesDeletedItems(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Cornrows", Descriptions: []string{}})
+	gone := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Bantu Knots", Descriptions: []string{}})
+	appt := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	port, err := s.CreatePortfolioItem(ctx, &models.PortfolioItem{Category: "hair", Style: "Cornrows", Images: []string{"https://cdn.example.com/a.jpg"}, Description: "Neat"})
+	if err != nil {
+		t.Fatalf("CreatePortfolioItem: %v", err)
+	}
+	menu, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "hair", Name: "Cornrows", Currency: "UGX", PriceCents: 50000, DurationMinutes: 90})
+	if err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+
+	if err := s.DeleteAppointment(ctx, appt.ID); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+	if err := s.DeleteServiceItem(ctx, gone.ID); err != nil {
+		t.Fatalf("DeleteServiceItem: %v", err)
+	}
+	if err := s.DeletePortfolioItem(ctx, port.ID); err != nil {
+		t.Fatalf("DeletePortfolioItem: %v", err)
+	}
+	if err := s.DeleteMenuItem(ctx, menu.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+
+	if _, err := s.GetAppointment(ctx, appt.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAppointment of deleted: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.UpdateAppointment(ctx, appt.ID, appt); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateAppointment of deleted: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteAppointment(ctx, appt.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting twice: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetServiceItem(ctx, gone.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetServiceItem of deleted: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetPortfolioItem(ctx, port.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPortfolioItem of deleted: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetMenuItem(ctx, menu.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetMenuItem of deleted: got %v, want ErrNotFound", err)
+	}
+
+	if all, _ := s.GetAllAppointments(ctx); len(all) != 0 {
+		t.Errorf("GetAllAppointments returned %d deleted appointments", len(all))
+	}
+	if _, total, _ := s.GetAppointmentsWithPagination(ctx, AppointmentFilter{}, "", 0, 0); total != 0 {
+		t.Errorf("GetAppointmentsWithPagination total = %d, want 0", total)
+	}
+	if items, total, _ := s.ListServiceItems(ctx, "", 0, "", 0, 10); total != 1 || items[0].ID != svc.ID {
+		t.Errorf("ListServiceItems total = %d, want only the live service", total)
+	}
+	if _, total, _ := s.ListPortfolioItems(ctx, PortfolioFilter{}, 0, 10); total != 0 {
+		t.Errorf("ListPortfolioItems total = %d, want 0", total)
+	}
+	if _, total, _ := s.ListMenuItems(ctx, "", "", 0, 10); total != 0 {
+		t.Errorf("ListMenuItems total = %d, want 0", total)
+	}
+
+	trash, total, err := s.ListTrash(ctx, "", 0, 10)
+	if err != nil {
+		t.Fatalf("ListTrash: %v", err)
+	}
+	if total != 4 || len(trash) != 4 {
+		t.Fatalf("ListTrash returned %d of %d, want 4", len(trash), total)
+	}
+	only, total, err := s.ListTrash(ctx, TrashPortfolio, 0, 10)
+	if err != nil {
+		t.Fatalf("ListTrash(portfolio): %v", err)
+	}
+	if total != 1 || only[0].ID != port.ID || only[0].Label != "Cornrows" || len(only[0].Images) != 1 {
+		t.Fatalf("ListTrash(portfolio) = %+v, want the deleted portfolio item", only)
+	}
+}
+
+func testTrashRestoreAndPurge(t *testing.T, s Store) {
+	ctx := context.Background()
+	menu, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "nails", Name: "Pedicure", Currency: "UGX", PriceCents: 40000, DurationMinutes: 60})
+	if err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+
+	if err := s.RestoreFromTrash(ctx, TrashMenuItems, menu.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("restoring a live item: got %v, want ErrNotFound", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashMenuItems, menu.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("purging a live item: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeleteMenuItem(ctx, menu.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+	if err := s.RestoreFromTrash(ctx, TrashMenuItems, menu.ID); err != nil {
+		t.Fatalf("RestoreFromTrash: %v", err)
+	}
+	got, err := s.GetMenuItem(ctx, menu.ID)
+	if err != nil {
+		t.Fatalf("GetMenuItem after restore: %v", err)
+	}
+	if *got != *menu {
+		t.Fatalf("restored item = %+v, want %+v", *got, *menu)
+	}
+
+	if err := s.DeleteMenuItem(ctx, menu.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+	purged, err := s.PurgeFromTrash(ctx, TrashMenuItems, menu.ID)
+	if err != nil {
+		t.Fatalf("PurgeFromTrash: %v", err)
+	}
+	if purged.ID != menu.ID || purged.Type != string(TrashMenuItems) {
+		t.Fatalf("PurgeFromTrash returned %+v", *purged)
+	}
+	if err := s.RestoreFromTrash(ctx, TrashMenuItems, menu.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("restoring a purged item: got %v, want ErrNotFound", err)
+	}
+	if _, total, _ := s.ListTrash(ctx, "", 0, 10); total != 0 {
+		t.Fatalf("trash holds %d items after purge, want 0", total)
+	}
+}
+
+func testCategoryCRUD(t *testing.T, s Store) {
+	ctx := context.Background()
+	cats, err := s.ListCategories(ctx)
+	if err != nil {
+		t.Fatalf("ListCategories: %v", err)
+	}
+	if got := categorySlugs(cats); !slices.Equal(got, []string{"hair", "makeup", "nails"}) {
+		t.Fatalf("default categories = %v", got)
+	}
+
+	lashes := &models.Category{Slug: "lashes", Name: "Lashes", SortOrder: 2, Icon: "eye"}
+	if _, err := s.CreateCategory(ctx, lashes); err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	if _, err := s.CreateCategory(ctx, &models.Category{Slug: "lashes", Name: "Again"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreateCategory with a duplicate slug: got %v, want ErrConflict", err)
+	}
+	got, err := s.GetCategory(ctx, "lashes")
+	if err != nil {
+		t.Fatalf("GetCategory: %v", err)
+	}
+	if *got != *lashes {
+		t.Fatalf("GetCategory = %+v, want %+v", *got, *lashes)
+	}
+	// Equal sort orders fall back to the slug.
+	cats, _ = s.ListCategories(ctx)
+	if got := categorySlugs(cats); !slices.Equal(got, []string{"hair", "lashes", "makeup", "nails"}) {
+		t.Fatalf("categories = %v", got)
+	}
+
+	upd := &models.Category{Slug: "lashes", Name: "Lashes & Brows", SortOrder: 9}
+	if _, err := s.UpdateCategory(ctx, "lashes", upd); err != nil {
+		t.Fatalf("UpdateCategory: %v", err)
+	}
+	if got, _ := s.GetCategory(ctx, "lashes"); *got != *upd {
+		t.Fatalf("updated category = %+v, want %+v", *got, *upd)
+	}
+	if _, err := s.UpdateCategory(ctx, "lashes", &models.Category{Slug: "hair", Name: "Hair"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("renaming onto an existing slug: got %v, want ErrConflict", err)
+	}
+	if _, err := s.UpdateCategory(ctx, "missing", upd); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateCategory missing: got %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeleteCategory(ctx, "lashes"); err != nil {
+		t.Fatalf("DeleteCategory: %v", err)
+	}
+	if _, err := s.GetCategory(ctx, "lashes"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetCategory after delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteCategory(ctx, "lashes"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteCategory twice: got %v, want ErrNotFound", err)
+	}
+}
+
+func categorySlugs(cats []*models.Category) []string {
+	out := make([]string, len(cats))
+	for i, cat := range cats {
+		out[i] = cat.Slug
+	}
+	return out
+}
+
+func testCategoryRenameMovesItems(t *testing.T, s Store) {
+	ctx := context.Background()
+	if _, err := s.CreateCategory(ctx, &models.Category{Slug: "lash", Name: "Lash"}); err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "lash", Name: "Lash Lift", Descriptions: []string{}})
+	port, err := s.CreatePortfolioItem(ctx, &models.PortfolioItem{Category: "lash", Style: "Lifted", Images: []string{"https://x/1.jpg"}, Description: "Lifted"})
+	if err != nil {
+		t.Fatalf("CreatePortfolioItem: %v", err)
+	}
+	menu, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "lash", Name: "Lash Tint", DurationMinutes: 20})
+	if err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+	if err := s.DeleteMenuItem(ctx, menu.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+
+	if _, err := s.UpdateCategory(ctx, "lash", &models.Category{Slug: "lashes", Name: "Lashes"}); err != nil {
+		t.Fatalf("UpdateCategory: %v", err)
+	}
+	if got, _ := s.GetServiceItem(ctx, svc.ID); got.Service != "lashes" {
+		t.Errorf("service category = %q, want lashes", got.Service)
+	}
+	if got, _ := s.GetPortfolioItem(ctx, port.ID); got.Category != "lashes" {
+		t.Errorf("portfolio category = %q, want lashes", got.Category)
+	}
+
+	// A trashed item still holds on to its category.
+	if err := s.DeleteServiceItem(ctx, svc.ID); err != nil {
+		t.Fatalf("DeleteServiceItem: %v", err)
+	}
+	if err := s.DeletePortfolioItem(ctx, port.ID); err != nil {
+		t.Fatalf("DeletePortfolioItem: %v", err)
+	}
+	if err := s.DeleteCategory(ctx, "lashes"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("deleting a category with trashed items: got %v, want ErrConflict", err)
+	}
+	if err := s.RestoreFromTrash(ctx, TrashMenuItems, menu.ID); err != nil {
+		t.Fatalf("RestoreFromTrash: %v", err)
+	}
+	if got, _ := s.GetMenuItem(ctx, menu.ID); got.Category != "lashes" {
+		t.Errorf("restored menu item category = %q, want lashes", got.Category)
+	}
+
+	for _, purge := range []struct {
+		kind TrashKind
+		id   int64
+	}{{TrashServices, svc.ID}, {TrashPortfolio, port.ID}} {
+		if _, err := s.PurgeFromTrash(ctx, purge.kind, purge.id); err != nil {
+			t.Fatalf("PurgeFromTrash(%s): %v", purge.kind, err)
+		}
+	}
+	if err := s.DeleteMenuItem(ctx, menu.ID); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashMenuItems, menu.ID); err != nil {
+		t.Fatalf("PurgeFromTrash(menu): %v", err)
+	}
+	if err := s.DeleteCategory(ctx, "lashes"); err != nil {
+		t.Fatalf("DeleteCategory once empty: %v", err)
+	}
+}
+
+func testUnknownCategoryConflicts(t *testing.T, s Store) {
+	ctx := context.Background()
+	if _, err := s.CreateServiceItem(ctx, &models.ServiceItem{Service: "spa", Name: "Facial", Descriptions: []string{}}); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateServiceItem with an unknown category: got %v, want ErrConflict", err)
+	}
+	if _, err := s.CreatePortfolioItem(ctx, &models.PortfolioItem{Category: "spa", Style: "Glow", Images: []string{"https://x/1.jpg"}, Description: "Glow"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreatePortfolioItem with an unknown category: got %v, want ErrConflict", err)
+	}
+	if _, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "spa", Name: "Facial", DurationMinutes: 60}); !errors.Is(err, ErrConflict) {
+		t.Errorf("CreateMenuItem with an unknown category: got %v, want ErrConflict", err)
+	}
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Trim", Descriptions: []string{}})
+	svc.Service = "spa"
+	if _, err := s.UpdateServiceItem(ctx, svc.ID, svc); !errors.Is(err, ErrConflict) {
+		t.Errorf("UpdateServiceItem to an unknown category: got %v, want ErrConflict", err)
+	}
+}
+
+func mustCreatePayment(t *testing.T, s Store, appointmentID int64, ref string, amount int64) *models.Payment {
+	t.Helper()
+	p, err := s.CreatePayment(context.Background(), &models.Payment{
+		AppointmentID: appointmentID, Provider: "fake", ProviderRef: ref, AmountCents: amount, Currency: "UGX",
+	})
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+	return p
+}
+
+func testPaymentsConfirmBookingOnceDepositPaid(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Knotless Braids", Descriptions: []string{}, DepositPercent: 30})
+	if got, _ := s.GetServiceItem(ctx, svc.ID); got.DepositPercent != 30 {
+		t.Fatalf("deposit percent = %d, want 30", got.DepositPercent)
+	}
+	a := newTestAppointment(svc.ID, "2026-05-02", "pending")
+	a.DepositCents = 45000
+	appt := mustCreateAppointment(t, s, a)
+	if got, _ := s.GetAppointment(ctx, appt.ID); got.DepositCents != 45000 {
+		t.Fatalf("deposit = %d, want 45000", got.DepositCents)
+	}
+
+	if _, err := s.CreatePayment(ctx, &models.Payment{AppointmentID: 999, Provider: "fake", ProviderRef: "x", AmountCents: 1, Currency: "UGX"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("CreatePayment for a missing appointment: got %v, want ErrNotFound", err)
+	}
+	first := mustCreatePayment(t, s, appt.ID, "ref-1", 25000)
+	if first.Status != "pending" || first.CreatedAt == "" {
+		t.Fatalf("created payment = %+v", *first)
+	}
+	if _, err := s.CreatePayment(ctx, &models.Payment{AppointmentID: appt.ID, Provider: "fake", ProviderRef: "ref-1", AmountCents: 1, Currency: "UGX"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("CreatePayment with a duplicate reference: got %v, want ErrConflict", err)
+	}
+	second := mustCreatePayment(t, s, appt.ID, "ref-2", 20000)
+
+	p, confirmed, err := s.SettlePayment(ctx, "fake", "ref-1", "succeeded", "")
+	if err != nil || confirmed || p.Status != "succeeded" {
+		t.Fatalf("SettlePayment(part of deposit) = %+v, %v, %v", p, confirmed, err)
+	}
+	if got, _ := s.GetAppointment(ctx, appt.ID); got.Status != "pending" {
+		t.Fatalf("status with deposit part paid = %q, want pending", got.Status)
+	}
+	// A repeated or contradictory webhook leaves a settled payment alone.
+	if p, confirmed, err := s.SettlePayment(ctx, "fake", "ref-1", "failed", "late"); err != nil || confirmed || p.Status != "succeeded" {
+		t.Fatalf("resettling = %+v, %v, %v", p, confirmed, err)
+	}
+	if _, _, err := s.SettlePayment(ctx, "fake", "missing", "succeeded", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SettlePayment unknown ref: got %v, want ErrNotFound", err)
+	}
+
+	if _, confirmed, err := s.SettlePayment(ctx, "fake", "ref-2", "succeeded", ""); err != nil || !confirmed {
+		t.Fatalf("SettlePayment(rest of deposit) confirmed = %v, %v; want true", confirmed, err)
+	}
+	if got, _ := s.GetAppointment(ctx, appt.ID); got.Status != "confirmed" {
+		t.Fatalf("status with deposit paid = %q, want confirmed", got.Status)
+	}
+
+	list, err := s.ListPayments(ctx, appt.ID)
+	if err != nil {
+		t.Fatalf("ListPayments: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+		t.Fatalf("ListPayments = %+v", list)
+	}
+	got, err := s.GetPaymentByRef(ctx, "fake", "ref-2")
+	if err != nil || got.ID != second.ID || got.Status != "succeeded" {
+		t.Fatalf("GetPaymentByRef = %+v, %v", got, err)
+	}
+
+	// Purging the appointment takes its payments with it.
+	if err := s.DeleteAppointment(ctx, appt.ID); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashAppointments, appt.ID); err != nil {
+		t.Fatalf("PurgeFromTrash: %v", err)
+	}
+	if _, err := s.GetPaymentByRef(ctx, "fake", "ref-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("payment after purge: got %v, want ErrNotFound", err)
+	}
+}
+
+func testPaymentSettlementRespectsCapacity(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Cornrows", Descriptions: []string{}, DepositPercent: 10})
+	a := newTestAppointment(svc.ID, "2026-05-09", "pending")
+	a.DepositCents = 15000
+	appt := mustCreateAppointment(t, s, a)
+	for i := 0; i < maxConfirmedAppointmentsPerDay; i++ {
+		mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-05-09", "confirmed"))
+	}
+	mustCreatePayment(t, s, appt.ID, "ref-full", 15000)
+	p, confirmed, err := s.SettlePayment(ctx, "fake", "ref-full", "succeeded", "")
+	if err != nil || confirmed || p.Status != "succeeded" {
+		t.Fatalf("SettlePayment on a full day = %+v, %v, %v", p, confirmed, err)
+	}
+	if got, _ := s.GetAppointment(ctx, appt.ID); got.Status != "pending" {
+		t.Fatalf("status on a full day = %q, want pending", got.Status)
+	}
+}
+
+func testTrashRestoreRespectsCapacity(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "makeup", Name: "Soft Glam", Descriptions: []string{}})
+	deleted := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	if err := s.DeleteAppointment(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+	// The deleted booking frees its slot for someone else.
+	for i := 0; i < maxConfirmedAppointmentsPerDay; i++ {
+		mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-03-14", "confirmed"))
+	}
+	if err := s.RestoreFromTrash(ctx, TrashAppointments, deleted.ID); !errors.Is(err, ErrSlotUnavailable) {
+		t.Fatalf("restoring onto a full day: got %v, want ErrSlotUnavailable", err)
+	}
+}
+
+func testCancellationRefundsPayments(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Silk Press", Descriptions: []string{}, DepositPercent: 50})
+	a := newTestAppointment(svc.ID, "2026-05-09", "pending")
+	a.DepositCents = 45000
+	appt := mustCreateAppointment(t, s, a)
+	first := mustCreatePayment(t, s, appt.ID, "ref-1", 25000)
+	second := mustCreatePayment(t, s, appt.ID, "ref-2", 20000)
+	mustCreatePayment(t, s, appt.ID, "ref-3", 45000)
+	for _, ref := range []string{"ref-1", "ref-2"} {
+		if _, _, err := s.SettlePayment(ctx, "fake", ref, "succeeded", ""); err != nil {
+			t.Fatalf("SettlePayment(%s): %v", ref, err)
+		}
+	}
+	if _, _, err := s.SettlePayment(ctx, "fake", "ref-3", "failed", "declined"); err != nil {
+		t.Fatalf("SettlePayment(ref-3): %v", err)
+	}
+
+	// A cancellation worked out before the second payment settled is refused.
+	if _, _, err := s.CancelAppointment(ctx, appt.ID, models.Cancellation{
+		By: "customer", FeeCents: 5000, RefundCents: 20000, PaidCents: 25000,
+	}); !errors.Is(err, ErrPaymentsChanged) {
+		t.Fatalf("CancelAppointment with stale payments: got %v, want ErrPaymentsChanged", err)
+	}
+	if got, _ := s.GetAppointment(ctx, appt.ID); isCancelledStatus(got.Status) {
+		t.Fatalf("status after refused cancellation = %q", got.Status)
+	}
+
+	// Refunds come from the newest succeeded payments first, and never
+	// from failed ones.
+	cancelled, refunds, err := s.CancelAppointment(ctx, appt.ID, models.Cancellation{
+		By: "customer", FeeCents: 15000, RefundCents: 30000, PaidCents: 45000,
+	})
+	if err != nil {
+		t.Fatalf("CancelAppointment: %v", err)
+	}
+	if cancelled.CancellationFeeCents != 15000 || cancelled.CancelledBy != "customer" {
+		t.Fatalf("cancelled appointment = %+v", *cancelled)
+	}
+	if len(refunds) != 2 ||
+		refunds[0].PaymentID != second.ID || refunds[0].AmountCents != 20000 ||
+		refunds[1].PaymentID != first.ID || refunds[1].AmountCents != 10000 {
+		t.Fatalf("refunds = %+v", refunds)
+	}
+	for _, r := range refunds {
+		if r.Status != "pending" || r.Currency != "UGX" || r.AppointmentID != appt.ID || r.CreatedAt == "" {
+			t.Fatalf("refund = %+v", *r)
+		}
+	}
+
+	pending, total, err := s.ListRefunds(ctx, RefundFilter{Status: "pending"}, 0, 10)
+	if err != nil || total != 2 || pending[0].ID != refunds[1].ID {
+		t.Fatalf("ListRefunds(pending) = %v, %d, %v", pending, total, err)
+	}
+	paid, err := s.MarkRefundPaid(ctx, refunds[0].ID)
+	if err != nil || paid.Status != "paid" || paid.PaidAt == "" {
+		t.Fatalf("MarkRefundPaid = %+v, %v", paid, err)
+	}
+	if _, err := s.MarkRefundPaid(ctx, refunds[0].ID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("MarkRefundPaid twice: got %v, want ErrConflict", err)
+	}
+	if _, err := s.MarkRefundPaid(ctx, 999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("MarkRefundPaid(999): got %v, want ErrNotFound", err)
+	}
+	if _, total, _ := s.ListRefunds(ctx, RefundFilter{AppointmentID: appt.ID, Status: "paid"}, 0, 10); total != 1 {
+		t.Fatalf("paid refunds for the appointment = %d, want 1", total)
+	}
+
+	// Purging the appointment takes its refunds with it.
+	if err := s.DeleteAppointment(ctx, appt.ID); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+	if _, err := s.PurgeFromTrash(ctx, TrashAppointments, appt.ID); err != nil {
+		t.Fatalf("PurgeFromTrash: %v", err)
+	}
+	if _, total, _ := s.ListRefunds(ctx, RefundFilter{}, 0, 10); total != 0 {
+		t.Fatalf("refunds after purge = %d, want 0", total)
+	}
+}
+
+func testLatePaymentIsRefunded(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Silk Press", Descriptions: []string{}, DepositPercent: 50})
+	for _, noShow := range []bool{false, true} {
+		a := newTestAppointment(svc.ID, "2026-05-10", "pending")
+		a.DepositCents = 45000
+		appt := mustCreateAppointment(t, s, a)
+		ref := fmt.Sprintf("late-%d", appt.ID)
+		p := mustCreatePayment(t, s, appt.ID, ref, 45000)
+
+		// The webhook for the deposit arrives after the booking was cancelled.
+		cancelled, _, err := s.CancelAppointment(ctx, appt.ID, models.Cancellation{By: "admin", NoShow: noShow})
+		if err != nil {
+			t.Fatalf("CancelAppointment(no_show=%v): %v", noShow, err)
+		}
+		for range 2 {
+			settled, confirmed, err := s.SettlePayment(ctx, "fake", ref, "succeeded", "")
+			if err != nil || confirmed || settled.Status != "succeeded" {
+				t.Fatalf("SettlePayment(no_show=%v) = %+v, %v, %v", noShow, settled, confirmed, err)
+			}
+		}
+		if got, _ := s.GetAppointment(ctx, appt.ID); got.Status != cancelled.Status {
+			t.Fatalf("status after late payment = %q, want %q", got.Status, cancelled.Status)
+		}
+		refunds, total, err := s.ListRefunds(ctx, RefundFilter{AppointmentID: appt.ID}, 0, 10)
+		if err != nil || total != 1 || refunds[0].PaymentID != p.ID || refunds[0].AmountCents != 45000 || refunds[0].Status != "pending" {
+			t.Fatalf("refunds after late payment (no_show=%v) = %+v, %d, %v; want the payment refunded once", noShow, refunds, total, err)
+		}
+	}
+}
+
+func testInvoicesAreIssuedOnce(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Acrylics", Descriptions: []string{}})
+	first := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-06-01", "completed"))
+	second := mustCreateAppointment(t, s, newTestAppointment(svc.ID, "2026-06-02", "completed"))
+
+	invoiceFor := func(a *models.Appointment, total int64) *models.Invoice {
+		return &models.Invoice{
+			AppointmentID: a.ID, CustomerName: a.CustomerName, CustomerEmail: a.CustomerEmail,
+			ServiceName: svc.Name, ServiceDescription: a.ServiceDescription, AppointmentDate: a.Date,
+			Currency: "UGX", TotalCents: total, DiscountCents: 10000, PromoCode: "SPRING10", PointsRedeemed: 40,
+			DepositCents: 30000, DepositPaidCents: 20000,
+		}
+	}
+	inv, err := s.IssueInvoice(ctx, invoiceFor(first, 80000))
+	if err != nil {
+		t.Fatalf("IssueInvoice: %v", err)
+	}
+	if inv.Number != "INV-000001" || inv.IssuedAt == "" || inv.AppointmentDate != "2026-06-01" || inv.TotalCents != 80000 ||
+		inv.DiscountCents != 10000 || inv.PromoCode != "SPRING10" || inv.PointsRedeemed != 40 || inv.DepositCents != 30000 {
+		t.Fatalf("issued invoice = %+v", *inv)
+	}
+	// Issuing again returns the original, amounts included.
+	again, err := s.IssueInvoice(ctx, invoiceFor(first, 99000))
+	if err != nil || *again != *inv {
+		t.Fatalf("reissued invoice = %+v, %v; want %+v", again, err, *inv)
+	}
+	next, err := s.IssueInvoice(ctx, invoiceFor(second, 50000))
+	if err != nil || next.Number != "INV-000002" {
+		t.Fatalf("second invoice = %+v, %v; want INV-000002", next, err)
+	}
+	if _, err := s.IssueInvoice(ctx, &models.Invoice{AppointmentID: 999, AppointmentDate: "2026-06-01"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("IssueInvoice for a missing appointment: got %v, want ErrNotFound", err)
+	}
+}
+
+func testVoucherCRUD(t *testing.T, s Store) {
+	ctx := context.Background()
+	v, err := s.CreateVoucher(ctx, &models.Voucher{Code: "GIFT50K", Kind: "fixed", Value: 50000, Currency: "UGX", MaxUses: 1, Active: true})
+	if err != nil {
+		t.Fatalf("CreateVoucher: %v", err)
+	}
+	if v.ID == 0 || v.Uses != 0 || v.CreatedAt == "" {
+		t.Fatalf("created voucher = %+v", *v)
+	}
+	if _, err := s.CreateVoucher(ctx, &models.Voucher{Code: "GIFT50K", Kind: "percent", Value: 10, Active: true}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("duplicate code: got %v, want ErrConflict", err)
+	}
+	got, err := s.GetVoucherByCode(ctx, "GIFT50K")
+	if err != nil || *got != *v {
+		t.Fatalf("GetVoucherByCode = %+v, %v; want %+v", got, err, *v)
+	}
+
+	upd := *v
+	upd.Value, upd.ExpiresAt, upd.Note, upd.Uses = 60000, "2030-01-01T00:00:00Z", "for Amina", 7
+	updated, err := s.UpdateVoucher(ctx, v.ID, &upd)
+	if err != nil || updated.Value != 60000 || updated.ExpiresAt != "2030-01-01T00:00:00Z" || updated.Note != "for Amina" || updated.Uses != 0 {
+		t.Fatalf("UpdateVoucher = %+v, %v", updated, err)
+	}
+	if _, err := s.UpdateVoucher(ctx, 999, &upd); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateVoucher(missing): got %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.CreateVoucher(ctx, &models.Voucher{Code: "SPRING10", Kind: "percent", Value: 10, Active: true}); err != nil {
+		t.Fatalf("CreateVoucher: %v", err)
+	}
+	list, total, err := s.ListVouchers(ctx, 0, 10)
+	if err != nil || total != 2 || len(list) != 2 || list[0].Code != "SPRING10" {
+		t.Fatalf("ListVouchers = %d items, total %d, %v; want SPRING10 first", len(list), total, err)
+	}
+
+	if err := s.DeleteVoucher(ctx, v.ID); err != nil {
+		t.Fatalf("DeleteVoucher: %v", err)
+	}
+	if _, err := s.GetVoucher(ctx, v.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetVoucher after delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func testVoucherRedemptionLimits(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel", Descriptions: []string{}})
+	once, err := s.CreateVoucher(ctx, &models.Voucher{Code: "ONCE", Kind: "percent", Value: 20, MaxUses: 1, Active: true})
+	if err != nil {
+		t.Fatalf("CreateVoucher: %v", err)
+	}
+	expired, err := s.CreateVoucher(ctx, &models.Voucher{Code: "OLD", Kind: "percent", Value: 20, ExpiresAt: "2020-01-01T00:00:00Z", Active: true})
+	if err != nil {
+		t.Fatalf("CreateVoucher: %v", err)
+	}
+	inactive, err := s.CreateVoucher(ctx, &models.Voucher{Code: "OFF", Kind: "percent", Value: 20})
+	if err != nil {
+		t.Fatalf("CreateVoucher: %v", err)
+	}
+
+	redeem := func(v *models.Voucher) (*models.Appointment, error) {
+		a := newTestAppointment(svc.ID, "2026-07-01", "pending")
+		a.VoucherID, a.PromoCode, a.DiscountCents, a.PriceCents = v.ID, v.Code, 10000, 40000
+		return s.CreateAppointment(ctx, a)
+	}
+	a, err := redeem(once)
+	if err != nil {
+		t.Fatalf("redeem ONCE: %v", err)
+	}
+	got, err := s.GetAppointment(ctx, a.ID)
+	if err != nil || got.VoucherID != once.ID || got.PromoCode != "ONCE" || got.DiscountCents != 10000 {
+		t.Fatalf("redeemed appointment = %+v, %v", got, err)
+	}
+	if v, _ := s.GetVoucher(ctx, once.ID); v.Uses != 1 {
+		t.Fatalf("uses after redemption = %d, want 1", v.Uses)
+	}
+	for _, v := range []*models.Voucher{once, expired, inactive} {
+		if _, err := redeem(v); !errors.Is(err, ErrVoucherUnavailable) {
+			t.Errorf("redeem %s: got %v, want ErrVoucherUnavailable", v.Code, err)
+		}
+	}
+	if v, _ := s.GetVoucher(ctx, once.ID); v.Uses != 1 {
+		t.Fatalf("uses after refused redemption = %d, want 1", v.Uses)
+	}
+	// Cancelling the booking gives the use back, so the voucher can be
+	// redeemed again.
+	if _, _, err := s.CancelAppointment(ctx, a.ID, models.Cancellation{By: "customer"}); err != nil {
+		t.Fatalf("CancelAppointment: %v", err)
+	}
+	if v, _ := s.GetVoucher(ctx, once.ID); v.Uses != 0 {
+		t.Fatalf("uses after cancelling = %d, want 0", v.Uses)
+	}
+	if got, _ := s.GetAppointment(ctx, a.ID); got.PromoCode != "ONCE" || got.DiscountCents != 10000 {
+		t.Fatalf("cancelled appointment = %+v; want the discount kept on record", got)
+	}
+	again, err := redeem(once)
+	if err != nil {
+		t.Fatalf("redeem ONCE after cancelling: %v", err)
+	}
+	// A no-show used its booking, so the use is kept.
+	if _, _, err := s.CancelAppointment(ctx, again.ID, models.Cancellation{By: "admin", NoShow: true}); err != nil {
+		t.Fatalf("CancelAppointment no-show: %v", err)
+	}
+	if v, _ := s.GetVoucher(ctx, once.ID); v.Uses != 1 {
+		t.Fatalf("uses after a no-show = %d, want 1", v.Uses)
+	}
+	if _, err := redeem(once); !errors.Is(err, ErrVoucherUnavailable) {
+		t.Fatalf("redeem ONCE after a no-show: got %v, want ErrVoucherUnavailable", err)
+	}
+	// A redeemed voucher is kept for the bookings that used it.
+	if err := s.DeleteVoucher(ctx, once.ID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("DeleteVoucher(redeemed): got %v, want ErrConflict", err)
+	}
+}
+
+func testLoyaltyPoints(t *testing.T, s Store) {
+	ctx := context.Background()
+	settings, err := s.GetLoyaltySettings(ctx)
+	if err != nil || settings.SpendPerPoint != 0 || settings.PointValueCents != 0 {
+		t.Fatalf("default settings = %+v, %v; want earning and redeeming off", settings, err)
+	}
+	want := models.LoyaltySettings{Currency: "UGX", SpendPerPoint: 1000, PointValueCents: 50}
+	if got, err := s.UpdateLoyaltySettings(ctx, &want); err != nil || *got != want {
+		t.Fatalf("UpdateLoyaltySettings = %+v, %v", got, err)
+	}
+	if got, err := s.GetLoyaltySettings(ctx); err != nil || *got != want {
+		t.Fatalf("GetLoyaltySettings = %+v, %v; want %+v", got, err, want)
+	}
+
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{}})
+	done := newTestAppointment(svc.ID, "2026-08-01", "completed")
+	done.CustomerEmail = "Regular@Example.com"
+	done = mustCreateAppointment(t, s, done)
+	earned, err := s.EarnLoyaltyPoints(ctx, done.ID, 80)
+	if err != nil || earned.Kind != "earned" || earned.Points != 80 || earned.CustomerEmail != "regular@example.com" {
+		t.Fatalf("EarnLoyaltyPoints = %+v, %v", earned, err)
+	}
+	// An appointment only earns once.
+	if again, err := s.EarnLoyaltyPoints(ctx, done.ID, 500); err != nil || again.ID != earned.ID || again.Points != 80 {
+		t.Fatalf("earning again = %+v, %v; want the first entry", again, err)
+	}
+	if _, err := s.EarnLoyaltyPoints(ctx, 999, 10); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("EarnLoyaltyPoints(missing): got %v, want ErrNotFound", err)
+	}
+
+	book := func(points int64) (*models.Appointment, error) {
+		a := newTestAppointment(svc.ID, "2026-08-02", "pending")
+		a.CustomerEmail = "regular@example.com"
+		a.PointsRedeemed = points
+		return s.CreateAppointment(ctx, a)
+	}
+	if _, err := book(81); !errors.Is(err, ErrInsufficientPoints) {
+		t.Fatalf("redeeming 81 of 80 points: got %v, want ErrInsufficientPoints", err)
+	}
+	a, err := book(30)
+	if err != nil {
+		t.Fatalf("redeeming 30 points: %v", err)
+	}
+	if got, _ := s.GetAppointment(ctx, a.ID); got.PointsRedeemed != 30 {
+		t.Fatalf("points_redeemed = %d, want 30", got.PointsRedeemed)
+	}
+	if balance, err := s.LoyaltyBalance(ctx, " REGULAR@example.com"); err != nil || balance != 50 {
+		t.Fatalf("LoyaltyBalance = %d, %v; want 50", balance, err)
+	}
+	entries, total, err := s.ListLoyaltyEntries(ctx, "regular@example.com", 0, 10)
+	if err != nil || total != 2 || entries[0].Kind != "redeemed" || entries[0].Points != -30 || *entries[0].AppointmentID != a.ID {
+		t.Fatalf("ListLoyaltyEntries = %d entries, total %d, %v", len(entries), total, err)
+	}
+
+	// Cancelling the booking gives the points back.
+	if _, _, err := s.CancelAppointment(ctx, a.ID, models.Cancellation{By: "customer"}); err != nil {
+		t.Fatalf("CancelAppointment: %v", err)
+	}
+	if balance, err := s.LoyaltyBalance(ctx, "regular@example.com"); err != nil || balance != 80 {
+		t.Fatalf("LoyaltyBalance after cancelling = %d, %v; want 80", balance, err)
+	}
+	entries, total, err = s.ListLoyaltyEntries(ctx, "regular@example.com", 0, 10)
+	if err != nil || total != 3 || entries[0].Kind != "refunded" || entries[0].Points != 30 || *entries[0].AppointmentID != a.ID {
+		t.Fatalf("ListLoyaltyEntries after cancelling = %d entries, total %d, %v", len(entries), total, err)
+	}
+
+	// A no-show keeps the points it spent.
+	missed, err := book(20)
+	if err != nil {
+		t.Fatalf("redeeming 20 points: %v", err)
+	}
+	if _, _, err := s.CancelAppointment(ctx, missed.ID, models.Cancellation{By: "admin", NoShow: true}); err != nil {
+		t.Fatalf("CancelAppointment no-show: %v", err)
+	}
+	if balance, err := s.LoyaltyBalance(ctx, "regular@example.com"); err != nil || balance != 60 {
+		t.Fatalf("LoyaltyBalance after a no-show = %d, %v; want 60", balance, err)
+	}
+	entries, total, err = s.ListLoyaltyEntries(ctx, "regular@example.com", 0, 10)
+	if err != nil || total != 4 || entries[0].Kind != "redeemed" || *entries[0].AppointmentID != missed.ID {
+		t.Fatalf("ListLoyaltyEntries after a no-show = %d entries, total %d, %v", len(entries), total, err)
+	}
+}
+
+func testReportAppointments(t *testing.T, s Store) {
+	ctx := context.Background()
+	nails := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel", Descriptions: []string{}})
+	hair := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{}})
+	book := func(svc *models.ServiceItem, date, clock, staff, status, currency string, price int64) *models.Appointment {
+		a := newTestAppointment(svc.ID, date, status)
+		a.Time, a.StaffName, a.Currency, a.PriceCents = clock, staff, currency, price
+		return mustCreateAppointment(t, s, a)
+	}
+	// 2026-03-02 is a Monday.
+	book(nails, "2026-03-02", "09:00", "Amina", "completed", "UGX", 50000)
+	book(nails, "2026-03-04", "09:30", "Amina", "completed", "UGX", 30000)
+	book(hair, "2026-03-04", "14:00", "", "completed", "UGX", 120000)
+	book(hair, "2026-03-09", "14:00", "Grace", "completed", "USD", 4000)
+	noShow := book(hair, "2026-03-10", "10:00", "Grace", "confirmed", "UGX", 80000)
+	if _, _, err := s.CancelAppointment(ctx, noShow.ID, models.Cancellation{By: "admin", NoShow: true, FeeCents: 40000}); err != nil {
+		t.Fatalf("CancelAppointment: %v", err)
+	}
+	book(nails, "2026-04-01", "09:00", "Amina", "pending", "UGX", 50000)
+	trashed := book(nails, "2026-03-02", "09:00", "Amina", "completed", "UGX", 99000)
+	if err := s.DeleteAppointment(ctx, trashed.ID); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+
+	report := func(f ReportFilter, by ReportGrouping) []models.ReportRow {
+		t.Helper()
+		rows, err := s.ReportAppointments(ctx, f, by)
+		if err != nil {
+			t.Fatalf("ReportAppointments(%s): %v", by, err)
+		}
+		out := make([]models.ReportRow, len(rows))
+		for i, r := range rows {
+			out[i] = *r
+		}
+		return out
+	}
+	march := ReportFilter{From: "2026-03-01", To: "2026-03-31"}
+
+	weeks := report(march, ReportByWeek)
+	wantWeeks := []models.ReportRow{
+		{Key: "2026-03-02", Label: "2026-03-02", Currency: "UGX", Bookings: 3, Completed: 3, RevenueCents: 200000},
+		{Key: "2026-03-09", Label: "2026-03-09", Currency: "UGX", Bookings: 1, NoShows: 1, FeesCents: 40000},
+		{Key: "2026-03-09", Label: "2026-03-09", Currency: "USD", Bookings: 1, Completed: 1, RevenueCents: 4000},
+	}
+	if !slices.Equal(weeks, wantWeeks) {
+		t.Fatalf("by week = %+v, want %+v", weeks, wantWeeks)
+	}
+	if months := report(ReportFilter{}, ReportByMonth); len(months) != 3 || months[2].Key != "2026-04" || months[2].Bookings != 1 {
+		t.Fatalf("by month = %+v", months)
+	}
+	if days := report(ReportFilter{From: "2026-03-04", To: "2026-03-04"}, ReportByDay); len(days) != 1 || days[0].Bookings != 2 {
+		t.Fatalf("by day = %+v", days)
+	}
+
+	services := report(march, ReportByService)
+	if services[0].Label != "Braids" || services[0].Currency != "UGX" || services[0].RevenueCents != 120000 || services[0].Bookings != 2 {
+		t.Fatalf("top service = %+v, want Braids in UGX", services[0])
+	}
+	categories := report(march, ReportByCategory)
+	if categories[0].Key != "hair" || categories[0].Label == "" || categories[1].Key != "nails" || categories[1].RevenueCents != 80000 {
+		t.Fatalf("by category = %+v", categories)
+	}
+	staff := report(march, ReportByStaff)
+	if staff[0].Label != "Unassigned" || staff[0].Key != "" || staff[1].Key != "Amina" || staff[1].Completed != 2 {
+		t.Fatalf("by staff = %+v", staff)
+	}
+	hours := report(march, ReportByHour)
+	if len(hours) != 4 || hours[0].Key != "09" || hours[0].Label != "09:00" || hours[0].Bookings != 2 {
+		t.Fatalf("by hour = %+v", hours)
+	}
+	totals := report(march, ReportTotal)
+	if len(totals) != 2 || totals[0].Currency != "UGX" || totals[0].Bookings != 4 || totals[0].NoShows != 1 {
+		t.Fatalf("totals = %+v", totals)
+	}
+}
+
+func testEachAppointmentFilters(t *testing.T, s Store) {
+	ctx := context.Background()
+	nails := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel", Descriptions: []string{}})
+	hair := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{}})
+	book := func(svc *models.ServiceItem, date, clock, staff, status string) int64 {
+		a := newTestAppointment(svc.ID, date, status)
+		a.Time, a.StaffName = clock, staff
+		return mustCreateAppointment(t, s, a).ID
+	}
+	late := book(nails, "2026-05-02", "15:00", "Amina", "completed")
+	early := book(nails, "2026-05-02", "09:00", "Amina", "completed")
+	first := book(hair, "2026-05-01", "12:00", "Grace", "pending")
+	june := book(nails, "2026-06-01", "09:00", "Amina", "completed")
+	trashed := book(nails, "2026-05-03", "09:00", "Amina", "completed")
+	if err := s.DeleteAppointment(ctx, trashed); err != nil {
+		t.Fatalf("DeleteAppointment: %v", err)
+	}
+
+	each := func(f AppointmentFilter) []int64 {
+		t.Helper()
+		ids := []int64{}
+		if err := s.EachAppointment(ctx, f, func(a *models.Appointment) error {
+			ids = append(ids, a.ID)
+			return nil
+		}); err != nil {
+			t.Fatalf("EachAppointment(%+v): %v", f, err)
+		}
+		return ids
+	}
+	cases := []struct {
+		f    AppointmentFilter
+		want []int64
+	}{
+		{AppointmentFilter{}, []int64{first, early, late, june}},
+		{AppointmentFilter{From: "2026-05-01", To: "2026-05-31"}, []int64{first, early, late}},
+		{AppointmentFilter{Status: "completed", ServiceID: nails.ID}, []int64{early, late, june}},
+		{AppointmentFilter{StaffName: "grace"}, []int64{first}},
+	}
+	for _, tc := range cases {
+		if got := each(tc.f); !slices.Equal(got, tc.want) {
+			t.Errorf("EachAppointment(%+v) = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := s.EachAppointment(ctx, AppointmentFilter{}, func(*models.Appointment) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("EachAppointment stopping: %v after %d calls", err, calls)
+	}
+}
+
+func testEachCustomer(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "nails", Name: "Gel", Descriptions: []string{}})
+	book := func(email, name, date, status, currency string, price int64) {
+		a := newTestAppointment(svc.ID, date, status)
+		a.CustomerEmail, a.CustomerName, a.Currency, a.PriceCents = email, name, currency, price
+		mustCreateAppointment(t, s, a)
+	}
+	book("zawadi@example.com", "Zawadi", "2026-05-01", "completed", "UGX", 50000)
+	book("Amina@Example.com", "Amina", "2026-05-03", "completed", "UGX", 40000)
+	book("amina@example.com", "Amina N.", "2026-05-10", "completed", "USD", 2500)
+	book("amina@example.com", "Amina N.", "2026-05-12", "cancelled", "UGX", 40000)
+	book("amina@example.com", "Amina", "2026-06-01", "pending", "UGX", 40000)
+
+	var got []*models.Customer
+	collect := func(c *models.Customer) error {
+		got = append(got, c)
+		return nil
+	}
+	if err := s.EachCustomer(ctx, ReportFilter{To: "2026-05-31"}, collect); err != nil {
+		t.Fatalf("EachCustomer: %v", err)
+	}
+	if len(got) != 2 || got[0].Email != "amina@example.com" || got[1].Email != "zawadi@example.com" {
+		t.Fatalf("customers = %+v, want amina then zawadi", got)
+	}
+	amina := got[0]
+	if amina.Name != "Amina N." || amina.Bookings != 3 || amina.Completed != 2 || amina.Cancelled != 1 ||
+		amina.FirstVisit != "2026-05-03" || amina.LastVisit != "2026-05-12" {
+		t.Fatalf("amina = %+v", *amina)
+	}
+	if amina.SpentCents["UGX"] != 40000 || amina.SpentCents["USD"] != 2500 || len(amina.SpentCents) != 2 {
+		t.Fatalf("amina spent = %v", amina.SpentCents)
+	}
+}
+
+func testImportMenuItemsIsAtomic(t *testing.T, s Store) {
+	ctx := context.Background()
+	svc := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Knotless Braids", Descriptions: []string{}})
+	wash, err := s.CreateMenuItem(ctx, &models.MenuItem{Category: "hair", Name: "Wash", Currency: "UGX", PriceCents: 20000, DurationMinutes: 30})
+	if err != nil {
+		t.Fatalf("CreateMenuItem: %v", err)
+	}
+	small := &models.MenuItem{Category: "hair", Name: "Small", ServiceItemID: &svc.ID, Currency: "UGX", PriceCents: 180000, DurationMinutes: 240}
+	update := *wash
+	update.PriceCents = 25000
+	if err := s.ImportMenuItems(ctx, []*models.MenuItem{small, &update}); err != nil {
+		t.Fatalf("ImportMenuItems: %v", err)
+	}
+	if small.ID == 0 {
+		t.Fatal("ImportMenuItems left the new item without an ID")
+	}
+	if got, _ := s.GetMenuItem(ctx, wash.ID); got.PriceCents != 25000 {
+		t.Errorf("imported update price = %d, want 25000", got.PriceCents)
+	}
+
+	// A duplicate variant name fails the whole import, undoing the items
+	// before it.
+	before := *wash
+	before.PriceCents = 30000
+	medium := &models.MenuItem{Category: "hair", Name: "Medium", ServiceItemID: &svc.ID, Currency: "UGX", PriceCents: 150000, DurationMinutes: 240}
+	dupe := &models.MenuItem{Category: "hair", Name: "SMALL", ServiceItemID: &svc.ID, Currency: "UGX", PriceCents: 1, DurationMinutes: 240}
+	if err := s.ImportMenuItems(ctx, []*models.MenuItem{&before, medium, dupe}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("ImportMenuItems with a duplicate variant: got %v, want ErrConflict", err)
+	}
+	missing := &models.MenuItem{ID: 999, Category: "hair", Name: "Gone", Currency: "UGX", PriceCents: 1, DurationMinutes: 30}
+	if err := s.ImportMenuItems(ctx, []*models.MenuItem{&before, missing}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ImportMenuItems updating a missing item: got %v, want ErrNotFound", err)
+	}
+	if got, _ := s.GetMenuItem(ctx, wash.ID); got.PriceCents != 25000 {
+		t.Errorf("price after failed imports = %d, want 25000", got.PriceCents)
+	}
+	if _, total, _ := s.ListMenuItems(ctx, "", "", 0, 10); total != 2 {
+		t.Errorf("menu items after failed imports = %d, want 2", total)
+	}
+}
+
+func testImportServiceItemsIsAtomic(t *testing.T, s Store) {
+	ctx := context.Background()
+	braids := mustCreateService(t, s, &models.ServiceItem{Service: "hair", Name: "Braids", Descriptions: []string{}, Image: "/images/braids.webp"})
+	update := *braids
+	update.Descriptions, update.DepositPercent = []string{"Long lasting"}, 20
+	gel := &models.ServiceItem{Service: "nails", Name: "Gel", Descriptions: []string{}}
+	if err := s.ImportServiceItems(ctx, []*models.ServiceItem{&update, gel}); err != nil {
+		t.Fatalf("ImportServiceItems: %v", err)
+	}
+	got, err := s.GetServiceItem(ctx, braids.ID)
+	if err != nil {
+		t.Fatalf("GetServiceItem: %v", err)
+	}
+	if got.DepositPercent != 20 || len(got.Descriptions) != 1 || got.Image != braids.Image {
+		t.Errorf("imported update = %+v", got)
+	}
+	if gel.ID == 0 {
+		t.Fatal("ImportServiceItems left the new service without an ID")
+	}
+
+	again := *got
+	again.DepositPercent = 50
+	unknown := &models.ServiceItem{Service: "no-such-category", Name: "Mystery", Descriptions: []string{}}
+	if err := s.ImportServiceItems(ctx, []*models.ServiceItem{&again, unknown}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("ImportServiceItems into an unknown category: got %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetServiceItem(ctx, braids.ID); got.DepositPercent != 20 {
+		t.Errorf("deposit after failed import = %d, want 20", got.DepositPercent)
+	}
+	if _, total, _ := s.ListServiceItems(ctx, "", 0, "", 0, 10); total != 2 {
+		t.Errorf("services after failed import = %d, want 2", total)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness or
+	// referential constraint, e.g. deleting a service that still has bookings.
+	ErrConflict = errors.New("conflict")
+	// ErrSlotUnavailable is returned when a booking would push a day past its
+	// confirmed-appointment capacity.
+	ErrSlotUnavailable = errors.New("no slots available")
+	// ErrVoucherUnavailable is returned when a booking redeems a voucher that
+	// is inactive, expired or used up.
+	ErrVoucherUnavailable = errors.New("voucher unavailable")
+	// ErrInsufficientPoints is returned when a booking redeems more loyalty
+	// points than the customer has.
+	ErrInsufficientPoints = errors.New("insufficient loyalty points")
+	// ErrPaymentsChanged is returned when a cancellation was worked out from
+	// payments that have since changed, e.g. a deposit settling meanwhile.
+	ErrPaymentsChanged = errors.New("payments changed")
+)
+
+// Postgres error codes that indicate a conflicting write rather than a failure.
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+	pqExclusionViolation  = "23P01"
+)
+
+// wrapDBError annotates err with the failed operation and maps driver errors
+// onto ErrNotFound and ErrConflict so callers can match them with errors.Is.
+func wrapDBError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("storage: %s: %w", op, ErrNotFound)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqForeignKeyViolation, pqUniqueViolation, pqExclusionViolation:
+			return fmt.Errorf("storage: %s: %w: %w", op, ErrConflict, err)
+		}
+	}
+	return fmt.Errorf("storage: %s: %w", op, err)
+}
+
+// checkAffected turns a zero-row update or delete into ErrNotFound.
+func checkAffected(op string, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return wrapDBError(op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("storage: %s: %w", op, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package storage
+
+import "testing"
+
+func TestInMemoryStoreContract(t *testing.T) {
+	runStoreContract(t, func(t *testing.T) Store {
+		return NewInMemoryStore()
+	})
+}
@@ -1,11 +1,13 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"lucys-beauty-parlour-backend/models"
 )
@@ -21,67 +23,160 @@ func NewPostgresStore(db *sql.DB) *PostgresStore {
 // normalizeImagePaths ensures all image paths have a leading slash for URL compatibility
 func normalizeImagePaths(paths []string) []string {
 	for i, p := range paths {
-		if p == "" {
-			continue
-		}
-		lower := strings.ToLower(p)
-		// Leave data URIs and absolute URLs unchanged
-		if strings.HasPrefix(lower, "data:") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
-			continue
-		}
-		// If someone accidentally stored "/data:..." or "/http...", strip the extra leading slash
-		if strings.HasPrefix(lower, "/data:") || strings.HasPrefix(lower, "/http://") || strings.HasPrefix(lower, "/https://") {
-			paths[i] = p[1:]
-			continue
-		}
-		// For local upload paths, ensure they start with a slash
-		if !strings.HasPrefix(p, "/") {
-			paths[i] = "/" + p
-		}
+		paths[i] = NormalizeImagePath(p)
 	}
 	return paths
 }
 
-func (s *PostgresStore) CreateAppointment(a *models.Appointment) *models.Appointment {
+// NormalizeImagePath gives a stored local upload path its leading slash, as
+// older rows may lack it, and leaves data URIs and absolute URLs unchanged.
+func NormalizeImagePath(p string) string {
+	if p == "" {
+		return p
+	}
+	lower := strings.ToLower(p)
+	// Leave data URIs and absolute URLs unchanged
+	if strings.HasPrefix(lower, "data:") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return p
+	}
+	// If someone accidentally stored "/data:..." or "/http...", strip the extra leading slash
+	if strings.HasPrefix(lower, "/data:") || strings.HasPrefix(lower, "/http://") || strings.HasPrefix(lower, "/https://") {
+		return p[1:]
+	}
+	// For local upload paths, ensure they start with a slash
+	if !strings.HasPrefix(p, "/") {
+		return "/" + p
+	}
+	return p
+}
+
+// withTx runs fn inside a transaction, committing only if fn succeeds.
+func (s *PostgresStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapDBError("begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapDBError("commit transaction", err)
+	}
+	return nil
+}
+
+// appointmentDayLockSpace namespaces the advisory locks taken per booking day.
+const appointmentDayLockSpace = 1_205_029
+
+// reserveAppointmentDay serialises bookings for date within tx and reports
+// ErrSlotUnavailable if the day already holds its maximum number of confirmed
+// appointments (ignoring excludeID, the appointment being updated, if any).
+//
+// Capacity is counted per day rather than per time range, so an exclusion
+// constraint cannot express it; instead a transaction-scoped advisory lock on
+// the day makes the count and the following write atomic without blocking
+// bookings for other days. The lock is released on commit or rollback.
+func reserveAppointmentDay(ctx context.Context, tx *sql.Tx, date string, excludeID int64) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, ($2::date - DATE '2000-01-01'))`, appointmentDayLockSpace, date); err != nil {
+		return wrapDBError("lock appointment day", err)
+	}
+	var cnt int
+	err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM appointments
+		WHERE appointment_date = $1::date AND status = 'confirmed' AND id <> $2 AND deleted_at IS NULL
+	`, date, excludeID).Scan(&cnt)
+	if err != nil {
+		return wrapDBError("count confirmed appointments", err)
+	}
+	if cnt >= maxConfirmedAppointmentsPerDay {
+		return fmt.Errorf("storage: reserve %s: %w", date, ErrSlotUnavailable)
+	}
+	return nil
+}
+
+// CreateAppointment inserts a, failing with ErrSlotUnavailable if its day is
+// already fully booked. The capacity check, the voucher and points
+// redemptions and the insert happen atomically.
+func (s *PostgresStore) CreateAppointment(ctx context.Context, a *models.Appointment) (*models.Appointment, error) {
 	const q = `
 		INSERT INTO appointments (
 			customer_name, customer_email, customer_phone, staff_name,
 			appointment_date, appointment_time, service_id, service_description,
-			currency, price_cents, notes, status
+			currency, price_cents, deposit_cents, notes, status, cancel_token_hash,
+			voucher_id, promo_code, discount_cents, points_redeemed
 		)
-		VALUES ($1,$2,$3,$4,$5::date,$6::time,$7,$8,$9,$10,$11,$12)
+		VALUES ($1,$2,$3,$4,$5::date,$6::time,$7,$8,$9,$10,$11,$12,$13,NULLIF($14, ''),NULLIF($15, 0),$16,$17,$18)
 		RETURNING id;
 	`
-	if err := s.db.QueryRow(q,
-		a.CustomerName,
-		a.CustomerEmail,
-		a.CustomerPhone,
-		a.StaffName,
-		a.Date,
-		a.Time,
-		a.ServiceID,
-		a.ServiceDescription,
-		a.Currency,
-		a.PriceCents,
-		a.Notes,
-		a.Status,
-	).Scan(&a.ID); err != nil {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := reserveAppointmentDay(ctx, tx, a.Date, 0); err != nil {
+			return err
+		}
+		if a.VoucherID != 0 {
+			if err := redeemVoucher(ctx, tx, a.VoucherID); err != nil {
+				return err
+			}
+		}
+		if a.PointsRedeemed > 0 {
+			balance, err := lockLoyaltyBalance(ctx, tx, loyaltyEmail(a.CustomerEmail))
+			if err != nil {
+				return err
+			}
+			if balance < a.PointsRedeemed {
+				return fmt.Errorf("storage: redeem %d points: %w", a.PointsRedeemed, ErrInsufficientPoints)
+			}
+		}
+		if err := tx.QueryRowContext(ctx, q,
+			a.CustomerName,
+			a.CustomerEmail,
+			a.CustomerPhone,
+			a.StaffName,
+			a.Date,
+			a.Time,
+			a.ServiceID,
+			a.ServiceDescription,
+			a.Currency,
+			a.PriceCents,
+			a.DepositCents,
+			a.Notes,
+			a.Status,
+			a.CancelTokenHash,
+			a.VoucherID,
+			a.PromoCode,
+			a.DiscountCents,
+			a.PointsRedeemed,
+		).Scan(&a.ID); err != nil {
+			return wrapDBError("create appointment", err)
+		}
+		if a.PointsRedeemed > 0 {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO loyalty_entries (customer_email, appointment_id, kind, points)
+				VALUES ($1, $2, 'redeemed', $3)
+			`, loyaltyEmail(a.CustomerEmail), a.ID, -a.PointsRedeemed)
+			if err != nil {
+				return wrapDBError("redeem loyalty points", err)
+			}
+		}
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return a
+	return a, nil
 }
 
-func (s *PostgresStore) GetAllAppointments() []*models.Appointment {
-	rows, err := s.db.Query(`
-		SELECT id, customer_name, customer_email, customer_phone, staff_name,
-			TO_CHAR(appointment_date, 'YYYY-MM-DD') AS date_str,
-			TO_CHAR(appointment_time, 'HH24:MI') AS time_str,
-			service_id, service_description, currency, price_cents, notes, status
+func (s *PostgresStore) GetAllAppointments(ctx context.Context) ([]*models.Appointment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+appointmentColumns+`
 		FROM appointments
+		WHERE deleted_at IS NULL
 		ORDER BY id DESC
 	`)
 	if err != nil {
-		return []*models.Appointment{}
+		return nil, wrapDBError("list appointments", err)
 	}
 	defer rows.Close()
 
@@ -89,48 +184,32 @@ func (s *PostgresStore) GetAllAppointments() []*models.Appointment {
 	for rows.Next() {
 		a, err := scanAppointment(rows)
 		if err != nil {
-			continue
+			return nil, wrapDBError("scan appointment", err)
 		}
 		out = append(out, a)
 	}
-	return out
+	if err := rows.Err(); err != nil {
+		return nil, wrapDBError("list appointments", err)
+	}
+	return out, nil
 }
 
-func (s *PostgresStore) GetAppointment(id int64) (*models.Appointment, error) {
+func (s *PostgresStore) GetAppointment(ctx context.Context, id int64) (*models.Appointment, error) {
 	const q = `
-		SELECT id, customer_name, customer_email, customer_phone, staff_name,
-			TO_CHAR(appointment_date, 'YYYY-MM-DD') AS date_str,
-			TO_CHAR(appointment_time, 'HH24:MI') AS time_str,
-			service_id, service_description, currency, price_cents, notes, status
+		SELECT ` + appointmentColumns + `
 		FROM appointments
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
-	row := s.db.QueryRow(q, id)
-	a := &models.Appointment{}
-	if err := row.Scan(
-		&a.ID,
-		&a.CustomerName,
-		&a.CustomerEmail,
-		&a.CustomerPhone,
-		&a.StaffName,
-		&a.Date,
-		&a.Time,
-		&a.ServiceID,
-		&a.ServiceDescription,
-		&a.Currency,
-		&a.PriceCents,
-		&a.Notes,
-		&a.Status,
-	); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("not found")
-		}
-		return nil, err
+	a, err := scanAppointment(s.db.QueryRowContext(ctx, q, id))
+	if err != nil {
+		return nil, wrapDBError("get appointment", err)
 	}
 	return a, nil
 }
 
-func (s *PostgresStore) UpdateAppointment(id int64, upd *models.Appointment) (*models.Appointment, error) {
+// UpdateAppointment replaces the appointment with id. Confirming it on a day
+// that is already fully booked fails with ErrSlotUnavailable.
+func (s *PostgresStore) UpdateAppointment(ctx context.Context, id int64, upd *models.Appointment) (*models.Appointment, error) {
 	const q = `
 		UPDATE appointments SET
 			customer_name = $1,
@@ -143,104 +222,256 @@ func (s *PostgresStore) UpdateAppointment(id int64, upd *models.Appointment) (*m
 			service_description = $8,
 			currency = $9,
 			price_cents = $10,
-			notes = $11,
-			status = $12
-		WHERE id = $13
+			deposit_cents = $11,
+			notes = $12,
+			status = $13
+		WHERE id = $14 AND deleted_at IS NULL
 	`
-	res, err := s.db.Exec(q,
-		upd.CustomerName,
-		upd.CustomerEmail,
-		upd.CustomerPhone,
-		upd.StaffName,
-		upd.Date,
-		upd.Time,
-		upd.ServiceID,
-		upd.ServiceDescription,
-		upd.Currency,
-		upd.PriceCents,
-		upd.Notes,
-		upd.Status,
-		id,
-	)
-	if err != nil {
-		return nil, err
-	}
-	affected, err := res.RowsAffected()
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// The day's lock comes before the appointment's, as in SettlePayment.
+		if upd.Status == "confirmed" {
+			if err := reserveAppointmentDay(ctx, tx, upd.Date, id); err != nil {
+				return err
+			}
+		}
+		var current string
+		err := tx.QueryRowContext(ctx, `
+			SELECT status FROM appointments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		`, id).Scan(&current)
+		if err != nil {
+			return wrapDBError("update appointment", err)
+		}
+		if err := checkStatusChange(current, upd.Status); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, q,
+			upd.CustomerName,
+			upd.CustomerEmail,
+			upd.CustomerPhone,
+			upd.StaffName,
+			upd.Date,
+			upd.Time,
+			upd.ServiceID,
+			upd.ServiceDescription,
+			upd.Currency,
+			upd.PriceCents,
+			upd.DepositCents,
+			upd.Notes,
+			upd.Status,
+			id,
+		)
+		if err != nil {
+			return wrapDBError("update appointment", err)
+		}
+		return checkAffected("update appointment", res)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if affected == 0 {
-		return nil, errors.New("not found")
-	}
 	upd.ID = id
 	return upd, nil
 }
 
-func (s *PostgresStore) DeleteAppointment(id int64) error {
-	res, err := s.db.Exec(`DELETE FROM appointments WHERE id = $1`, id)
+func (s *PostgresStore) DeleteAppointment(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE appointments SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
 	if err != nil {
-		return err
-	}
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return err
+		return wrapDBError("delete appointment", err)
 	}
-	if affected == 0 {
-		return errors.New("not found")
-	}
-	return nil
+	return checkAffected("delete appointment", res)
 }
 
-func (s *PostgresStore) IsAppointmentSlotAvailable(date string) bool {
+func (s *PostgresStore) IsAppointmentSlotAvailable(ctx context.Context, date string) (bool, error) {
 	var cnt int
-	err := s.db.QueryRow(`SELECT COUNT(*) FROM appointments WHERE appointment_date = $1::date AND status = 'confirmed'`, date).Scan(&cnt)
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM appointments WHERE appointment_date = $1::date AND status = 'confirmed' AND deleted_at IS NULL`, date).Scan(&cnt)
 	if err != nil {
-		return false
+		return false, wrapDBError("count confirmed appointments", err)
 	}
-	return cnt < 15
+	return cnt < maxConfirmedAppointmentsPerDay, nil
 }
 
-func (s *PostgresStore) CancelAppointment(id int64) (*models.Appointment, error) {
-	res, err := s.db.Exec(`UPDATE appointments SET status = 'cancelled' WHERE id = $1`, id)
+func (s *PostgresStore) CancelAppointment(ctx context.Context, id int64, c models.Cancellation) (*models.Appointment, []*models.Refund, error) {
+	status := "cancelled"
+	if c.NoShow {
+		status = "no_show"
+	}
+	var (
+		a       *models.Appointment
+		refunds = make([]*models.Refund, 0)
+	)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var current string
+		err := tx.QueryRowContext(ctx, `
+			SELECT status FROM appointments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		`, id).Scan(&current)
+		if err != nil {
+			return wrapDBError("cancel appointment", err)
+		}
+		if current != "pending" && current != "confirmed" {
+			return conflict("cancel appointment", "appointment is "+current)
+		}
+		// SettlePayment locks the appointment too, so no payment settles
+		// between this check and the commit.
+		var paid int64
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE((
+				SELECT SUM(amount_cents) FROM payments WHERE appointment_id = $1 AND status = 'succeeded'
+			), 0) - COALESCE((
+				SELECT SUM(amount_cents) FROM refunds WHERE appointment_id = $1
+			), 0)
+		`, id).Scan(&paid)
+		if err != nil {
+			return wrapDBError("sum payments", err)
+		}
+		if paid != c.PaidCents {
+			return fmt.Errorf("storage: cancel appointment: %d paid, not %d: %w", paid, c.PaidCents, ErrPaymentsChanged)
+		}
+		a, err = scanAppointment(tx.QueryRowContext(ctx, `
+			UPDATE appointments SET status = $2, cancelled_by = $3, cancellation_reason = $4,
+				cancellation_fee_cents = $5, cancelled_at = NOW()
+			WHERE id = $1
+			RETURNING `+appointmentColumns, id, status, c.By, c.Reason, c.FeeCents))
+		if err != nil {
+			return wrapDBError("cancel appointment", err)
+		}
+		if a.VoucherID != 0 && !c.NoShow {
+			// A cancelled booking never happened, so its voucher use is
+			// given back. A no-show keeps it, as it does the fee.
+			_, err := tx.ExecContext(ctx, `
+				UPDATE vouchers SET uses = uses - 1 WHERE id = $1 AND uses > 0
+			`, a.VoucherID)
+			if err != nil {
+				return wrapDBError("release voucher", err)
+			}
+		}
+		if a.PointsRedeemed > 0 && !c.NoShow {
+			// As with the voucher, a no-show keeps the points it spent. Lock
+			// the balance like a redemption does, so the two can't interleave.
+			if _, err := lockLoyaltyBalance(ctx, tx, loyaltyEmail(a.CustomerEmail)); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO loyalty_entries (customer_email, appointment_id, kind, points)
+				VALUES ($1, $2, 'refunded', $3)
+			`, loyaltyEmail(a.CustomerEmail), id, a.PointsRedeemed)
+			if err != nil {
+				return wrapDBError("refund loyalty points", err)
+			}
+		}
+		if c.RefundCents <= 0 {
+			return nil
+		}
+
+		// What is left to refund of each succeeded payment, newest first.
+		type refundable struct {
+			paymentID, cents int64
+			currency         string
+		}
+		rows, err := tx.QueryContext(ctx, `
+			SELECT p.id, p.currency, p.amount_cents - COALESCE((
+				SELECT SUM(r.amount_cents) FROM refunds r WHERE r.payment_id = p.id
+			), 0)
+			FROM payments p
+			WHERE p.appointment_id = $1 AND p.status = 'succeeded'
+			ORDER BY p.id DESC
+		`, id)
+		if err != nil {
+			return wrapDBError("list refundable payments", err)
+		}
+		var left []refundable
+		for rows.Next() {
+			var r refundable
+			if err := rows.Scan(&r.paymentID, &r.currency, &r.cents); err != nil {
+				rows.Close()
+				return wrapDBError("scan refundable payment", err)
+			}
+			left = append(left, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return wrapDBError("list refundable payments", err)
+		}
+
+		remaining := c.RefundCents
+		for _, p := range left {
+			if remaining <= 0 {
+				break
+			}
+			amount := min(remaining, p.cents)
+			if amount <= 0 {
+				continue
+			}
+			r, err := scanRefund(tx.QueryRowContext(ctx, `
+				INSERT INTO refunds (appointment_id, payment_id, amount_cents, currency)
+				VALUES ($1, $2, $3, $4)
+				RETURNING `+refundColumns, id, p.paymentID, amount, p.currency))
+			if err != nil {
+				return wrapDBError("create refund", err)
+			}
+			refunds = append(refunds, r)
+			remaining -= amount
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	affected, err := res.RowsAffected()
+	return a, refunds, nil
+}
+
+func (s *PostgresStore) GetAppointmentByCancelToken(ctx context.Context, tokenHash string) (*models.Appointment, error) {
+	a, err := scanAppointment(s.db.QueryRowContext(ctx, `
+		SELECT `+appointmentColumns+`
+		FROM appointments
+		WHERE cancel_token_hash = $1 AND deleted_at IS NULL
+	`, tokenHash))
 	if err != nil {
-		return nil, err
-	}
-	if affected == 0 {
-		return nil, errors.New("not found")
+		return nil, wrapDBError("get appointment by cancel token", err)
 	}
-	return s.GetAppointment(id)
+	return a, nil
+}
+
+// appointmentOrders is the ORDER BY clause for each AppointmentSort.
+var appointmentOrders = map[AppointmentSort]string{
+	AppointmentsNewest:      "id DESC",
+	AppointmentsOldest:      "id",
+	AppointmentsByDate:      "appointment_date, appointment_time, id",
+	AppointmentsByDateDesc:  "appointment_date DESC, appointment_time DESC, id DESC",
+	AppointmentsByCustomer:  "LOWER(customer_name), id",
+	AppointmentsByPrice:     "price_cents, id",
+	AppointmentsByPriceDesc: "price_cents DESC, id DESC",
 }
 
-func (s *PostgresStore) GetAppointmentsWithPagination(offset, limit int) ([]*models.Appointment, int) {
+func (s *PostgresStore) GetAppointmentsWithPagination(ctx context.Context, f AppointmentFilter, order AppointmentSort, offset, limit int) ([]*models.Appointment, int, error) {
 	if offset < 0 {
 		offset = 0
 	}
 	// If limit <= 0, treat as no limit (return all). We'll set limit to total after counting.
 
+	where, args, argN := appointmentFilterSQL(f)
+	whereSQL := strings.Join(where, " AND ")
+
 	var total int
-	if err := s.db.QueryRow(`SELECT COUNT(*) FROM appointments`).Scan(&total); err != nil {
-		return []*models.Appointment{}, 0
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM appointments WHERE `+whereSQL, args...).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count appointments", err)
 	}
 
 	if limit <= 0 {
 		limit = total
 	}
+	orderBy, ok := appointmentOrders[order]
+	if !ok {
+		orderBy = appointmentOrders[AppointmentsNewest]
+	}
 
-	rows, err := s.db.Query(`
-		SELECT id, customer_name, customer_email, customer_phone, staff_name,
-			TO_CHAR(appointment_date, 'YYYY-MM-DD') AS date_str,
-			TO_CHAR(appointment_time, 'HH24:MI') AS time_str,
-			service_id, service_description, currency, price_cents, notes, status
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
 		FROM appointments
-		ORDER BY id DESC
-		OFFSET $1 LIMIT $2
-	`, offset, limit)
+		WHERE %s
+		ORDER BY %s
+		OFFSET $%d LIMIT $%d
+	`, appointmentColumns, whereSQL, orderBy, argN, argN+1), append(args, offset, limit)...)
 	if err != nil {
-		return []*models.Appointment{}, total
+		return nil, 0, wrapDBError("list appointments", err)
 	}
 	defer rows.Close()
 
@@ -248,100 +479,205 @@ func (s *PostgresStore) GetAppointmentsWithPagination(offset, limit int) ([]*mod
 	for rows.Next() {
 		a, err := scanAppointment(rows)
 		if err != nil {
-			continue
+			return nil, 0, wrapDBError("scan appointment", err)
 		}
 		out = append(out, a)
 	}
-	return out, total
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list appointments", err)
+	}
+	return out, total, nil
+}
+
+// appointmentFilterSQL builds the conditions on appointments for f, with
+// the placeholder number its arguments continue from.
+func appointmentFilterSQL(f AppointmentFilter) (where []string, args []any, argN int) {
+	where = []string{"deleted_at IS NULL"}
+	args = make([]any, 0)
+	argN = 1
+
+	if f.Status != "" {
+		where = append(where, fmt.Sprintf("status = $%d", argN))
+		args = append(args, f.Status)
+		argN++
+	}
+	if f.From != "" {
+		where = append(where, fmt.Sprintf("appointment_date >= $%d::date", argN))
+		args = append(args, f.From)
+		argN++
+	}
+	if f.To != "" {
+		where = append(where, fmt.Sprintf("appointment_date <= $%d::date", argN))
+		args = append(args, f.To)
+		argN++
+	}
+	if f.ServiceID != 0 {
+		where = append(where, fmt.Sprintf("service_id = $%d", argN))
+		args = append(args, f.ServiceID)
+		argN++
+	}
+	if f.Category != "" {
+		where = append(where, fmt.Sprintf("service_id IN (SELECT id FROM service_items WHERE service = $%d)", argN))
+		args = append(args, f.Category)
+		argN++
+	}
+	if f.StaffName != "" {
+		where = append(where, fmt.Sprintf("LOWER(staff_name) = LOWER($%d)", argN))
+		args = append(args, f.StaffName)
+		argN++
+	}
+	if q := strings.TrimSpace(f.Query); q != "" {
+		// Each branch is served by one of the trigram indexes from
+		// migration 0014.
+		match := fmt.Sprintf("LOWER(customer_name) LIKE $%d OR LOWER(customer_email) LIKE $%d OR LOWER(customer_phone) LIKE $%d", argN, argN, argN)
+		args = append(args, "%"+strings.ToLower(q)+"%")
+		argN++
+		if digits := phoneDigits(q); digits != "" {
+			match += fmt.Sprintf(" OR REGEXP_REPLACE(customer_phone, '[^0-9]', '', 'g') LIKE $%d", argN)
+			args = append(args, "%"+digits+"%")
+			argN++
+		}
+		where = append(where, "("+match+")")
+	}
+	return where, args, argN
+}
+
+func (s *PostgresStore) EachAppointment(ctx context.Context, f AppointmentFilter, fn func(*models.Appointment) error) error {
+	where, args, _ := appointmentFilterSQL(f)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM appointments
+		WHERE %s
+		ORDER BY appointment_date, appointment_time, id
+	`, appointmentColumns, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return wrapDBError("list appointments", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAppointment(rows)
+		if err != nil {
+			return wrapDBError("scan appointment", err)
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return wrapDBError("list appointments", rows.Err())
 }
 
-func (s *PostgresStore) CreateServiceItem(it *models.ServiceItem) *models.ServiceItem {
-	descJSON, _ := json.Marshal(it.Descriptions)
+func (s *PostgresStore) CreateServiceItem(ctx context.Context, it *models.ServiceItem) (*models.ServiceItem, error) {
+	descJSON, err := json.Marshal(it.Descriptions)
+	if err != nil {
+		return nil, err
+	}
 
+	// Ratings are computed from reviews, so they are never written here.
 	if it.ID > 0 {
-		err := s.db.QueryRow(`
-			INSERT INTO service_items (id, service, name, descriptions, rating)
-			VALUES ($1, $2, $3, $4::jsonb, $5)
+		err := s.db.QueryRowContext(ctx, `
+			INSERT INTO service_items (id, service, name, descriptions, image, deposit_percent)
+			VALUES ($1, $2, $3, $4::jsonb, $5, $6)
 			ON CONFLICT (id) DO UPDATE SET
 				service = EXCLUDED.service,
 				name = EXCLUDED.name,
 				descriptions = EXCLUDED.descriptions,
-				rating = EXCLUDED.rating
-			RETURNING id
-		`, it.ID, it.Service, it.Name, string(descJSON), it.Rating).Scan(&it.ID)
+				image = EXCLUDED.image,
+				deposit_percent = EXCLUDED.deposit_percent
+			RETURNING id, rating, review_count
+		`, it.ID, it.Service, it.Name, string(descJSON), it.Image, it.DepositPercent).Scan(&it.ID, &it.Rating, &it.ReviewCount)
 		if err != nil {
-			return nil
+			return nil, wrapDBError("create service item", err)
 		}
-		return it
+		return it, nil
 	}
 
-	err := s.db.QueryRow(`
+	err = s.db.QueryRowContext(ctx, `
 		WITH next_id AS (
 			SELECT COALESCE(MAX(id), 0) + 1 AS id FROM service_items
 		)
-		INSERT INTO service_items (id, service, name, descriptions, rating)
-		SELECT id, $1, $2, $3::jsonb, $4 FROM next_id
-		RETURNING id
-	`, it.Service, it.Name, string(descJSON), it.Rating).Scan(&it.ID)
+		INSERT INTO service_items (id, service, name, descriptions, image, deposit_percent)
+		SELECT id, $1, $2, $3::jsonb, $4, $5 FROM next_id
+		RETURNING id, rating, review_count
+	`, it.Service, it.Name, string(descJSON), it.Image, it.DepositPercent).Scan(&it.ID, &it.Rating, &it.ReviewCount)
 	if err != nil {
-		return nil
+		return nil, wrapDBError("create service item", err)
 	}
-	return it
+	return it, nil
 }
 
-func (s *PostgresStore) UpdateServiceItem(id int64, upd *models.ServiceItem) (*models.ServiceItem, error) {
+func (s *PostgresStore) UpdateServiceItem(ctx context.Context, id int64, upd *models.ServiceItem) (*models.ServiceItem, error) {
 	descJSON, err := json.Marshal(upd.Descriptions)
 	if err != nil {
 		return nil, err
 	}
 
-	res, err := s.db.Exec(`
+	err = s.db.QueryRowContext(ctx, `
 		UPDATE service_items
-		SET service = $1, name = $2, descriptions = $3::jsonb, rating = $4
-		WHERE id = $5
-	`, upd.Service, upd.Name, string(descJSON), upd.Rating, id)
-	if err != nil {
-		return nil, err
-	}
-	affected, err := res.RowsAffected()
+		SET service = $1, name = $2, descriptions = $3::jsonb, image = $4, deposit_percent = $5
+		WHERE id = $6 AND deleted_at IS NULL
+		RETURNING rating, review_count
+	`, upd.Service, upd.Name, string(descJSON), upd.Image, upd.DepositPercent, id).Scan(&upd.Rating, &upd.ReviewCount)
 	if err != nil {
-		return nil, err
-	}
-	if affected == 0 {
-		return nil, errors.New("not found")
+		return nil, wrapDBError("update service item", err)
 	}
 	upd.ID = id
 	return upd, nil
 }
 
-func (s *PostgresStore) DeleteServiceItem(id int64) error {
-	res, err := s.db.Exec(`DELETE FROM service_items WHERE id = $1`, id)
-	if err != nil {
-		return err
-	}
-	affected, err := res.RowsAffected()
+func (s *PostgresStore) ImportServiceItems(ctx context.Context, items []*models.ServiceItem) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, it := range items {
+			descJSON, err := json.Marshal(it.Descriptions)
+			if err != nil {
+				return err
+			}
+			if it.ID == 0 {
+				err = tx.QueryRowContext(ctx, `
+					WITH next_id AS (
+						SELECT COALESCE(MAX(id), 0) + 1 AS id FROM service_items
+					)
+					INSERT INTO service_items (id, service, name, descriptions, image, deposit_percent)
+					SELECT id, $1, $2, $3::jsonb, $4, $5 FROM next_id
+					RETURNING id, rating, review_count
+				`, it.Service, it.Name, string(descJSON), it.Image, it.DepositPercent).Scan(&it.ID, &it.Rating, &it.ReviewCount)
+				if err != nil {
+					return wrapDBError("create service item", err)
+				}
+				continue
+			}
+			err = tx.QueryRowContext(ctx, `
+				UPDATE service_items
+				SET service = $1, name = $2, descriptions = $3::jsonb, image = $4, deposit_percent = $5
+				WHERE id = $6 AND deleted_at IS NULL
+				RETURNING rating, review_count
+			`, it.Service, it.Name, string(descJSON), it.Image, it.DepositPercent, it.ID).Scan(&it.Rating, &it.ReviewCount)
+			if err != nil {
+				return wrapDBError("update service item", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStore) DeleteServiceItem(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE service_items SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
 	if err != nil {
-		return err
-	}
-	if affected == 0 {
-		return errors.New("not found")
+		return wrapDBError("delete service item", err)
 	}
-	return nil
+	return checkAffected("delete service item", res)
 }
 
-func (s *PostgresStore) GetServiceItem(id int64) (*models.ServiceItem, error) {
+func (s *PostgresStore) GetServiceItem(ctx context.Context, id int64) (*models.ServiceItem, error) {
 	var descriptionsRaw []byte
 	it := &models.ServiceItem{}
-	err := s.db.QueryRow(`
-		SELECT id, service, name, descriptions, rating
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, service, name, descriptions, rating, review_count, image, deposit_percent
 		FROM service_items
-		WHERE id = $1
-	`, id).Scan(&it.ID, &it.Service, &it.Name, &descriptionsRaw, &it.Rating)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("not found")
-	}
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id).Scan(&it.ID, &it.Service, &it.Name, &descriptionsRaw, &it.Rating, &it.ReviewCount, &it.Image, &it.DepositPercent)
 	if err != nil {
-		return nil, err
+		return nil, wrapDBError("get service item", err)
 	}
 	if err := json.Unmarshal(descriptionsRaw, &it.Descriptions); err != nil {
 		it.Descriptions = []string{}
@@ -349,7 +685,7 @@ func (s *PostgresStore) GetServiceItem(id int64) (*models.ServiceItem, error) {
 	return it, nil
 }
 
-func (s *PostgresStore) ListServiceItems(category string, minRating float64, q string, offset, limit int) ([]*models.ServiceItem, int) {
+func (s *PostgresStore) ListServiceItems(ctx context.Context, category string, minRating float64, q string, offset, limit int) ([]*models.ServiceItem, int, error) {
 	if offset < 0 {
 		offset = 0
 	}
@@ -360,7 +696,7 @@ func (s *PostgresStore) ListServiceItems(category string, minRating float64, q s
 		limit = 100
 	}
 
-	where := []string{"1=1"}
+	where := []string{"deleted_at IS NULL"}
 	args := make([]any, 0)
 	argN := 1
 
@@ -385,22 +721,22 @@ func (s *PostgresStore) ListServiceItems(category string, minRating float64, q s
 
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM service_items WHERE %s", whereSQL)
 	var total int
-	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
-		return []*models.ServiceItem{}, 0
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count service items", err)
 	}
 
 	listArgs := append(args, offset, limit)
 	listQuery := fmt.Sprintf(`
-		SELECT id, service, name, descriptions, rating
+		SELECT id, service, name, descriptions, rating, review_count, image, deposit_percent
 		FROM service_items
 		WHERE %s
 		ORDER BY id ASC
 		OFFSET $%d LIMIT $%d
 	`, whereSQL, argN, argN+1)
 
-	rows, err := s.db.Query(listQuery, listArgs...)
+	rows, err := s.db.QueryContext(ctx, listQuery, listArgs...)
 	if err != nil {
-		return []*models.ServiceItem{}, total
+		return nil, 0, wrapDBError("list service items", err)
 	}
 	defer rows.Close()
 
@@ -408,81 +744,102 @@ func (s *PostgresStore) ListServiceItems(category string, minRating float64, q s
 	for rows.Next() {
 		var descRaw []byte
 		it := &models.ServiceItem{}
-		if err := rows.Scan(&it.ID, &it.Service, &it.Name, &descRaw, &it.Rating); err != nil {
-			continue
+		if err := rows.Scan(&it.ID, &it.Service, &it.Name, &descRaw, &it.Rating, &it.ReviewCount, &it.Image, &it.DepositPercent); err != nil {
+			return nil, 0, wrapDBError("scan service item", err)
 		}
 		if err := json.Unmarshal(descRaw, &it.Descriptions); err != nil {
 			it.Descriptions = []string{}
 		}
 		out = append(out, it)
 	}
-	return out, total
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list service items", err)
+	}
+	return out, total, nil
 }
 
-func (s *PostgresStore) CreateMenuItem(it *models.MenuItem) *models.MenuItem {
-	err := s.db.QueryRow(`
-		INSERT INTO menu_items (category, name, currency, price_cents, duration_minutes)
-		VALUES ($1, $2, $3, $4, $5)
+// menuItemColumns selects the columns scanned by scanMenuItem.
+const menuItemColumns = `id, category, name, service_item_id, currency, price_cents, duration_minutes`
+
+func (s *PostgresStore) CreateMenuItem(ctx context.Context, it *models.MenuItem) (*models.MenuItem, error) {
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO menu_items (category, name, service_item_id, currency, price_cents, duration_minutes)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
-	`, it.Category, it.Name, it.Currency, it.PriceCents, it.DurationMinutes).Scan(&it.ID)
+	`, it.Category, it.Name, it.ServiceItemID, it.Currency, it.PriceCents, it.DurationMinutes).Scan(&it.ID)
 	if err != nil {
-		return nil
+		return nil, wrapDBError("create menu item", err)
 	}
-	return it
+	return it, nil
 }
 
-func (s *PostgresStore) GetMenuItem(id int64) (*models.MenuItem, error) {
-	it := &models.MenuItem{}
-	err := s.db.QueryRow(`
-		SELECT id, category, name, currency, price_cents, duration_minutes
+func (s *PostgresStore) GetMenuItem(ctx context.Context, id int64) (*models.MenuItem, error) {
+	it, err := scanMenuItem(s.db.QueryRowContext(ctx, `
+		SELECT `+menuItemColumns+`
 		FROM menu_items
-		WHERE id = $1
-	`, id).Scan(&it.ID, &it.Category, &it.Name, &it.Currency, &it.PriceCents, &it.DurationMinutes)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("not found")
-	}
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id))
 	if err != nil {
-		return nil, err
+		return nil, wrapDBError("get menu item", err)
 	}
 	return it, nil
 }
 
-func (s *PostgresStore) UpdateMenuItem(id int64, upd *models.MenuItem) (*models.MenuItem, error) {
-	res, err := s.db.Exec(`
+func (s *PostgresStore) UpdateMenuItem(ctx context.Context, id int64, upd *models.MenuItem) (*models.MenuItem, error) {
+	res, err := s.db.ExecContext(ctx, `
 		UPDATE menu_items
-		SET category = $1, name = $2, currency = $3, price_cents = $4, duration_minutes = $5
-		WHERE id = $6
-	`, upd.Category, upd.Name, upd.Currency, upd.PriceCents, upd.DurationMinutes, id)
+		SET category = $1, name = $2, service_item_id = $3, currency = $4, price_cents = $5, duration_minutes = $6
+		WHERE id = $7 AND deleted_at IS NULL
+	`, upd.Category, upd.Name, upd.ServiceItemID, upd.Currency, upd.PriceCents, upd.DurationMinutes, id)
 	if err != nil {
-		return nil, err
+		return nil, wrapDBError("update menu item", err)
 	}
-	affected, err := res.RowsAffected()
-	if err != nil {
+	if err := checkAffected("update menu item", res); err != nil {
 		return nil, err
 	}
-	if affected == 0 {
-		return nil, errors.New("not found")
-	}
 	upd.ID = id
 	return upd, nil
 }
 
-func (s *PostgresStore) DeleteMenuItem(id int64) error {
-	res, err := s.db.Exec(`DELETE FROM menu_items WHERE id = $1`, id)
-	if err != nil {
-		return err
-	}
-	affected, err := res.RowsAffected()
+func (s *PostgresStore) ImportMenuItems(ctx context.Context, items []*models.MenuItem) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, it := range items {
+			if it.ID == 0 {
+				err := tx.QueryRowContext(ctx, `
+					INSERT INTO menu_items (category, name, service_item_id, currency, price_cents, duration_minutes)
+					VALUES ($1, $2, $3, $4, $5, $6)
+					RETURNING id
+				`, it.Category, it.Name, it.ServiceItemID, it.Currency, it.PriceCents, it.DurationMinutes).Scan(&it.ID)
+				if err != nil {
+					return wrapDBError("create menu item", err)
+				}
+				continue
+			}
+			res, err := tx.ExecContext(ctx, `
+				UPDATE menu_items
+				SET category = $1, name = $2, service_item_id = $3, currency = $4, price_cents = $5, duration_minutes = $6
+				WHERE id = $7 AND deleted_at IS NULL
+			`, it.Category, it.Name, it.ServiceItemID, it.Currency, it.PriceCents, it.DurationMinutes, it.ID)
+			if err != nil {
+				return wrapDBError("update menu item", err)
+			}
+			if err := checkAffected("update menu item", res); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *PostgresStore) DeleteMenuItem(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE menu_items SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
 	if err != nil {
-		return err
+		return wrapDBError("delete menu item", err)
 	}
-	if affected == 0 {
-		return errors.New("not found")
-	}
-	return nil
+	return checkAffected("delete menu item", res)
 }
 
-func (s *PostgresStore) ListMenuItems(category string, q string, offset, limit int) ([]*models.MenuItem, int) {
+func (s *PostgresStore) ListMenuItems(ctx context.Context, category string, q string, offset, limit int) ([]*models.MenuItem, int, error) {
 	if offset < 0 {
 		offset = 0
 	}
@@ -493,7 +850,7 @@ func (s *PostgresStore) ListMenuItems(category string, q string, offset, limit i
 		limit = 100
 	}
 
-	where := []string{"1=1"}
+	where := []string{"deleted_at IS NULL"}
 	args := make([]any, 0)
 	argN := 1
 
@@ -512,114 +869,155 @@ func (s *PostgresStore) ListMenuItems(category string, q string, offset, limit i
 
 	var total int
 	countQ := fmt.Sprintf("SELECT COUNT(*) FROM menu_items WHERE %s", whereSQL)
-	if err := s.db.QueryRow(countQ, args...).Scan(&total); err != nil {
-		return []*models.MenuItem{}, 0
+	if err := s.db.QueryRowContext(ctx, countQ, args...).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count menu items", err)
 	}
 
 	listArgs := append(args, offset, limit)
 	listQ := fmt.Sprintf(`
-		SELECT id, category, name, currency, price_cents, duration_minutes
+		SELECT %s
 		FROM menu_items
 		WHERE %s
 		ORDER BY id ASC
 		OFFSET $%d LIMIT $%d
-	`, whereSQL, argN, argN+1)
+	`, menuItemColumns, whereSQL, argN, argN+1)
 
-	rows, err := s.db.Query(listQ, listArgs...)
+	rows, err := s.db.QueryContext(ctx, listQ, listArgs...)
 	if err != nil {
-		return []*models.MenuItem{}, total
+		return nil, 0, wrapDBError("list menu items", err)
 	}
 	defer rows.Close()
 
 	items := make([]*models.MenuItem, 0)
 	for rows.Next() {
-		it := &models.MenuItem{}
-		if err := rows.Scan(&it.ID, &it.Category, &it.Name, &it.Currency, &it.PriceCents, &it.DurationMinutes); err != nil {
-			continue
+		it, err := scanMenuItem(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan menu item", err)
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list menu items", err)
+	}
+	return items, total, nil
+}
+
+func (s *PostgresStore) ListServiceVariants(ctx context.Context, serviceID int64) ([]*models.MenuItem, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+menuItemColumns+`
+		FROM menu_items
+		WHERE service_item_id = $1 AND deleted_at IS NULL
+		ORDER BY id ASC
+	`, serviceID)
+	if err != nil {
+		return nil, wrapDBError("list service variants", err)
+	}
+	defer rows.Close()
+
+	items := make([]*models.MenuItem, 0)
+	for rows.Next() {
+		it, err := scanMenuItem(rows)
+		if err != nil {
+			return nil, wrapDBError("scan menu item", err)
 		}
 		items = append(items, it)
 	}
-	return items, total
+	if err := rows.Err(); err != nil {
+		return nil, wrapDBError("list service variants", err)
+	}
+	return items, nil
 }
 
 // Portfolio Item Methods
-func (s *PostgresStore) CreatePortfolioItem(it *models.PortfolioItem) *models.PortfolioItem {
-	imgJSON, _ := json.Marshal(it.Images)
 
-	err := s.db.QueryRow(`
-		INSERT INTO portfolio_items (category, style, images, description)
-		VALUES ($1, $2, $3::jsonb, $4)
-		RETURNING id, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
-	`, it.Category, it.Style, string(imgJSON), it.Description).Scan(&it.ID, &it.CreatedAt)
+// portfolioColumns selects the columns scanned by scanPortfolioItem.
+const portfolioColumns = `id, category, style, images, description, captions, before_after, service_item_id, tags, featured, sort_order, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+
+// portfolioJSON encodes the JSONB columns of a portfolio item.
+func portfolioJSON(it *models.PortfolioItem) (images, captions, pairs, tags string, err error) {
+	enc := func(v any) string {
+		if err != nil {
+			return ""
+		}
+		var b []byte
+		b, err = json.Marshal(v)
+		return string(b)
+	}
+	images = enc(nonNil(it.Images))
+	captions = enc(nonNil(it.Captions))
+	pairs = enc(nonNil(it.BeforeAfter))
+	tags = enc(nonNil(it.Tags))
+	return images, captions, pairs, tags, err
+}
+
+// nonNil makes nil slices encode as [] rather than null.
+func nonNil[T any](v []T) []T {
+	if v == nil {
+		return []T{}
+	}
+	return v
+}
+
+func (s *PostgresStore) CreatePortfolioItem(ctx context.Context, it *models.PortfolioItem) (*models.PortfolioItem, error) {
+	images, captions, pairs, tags, err := portfolioJSON(it)
 	if err != nil {
-		// Log the error for debugging
-		fmt.Printf("CreatePortfolioItem error: %v\n", err)
-		return nil
+		return nil, err
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO portfolio_items (category, style, images, description, captions, before_after, service_item_id, tags, featured)
+		VALUES ($1, $2, $3::jsonb, $4, $5::jsonb, $6::jsonb, $7, $8::jsonb, $9)
+		RETURNING id, sort_order, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+	`, it.Category, it.Style, images, it.Description, captions, pairs, it.ServiceItemID, tags, it.Featured).Scan(&it.ID, &it.SortOrder, &it.CreatedAt)
+	if err != nil {
+		return nil, wrapDBError("create portfolio item", err)
 	}
-	return it
+	return it, nil
 }
 
-func (s *PostgresStore) UpdatePortfolioItem(id int64, upd *models.PortfolioItem) (*models.PortfolioItem, error) {
-	imgJSON, err := json.Marshal(upd.Images)
+func (s *PostgresStore) UpdatePortfolioItem(ctx context.Context, id int64, upd *models.PortfolioItem) (*models.PortfolioItem, error) {
+	images, captions, pairs, tags, err := portfolioJSON(upd)
 	if err != nil {
 		return nil, err
 	}
 
 	var createdAt string
-	err = s.db.QueryRow(`
+	err = s.db.QueryRowContext(ctx, `
 		UPDATE portfolio_items
-		SET category = $1, style = $2, images = $3::jsonb, description = $4
-		WHERE id = $5
-		RETURNING TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
-	`, upd.Category, upd.Style, string(imgJSON), upd.Description, id).Scan(&createdAt)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("not found")
-	}
+		SET category = $1, style = $2, images = $3::jsonb, description = $4,
+			captions = $5::jsonb, before_after = $6::jsonb, service_item_id = $7, tags = $8::jsonb, featured = $9
+		WHERE id = $10 AND deleted_at IS NULL
+		RETURNING sort_order, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+	`, upd.Category, upd.Style, images, upd.Description, captions, pairs, upd.ServiceItemID, tags, upd.Featured, id).Scan(&upd.SortOrder, &createdAt)
 	if err != nil {
-		return nil, err
+		return nil, wrapDBError("update portfolio item", err)
 	}
 	upd.ID = id
 	upd.CreatedAt = createdAt
 	return upd, nil
 }
 
-func (s *PostgresStore) DeletePortfolioItem(id int64) error {
-	res, err := s.db.Exec(`DELETE FROM portfolio_items WHERE id = $1`, id)
-	if err != nil {
-		return err
-	}
-	affected, err := res.RowsAffected()
+func (s *PostgresStore) DeletePortfolioItem(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE portfolio_items SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`, id)
 	if err != nil {
-		return err
-	}
-	if affected == 0 {
-		return errors.New("not found")
+		return wrapDBError("delete portfolio item", err)
 	}
-	return nil
+	return checkAffected("delete portfolio item", res)
 }
 
-func (s *PostgresStore) GetPortfolioItem(id int64) (*models.PortfolioItem, error) {
-	var imagesRaw []byte
-	it := &models.PortfolioItem{}
-	err := s.db.QueryRow(`
-		SELECT id, category, style, images, description, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+func (s *PostgresStore) GetPortfolioItem(ctx context.Context, id int64) (*models.PortfolioItem, error) {
+	it, err := scanPortfolioItem(s.db.QueryRowContext(ctx, `
+		SELECT `+portfolioColumns+`
 		FROM portfolio_items
-		WHERE id = $1
-	`, id).Scan(&it.ID, &it.Category, &it.Style, &imagesRaw, &it.Description, &it.CreatedAt)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("not found")
-	}
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id))
 	if err != nil {
-		return nil, err
-	}
-	if err := json.Unmarshal(imagesRaw, &it.Images); err != nil {
-		it.Images = []string{}
+		return nil, wrapDBError("get portfolio item", err)
 	}
-	it.Images = normalizeImagePaths(it.Images)
 	return it, nil
 }
 
-func (s *PostgresStore) ListPortfolioItems(category string, q string, offset, limit int) ([]*models.PortfolioItem, int) {
+func (s *PostgresStore) ListPortfolioItems(ctx context.Context, f PortfolioFilter, offset, limit int) ([]*models.PortfolioItem, int, error) {
 	if offset < 0 {
 		offset = 0
 	}
@@ -630,61 +1028,1266 @@ func (s *PostgresStore) ListPortfolioItems(category string, q string, offset, li
 		limit = 100
 	}
 
-	where := []string{"1=1"}
+	where := []string{"deleted_at IS NULL"}
 	args := make([]any, 0)
 	argN := 1
 
-	if category != "" {
+	if f.Category != "" {
 		where = append(where, fmt.Sprintf("category = $%d", argN))
-		args = append(args, category)
+		args = append(args, f.Category)
 		argN++
 	}
-	if strings.TrimSpace(q) != "" {
-		pattern := "%" + strings.ToLower(strings.TrimSpace(q)) + "%"
+	if q := strings.TrimSpace(f.Query); q != "" {
+		pattern := "%" + strings.ToLower(q) + "%"
 		where = append(where, fmt.Sprintf("(LOWER(style) LIKE $%d OR LOWER(description) LIKE $%d)", argN, argN))
 		args = append(args, pattern)
 		argN++
 	}
+	if f.Tag != "" {
+		where = append(where, fmt.Sprintf("tags ? $%d", argN))
+		args = append(args, f.Tag)
+		argN++
+	}
+	if f.ServiceItemID != 0 {
+		where = append(where, fmt.Sprintf("service_item_id = $%d", argN))
+		args = append(args, f.ServiceItemID)
+		argN++
+	}
+	if f.FeaturedOnly {
+		where = append(where, "featured")
+	}
 
 	whereSQL := strings.Join(where, " AND ")
 
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM portfolio_items WHERE %s", whereSQL)
 	var total int
-	if err := s.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
-		return []*models.PortfolioItem{}, 0
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count portfolio items", err)
 	}
 
 	listArgs := append(args, offset, limit)
 	listQuery := fmt.Sprintf(`
-		SELECT id, category, style, images, description, TO_CHAR(created_at, 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		SELECT %s
 		FROM portfolio_items
 		WHERE %s
-		ORDER BY created_at DESC
+		ORDER BY featured DESC, sort_order, created_at DESC, id DESC
 		OFFSET $%d LIMIT $%d
-	`, whereSQL, argN, argN+1)
+	`, portfolioColumns, whereSQL, argN, argN+1)
 
-	rows, err := s.db.Query(listQuery, listArgs...)
+	rows, err := s.db.QueryContext(ctx, listQuery, listArgs...)
 	if err != nil {
-		return []*models.PortfolioItem{}, total
+		return nil, 0, wrapDBError("list portfolio items", err)
 	}
 	defer rows.Close()
 
 	out := make([]*models.PortfolioItem, 0)
 	for rows.Next() {
-		var imgRaw []byte
-		it := &models.PortfolioItem{}
-		if err := rows.Scan(&it.ID, &it.Category, &it.Style, &imgRaw, &it.Description, &it.CreatedAt); err != nil {
-			continue
-		}
-		if err := json.Unmarshal(imgRaw, &it.Images); err != nil {
-			it.Images = []string{}
+		it, err := scanPortfolioItem(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan portfolio item", err)
 		}
-		it.Images = normalizeImagePaths(it.Images)
 		out = append(out, it)
 	}
-	return out, total
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list portfolio items", err)
+	}
+	return out, total, nil
 }
 
+func (s *PostgresStore) ReorderPortfolioItems(ctx context.Context, ids []int64) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for i, id := range ids {
+			res, err := tx.ExecContext(ctx, `UPDATE portfolio_items SET sort_order = $1 WHERE id = $2 AND deleted_at IS NULL`, i+1, id)
+			if err != nil {
+				return wrapDBError("reorder portfolio items", err)
+			}
+			if err := checkAffected("reorder portfolio items", res); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Category Methods
+
+const categoryColumns = `slug, name, sort_order, icon`
+
+func scanCategory(row interface{ Scan(...any) error }) (*models.Category, error) {
+	cat := &models.Category{}
+	if err := row.Scan(&cat.Slug, &cat.Name, &cat.SortOrder, &cat.Icon); err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+func (s *PostgresStore) ListCategories(ctx context.Context) ([]*models.Category, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+categoryColumns+` FROM categories ORDER BY sort_order, slug`)
+	if err != nil {
+		return nil, wrapDBError("list categories", err)
+	}
+	defer rows.Close()
+	out := []*models.Category{}
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cat)
+	}
+	return out, rows.Err()
+}
+
+func (s *PostgresStore) GetCategory(ctx context.Context, slug string) (*models.Category, error) {
+	cat, err := scanCategory(s.db.QueryRowContext(ctx, `SELECT `+categoryColumns+` FROM categories WHERE slug = $1`, slug))
+	if err != nil {
+		return nil, wrapDBError("get category", err)
+	}
+	return cat, nil
+}
+
+func (s *PostgresStore) CreateCategory(ctx context.Context, cat *models.Category) (*models.Category, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO categories (slug, name, sort_order, icon) VALUES ($1, $2, $3, $4)
+	`, cat.Slug, cat.Name, cat.SortOrder, cat.Icon)
+	if err != nil {
+		return nil, wrapDBError("create category", err)
+	}
+	return cat, nil
+}
+
+// UpdateCategory relies on ON UPDATE CASCADE to move items to a new slug.
+func (s *PostgresStore) UpdateCategory(ctx context.Context, slug string, upd *models.Category) (*models.Category, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE categories SET slug = $1, name = $2, sort_order = $3, icon = $4
+		WHERE slug = $5
+	`, upd.Slug, upd.Name, upd.SortOrder, upd.Icon, slug)
+	if err != nil {
+		return nil, wrapDBError("update category", err)
+	}
+	if err := checkAffected("update category", res); err != nil {
+		return nil, err
+	}
+	return upd, nil
+}
+
+// DeleteCategory fails on the foreign keys while any item, including a
+// trashed one, is in the category.
+func (s *PostgresStore) DeleteCategory(ctx context.Context, slug string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM categories WHERE slug = $1`, slug)
+	if err != nil {
+		return wrapDBError("delete category", err)
+	}
+	return checkAffected("delete category", res)
+}
+
+// Review Methods
+
+func (s *PostgresStore) CreateReviewInvite(ctx context.Context, appointmentID int64, tokenHash string, expiresAt time.Time) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var reviewed bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM reviews WHERE appointment_id = a.id)
+			FROM appointments a
+			WHERE a.id = $1 AND a.deleted_at IS NULL
+			FOR UPDATE OF a
+		`, appointmentID).Scan(&reviewed)
+		if err != nil {
+			return wrapDBError("create review invite", err)
+		}
+		if reviewed {
+			return conflict("create review invite", "appointment already reviewed")
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO review_invites (token_hash, appointment_id, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (appointment_id) DO UPDATE SET
+				token_hash = EXCLUDED.token_hash,
+				expires_at = EXCLUDED.expires_at,
+				used_at = NULL,
+				created_at = NOW()
+		`, tokenHash, appointmentID, expiresAt)
+		return wrapDBError("create review invite", err)
+	})
+}
+
+func (s *PostgresStore) GetReviewInvite(ctx context.Context, tokenHash string) (*models.ReviewInvite, error) {
+	inv := &models.ReviewInvite{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT a.id, a.service_id, a.customer_name, TO_CHAR(a.appointment_date, 'YYYY-MM-DD'),
+			TO_CHAR(ri.expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		FROM review_invites ri
+		JOIN appointments a ON a.id = ri.appointment_id AND a.deleted_at IS NULL
+		WHERE ri.token_hash = $1 AND ri.used_at IS NULL AND ri.expires_at > NOW()
+	`, tokenHash).Scan(&inv.AppointmentID, &inv.ServiceID, &inv.CustomerName, &inv.Date, &inv.ExpiresAt)
+	if err != nil {
+		return nil, wrapDBError("get review invite", err)
+	}
+	return inv, nil
+}
+
+func (s *PostgresStore) SubmitReview(ctx context.Context, tokenHash string, r *models.Review) (*models.Review, error) {
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Marking the link used and reading it in one statement means two
+		// submissions racing on the same link cannot both succeed.
+		var appointmentID int64
+		err := tx.QueryRowContext(ctx, `
+			UPDATE review_invites ri SET used_at = NOW()
+			FROM appointments a
+			WHERE ri.token_hash = $1 AND ri.used_at IS NULL AND ri.expires_at > NOW()
+				AND a.id = ri.appointment_id AND a.deleted_at IS NULL
+			RETURNING a.id, a.service_id
+		`, tokenHash).Scan(&appointmentID, &r.ServiceID)
+		if err != nil {
+			return wrapDBError("submit review", err)
+		}
+		r.AppointmentID = &appointmentID
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO reviews (appointment_id, service_id, author, rating, comment)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, status, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		`, appointmentID, r.ServiceID, r.Author, r.Rating, r.Comment).Scan(&r.ID, &r.Status, &r.CreatedAt)
+		return wrapDBError("submit review", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reviewColumns selects the columns scanned by scanReview.
+const reviewColumns = `id, appointment_id, service_id, author, rating, comment, status, TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+
+func (s *PostgresStore) ListReviews(ctx context.Context, f ReviewFilter, offset, limit int) ([]*models.Review, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	where := []string{"TRUE"}
+	args := make([]any, 0)
+	argN := 1
+
+	if f.ServiceID != 0 {
+		where = append(where, fmt.Sprintf("service_id = $%d", argN))
+		args = append(args, f.ServiceID)
+		argN++
+	}
+	if f.Status != "" {
+		where = append(where, fmt.Sprintf("status = $%d", argN))
+		args = append(args, f.Status)
+		argN++
+	}
+
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM reviews WHERE %s", whereSQL), args...).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count reviews", err)
+	}
+
+	listArgs := append(args, offset, limit)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM reviews
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		OFFSET $%d LIMIT $%d
+	`, reviewColumns, whereSQL, argN, argN+1), listArgs...)
+	if err != nil {
+		return nil, 0, wrapDBError("list reviews", err)
+	}
+	defer rows.Close()
+
+	out := make([]*models.Review, 0)
+	for rows.Next() {
+		r, err := scanReview(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan review", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list reviews", err)
+	}
+	return out, total, nil
+}
+
+func (s *PostgresStore) ModerateReview(ctx context.Context, id int64, status string) (*models.Review, error) {
+	var r *models.Review
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		r, err = scanReview(tx.QueryRowContext(ctx, `
+			UPDATE reviews SET status = $1 WHERE id = $2
+			RETURNING `+reviewColumns, status, id))
+		if err != nil {
+			return wrapDBError("moderate review", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE service_items SET
+				rating = COALESCE(agg.rating, 0),
+				review_count = agg.n
+			FROM (
+				SELECT ROUND(AVG(rating)::numeric, 1)::float8 AS rating, COUNT(*) AS n
+				FROM reviews
+				WHERE service_id = $1 AND status = 'approved'
+			) agg
+			WHERE id = $1
+		`, r.ServiceID)
+		return wrapDBError("update service rating", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func scanReview(scanner interface {
+	Scan(dest ...any) error
+}) (*models.Review, error) {
+	var appointmentID sql.NullInt64
+	r := &models.Review{}
+	if err := scanner.Scan(&r.ID, &appointmentID, &r.ServiceID, &r.Author, &r.Rating, &r.Comment, &r.Status, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	if appointmentID.Valid {
+		r.AppointmentID = &appointmentID.Int64
+	}
+	return r, nil
+}
+
+// Payment Methods
+
+// paymentColumns selects the columns scanned by scanPayment.
+const paymentColumns = `id, appointment_id, provider, provider_ref, amount_cents, currency,
+	status, failure_reason, checkout_url,
+	TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+	TO_CHAR(updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+
+func scanPayment(scanner interface {
+	Scan(dest ...any) error
+}) (*models.Payment, error) {
+	p := &models.Payment{}
+	if err := scanner.Scan(&p.ID, &p.AppointmentID, &p.Provider, &p.ProviderRef, &p.AmountCents, &p.Currency,
+		&p.Status, &p.FailureReason, &p.CheckoutURL, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *PostgresStore) CreatePayment(ctx context.Context, p *models.Payment) (*models.Payment, error) {
+	if p.Status == "" {
+		p.Status = "pending"
+	}
+	created, err := scanPayment(s.db.QueryRowContext(ctx, `
+		INSERT INTO payments (appointment_id, provider, provider_ref, amount_cents, currency, status, failure_reason, checkout_url)
+		SELECT id, $2, $3, $4, $5, $6, $7, $8 FROM appointments WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+paymentColumns,
+		p.AppointmentID, p.Provider, p.ProviderRef, p.AmountCents, p.Currency, p.Status, p.FailureReason, p.CheckoutURL))
+	if err != nil {
+		return nil, wrapDBError("create payment", err)
+	}
+	return created, nil
+}
+
+func (s *PostgresStore) ListPayments(ctx context.Context, appointmentID int64) ([]*models.Payment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+paymentColumns+` FROM payments WHERE appointment_id = $1 ORDER BY id
+	`, appointmentID)
+	if err != nil {
+		return nil, wrapDBError("list payments", err)
+	}
+	defer rows.Close()
+	out := make([]*models.Payment, 0)
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, wrapDBError("scan payment", err)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapDBError("list payments", err)
+	}
+	return out, nil
+}
+
+func (s *PostgresStore) GetPaymentByRef(ctx context.Context, provider, providerRef string) (*models.Payment, error) {
+	p, err := scanPayment(s.db.QueryRowContext(ctx, `
+		SELECT `+paymentColumns+` FROM payments WHERE provider = $1 AND provider_ref = $2
+	`, provider, providerRef))
+	if err != nil {
+		return nil, wrapDBError("get payment", err)
+	}
+	return p, nil
+}
+
+func (s *PostgresStore) SettlePayment(ctx context.Context, provider, providerRef, status, reason string) (*models.Payment, bool, error) {
+	var (
+		p         *models.Payment
+		confirmed bool
+	)
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		// Only a pending payment is updated, so a repeated webhook finds
+		// nothing to do and reads the payment as it stands.
+		p, err = scanPayment(tx.QueryRowContext(ctx, `
+			UPDATE payments SET status = $3, failure_reason = $4, updated_at = NOW()
+			WHERE provider = $1 AND provider_ref = $2 AND status = 'pending'
+			RETURNING `+paymentColumns, provider, providerRef, status, reason))
+		if errors.Is(err, sql.ErrNoRows) {
+			p, err = scanPayment(tx.QueryRowContext(ctx, `
+				SELECT `+paymentColumns+` FROM payments WHERE provider = $1 AND provider_ref = $2
+			`, provider, providerRef))
+			return wrapDBError("settle payment", err)
+		}
+		if err != nil {
+			return wrapDBError("settle payment", err)
+		}
+		if status != "succeeded" {
+			return nil
+		}
+
+		var date string
+		err = tx.QueryRowContext(ctx, `
+			SELECT TO_CHAR(appointment_date, 'YYYY-MM-DD') FROM appointments WHERE id = $1 AND deleted_at IS NULL
+		`, p.AppointmentID).Scan(&date)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return wrapDBError("load appointment", err)
+		}
+		// Taking the day's lock first orders this with bookings for the day,
+		// and with settling the appointment's other payments. A full day
+		// leaves the booking for the salon to reschedule.
+		err = reserveAppointmentDay(ctx, tx, date, p.AppointmentID)
+		full := errors.Is(err, ErrSlotUnavailable)
+		if err != nil && !full {
+			return err
+		}
+		// Locking the appointment orders this with CancelAppointment, which
+		// works out refunds from what has been paid.
+		var current string
+		err = tx.QueryRowContext(ctx, `
+			SELECT status FROM appointments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		`, p.AppointmentID).Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return wrapDBError("load appointment", err)
+		}
+		if isCancelledStatus(current) {
+			// The cancellation has already settled what was paid.
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO refunds (appointment_id, payment_id, amount_cents, currency)
+				VALUES ($1, $2, $3, $4)
+			`, p.AppointmentID, p.ID, p.AmountCents, p.Currency)
+			return wrapDBError("refund late payment", err)
+		}
+		if full {
+			return nil
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE appointments a SET status = 'confirmed'
+			WHERE a.id = $1 AND a.status = 'pending' AND a.deleted_at IS NULL AND a.deposit_cents > 0
+				AND a.deposit_cents <= (
+					SELECT COALESCE(SUM(amount_cents), 0) FROM payments
+					WHERE appointment_id = a.id AND status = 'succeeded'
+				)
+		`, p.AppointmentID)
+		if err != nil {
+			return wrapDBError("confirm appointment", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return wrapDBError("confirm appointment", err)
+		}
+		confirmed = n > 0
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return p, confirmed, nil
+}
+
+// Refund Methods
+
+// refundColumns selects the columns scanned by scanRefund.
+const refundColumns = `id, appointment_id, payment_id, amount_cents, currency, status,
+	TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+	COALESCE(TO_CHAR(paid_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), '')`
+
+func scanRefund(scanner interface {
+	Scan(dest ...any) error
+}) (*models.Refund, error) {
+	r := &models.Refund{}
+	if err := scanner.Scan(&r.ID, &r.AppointmentID, &r.PaymentID, &r.AmountCents, &r.Currency,
+		&r.Status, &r.CreatedAt, &r.PaidAt); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *PostgresStore) ListRefunds(ctx context.Context, f RefundFilter, offset, limit int) ([]*models.Refund, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	where := []string{"TRUE"}
+	args := make([]any, 0)
+	argN := 1
+
+	if f.AppointmentID != 0 {
+		where = append(where, fmt.Sprintf("appointment_id = $%d", argN))
+		args = append(args, f.AppointmentID)
+		argN++
+	}
+	if f.Status != "" {
+		where = append(where, fmt.Sprintf("status = $%d", argN))
+		args = append(args, f.Status)
+		argN++
+	}
+
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM refunds WHERE %s", whereSQL), args...).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count refunds", err)
+	}
+
+	listArgs := append(args, offset, limit)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s
+		FROM refunds
+		WHERE %s
+		ORDER BY id DESC
+		OFFSET $%d LIMIT $%d
+	`, refundColumns, whereSQL, argN, argN+1), listArgs...)
+	if err != nil {
+		return nil, 0, wrapDBError("list refunds", err)
+	}
+	defer rows.Close()
+
+	out := make([]*models.Refund, 0)
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan refund", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list refunds", err)
+	}
+	return out, total, nil
+}
+
+func (s *PostgresStore) MarkRefundPaid(ctx context.Context, id int64) (*models.Refund, error) {
+	r, err := scanRefund(s.db.QueryRowContext(ctx, `
+		UPDATE refunds SET status = 'paid', paid_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING `+refundColumns, id))
+	if !errors.Is(err, sql.ErrNoRows) {
+		if err != nil {
+			return nil, wrapDBError("mark refund paid", err)
+		}
+		return r, nil
+	}
+	var status string
+	if err := s.db.QueryRowContext(ctx, `SELECT status FROM refunds WHERE id = $1`, id).Scan(&status); err != nil {
+		return nil, wrapDBError("mark refund paid", err)
+	}
+	return nil, conflict("mark refund paid", "refund is "+status)
+}
+
+// Invoice Methods
+
+// invoiceColumns selects the columns scanned by scanInvoice.
+const invoiceColumns = `id, number, appointment_id, customer_name, customer_email, service_name,
+	service_description, TO_CHAR(appointment_date, 'YYYY-MM-DD'), currency, total_cents, discount_cents,
+	promo_code, points_redeemed, deposit_cents, deposit_paid_cents, TO_CHAR(issued_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+
+func scanInvoice(scanner interface {
+	Scan(dest ...any) error
+}) (*models.Invoice, error) {
+	inv := &models.Invoice{}
+	if err := scanner.Scan(&inv.ID, &inv.Number, &inv.AppointmentID, &inv.CustomerName, &inv.CustomerEmail,
+		&inv.ServiceName, &inv.ServiceDescription, &inv.AppointmentDate, &inv.Currency, &inv.TotalCents,
+		&inv.DiscountCents, &inv.PromoCode, &inv.PointsRedeemed, &inv.DepositCents, &inv.DepositPaidCents,
+		&inv.IssuedAt); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (s *PostgresStore) IssueInvoice(ctx context.Context, inv *models.Invoice) (*models.Invoice, error) {
+	var issued *models.Invoice
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		// Locking the appointment orders concurrent requests, so only the
+		// first takes a number.
+		var id int64
+		err := tx.QueryRowContext(ctx, `
+			SELECT id FROM appointments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		`, inv.AppointmentID).Scan(&id)
+		if err != nil {
+			return wrapDBError("issue invoice", err)
+		}
+		issued, err = scanInvoice(tx.QueryRowContext(ctx, `
+			SELECT `+invoiceColumns+` FROM invoices WHERE appointment_id = $1
+		`, inv.AppointmentID))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return wrapDBError("get invoice", err)
+		}
+
+		var next int64
+		if err := tx.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('invoices', 'id'))`).Scan(&next); err != nil {
+			return wrapDBError("number invoice", err)
+		}
+		issued, err = scanInvoice(tx.QueryRowContext(ctx, `
+			INSERT INTO invoices (id, number, appointment_id, customer_name, customer_email, service_name,
+				service_description, appointment_date, currency, total_cents, discount_cents, promo_code,
+				points_redeemed, deposit_cents, deposit_paid_cents)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::date, $9, $10, $11, $12, $13, $14, $15)
+			RETURNING `+invoiceColumns,
+			next, invoiceNumber(next), inv.AppointmentID, inv.CustomerName, inv.CustomerEmail, inv.ServiceName,
+			inv.ServiceDescription, inv.AppointmentDate, inv.Currency, inv.TotalCents, inv.DiscountCents, inv.PromoCode,
+			inv.PointsRedeemed, inv.DepositCents, inv.DepositPaidCents))
+		return wrapDBError("issue invoice", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// Voucher Methods
+
+// voucherColumns selects the columns scanned by scanVoucher.
+const voucherColumns = `id, code, kind, value, currency,
+	COALESCE(TO_CHAR(expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), ''),
+	max_uses, uses, active, note,
+	TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+
+func scanVoucher(scanner interface {
+	Scan(dest ...any) error
+}) (*models.Voucher, error) {
+	v := &models.Voucher{}
+	if err := scanner.Scan(&v.ID, &v.Code, &v.Kind, &v.Value, &v.Currency, &v.ExpiresAt,
+		&v.MaxUses, &v.Uses, &v.Active, &v.Note, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// redeemVoucher counts a use of voucher id, failing with
+// ErrVoucherUnavailable if it is inactive, expired or used up. The row lock
+// taken by the update keeps concurrent bookings under max_uses.
+func redeemVoucher(ctx context.Context, tx *sql.Tx, id int64) error {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE vouchers SET uses = uses + 1
+		WHERE id = $1 AND active
+			AND (expires_at IS NULL OR expires_at > NOW())
+			AND (max_uses = 0 OR uses < max_uses)
+	`, id)
+	if err != nil {
+		return wrapDBError("redeem voucher", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return wrapDBError("redeem voucher", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("storage: redeem voucher %d: %w", id, ErrVoucherUnavailable)
+	}
+	return nil
+}
+
+func (s *PostgresStore) CreateVoucher(ctx context.Context, v *models.Voucher) (*models.Voucher, error) {
+	created, err := scanVoucher(s.db.QueryRowContext(ctx, `
+		INSERT INTO vouchers (code, kind, value, currency, expires_at, max_uses, active, note)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::timestamptz, $6, $7, $8)
+		RETURNING `+voucherColumns,
+		v.Code, v.Kind, v.Value, v.Currency, v.ExpiresAt, v.MaxUses, v.Active, v.Note))
+	if err != nil {
+		return nil, wrapDBError("create voucher", err)
+	}
+	return created, nil
+}
+
+func (s *PostgresStore) GetVoucher(ctx context.Context, id int64) (*models.Voucher, error) {
+	v, err := scanVoucher(s.db.QueryRowContext(ctx, `SELECT `+voucherColumns+` FROM vouchers WHERE id = $1`, id))
+	if err != nil {
+		return nil, wrapDBError("get voucher", err)
+	}
+	return v, nil
+}
+
+func (s *PostgresStore) GetVoucherByCode(ctx context.Context, code string) (*models.Voucher, error) {
+	v, err := scanVoucher(s.db.QueryRowContext(ctx, `SELECT `+voucherColumns+` FROM vouchers WHERE code = $1`, code))
+	if err != nil {
+		return nil, wrapDBError("get voucher", err)
+	}
+	return v, nil
+}
+
+func (s *PostgresStore) ListVouchers(ctx context.Context, offset, limit int) ([]*models.Voucher, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM vouchers`).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count vouchers", err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+voucherColumns+`
+		FROM vouchers
+		ORDER BY id DESC
+		OFFSET $1 LIMIT $2
+	`, offset, limit)
+	if err != nil {
+		return nil, 0, wrapDBError("list vouchers", err)
+	}
+	defer rows.Close()
+
+	out := make([]*models.Voucher, 0)
+	for rows.Next() {
+		v, err := scanVoucher(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan voucher", err)
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list vouchers", err)
+	}
+	return out, total, nil
+}
+
+func (s *PostgresStore) UpdateVoucher(ctx context.Context, id int64, upd *models.Voucher) (*models.Voucher, error) {
+	v, err := scanVoucher(s.db.QueryRowContext(ctx, `
+		UPDATE vouchers SET kind = $1, value = $2, currency = $3,
+			expires_at = NULLIF($4, '')::timestamptz, max_uses = $5, active = $6, note = $7
+		WHERE id = $8
+		RETURNING `+voucherColumns,
+		upd.Kind, upd.Value, upd.Currency, upd.ExpiresAt, upd.MaxUses, upd.Active, upd.Note, id))
+	if err != nil {
+		return nil, wrapDBError("update voucher", err)
+	}
+	return v, nil
+}
+
+// DeleteVoucher fails on the foreign key once a booking, trashed or not,
+// has redeemed the voucher.
+func (s *PostgresStore) DeleteVoucher(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM vouchers WHERE id = $1`, id)
+	if err != nil {
+		return wrapDBError("delete voucher", err)
+	}
+	return checkAffected("delete voucher", res)
+}
+
+// Loyalty Methods
+
+// loyaltyEntryColumns selects the columns scanned by scanLoyaltyEntry.
+const loyaltyEntryColumns = `id, customer_email, appointment_id, kind, points,
+	TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')`
+
+func scanLoyaltyEntry(scanner interface {
+	Scan(dest ...any) error
+}) (*models.LoyaltyEntry, error) {
+	e := &models.LoyaltyEntry{}
+	var appointmentID sql.NullInt64
+	if err := scanner.Scan(&e.ID, &e.CustomerEmail, &appointmentID, &e.Kind, &e.Points, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	if appointmentID.Valid {
+		e.AppointmentID = &appointmentID.Int64
+	}
+	return e, nil
+}
+
+// lockLoyaltyBalance returns a customer's balance, holding a transaction
+// lock on their points so concurrent bookings can't spend them twice.
+func lockLoyaltyBalance(ctx context.Context, tx *sql.Tx, email string) (int64, error) {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('loyalty:' || $1))`, email); err != nil {
+		return 0, wrapDBError("lock loyalty points", err)
+	}
+	var balance int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(points), 0) FROM loyalty_entries WHERE customer_email = $1
+	`, email).Scan(&balance)
+	if err != nil {
+		return 0, wrapDBError("loyalty balance", err)
+	}
+	return balance, nil
+}
+
+func (s *PostgresStore) GetLoyaltySettings(ctx context.Context) (*models.LoyaltySettings, error) {
+	ls := &models.LoyaltySettings{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT currency, spend_per_point, point_value_cents FROM loyalty_settings
+	`).Scan(&ls.Currency, &ls.SpendPerPoint, &ls.PointValueCents)
+	if err != nil {
+		return nil, wrapDBError("get loyalty settings", err)
+	}
+	return ls, nil
+}
+
+func (s *PostgresStore) UpdateLoyaltySettings(ctx context.Context, upd *models.LoyaltySettings) (*models.LoyaltySettings, error) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO loyalty_settings (id, currency, spend_per_point, point_value_cents)
+		VALUES (TRUE, $1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET
+			currency = EXCLUDED.currency,
+			spend_per_point = EXCLUDED.spend_per_point,
+			point_value_cents = EXCLUDED.point_value_cents
+	`, upd.Currency, upd.SpendPerPoint, upd.PointValueCents)
+	if err != nil {
+		return nil, wrapDBError("update loyalty settings", err)
+	}
+	return upd, nil
+}
+
+func (s *PostgresStore) EarnLoyaltyPoints(ctx context.Context, appointmentID, points int64) (*models.LoyaltyEntry, error) {
+	var earned *models.LoyaltyEntry
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var email string
+		err := tx.QueryRowContext(ctx, `
+			SELECT customer_email FROM appointments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		`, appointmentID).Scan(&email)
+		if err != nil {
+			return wrapDBError("earn loyalty points", err)
+		}
+		earned, err = scanLoyaltyEntry(tx.QueryRowContext(ctx, `
+			SELECT `+loyaltyEntryColumns+` FROM loyalty_entries WHERE appointment_id = $1 AND kind = 'earned'
+		`, appointmentID))
+		if !errors.Is(err, sql.ErrNoRows) {
+			return wrapDBError("get loyalty entry", err)
+		}
+		earned, err = scanLoyaltyEntry(tx.QueryRowContext(ctx, `
+			INSERT INTO loyalty_entries (customer_email, appointment_id, kind, points)
+			VALUES ($1, $2, 'earned', $3)
+			RETURNING `+loyaltyEntryColumns, loyaltyEmail(email), appointmentID, points))
+		return wrapDBError("earn loyalty points", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return earned, nil
+}
+
+func (s *PostgresStore) LoyaltyBalance(ctx context.Context, email string) (int64, error) {
+	var balance int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(points), 0) FROM loyalty_entries WHERE customer_email = $1
+	`, loyaltyEmail(email)).Scan(&balance)
+	if err != nil {
+		return 0, wrapDBError("loyalty balance", err)
+	}
+	return balance, nil
+}
+
+func (s *PostgresStore) ListLoyaltyEntries(ctx context.Context, email string, offset, limit int) ([]*models.LoyaltyEntry, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	email = loyaltyEmail(email)
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM loyalty_entries WHERE customer_email = $1`, email).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count loyalty entries", err)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+loyaltyEntryColumns+`
+		FROM loyalty_entries
+		WHERE customer_email = $1
+		ORDER BY id DESC
+		OFFSET $2 LIMIT $3
+	`, email, offset, limit)
+	if err != nil {
+		return nil, 0, wrapDBError("list loyalty entries", err)
+	}
+	defer rows.Close()
+
+	out := make([]*models.LoyaltyEntry, 0)
+	for rows.Next() {
+		e, err := scanLoyaltyEntry(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan loyalty entry", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list loyalty entries", err)
+	}
+	return out, total, nil
+}
+
+// Report Methods
+
+// reportGroups are the SQL expressions for the key and label of each report
+// grouping, over appointments a joined to their service s and its category c.
+var reportGroups = map[ReportGrouping]struct{ key, label string }{
+	ReportTotal:      {`''`, `''`},
+	ReportByDay:      {`TO_CHAR(a.appointment_date, 'YYYY-MM-DD')`, `TO_CHAR(a.appointment_date, 'YYYY-MM-DD')`},
+	ReportByWeek:     {`TO_CHAR(DATE_TRUNC('week', a.appointment_date), 'YYYY-MM-DD')`, `TO_CHAR(DATE_TRUNC('week', a.appointment_date), 'YYYY-MM-DD')`},
+	ReportByMonth:    {`TO_CHAR(a.appointment_date, 'YYYY-MM')`, `TO_CHAR(a.appointment_date, 'YYYY-MM')`},
+	ReportByService:  {`a.service_id::text`, `COALESCE(s.name, '')`},
+	ReportByCategory: {`COALESCE(s.service, '')`, `COALESCE(c.name, s.service, '')`},
+	ReportByStaff:    {`a.staff_name`, `COALESCE(NULLIF(a.staff_name, ''), 'Unassigned')`},
+	ReportByHour:     {`TO_CHAR(a.appointment_time, 'HH24')`, `TO_CHAR(a.appointment_time, 'HH24') || ':00'`},
+}
+
+func (s *PostgresStore) ReportAppointments(ctx context.Context, f ReportFilter, by ReportGrouping) ([]*models.ReportRow, error) {
+	group, ok := reportGroups[by]
+	if !ok {
+		return nil, fmt.Errorf("storage: unknown report grouping %q", by)
+	}
+
+	where := []string{"a.deleted_at IS NULL"}
+	args := make([]any, 0)
+	argN := 1
+
+	if f.From != "" {
+		where = append(where, fmt.Sprintf("a.appointment_date >= $%d::date", argN))
+		args = append(args, f.From)
+		argN++
+	}
+	if f.To != "" {
+		where = append(where, fmt.Sprintf("a.appointment_date <= $%d::date", argN))
+		args = append(args, f.To)
+		argN++
+	}
+
+	order := "key, currency"
+	if !by.chronological() {
+		order = "revenue_cents DESC, bookings DESC, key, currency"
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s AS key, %s AS label, a.currency,
+			COUNT(*) AS bookings,
+			COUNT(*) FILTER (WHERE a.status = 'completed'),
+			COUNT(*) FILTER (WHERE a.status = 'cancelled'),
+			COUNT(*) FILTER (WHERE a.status = 'no_show'),
+			COALESCE(SUM(a.price_cents) FILTER (WHERE a.status = 'completed'), 0) AS revenue_cents,
+			COALESCE(SUM(a.cancellation_fee_cents) FILTER (WHERE a.status IN ('cancelled', 'no_show')), 0)
+		FROM appointments a
+		LEFT JOIN service_items s ON s.id = a.service_id
+		LEFT JOIN categories c ON c.slug = s.service
+		WHERE %s
+		GROUP BY 1, 2, 3
+		ORDER BY %s
+	`, group.key, group.label, strings.Join(where, " AND "), order), args...)
+	if err != nil {
+		return nil, wrapDBError("report appointments", err)
+	}
+	defer rows.Close()
+
+	out := make([]*models.ReportRow, 0)
+	for rows.Next() {
+		r := &models.ReportRow{}
+		if err := rows.Scan(&r.Key, &r.Label, &r.Currency, &r.Bookings, &r.Completed, &r.Cancelled,
+			&r.NoShows, &r.RevenueCents, &r.FeesCents); err != nil {
+			return nil, wrapDBError("scan report row", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapDBError("report appointments", err)
+	}
+	return out, nil
+}
+
+// Customer Methods
+
+func (s *PostgresStore) EachCustomer(ctx context.Context, f ReportFilter, fn func(*models.Customer) error) error {
+	where := []string{"deleted_at IS NULL"}
+	args := make([]any, 0)
+	argN := 1
+
+	if f.From != "" {
+		where = append(where, fmt.Sprintf("appointment_date >= $%d::date", argN))
+		args = append(args, f.From)
+		argN++
+	}
+	if f.To != "" {
+		where = append(where, fmt.Sprintf("appointment_date <= $%d::date", argN))
+		args = append(args, f.To)
+		argN++
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		WITH booked AS (
+			SELECT LOWER(TRIM(customer_email)) AS email, *
+			FROM appointments
+			WHERE %s
+		), latest AS (
+			SELECT DISTINCT ON (email) email, customer_name, customer_phone
+			FROM booked
+			ORDER BY email, appointment_date DESC, id DESC
+		), totals AS (
+			SELECT email,
+				COUNT(*) AS bookings,
+				COUNT(*) FILTER (WHERE status = 'completed') AS completed,
+				COUNT(*) FILTER (WHERE status = 'cancelled') AS cancelled,
+				COUNT(*) FILTER (WHERE status = 'no_show') AS no_shows,
+				TO_CHAR(MIN(appointment_date), 'YYYY-MM-DD') AS first_visit,
+				TO_CHAR(MAX(appointment_date), 'YYYY-MM-DD') AS last_visit
+			FROM booked
+			GROUP BY email
+		), spent AS (
+			SELECT email, jsonb_object_agg(currency, cents) AS cents
+			FROM (
+				SELECT email, currency, SUM(price_cents) AS cents
+				FROM booked
+				WHERE status = 'completed'
+				GROUP BY email, currency
+			) per_currency
+			GROUP BY email
+		)
+		SELECT t.email, l.customer_name, l.customer_phone, t.bookings, t.completed, t.cancelled,
+			t.no_shows, t.first_visit, t.last_visit, COALESCE(sp.cents, '{}'::jsonb),
+			COALESCE((SELECT SUM(points) FROM loyalty_entries le WHERE le.customer_email = t.email), 0)
+		FROM totals t
+		JOIN latest l ON l.email = t.email
+		LEFT JOIN spent sp ON sp.email = t.email
+		ORDER BY t.email
+	`, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return wrapDBError("list customers", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := &models.Customer{}
+		var spentRaw []byte
+		if err := rows.Scan(&c.Email, &c.Name, &c.Phone, &c.Bookings, &c.Completed, &c.Cancelled,
+			&c.NoShows, &c.FirstVisit, &c.LastVisit, &spentRaw, &c.LoyaltyPoints); err != nil {
+			return wrapDBError("scan customer", err)
+		}
+		if err := json.Unmarshal(spentRaw, &c.SpentCents); err != nil {
+			return fmt.Errorf("storage: decode customer spend: %w", err)
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return wrapDBError("list customers", rows.Err())
+}
+
+// trashTable describes how each trash kind is stored: its table, the
+// expression that labels a row, and the expression yielding its images.
+type trashTable struct {
+	table, label, images string
+}
+
+var trashTables = map[TrashKind]trashTable{
+	TrashAppointments: {"appointments", `customer_name || ' on ' || TO_CHAR(appointment_date, 'YYYY-MM-DD')`, `'[]'::jsonb`},
+	TrashServices:     {"service_items", "name", `'[]'::jsonb`},
+	TrashPortfolio:    {"portfolio_items", "style", "images"},
+	TrashMenuItems:    {"menu_items", "name", `'[]'::jsonb`},
+}
+
+// trashColumns selects the columns scanned by scanTrashItem for kind.
+func trashColumns(kind TrashKind) string {
+	t := trashTables[kind]
+	return fmt.Sprintf(`'%s' AS kind, id, %s AS label, %s AS images, deleted_at`, kind, t.label, t.images)
+}
+
+func (s *PostgresStore) ListTrash(ctx context.Context, kind TrashKind, offset, limit int) ([]*models.TrashItem, int, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	parts := make([]string, 0, len(TrashKinds))
+	for _, k := range TrashKinds {
+		if kind != "" && k != kind {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("SELECT %s FROM %s WHERE deleted_at IS NOT NULL", trashColumns(k), trashTables[k].table))
+	}
+	if len(parts) == 0 {
+		return nil, 0, fmt.Errorf("storage: list trash: unknown kind %q", kind)
+	}
+	union := strings.Join(parts, " UNION ALL ")
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM (%s) t", union)).Scan(&total); err != nil {
+		return nil, 0, wrapDBError("count trash", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT kind, id, label, images, TO_CHAR(deleted_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+		FROM (%s) t
+		ORDER BY deleted_at DESC, kind, id DESC
+		OFFSET $1 LIMIT $2
+	`, union), offset, limit)
+	if err != nil {
+		return nil, 0, wrapDBError("list trash", err)
+	}
+	defer rows.Close()
+
+	out := make([]*models.TrashItem, 0)
+	for rows.Next() {
+		it, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, 0, wrapDBError("scan trash item", err)
+		}
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapDBError("list trash", err)
+	}
+	return out, total, nil
+}
+
+// RestoreFromTrash makes a trashed record live again. Restoring a confirmed
+// appointment fails with ErrSlotUnavailable if its day has filled up since.
+func (s *PostgresStore) RestoreFromTrash(ctx context.Context, kind TrashKind, id int64) error {
+	t, ok := trashTables[kind]
+	if !ok {
+		return fmt.Errorf("storage: restore: unknown kind %q", kind)
+	}
+	op := "restore " + string(kind)
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if kind == TrashAppointments {
+			var date, status string
+			err := tx.QueryRowContext(ctx, `
+				SELECT TO_CHAR(appointment_date, 'YYYY-MM-DD'), status
+				FROM appointments
+				WHERE id = $1 AND deleted_at IS NOT NULL
+			`, id).Scan(&date, &status)
+			if err != nil {
+				return wrapDBError(op, err)
+			}
+			if status == "confirmed" {
+				if err := reserveAppointmentDay(ctx, tx, date, id); err != nil {
+					return err
+				}
+			}
+		}
+		res, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`, t.table), id)
+		if err != nil {
+			return wrapDBError(op, err)
+		}
+		return checkAffected(op, res)
+	})
+}
+
+// PurgeFromTrash permanently deletes a trashed record and returns what was
+// removed. A service that bookings still reference cannot be purged.
+func (s *PostgresStore) PurgeFromTrash(ctx context.Context, kind TrashKind, id int64) (*models.TrashItem, error) {
+	t, ok := trashTables[kind]
+	if !ok {
+		return nil, fmt.Errorf("storage: purge: unknown kind %q", kind)
+	}
+	it, err := scanTrashItem(s.db.QueryRowContext(ctx, fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING '%s', id, %s, %s, TO_CHAR(deleted_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"')
+	`, t.table, kind, t.label, t.images), id))
+	if err != nil {
+		return nil, wrapDBError("purge "+string(kind), err)
+	}
+	return it, nil
+}
+
+func scanTrashItem(scanner interface {
+	Scan(dest ...any) error
+}) (*models.TrashItem, error) {
+	var imagesRaw []byte
+	it := &models.TrashItem{}
+	if err := scanner.Scan(&it.Type, &it.ID, &it.Label, &imagesRaw, &it.DeletedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(imagesRaw, &it.Images); err != nil {
+		it.Images = nil
+	}
+	it.Images = normalizeImagePaths(it.Images)
+	return it, nil
+}
+
+func scanMenuItem(scanner interface {
+	Scan(dest ...any) error
+}) (*models.MenuItem, error) {
+	var serviceID sql.NullInt64
+	var currency sql.NullString
+	it := &models.MenuItem{}
+	if err := scanner.Scan(&it.ID, &it.Category, &it.Name, &serviceID, &currency, &it.PriceCents, &it.DurationMinutes); err != nil {
+		return nil, err
+	}
+	it.Currency = currency.String
+	if serviceID.Valid {
+		it.ServiceItemID = &serviceID.Int64
+	}
+	return it, nil
+}
+
+func scanPortfolioItem(scanner interface {
+	Scan(dest ...any) error
+}) (*models.PortfolioItem, error) {
+	var imagesRaw, captionsRaw, pairsRaw, tagsRaw []byte
+	var serviceID sql.NullInt64
+	it := &models.PortfolioItem{}
+	if err := scanner.Scan(&it.ID, &it.Category, &it.Style, &imagesRaw, &it.Description,
+		&captionsRaw, &pairsRaw, &serviceID, &tagsRaw, &it.Featured, &it.SortOrder, &it.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(imagesRaw, &it.Images); err != nil {
+		it.Images = []string{}
+	}
+	it.Images = normalizeImagePaths(it.Images)
+	// The other JSONB columns are only ever written by this store.
+	_ = json.Unmarshal(captionsRaw, &it.Captions)
+	_ = json.Unmarshal(pairsRaw, &it.BeforeAfter)
+	_ = json.Unmarshal(tagsRaw, &it.Tags)
+	if serviceID.Valid {
+		it.ServiceItemID = &serviceID.Int64
+	}
+	return it, nil
+}
+
+// appointmentColumns selects the columns scanned by scanAppointment.
+const appointmentColumns = `id, customer_name, customer_email, customer_phone, staff_name,
+	TO_CHAR(appointment_date, 'YYYY-MM-DD'), TO_CHAR(appointment_time, 'HH24:MI'),
+	service_id, service_description, currency, price_cents, deposit_cents, notes, status,
+	cancelled_by, cancellation_reason, cancellation_fee_cents,
+	COALESCE(TO_CHAR(cancelled_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"'), ''),
+	COALESCE(voucher_id, 0), promo_code, discount_cents, points_redeemed`
+
 func scanAppointment(scanner interface {
 	Scan(dest ...any) error
 }) (*models.Appointment, error) {
@@ -701,8 +2304,17 @@ func scanAppointment(scanner interface {
 		&a.ServiceDescription,
 		&a.Currency,
 		&a.PriceCents,
+		&a.DepositCents,
 		&a.Notes,
 		&a.Status,
+		&a.CancelledBy,
+		&a.CancellationReason,
+		&a.CancellationFeeCents,
+		&a.CancelledAt,
+		&a.VoucherID,
+		&a.PromoCode,
+		&a.DiscountCents,
+		&a.PointsRedeemed,
 	); err != nil {
 		return nil, err
 	}
@@ -1,48 +1,407 @@
 package storage
 
 import (
-	"errors"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"lucys-beauty-parlour-backend/models"
 )
 
 // Store defines the methods required by handlers.
+//
+// Lookups of missing records return an error wrapping ErrNotFound, writes that
+// violate a constraint return one wrapping ErrConflict, and any other failure
+// is returned wrapped so handlers can tell client mistakes from server faults.
+//
+// CreateAppointment, and UpdateAppointment when it confirms a booking, fail
+// with ErrSlotUnavailable once the day holds the maximum number of confirmed
+// appointments. The capacity check and the write are atomic, so concurrent
+// bookings cannot overshoot the cap. CreateAppointment also redeems the
+// voucher in a.VoucherID, if any, in the same step, failing with
+// ErrVoucherUnavailable if it is inactive, expired or used up, and spends
+// a.PointsRedeemed of the customer's loyalty points, failing with
+// ErrInsufficientPoints if their balance is short.
+//
+// Delete methods move records to the trash: they disappear from every lookup
+// and list, and no longer count towards a day's capacity, until they are
+// restored or purged.
 type Store interface {
 	// Appointments
-	CreateAppointment(a *models.Appointment) *models.Appointment
-	GetAllAppointments() []*models.Appointment
-	GetAppointment(id int64) (*models.Appointment, error)
-	UpdateAppointment(id int64, upd *models.Appointment) (*models.Appointment, error)
-	DeleteAppointment(id int64) error
-	IsAppointmentSlotAvailable(date string) bool
-	CancelAppointment(id int64) (*models.Appointment, error)
-	GetAppointmentsWithPagination(offset, limit int) ([]*models.Appointment, int)
+	CreateAppointment(ctx context.Context, a *models.Appointment) (*models.Appointment, error)
+	GetAllAppointments(ctx context.Context) ([]*models.Appointment, error)
+	GetAppointment(ctx context.Context, id int64) (*models.Appointment, error)
+	// UpdateAppointment replaces an appointment's details. It gives
+	// ErrConflict for a change of status to cancelled or no_show, which only
+	// CancelAppointment makes, and for any change of status out of them.
+	UpdateAppointment(ctx context.Context, id int64, upd *models.Appointment) (*models.Appointment, error)
+	DeleteAppointment(ctx context.Context, id int64) error
+	IsAppointmentSlotAvailable(ctx context.Context, date string) (bool, error)
+	// CancelAppointment cancels a pending or confirmed appointment, or marks
+	// it a no-show, keeping c.FeeCents and recording refunds of up to
+	// c.RefundCents from its succeeded payments, newest first. Unless it is a
+	// no-show, the voucher use and loyalty points the booking redeemed are
+	// given back. Any other appointment gives ErrConflict, and payments that
+	// no longer add up to c.PaidCents give ErrPaymentsChanged.
+	CancelAppointment(ctx context.Context, id int64, c models.Cancellation) (*models.Appointment, []*models.Refund, error)
+	// GetAppointmentByCancelToken finds the appointment a customer's cancel
+	// link is for, by the hash stored when it was booked.
+	GetAppointmentByCancelToken(ctx context.Context, tokenHash string) (*models.Appointment, error)
+	// GetAppointmentsWithPagination lists a page of the appointments in f,
+	// ordered by sort, with how many there are in all. A limit <= 0 lists
+	// them all.
+	GetAppointmentsWithPagination(ctx context.Context, f AppointmentFilter, sort AppointmentSort, offset, limit int) ([]*models.Appointment, int, error)
+	// EachAppointment calls fn with the appointments in f by date and time,
+	// one at a time, stopping at the first error.
+	EachAppointment(ctx context.Context, f AppointmentFilter, fn func(*models.Appointment) error) error
 
 	// Services
-	CreateServiceItem(it *models.ServiceItem) *models.ServiceItem
-	UpdateServiceItem(id int64, upd *models.ServiceItem) (*models.ServiceItem, error)
-	DeleteServiceItem(id int64) error
-	GetServiceItem(id int64) (*models.ServiceItem, error)
-	ListServiceItems(category string, minRating float64, q string, offset, limit int) ([]*models.ServiceItem, int)
+	CreateServiceItem(ctx context.Context, it *models.ServiceItem) (*models.ServiceItem, error)
+	UpdateServiceItem(ctx context.Context, id int64, upd *models.ServiceItem) (*models.ServiceItem, error)
+	DeleteServiceItem(ctx context.Context, id int64) error
+	GetServiceItem(ctx context.Context, id int64) (*models.ServiceItem, error)
+	ListServiceItems(ctx context.Context, category string, minRating float64, q string, offset, limit int) ([]*models.ServiceItem, int, error)
+	// ImportServiceItems creates the items without an ID and updates those
+	// with one, all or none of them. It fails as CreateServiceItem and
+	// UpdateServiceItem would for the first item that can't be written.
+	ImportServiceItems(ctx context.Context, items []*models.ServiceItem) error
 
 	// Portfolio Items
-	CreatePortfolioItem(it *models.PortfolioItem) *models.PortfolioItem
-	UpdatePortfolioItem(id int64, upd *models.PortfolioItem) (*models.PortfolioItem, error)
-	DeletePortfolioItem(id int64) error
-	GetPortfolioItem(id int64) (*models.PortfolioItem, error)
-	ListPortfolioItems(category string, q string, offset, limit int) ([]*models.PortfolioItem, int)
+	CreatePortfolioItem(ctx context.Context, it *models.PortfolioItem) (*models.PortfolioItem, error)
+	UpdatePortfolioItem(ctx context.Context, id int64, upd *models.PortfolioItem) (*models.PortfolioItem, error)
+	DeletePortfolioItem(ctx context.Context, id int64) error
+	GetPortfolioItem(ctx context.Context, id int64) (*models.PortfolioItem, error)
+	ListPortfolioItems(ctx context.Context, f PortfolioFilter, offset, limit int) ([]*models.PortfolioItem, int, error)
+	// ReorderPortfolioItems sets the gallery position of each item to its
+	// place in ids; it changes nothing if any of them is missing.
+	ReorderPortfolioItems(ctx context.Context, ids []int64) error
 
 	// Menu Items
-	CreateMenuItem(it *models.MenuItem) *models.MenuItem
-	GetMenuItem(id int64) (*models.MenuItem, error)
-	UpdateMenuItem(id int64, upd *models.MenuItem) (*models.MenuItem, error)
-	DeleteMenuItem(id int64) error
-	ListMenuItems(category string, q string, offset, limit int) ([]*models.MenuItem, int)
+	CreateMenuItem(ctx context.Context, it *models.MenuItem) (*models.MenuItem, error)
+	GetMenuItem(ctx context.Context, id int64) (*models.MenuItem, error)
+	UpdateMenuItem(ctx context.Context, id int64, upd *models.MenuItem) (*models.MenuItem, error)
+	DeleteMenuItem(ctx context.Context, id int64) error
+	ListMenuItems(ctx context.Context, category string, q string, offset, limit int) ([]*models.MenuItem, int, error)
+	// ListServiceVariants returns the live menu items linked to a service,
+	// in the order they were created.
+	ListServiceVariants(ctx context.Context, serviceID int64) ([]*models.MenuItem, error)
+	// ImportMenuItems creates the items without an ID and updates those with
+	// one, all or none of them. It fails as CreateMenuItem and UpdateMenuItem
+	// would for the first item that can't be written.
+	ImportMenuItems(ctx context.Context, items []*models.MenuItem) error
+
+	// Categories
+	// ListCategories returns every category by sort order, then slug.
+	ListCategories(ctx context.Context) ([]*models.Category, error)
+	GetCategory(ctx context.Context, slug string) (*models.Category, error)
+	CreateCategory(ctx context.Context, cat *models.Category) (*models.Category, error)
+	// UpdateCategory may change the slug; items in the category follow it.
+	UpdateCategory(ctx context.Context, slug string, upd *models.Category) (*models.Category, error)
+	// DeleteCategory fails with ErrConflict while any item, trashed or
+	// not, is in the category.
+	DeleteCategory(ctx context.Context, slug string) error
+
+	// Reviews
+	// CreateReviewInvite stores the hash of a one-time review link for an
+	// appointment, replacing any unused link issued for it before. It fails
+	// with ErrConflict once the appointment has been reviewed.
+	CreateReviewInvite(ctx context.Context, appointmentID int64, tokenHash string, expiresAt time.Time) error
+	// GetReviewInvite looks up an unused, unexpired review link.
+	GetReviewInvite(ctx context.Context, tokenHash string) (*models.ReviewInvite, error)
+	// SubmitReview uses up a review link and stores the review as pending.
+	// A used, expired or unknown link gives ErrNotFound.
+	SubmitReview(ctx context.Context, tokenHash string, r *models.Review) (*models.Review, error)
+	ListReviews(ctx context.Context, f ReviewFilter, offset, limit int) ([]*models.Review, int, error)
+	// ModerateReview sets a review's status and recomputes the rating and
+	// review count of its service from the approved reviews.
+	ModerateReview(ctx context.Context, id int64, status string) (*models.Review, error)
+
+	// Payments
+	// CreatePayment records a payment requested from a provider. The
+	// appointment must exist and not be in the trash.
+	CreatePayment(ctx context.Context, p *models.Payment) (*models.Payment, error)
+	// ListPayments returns an appointment's payments, oldest first.
+	ListPayments(ctx context.Context, appointmentID int64) ([]*models.Payment, error)
+	GetPaymentByRef(ctx context.Context, provider, providerRef string) (*models.Payment, error)
+	// SettlePayment records the outcome of a pending payment. Once the
+	// succeeded payments of a pending appointment cover its deposit, the
+	// appointment is confirmed, unless its day is fully booked; confirmed
+	// reports whether that happened. A payment that succeeds after its
+	// appointment was cancelled or marked a no-show is refunded in full.
+	// Settling a payment again changes nothing, so providers may repeat
+	// webhooks.
+	SettlePayment(ctx context.Context, provider, providerRef, status, reason string) (p *models.Payment, confirmed bool, err error)
+
+	// Refunds
+	ListRefunds(ctx context.Context, f RefundFilter, offset, limit int) ([]*models.Refund, int, error)
+	// MarkRefundPaid records that a pending refund was paid out; a refund
+	// already paid gives ErrConflict.
+	MarkRefundPaid(ctx context.Context, id int64) (*models.Refund, error)
+
+	// Invoices
+	// IssueInvoice numbers and stores inv for its appointment, or returns
+	// the invoice already issued for the appointment unchanged. The
+	// appointment must exist and not be in the trash.
+	IssueInvoice(ctx context.Context, inv *models.Invoice) (*models.Invoice, error)
+
+	// Vouchers
+	// CreateVoucher fails with ErrConflict if the code is taken.
+	CreateVoucher(ctx context.Context, v *models.Voucher) (*models.Voucher, error)
+	GetVoucher(ctx context.Context, id int64) (*models.Voucher, error)
+	// GetVoucherByCode looks a voucher up by its upper-case code.
+	GetVoucherByCode(ctx context.Context, code string) (*models.Voucher, error)
+	// ListVouchers returns vouchers newest first.
+	ListVouchers(ctx context.Context, offset, limit int) ([]*models.Voucher, int, error)
+	// UpdateVoucher replaces a voucher's terms; its code and uses stay.
+	UpdateVoucher(ctx context.Context, id int64, upd *models.Voucher) (*models.Voucher, error)
+	// DeleteVoucher fails with ErrConflict once a booking has redeemed it.
+	DeleteVoucher(ctx context.Context, id int64) error
+
+	// Loyalty points, keyed by lower-case customer email
+	GetLoyaltySettings(ctx context.Context) (*models.LoyaltySettings, error)
+	UpdateLoyaltySettings(ctx context.Context, upd *models.LoyaltySettings) (*models.LoyaltySettings, error)
+	// EarnLoyaltyPoints credits the customer of an appointment with points.
+	// An appointment earns once: later calls return the first entry.
+	EarnLoyaltyPoints(ctx context.Context, appointmentID, points int64) (*models.LoyaltyEntry, error)
+	LoyaltyBalance(ctx context.Context, email string) (int64, error)
+	// ListLoyaltyEntries returns a customer's entries, newest first.
+	ListLoyaltyEntries(ctx context.Context, email string, offset, limit int) ([]*models.LoyaltyEntry, int, error)
+
+	// Reports
+	// ReportAppointments counts the appointments in f, and adds up their
+	// revenue, per group and currency. Days, weeks, months and hours are
+	// listed in order; services, categories and staff by revenue, then by
+	// bookings.
+	ReportAppointments(ctx context.Context, f ReportFilter, by ReportGrouping) ([]*models.ReportRow, error)
+	// EachCustomer calls fn with everyone who booked an appointment in f, by
+	// email, one at a time, stopping at the first error.
+	EachCustomer(ctx context.Context, f ReportFilter, fn func(*models.Customer) error) error
+
+	// Trash
+	ListTrash(ctx context.Context, kind TrashKind, offset, limit int) ([]*models.TrashItem, int, error)
+	RestoreFromTrash(ctx context.Context, kind TrashKind, id int64) error
+	PurgeFromTrash(ctx context.Context, kind TrashKind, id int64) (*models.TrashItem, error)
+}
+
+// AppointmentFilter narrows the appointments listed; zero fields match
+// everything.
+type AppointmentFilter struct {
+	Status string
+	// From and To bound the appointment date, inclusive, as YYYY-MM-DD.
+	From      string
+	To        string
+	ServiceID int64
+	// Category is the category slug of the appointment's service.
+	Category  string
+	StaffName string
+	// Query matches part of the customer's name, email or phone number.
+	// Phone numbers match on their digits alone, so "0755 897" finds
+	// "+256-755897061" as well as "0755897061".
+	Query string
+}
+
+// matches reports whether a passes f, apart from f.Category, which needs
+// the appointment's service.
+func (f AppointmentFilter) matches(a *models.Appointment) bool {
+	switch {
+	case f.Status != "" && a.Status != f.Status,
+		f.From != "" && a.Date < f.From,
+		f.To != "" && a.Date > f.To,
+		f.ServiceID != 0 && a.ServiceID != f.ServiceID,
+		f.StaffName != "" && !strings.EqualFold(a.StaffName, f.StaffName):
+		return false
+	}
+	q := strings.TrimSpace(f.Query)
+	if q == "" || containsFold(a.CustomerName, q) || containsFold(a.CustomerEmail, q) || containsFold(a.CustomerPhone, q) {
+		return true
+	}
+	digits := phoneDigits(q)
+	return digits != "" && strings.Contains(phoneDigits(a.CustomerPhone), digits)
+}
+
+// phoneDigits returns the digits of a phone number written with spaces,
+// dashes, dots, brackets or a leading "+", or "" for anything else.
+func phoneDigits(s string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune(" +-.()", r):
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// AppointmentSort orders a list of appointments. A leading "-" means
+// descending.
+type AppointmentSort string
+
+const (
+	// AppointmentsNewest lists the most recently booked first; it is the
+	// default.
+	AppointmentsNewest AppointmentSort = "-created"
+	AppointmentsOldest AppointmentSort = "created"
+	// AppointmentsByDate lists by appointment date and time, soonest first.
+	AppointmentsByDate     AppointmentSort = "date"
+	AppointmentsByDateDesc AppointmentSort = "-date"
+	// AppointmentsByCustomer lists by customer name, A to Z.
+	AppointmentsByCustomer  AppointmentSort = "customer"
+	AppointmentsByPrice     AppointmentSort = "price"
+	AppointmentsByPriceDesc AppointmentSort = "-price"
+)
+
+// AppointmentSorts lists every AppointmentSort.
+var AppointmentSorts = []AppointmentSort{
+	AppointmentsNewest, AppointmentsOldest, AppointmentsByDate, AppointmentsByDateDesc,
+	AppointmentsByCustomer, AppointmentsByPrice, AppointmentsByPriceDesc,
+}
+
+// compare orders a before b (-1) or after it (1) under o; ties fall back to
+// the order they were booked in, in o's direction.
+func (o AppointmentSort) compare(a, b *models.Appointment) int {
+	desc := strings.HasPrefix(string(o), "-")
+	var c int
+	switch strings.TrimPrefix(string(o), "-") {
+	case "date":
+		c = cmp.Or(cmp.Compare(a.Date, b.Date), cmp.Compare(a.Time, b.Time))
+	case "customer":
+		c = cmp.Compare(strings.ToLower(a.CustomerName), strings.ToLower(b.CustomerName))
+	case "price":
+		c = cmp.Compare(a.PriceCents, b.PriceCents)
+	default:
+		desc = o != AppointmentsOldest
+	}
+	c = cmp.Or(c, cmp.Compare(a.ID, b.ID))
+	if desc {
+		return -c
+	}
+	return c
+}
+
+// PortfolioFilter narrows ListPortfolioItems; zero fields match everything.
+// Items are listed featured first, then by SortOrder, then newest first.
+type PortfolioFilter struct {
+	Category      string
+	Query         string // matched against style and description
+	Tag           string
+	ServiceItemID int64
+	FeaturedOnly  bool
+}
+
+// ReviewFilter narrows ListReviews; zero fields match everything. Reviews
+// are listed newest first.
+type ReviewFilter struct {
+	ServiceID int64
+	Status    string
+}
+
+// RefundFilter narrows ListRefunds; zero fields match everything. Refunds
+// are listed newest first.
+type RefundFilter struct {
+	AppointmentID int64
+	Status        string
+}
+
+// ReportGrouping is how ReportAppointments groups appointments.
+type ReportGrouping string
+
+const (
+	// ReportTotal puts every appointment in one group per currency.
+	ReportTotal   ReportGrouping = "total"
+	ReportByDay   ReportGrouping = "day"
+	ReportByWeek  ReportGrouping = "week" // starting on Monday
+	ReportByMonth ReportGrouping = "month"
+	// ReportByService groups by service ID, ReportByCategory by the
+	// service's category slug.
+	ReportByService  ReportGrouping = "service"
+	ReportByCategory ReportGrouping = "category"
+	ReportByStaff    ReportGrouping = "staff"
+	// ReportByHour groups by the hour of the day appointments start.
+	ReportByHour ReportGrouping = "hour"
+)
+
+// chronological reports whether groups are listed by key rather than by
+// revenue.
+func (g ReportGrouping) chronological() bool {
+	switch g {
+	case ReportTotal, ReportByDay, ReportByWeek, ReportByMonth, ReportByHour:
+		return true
+	}
+	return false
+}
+
+// ReportFilter narrows ReportAppointments to appointments dated From to To,
+// inclusive, as YYYY-MM-DD. An empty bound is open.
+type ReportFilter struct {
+	From string
+	To   string
+}
+
+// loyaltyEmail is the key a customer's loyalty points are kept under.
+func loyaltyEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// invoiceNumber formats the number of the invoice with id, e.g. INV-000042.
+func invoiceNumber(id int64) string {
+	return fmt.Sprintf("INV-%06d", id)
+}
+
+// defaultCategories are the categories the migrations create.
+var defaultCategories = []models.Category{
+	{Slug: "hair", Name: "Hair", SortOrder: 1},
+	{Slug: "makeup", Name: "Makeup", SortOrder: 2},
+	{Slug: "nails", Name: "Nails", SortOrder: 3},
+}
+
+// reviewRatingScale rounds computed ratings to one decimal place.
+const reviewRatingScale = 10
+
+// TrashKind names a type of soft-deletable record, matching its admin route.
+type TrashKind string
+
+const (
+	TrashAppointments TrashKind = "appointments"
+	TrashServices     TrashKind = "services"
+	TrashPortfolio    TrashKind = "portfolio"
+	TrashMenuItems    TrashKind = "menu-items"
+)
+
+// TrashKinds lists every kind in the order the trash groups them.
+var TrashKinds = []TrashKind{TrashAppointments, TrashServices, TrashPortfolio, TrashMenuItems}
+
+// Valid reports whether k is one of the known trash kinds.
+func (k TrashKind) Valid() bool {
+	for _, v := range TrashKinds {
+		if k == v {
+			return true
+		}
+	}
+	return false
 }
 
+var (
+	_ Store = (*InMemoryStore)(nil)
+	_ Store = (*PostgresStore)(nil)
+)
+
+// maxConfirmedAppointmentsPerDay caps how many confirmed bookings a single day can hold.
+const maxConfirmedAppointmentsPerDay = 15
+
+// InMemoryStore is a Store kept entirely in process memory. It mirrors the
+// filtering, ordering and error behaviour of PostgresStore so that handlers
+// can be exercised without a database; the contract tests hold both to it.
+// Records are copied on the way in and out, like rows read from Postgres.
 type InMemoryStore struct {
 	mu    sync.RWMutex
 	appts map[int64]*models.Appointment
@@ -50,9 +409,37 @@ type InMemoryStore struct {
 	// Services blog
 	services    map[int64]*models.ServiceItem
 	nextService int64
+	// Portfolio items
+	portfolio     map[int64]*models.PortfolioItem
+	nextPortfolio int64
 	// Menu items
 	menuItems    map[int64]*models.MenuItem
 	nextMenuItem int64
+	// Categories by slug
+	categories map[string]*models.Category
+	// Reviews, and the one-time links that create them keyed by token hash
+	reviews       map[int64]*models.Review
+	nextReview    int64
+	reviewInvites map[string]*reviewInvite
+	// Payments towards appointments
+	payments    map[int64]*models.Payment
+	nextPayment int64
+	// Refunds, and appointment IDs by the hash of their cancel link
+	refunds      map[int64]*models.Refund
+	nextRefund   int64
+	cancelTokens map[string]int64
+	// Invoices
+	invoices    map[int64]*models.Invoice
+	nextInvoice int64
+	// Vouchers
+	vouchers    map[int64]*models.Voucher
+	nextVoucher int64
+	// Loyalty settings and points
+	loyalty          models.LoyaltySettings
+	loyaltyEntries   map[int64]*models.LoyaltyEntry
+	nextLoyaltyEntry int64
+	// Soft-deleted IDs per kind, with the time they were deleted
+	deleted map[TrashKind]map[int64]time.Time
 }
 
 type RefreshStore struct {
@@ -85,62 +472,330 @@ func (s *RefreshStore) Delete(token string) {
 }
 
 func NewInMemoryStore() *InMemoryStore {
-	return &InMemoryStore{
-		appts:        make(map[int64]*models.Appointment),
-		next:         1,
-		services:     make(map[int64]*models.ServiceItem),
-		nextService:  1,
-		menuItems:    make(map[int64]*models.MenuItem),
-		nextMenuItem: 1,
+	s := &InMemoryStore{
+		appts:         make(map[int64]*models.Appointment),
+		next:          1,
+		services:      make(map[int64]*models.ServiceItem),
+		nextService:   1,
+		portfolio:     make(map[int64]*models.PortfolioItem),
+		nextPortfolio: 1,
+		menuItems:     make(map[int64]*models.MenuItem),
+		nextMenuItem:  1,
+		reviews:       make(map[int64]*models.Review),
+		nextReview:    1,
+		reviewInvites: make(map[string]*reviewInvite),
+		payments:      make(map[int64]*models.Payment),
+		nextPayment:   1,
+		refunds:       make(map[int64]*models.Refund),
+		nextRefund:    1,
+		cancelTokens:  make(map[string]int64),
+		invoices:      make(map[int64]*models.Invoice),
+		nextInvoice:   1,
+		vouchers:      make(map[int64]*models.Voucher),
+		nextVoucher:   1,
+		// Like the migration, earning and redeeming start off.
+		loyalty:          models.LoyaltySettings{Currency: "UGX"},
+		loyaltyEntries:   make(map[int64]*models.LoyaltyEntry),
+		nextLoyaltyEntry: 1,
+		deleted: map[TrashKind]map[int64]time.Time{
+			TrashAppointments: {},
+			TrashServices:     {},
+			TrashPortfolio:    {},
+			TrashMenuItems:    {},
+		},
+		categories: make(map[string]*models.Category),
+	}
+	for _, cat := range defaultCategories {
+		s.categories[cat.Slug] = &cat
+	}
+	return s
+}
+
+func notFound(op string) error {
+	return fmt.Errorf("storage: %s: %w", op, ErrNotFound)
+}
+
+func conflict(op, reason string) error {
+	return fmt.Errorf("storage: %s: %w: %s", op, ErrConflict, reason)
+}
+
+// isCancelledStatus reports whether status is one CancelAppointment sets.
+func isCancelledStatus(status string) bool {
+	return status == "cancelled" || status == "no_show"
+}
+
+// checkStatusChange refuses an update from status current to next that
+// cancels an appointment or reopens a cancelled one. Cancelling goes through
+// CancelAppointment; reopening would keep the refund, the voucher use and the
+// points it gave back.
+func checkStatusChange(current, next string) error {
+	switch {
+	case current == next:
+		return nil
+	case isCancelledStatus(current):
+		return conflict("update appointment", "a cancelled appointment cannot be reopened")
+	case isCancelledStatus(next):
+		return conflict("update appointment", "use CancelAppointment to cancel an appointment")
+	}
+	return nil
+}
+
+// page applies the public list defaults (10 per page, at most 100) and
+// returns the bounds of the requested page within total items.
+func page(total, offset, limit int) (start, end int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	start = offset
+	end = offset + limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+func containsFold(s, q string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(q))
+}
+
+func cloneAppointment(a *models.Appointment) *models.Appointment {
+	cp := *a
+	return &cp
+}
+
+func cloneServiceItem(it *models.ServiceItem) *models.ServiceItem {
+	cp := *it
+	cp.Descriptions = append([]string(nil), it.Descriptions...)
+	return &cp
+}
+
+func clonePortfolioItem(it *models.PortfolioItem) *models.PortfolioItem {
+	cp := *it
+	cp.Images = normalizeImagePaths(append([]string(nil), it.Images...))
+	cp.Captions = append([]string(nil), it.Captions...)
+	cp.BeforeAfter = append([]models.ImagePair(nil), it.BeforeAfter...)
+	cp.Tags = append([]string(nil), it.Tags...)
+	if it.ServiceItemID != nil {
+		id := *it.ServiceItemID
+		cp.ServiceItemID = &id
+	}
+	return &cp
+}
+
+func cloneReview(r *models.Review) *models.Review {
+	cp := *r
+	if r.AppointmentID != nil {
+		id := *r.AppointmentID
+		cp.AppointmentID = &id
+	}
+	return &cp
+}
+
+// checkCategory mirrors the foreign keys from items to categories. Callers
+// hold s.mu.
+func (s *InMemoryStore) checkCategory(op, slug string) error {
+	if _, ok := s.categories[slug]; !ok {
+		return conflict(op, "unknown category")
+	}
+	return nil
+}
+
+func cloneMenuItem(it *models.MenuItem) *models.MenuItem {
+	cp := *it
+	if it.ServiceItemID != nil {
+		id := *it.ServiceItemID
+		cp.ServiceItemID = &id
 	}
+	return &cp
 }
 
-func (s *InMemoryStore) CreateAppointment(a *models.Appointment) *models.Appointment {
+// isDeleted reports whether the record is in the trash. Callers hold s.mu.
+func (s *InMemoryStore) isDeleted(kind TrashKind, id int64) bool {
+	_, ok := s.deleted[kind][id]
+	return ok
+}
+
+// trash soft-deletes a live record. Callers hold s.mu for writing.
+func (s *InMemoryStore) trash(kind TrashKind, id int64, exists bool) bool {
+	if !exists || s.isDeleted(kind, id) {
+		return false
+	}
+	s.deleted[kind][id] = time.Now().UTC()
+	return true
+}
+
+func (s *InMemoryStore) CreateAppointment(ctx context.Context, a *models.Appointment) (*models.Appointment, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if _, ok := s.services[a.ServiceID]; !ok {
+		return nil, conflict("create appointment", "service does not exist")
+	}
+	if err := s.reserveAppointmentDay(a.Date, 0); err != nil {
+		return nil, err
+	}
+	if a.CancelTokenHash != "" {
+		if _, ok := s.cancelTokens[a.CancelTokenHash]; ok {
+			return nil, conflict("create appointment", "duplicate cancel token")
+		}
+	}
+	if a.PointsRedeemed > 0 && s.loyaltyBalance(loyaltyEmail(a.CustomerEmail)) < a.PointsRedeemed {
+		return nil, fmt.Errorf("storage: redeem %d points: %w", a.PointsRedeemed, ErrInsufficientPoints)
+	}
+	if a.VoucherID != 0 {
+		v, ok := s.vouchers[a.VoucherID]
+		if !ok {
+			return nil, conflict("create appointment", "voucher does not exist")
+		}
+		if !voucherRedeemable(v, time.Now()) {
+			return nil, fmt.Errorf("storage: redeem voucher %d: %w", v.ID, ErrVoucherUnavailable)
+		}
+		v.Uses++
+	}
 	a.ID = s.next
 	s.next++
-	s.appts[a.ID] = a
-	return a
+	stored := cloneAppointment(a)
+	if a.CancelTokenHash != "" {
+		s.cancelTokens[a.CancelTokenHash] = a.ID
+		stored.CancelTokenHash = ""
+	}
+	s.appts[a.ID] = stored
+	if a.PointsRedeemed > 0 {
+		s.addLoyaltyEntry(loyaltyEmail(a.CustomerEmail), a.ID, "redeemed", -a.PointsRedeemed)
+	}
+	return a, nil
 }
 
-func (s *InMemoryStore) GetAllAppointments() []*models.Appointment {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// sortedAppointments returns copies of all appointments, newest first. Callers hold s.mu.
+func (s *InMemoryStore) sortedAppointments() []*models.Appointment {
 	out := make([]*models.Appointment, 0, len(s.appts))
 	for _, v := range s.appts {
-		out = append(out, v)
+		if s.isDeleted(TrashAppointments, v.ID) {
+			continue
+		}
+		out = append(out, cloneAppointment(v))
 	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID > out[j].ID
+	})
 	return out
 }
 
-func (s *InMemoryStore) GetAppointment(id int64) (*models.Appointment, error) {
+// appointmentMatches reports whether a passes f. Callers hold s.mu.
+func (s *InMemoryStore) appointmentMatches(f AppointmentFilter, a *models.Appointment) bool {
+	if !f.matches(a) {
+		return false
+	}
+	if f.Category == "" {
+		return true
+	}
+	svc, ok := s.services[a.ServiceID]
+	return ok && svc.Service == f.Category
+}
+
+func (s *InMemoryStore) EachAppointment(ctx context.Context, f AppointmentFilter, fn func(*models.Appointment) error) error {
+	s.mu.RLock()
+	list := make([]*models.Appointment, 0)
+	for _, a := range s.sortedAppointments() {
+		if s.appointmentMatches(f, a) {
+			list = append(list, a)
+		}
+	}
+	s.mu.RUnlock()
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Date != list[j].Date {
+			return list[i].Date < list[j].Date
+		}
+		if list[i].Time != list[j].Time {
+			return list[i].Time < list[j].Time
+		}
+		return list[i].ID < list[j].ID
+	})
+	// Like rows read from a cursor, fn runs without the lock held.
+	for _, a := range list {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) GetAllAppointments(ctx context.Context) ([]*models.Appointment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedAppointments(), nil
+}
+
+func (s *InMemoryStore) GetAppointment(ctx context.Context, id int64) (*models.Appointment, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if a, ok := s.appts[id]; ok {
-		return a, nil
+	if a, ok := s.appts[id]; ok && !s.isDeleted(TrashAppointments, id) {
+		return cloneAppointment(a), nil
 	}
-	return nil, errors.New("not found")
+	return nil, notFound("get appointment")
 }
 
-func (s *InMemoryStore) UpdateAppointment(id int64, upd *models.Appointment) (*models.Appointment, error) {
+func (s *InMemoryStore) UpdateAppointment(ctx context.Context, id int64, upd *models.Appointment) (*models.Appointment, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.appts[id]; !ok {
-		return nil, errors.New("not found")
+	curr, ok := s.appts[id]
+	if !ok || s.isDeleted(TrashAppointments, id) {
+		return nil, notFound("update appointment")
+	}
+	if _, ok := s.services[upd.ServiceID]; !ok {
+		return nil, conflict("update appointment", "service does not exist")
+	}
+	if upd.Status == "confirmed" {
+		if err := s.reserveAppointmentDay(upd.Date, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkStatusChange(curr.Status, upd.Status); err != nil {
+		return nil, err
 	}
 	upd.ID = id
-	s.appts[id] = upd
+	stored := cloneAppointment(upd)
+	// Like the Postgres update, leave how it was cancelled alone.
+	stored.CancelledBy, stored.CancellationReason = curr.CancelledBy, curr.CancellationReason
+	stored.CancellationFeeCents, stored.CancelledAt = curr.CancellationFeeCents, curr.CancelledAt
+	stored.VoucherID, stored.PromoCode, stored.DiscountCents = curr.VoucherID, curr.PromoCode, curr.DiscountCents
+	stored.PointsRedeemed = curr.PointsRedeemed
+	stored.CancelTokenHash = ""
+	s.appts[id] = stored
 	return upd, nil
 }
 
-func (s *InMemoryStore) DeleteAppointment(id int64) error {
+func (s *InMemoryStore) DeleteAppointment(ctx context.Context, id int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.appts[id]; !ok {
-		return errors.New("not found")
+	_, ok := s.appts[id]
+	if !s.trash(TrashAppointments, id, ok) {
+		return notFound("delete appointment")
+	}
+	return nil
+}
+
+// reserveAppointmentDay reports ErrSlotUnavailable if date is fully booked,
+// ignoring excludeID. Callers hold s.mu for writing, which makes the check
+// and the following write atomic.
+func (s *InMemoryStore) reserveAppointmentDay(date string, excludeID int64) error {
+	confirmed := 0
+	for _, a := range s.appts {
+		if a.ID != excludeID && a.Date == date && a.Status == "confirmed" && !s.isDeleted(TrashAppointments, a.ID) {
+			confirmed++
+		}
+	}
+	if confirmed >= maxConfirmedAppointmentsPerDay {
+		return fmt.Errorf("storage: reserve %s: %w", date, ErrSlotUnavailable)
 	}
-	delete(s.appts, id)
 	return nil
 }
 
@@ -149,35 +804,131 @@ func (s *InMemoryStore) CountAppointmentsByDateAndStatus(date string, status str
 	defer s.mu.RUnlock()
 	count := 0
 	for _, a := range s.appts {
-		if a.Date == date && a.Status == status {
+		if a.Date == date && a.Status == status && !s.isDeleted(TrashAppointments, a.ID) {
 			count++
 		}
 	}
 	return count
 }
 
-func (s *InMemoryStore) IsAppointmentSlotAvailable(date string) bool {
+func (s *InMemoryStore) IsAppointmentSlotAvailable(ctx context.Context, date string) (bool, error) {
 	confirmedCount := s.CountAppointmentsByDateAndStatus(date, "confirmed")
-	return confirmedCount < 15
+	return confirmedCount < maxConfirmedAppointmentsPerDay, nil
 }
 
-func (s *InMemoryStore) CancelAppointment(id int64) (*models.Appointment, error) {
+func (s *InMemoryStore) CancelAppointment(ctx context.Context, id int64, c models.Cancellation) (*models.Appointment, []*models.Refund, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if a, ok := s.appts[id]; ok {
-		a.Status = "cancelled"
-		return a, nil
+	a, ok := s.appts[id]
+	if !ok || s.isDeleted(TrashAppointments, id) {
+		return nil, nil, notFound("cancel appointment")
+	}
+	if a.Status != "pending" && a.Status != "confirmed" {
+		return nil, nil, conflict("cancel appointment", "appointment is "+a.Status)
+	}
+	if paid := s.paidCents(id); paid != c.PaidCents {
+		return nil, nil, fmt.Errorf("storage: cancel appointment: %d paid, not %d: %w", paid, c.PaidCents, ErrPaymentsChanged)
+	}
+	a.Status = "cancelled"
+	if c.NoShow {
+		a.Status = "no_show"
+	}
+	a.CancelledBy, a.CancellationReason, a.CancellationFeeCents = c.By, c.Reason, c.FeeCents
+	now := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	a.CancelledAt = now
+	if v, ok := s.vouchers[a.VoucherID]; ok && v.Uses > 0 && !c.NoShow {
+		v.Uses--
+	}
+	if a.PointsRedeemed > 0 && !c.NoShow {
+		s.addLoyaltyEntry(loyaltyEmail(a.CustomerEmail), id, "refunded", a.PointsRedeemed)
+	}
+
+	paid := make([]*models.Payment, 0)
+	for _, p := range s.payments {
+		if p.AppointmentID == id && p.Status == "succeeded" {
+			paid = append(paid, p)
+		}
+	}
+	sort.Slice(paid, func(i, j int) bool { return paid[i].ID > paid[j].ID })
+	refunds := make([]*models.Refund, 0)
+	remaining := c.RefundCents
+	for _, p := range paid {
+		if remaining <= 0 {
+			break
+		}
+		refundable := p.AmountCents
+		for _, r := range s.refunds {
+			if r.PaymentID == p.ID {
+				refundable -= r.AmountCents
+			}
+		}
+		amount := min(remaining, refundable)
+		if amount <= 0 {
+			continue
+		}
+		refunds = append(refunds, s.addRefund(id, p, amount))
+		remaining -= amount
+	}
+	return cloneAppointment(a), refunds, nil
+}
+
+// paidCents is what the appointment's succeeded payments add up to, less
+// its refunds. The caller holds s.mu.
+func (s *InMemoryStore) paidCents(appointmentID int64) int64 {
+	var paid int64
+	for _, p := range s.payments {
+		if p.AppointmentID == appointmentID && p.Status == "succeeded" {
+			paid += p.AmountCents
+		}
+	}
+	for _, r := range s.refunds {
+		if r.AppointmentID == appointmentID {
+			paid -= r.AmountCents
+		}
+	}
+	return paid
+}
+
+// addRefund records a pending refund of amount from payment p. The caller
+// holds s.mu.
+func (s *InMemoryStore) addRefund(appointmentID int64, p *models.Payment, amount int64) *models.Refund {
+	r := &models.Refund{
+		ID:            s.nextRefund,
+		AppointmentID: appointmentID,
+		PaymentID:     p.ID,
+		AmountCents:   amount,
+		Currency:      p.Currency,
+		Status:        "pending",
+		CreatedAt:     time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	s.nextRefund++
+	s.refunds[r.ID] = r
+	return cloneRefund(r)
+}
+
+func (s *InMemoryStore) GetAppointmentByCancelToken(ctx context.Context, tokenHash string) (*models.Appointment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.cancelTokens[tokenHash]
+	if a, found := s.appts[id]; ok && found && !s.isDeleted(TrashAppointments, id) {
+		return cloneAppointment(a), nil
 	}
-	return nil, errors.New("not found")
+	return nil, notFound("get appointment by cancel token")
 }
 
 // GetAppointmentsWithPagination returns paginated appointments with total count
-func (s *InMemoryStore) GetAppointmentsWithPagination(offset, limit int) ([]*models.Appointment, int) {
+func (s *InMemoryStore) GetAppointmentsWithPagination(ctx context.Context, f AppointmentFilter, order AppointmentSort, offset, limit int) ([]*models.Appointment, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// Get total count
-	totalCount := len(s.appts)
+	all := make([]*models.Appointment, 0)
+	for _, a := range s.sortedAppointments() {
+		if s.appointmentMatches(f, a) {
+			all = append(all, a)
+		}
+	}
+	slices.SortStableFunc(all, order.compare)
+	totalCount := len(all)
 
 	// Validate pagination parameters
 	if offset < 0 {
@@ -188,18 +939,6 @@ func (s *InMemoryStore) GetAppointmentsWithPagination(offset, limit int) ([]*mod
 		limit = totalCount
 	}
 
-	// Collect all appointments
-	all := make([]*models.Appointment, 0, len(s.appts))
-	for _, v := range s.appts {
-		all = append(all, v)
-	}
-
-	// Sort by ID descending so results are deterministic (newest first)
-	sort.Slice(all, func(i, j int) bool {
-		return all[i].ID > all[j].ID
-	})
-
-	// Calculate end index
 	start := offset
 	end := offset + limit
 	if start > len(all) {
@@ -208,16 +947,26 @@ func (s *InMemoryStore) GetAppointmentsWithPagination(offset, limit int) ([]*mod
 	if end > len(all) {
 		end = len(all)
 	}
-
-	// Return paginated slice
-	return all[start:end], totalCount
+	return all[start:end], totalCount, nil
 }
 
 // --- Services (Blog) Operations ---
 
-func (s *InMemoryStore) CreateServiceItem(it *models.ServiceItem) *models.ServiceItem {
+func (s *InMemoryStore) CreateServiceItem(ctx context.Context, it *models.ServiceItem) (*models.ServiceItem, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if err := s.createServiceItem(it); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// createServiceItem stores it, giving it the next ID if it has none.
+// Callers hold s.mu.
+func (s *InMemoryStore) createServiceItem(it *models.ServiceItem) error {
+	if err := s.checkCategory("create service item", it.Service); err != nil {
+		return err
+	}
 	if it.ID == 0 {
 		it.ID = s.nextService
 		s.nextService++
@@ -227,48 +976,90 @@ func (s *InMemoryStore) CreateServiceItem(it *models.ServiceItem) *models.Servic
 			s.nextService = it.ID + 1
 		}
 	}
-	s.services[it.ID] = it
-	return it
+	// Ratings come from reviews; re-seeding an existing service keeps its own.
+	it.Rating, it.ReviewCount = 0, 0
+	if curr, ok := s.services[it.ID]; ok {
+		it.Rating, it.ReviewCount = curr.Rating, curr.ReviewCount
+	}
+	s.services[it.ID] = cloneServiceItem(it)
+	return nil
 }
 
-func (s *InMemoryStore) UpdateServiceItem(id int64, upd *models.ServiceItem) (*models.ServiceItem, error) {
+func (s *InMemoryStore) UpdateServiceItem(ctx context.Context, id int64, upd *models.ServiceItem) (*models.ServiceItem, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.services[id]; !ok {
-		return nil, errors.New("not found")
+	if err := s.updateServiceItem(id, upd); err != nil {
+		return nil, err
 	}
-	upd.ID = id
-	s.services[id] = upd
 	return upd, nil
 }
 
-func (s *InMemoryStore) DeleteServiceItem(id int64) error {
+// updateServiceItem replaces the live service id with upd. Callers hold s.mu.
+func (s *InMemoryStore) updateServiceItem(id int64, upd *models.ServiceItem) error {
+	curr, ok := s.services[id]
+	if !ok || s.isDeleted(TrashServices, id) {
+		return notFound("update service item")
+	}
+	if err := s.checkCategory("update service item", upd.Service); err != nil {
+		return err
+	}
+	upd.ID = id
+	upd.Rating, upd.ReviewCount = curr.Rating, curr.ReviewCount
+	s.services[id] = cloneServiceItem(upd)
+	return nil
+}
+
+func (s *InMemoryStore) ImportServiceItems(ctx context.Context, items []*models.ServiceItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Stored items are replaced rather than changed, so a shallow copy is
+	// enough to roll back to.
+	saved, next := maps.Clone(s.services), s.nextService
+	for _, it := range items {
+		var err error
+		if it.ID == 0 {
+			err = s.createServiceItem(it)
+		} else {
+			err = s.updateServiceItem(it.ID, it)
+		}
+		if err != nil {
+			s.services, s.nextService = saved, next
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) DeleteServiceItem(ctx context.Context, id int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.services[id]; !ok {
-		return errors.New("not found")
+	_, ok := s.services[id]
+	if !s.trash(TrashServices, id, ok) {
+		return notFound("delete service item")
 	}
-	delete(s.services, id)
 	return nil
 }
 
-func (s *InMemoryStore) GetServiceItem(id int64) (*models.ServiceItem, error) {
+func (s *InMemoryStore) GetServiceItem(ctx context.Context, id int64) (*models.ServiceItem, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if v, ok := s.services[id]; ok {
-		return v, nil
+	if v, ok := s.services[id]; ok && !s.isDeleted(TrashServices, id) {
+		return cloneServiceItem(v), nil
 	}
-	return nil, errors.New("not found")
+	return nil, notFound("get service item")
 }
 
 // ListServiceItems returns filtered + paginated items and total count
-func (s *InMemoryStore) ListServiceItems(category string, minRating float64, q string, offset, limit int) ([]*models.ServiceItem, int) {
+func (s *InMemoryStore) ListServiceItems(ctx context.Context, category string, minRating float64, q string, offset, limit int) ([]*models.ServiceItem, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// collect filtered
+	q = strings.TrimSpace(q)
 	filtered := make([]*models.ServiceItem, 0, len(s.services))
 	for _, v := range s.services {
+		if s.isDeleted(TrashServices, v.ID) {
+			continue
+		}
 		if category != "" && v.Service != category {
 			continue
 		}
@@ -280,124 +1071,1206 @@ func (s *InMemoryStore) ListServiceItems(category string, minRating float64, q s
 				continue
 			}
 		}
-		filtered = append(filtered, v)
+		filtered = append(filtered, cloneServiceItem(v))
 	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].ID < filtered[j].ID
+	})
 
 	total := len(filtered)
-	if offset < 0 {
-		offset = 0
-	}
-	if limit <= 0 {
-		limit = 10
-	}
-	if limit > 100 {
-		limit = 100
-	}
-	start := offset
-	end := offset + limit
-	if start > total {
-		start = total
-	}
-	if end > total {
-		end = total
-	}
-	return filtered[start:end], total
+	start, end := page(total, offset, limit)
+	return filtered[start:end], total, nil
 }
 
 func matchesQuery(v *models.ServiceItem, q string) bool {
-	ql := strings.ToLower(q)
-	if strings.Contains(strings.ToLower(v.Name), ql) {
+	if containsFold(v.Name, q) {
 		return true
 	}
 	for _, d := range v.Descriptions {
-		if strings.Contains(strings.ToLower(d), ql) {
+		if containsFold(d, q) {
 			return true
 		}
 	}
 	return false
 }
 
-// --- Menu Items Operations ---
+// --- Portfolio Operations ---
+
+// checkPortfolioService mirrors the foreign key from portfolio items to
+// services. Callers hold s.mu.
+func (s *InMemoryStore) checkPortfolioService(op string, it *models.PortfolioItem) error {
+	if it.ServiceItemID == nil {
+		return nil
+	}
+	if _, ok := s.services[*it.ServiceItemID]; !ok {
+		return conflict(op, "unknown service item")
+	}
+	return nil
+}
 
-func (s *InMemoryStore) CreateMenuItem(it *models.MenuItem) *models.MenuItem {
+func (s *InMemoryStore) CreatePortfolioItem(ctx context.Context, it *models.PortfolioItem) (*models.PortfolioItem, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if it.ID == 0 {
-		it.ID = s.nextMenuItem
-		s.nextMenuItem++
-	} else {
-		if it.ID >= s.nextMenuItem {
-			s.nextMenuItem = it.ID + 1
-		}
+	if err := s.checkCategory("create portfolio item", it.Category); err != nil {
+		return nil, err
 	}
-	s.menuItems[it.ID] = it
-	return it
+	if err := s.checkPortfolioService("create portfolio item", it); err != nil {
+		return nil, err
+	}
+	it.ID = s.nextPortfolio
+	s.nextPortfolio++
+	it.SortOrder = 0
+	it.CreatedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	s.portfolio[it.ID] = clonePortfolioItem(it)
+	return it, nil
 }
 
-func (s *InMemoryStore) GetMenuItem(id int64) (*models.MenuItem, error) {
+func (s *InMemoryStore) UpdatePortfolioItem(ctx context.Context, id int64, upd *models.PortfolioItem) (*models.PortfolioItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	curr, ok := s.portfolio[id]
+	if !ok || s.isDeleted(TrashPortfolio, id) {
+		return nil, notFound("update portfolio item")
+	}
+	if err := s.checkCategory("update portfolio item", upd.Category); err != nil {
+		return nil, err
+	}
+	if err := s.checkPortfolioService("update portfolio item", upd); err != nil {
+		return nil, err
+	}
+	upd.ID = id
+	upd.SortOrder = curr.SortOrder
+	upd.CreatedAt = curr.CreatedAt
+	s.portfolio[id] = clonePortfolioItem(upd)
+	return upd, nil
+}
+
+func (s *InMemoryStore) DeletePortfolioItem(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.portfolio[id]
+	if !s.trash(TrashPortfolio, id, ok) {
+		return notFound("delete portfolio item")
+	}
+	return nil
+}
+
+func (s *InMemoryStore) GetPortfolioItem(ctx context.Context, id int64) (*models.PortfolioItem, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	if v, ok := s.menuItems[id]; ok {
-		return v, nil
+	if v, ok := s.portfolio[id]; ok && !s.isDeleted(TrashPortfolio, id) {
+		return clonePortfolioItem(v), nil
+	}
+	return nil, notFound("get portfolio item")
+}
+
+func (s *InMemoryStore) ListPortfolioItems(ctx context.Context, f PortfolioFilter, offset, limit int) ([]*models.PortfolioItem, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	q := strings.TrimSpace(f.Query)
+	filtered := make([]*models.PortfolioItem, 0, len(s.portfolio))
+	for _, v := range s.portfolio {
+		if s.isDeleted(TrashPortfolio, v.ID) {
+			continue
+		}
+		if f.Category != "" && v.Category != f.Category {
+			continue
+		}
+		if q != "" && !containsFold(v.Style, q) && !containsFold(v.Description, q) {
+			continue
+		}
+		if f.Tag != "" && !slices.Contains(v.Tags, f.Tag) {
+			continue
+		}
+		if f.ServiceItemID != 0 && (v.ServiceItemID == nil || *v.ServiceItemID != f.ServiceItemID) {
+			continue
+		}
+		if f.FeaturedOnly && !v.Featured {
+			continue
+		}
+		filtered = append(filtered, clonePortfolioItem(v))
 	}
-	return nil, errors.New("not found")
+	// Featured first, then manual order, then newest first; IDs increase with
+	// creation time and break ties within a second.
+	sort.Slice(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if a.Featured != b.Featured {
+			return a.Featured
+		}
+		if a.SortOrder != b.SortOrder {
+			return a.SortOrder < b.SortOrder
+		}
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt > b.CreatedAt
+		}
+		return a.ID > b.ID
+	})
+
+	total := len(filtered)
+	start, end := page(total, offset, limit)
+	return filtered[start:end], total, nil
 }
 
-func (s *InMemoryStore) UpdateMenuItem(id int64, upd *models.MenuItem) (*models.MenuItem, error) {
+func (s *InMemoryStore) ReorderPortfolioItems(ctx context.Context, ids []int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.menuItems[id]; !ok {
-		return nil, errors.New("not found")
+	for _, id := range ids {
+		if _, ok := s.portfolio[id]; !ok || s.isDeleted(TrashPortfolio, id) {
+			return notFound("reorder portfolio items")
+		}
+	}
+	for i, id := range ids {
+		s.portfolio[id].SortOrder = i + 1
+	}
+	return nil
+}
+
+// --- Menu Items Operations ---
+
+// checkMenuItemService mirrors the foreign key from menu items to services
+// and the unique index on the names of a service's live variants. Callers
+// hold s.mu.
+func (s *InMemoryStore) checkMenuItemService(op string, it *models.MenuItem) error {
+	if it.ServiceItemID == nil {
+		return nil
+	}
+	if _, ok := s.services[*it.ServiceItemID]; !ok {
+		return conflict(op, "unknown service item")
+	}
+	for _, other := range s.menuItems {
+		if other.ID == it.ID || s.isDeleted(TrashMenuItems, other.ID) || other.ServiceItemID == nil {
+			continue
+		}
+		if *other.ServiceItemID == *it.ServiceItemID && strings.EqualFold(other.Name, it.Name) {
+			return conflict(op, "service already has a variant with this name")
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) CreateMenuItem(ctx context.Context, it *models.MenuItem) (*models.MenuItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.createMenuItem(it); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// createMenuItem stores it, giving it the next ID if it has none. Callers
+// hold s.mu.
+func (s *InMemoryStore) createMenuItem(it *models.MenuItem) error {
+	if err := s.checkCategory("create menu item", it.Category); err != nil {
+		return err
+	}
+	if err := s.checkMenuItemService("create menu item", it); err != nil {
+		return err
+	}
+	if it.ID == 0 {
+		it.ID = s.nextMenuItem
+		s.nextMenuItem++
+	} else {
+		if it.ID >= s.nextMenuItem {
+			s.nextMenuItem = it.ID + 1
+		}
+	}
+	s.menuItems[it.ID] = cloneMenuItem(it)
+	return nil
+}
+
+func (s *InMemoryStore) GetMenuItem(ctx context.Context, id int64) (*models.MenuItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.menuItems[id]; ok && !s.isDeleted(TrashMenuItems, id) {
+		return cloneMenuItem(v), nil
+	}
+	return nil, notFound("get menu item")
+}
+
+func (s *InMemoryStore) UpdateMenuItem(ctx context.Context, id int64, upd *models.MenuItem) (*models.MenuItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.updateMenuItem(id, upd); err != nil {
+		return nil, err
 	}
-	upd.ID = id
-	s.menuItems[id] = upd
 	return upd, nil
 }
 
-func (s *InMemoryStore) DeleteMenuItem(id int64) error {
+// updateMenuItem replaces the live menu item id with upd. Callers hold s.mu.
+func (s *InMemoryStore) updateMenuItem(id int64, upd *models.MenuItem) error {
+	if _, ok := s.menuItems[id]; !ok || s.isDeleted(TrashMenuItems, id) {
+		return notFound("update menu item")
+	}
+	upd.ID = id
+	if err := s.checkCategory("update menu item", upd.Category); err != nil {
+		return err
+	}
+	if err := s.checkMenuItemService("update menu item", upd); err != nil {
+		return err
+	}
+	s.menuItems[id] = cloneMenuItem(upd)
+	return nil
+}
+
+func (s *InMemoryStore) ImportMenuItems(ctx context.Context, items []*models.MenuItem) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.menuItems[id]; !ok {
-		return errors.New("not found")
+	saved, next := maps.Clone(s.menuItems), s.nextMenuItem
+	for _, it := range items {
+		var err error
+		if it.ID == 0 {
+			err = s.createMenuItem(it)
+		} else {
+			err = s.updateMenuItem(it.ID, it)
+		}
+		if err != nil {
+			s.menuItems, s.nextMenuItem = saved, next
+			return err
+		}
 	}
-	delete(s.menuItems, id)
 	return nil
 }
 
-func (s *InMemoryStore) ListMenuItems(category string, q string, offset, limit int) ([]*models.MenuItem, int) {
+func (s *InMemoryStore) DeleteMenuItem(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.menuItems[id]
+	if !s.trash(TrashMenuItems, id, ok) {
+		return notFound("delete menu item")
+	}
+	return nil
+}
+
+func (s *InMemoryStore) ListMenuItems(ctx context.Context, category string, q string, offset, limit int) ([]*models.MenuItem, int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	category = strings.TrimSpace(category)
+	q = strings.TrimSpace(q)
 	filtered := make([]*models.MenuItem, 0, len(s.menuItems))
 	for _, v := range s.menuItems {
+		if s.isDeleted(TrashMenuItems, v.ID) {
+			continue
+		}
 		if category != "" && v.Category != category {
 			continue
 		}
-		if q != "" {
-			if !strings.Contains(strings.ToLower(v.Name), strings.ToLower(q)) {
-				continue
+		if q != "" && !containsFold(v.Name, q) {
+			continue
+		}
+		filtered = append(filtered, cloneMenuItem(v))
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].ID < filtered[j].ID
+	})
+
+	total := len(filtered)
+	start, end := page(total, offset, limit)
+	return filtered[start:end], total, nil
+}
+
+func (s *InMemoryStore) ListServiceVariants(ctx context.Context, serviceID int64) ([]*models.MenuItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*models.MenuItem, 0)
+	for _, v := range s.menuItems {
+		if v.ServiceItemID != nil && *v.ServiceItemID == serviceID && !s.isDeleted(TrashMenuItems, v.ID) {
+			out = append(out, cloneMenuItem(v))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// --- Category Operations ---
+
+func cloneCategory(cat *models.Category) *models.Category {
+	cp := *cat
+	return &cp
+}
+
+func (s *InMemoryStore) ListCategories(ctx context.Context) ([]*models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*models.Category, 0, len(s.categories))
+	for _, cat := range s.categories {
+		out = append(out, cloneCategory(cat))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].SortOrder != out[j].SortOrder {
+			return out[i].SortOrder < out[j].SortOrder
+		}
+		return out[i].Slug < out[j].Slug
+	})
+	return out, nil
+}
+
+func (s *InMemoryStore) GetCategory(ctx context.Context, slug string) (*models.Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if cat, ok := s.categories[slug]; ok {
+		return cloneCategory(cat), nil
+	}
+	return nil, notFound("get category")
+}
+
+func (s *InMemoryStore) CreateCategory(ctx context.Context, cat *models.Category) (*models.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.categories[cat.Slug]; ok {
+		return nil, conflict("create category", "slug already exists")
+	}
+	s.categories[cat.Slug] = cloneCategory(cat)
+	return cat, nil
+}
+
+func (s *InMemoryStore) UpdateCategory(ctx context.Context, slug string, upd *models.Category) (*models.Category, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.categories[slug]; !ok {
+		return nil, notFound("update category")
+	}
+	if upd.Slug != slug {
+		if _, ok := s.categories[upd.Slug]; ok {
+			return nil, conflict("update category", "slug already exists")
+		}
+		// Mirror ON UPDATE CASCADE from the items in the category.
+		for _, it := range s.services {
+			if it.Service == slug {
+				it.Service = upd.Slug
+			}
+		}
+		for _, it := range s.portfolio {
+			if it.Category == slug {
+				it.Category = upd.Slug
+			}
+		}
+		for _, it := range s.menuItems {
+			if it.Category == slug {
+				it.Category = upd.Slug
 			}
 		}
-		filtered = append(filtered, v)
+		delete(s.categories, slug)
 	}
+	s.categories[upd.Slug] = cloneCategory(upd)
+	return upd, nil
+}
+
+func (s *InMemoryStore) DeleteCategory(ctx context.Context, slug string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.categories[slug]; !ok {
+		return notFound("delete category")
+	}
+	inUse := false
+	for _, it := range s.services {
+		inUse = inUse || it.Service == slug
+	}
+	for _, it := range s.portfolio {
+		inUse = inUse || it.Category == slug
+	}
+	for _, it := range s.menuItems {
+		inUse = inUse || it.Category == slug
+	}
+	if inUse {
+		return conflict("delete category", "category has items")
+	}
+	delete(s.categories, slug)
+	return nil
+}
+
+// --- Review Operations ---
+
+type reviewInvite struct {
+	appointmentID int64
+	expiresAt     time.Time
+	used          bool
+}
+
+func (s *InMemoryStore) CreateReviewInvite(ctx context.Context, appointmentID int64, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.appts[appointmentID]; !ok || s.isDeleted(TrashAppointments, appointmentID) {
+		return notFound("create review invite")
+	}
+	for _, r := range s.reviews {
+		if r.AppointmentID != nil && *r.AppointmentID == appointmentID {
+			return conflict("create review invite", "appointment already reviewed")
+		}
+	}
+	for hash, inv := range s.reviewInvites {
+		if inv.appointmentID == appointmentID {
+			delete(s.reviewInvites, hash)
+		}
+	}
+	s.reviewInvites[tokenHash] = &reviewInvite{appointmentID: appointmentID, expiresAt: expiresAt}
+	return nil
+}
+
+// liveReviewInvite returns the appointment behind an unused, unexpired link
+// whose appointment is not in the trash. Callers hold s.mu.
+func (s *InMemoryStore) liveReviewInvite(tokenHash string) (*reviewInvite, *models.Appointment) {
+	inv, ok := s.reviewInvites[tokenHash]
+	if !ok || inv.used || !time.Now().Before(inv.expiresAt) || s.isDeleted(TrashAppointments, inv.appointmentID) {
+		return nil, nil
+	}
+	return inv, s.appts[inv.appointmentID]
+}
+
+func (s *InMemoryStore) GetReviewInvite(ctx context.Context, tokenHash string) (*models.ReviewInvite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inv, a := s.liveReviewInvite(tokenHash)
+	if inv == nil {
+		return nil, notFound("get review invite")
+	}
+	return &models.ReviewInvite{
+		AppointmentID: a.ID,
+		ServiceID:     a.ServiceID,
+		CustomerName:  a.CustomerName,
+		Date:          a.Date,
+		ExpiresAt:     inv.expiresAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}, nil
+}
+
+func (s *InMemoryStore) SubmitReview(ctx context.Context, tokenHash string, r *models.Review) (*models.Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, a := s.liveReviewInvite(tokenHash)
+	if inv == nil {
+		return nil, notFound("submit review")
+	}
+	inv.used = true
+	appointmentID := a.ID
+	r.ID = s.nextReview
+	s.nextReview++
+	r.AppointmentID = &appointmentID
+	r.ServiceID = a.ServiceID
+	r.Status = "pending"
+	r.CreatedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	s.reviews[r.ID] = cloneReview(r)
+	return r, nil
+}
+
+func (s *InMemoryStore) ListReviews(ctx context.Context, f ReviewFilter, offset, limit int) ([]*models.Review, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filtered := make([]*models.Review, 0)
+	for _, r := range s.reviews {
+		if f.ServiceID != 0 && r.ServiceID != f.ServiceID {
+			continue
+		}
+		if f.Status != "" && r.Status != f.Status {
+			continue
+		}
+		filtered = append(filtered, cloneReview(r))
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].CreatedAt != filtered[j].CreatedAt {
+			return filtered[i].CreatedAt > filtered[j].CreatedAt
+		}
+		return filtered[i].ID > filtered[j].ID
+	})
 
 	total := len(filtered)
-	if offset < 0 {
-		offset = 0
+	start, end := page(total, offset, limit)
+	return filtered[start:end], total, nil
+}
+
+func (s *InMemoryStore) ModerateReview(ctx context.Context, id int64, status string) (*models.Review, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reviews[id]
+	if !ok {
+		return nil, notFound("moderate review")
 	}
-	if limit <= 0 {
-		limit = 10
+	r.Status = status
+
+	sum, n := 0, 0
+	for _, other := range s.reviews {
+		if other.ServiceID == r.ServiceID && other.Status == "approved" {
+			sum += other.Rating
+			n++
+		}
 	}
-	if limit > 100 {
-		limit = 100
+	if svc, ok := s.services[r.ServiceID]; ok {
+		svc.Rating, svc.ReviewCount = 0, n
+		if n > 0 {
+			svc.Rating = math.Round(float64(sum)/float64(n)*reviewRatingScale) / reviewRatingScale
+		}
 	}
-	start := offset
-	end := offset + limit
-	if start > total {
-		start = total
+	return cloneReview(r), nil
+}
+
+// --- Payment Operations ---
+
+func clonePayment(p *models.Payment) *models.Payment {
+	cp := *p
+	return &cp
+}
+
+func (s *InMemoryStore) CreatePayment(ctx context.Context, p *models.Payment) (*models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.appts[p.AppointmentID]; !ok || s.isDeleted(TrashAppointments, p.AppointmentID) {
+		return nil, notFound("create payment")
 	}
-	if end > total {
-		end = total
+	for _, other := range s.payments {
+		if other.Provider == p.Provider && other.ProviderRef == p.ProviderRef {
+			return nil, conflict("create payment", "duplicate provider reference")
+		}
+	}
+	p.ID = s.nextPayment
+	s.nextPayment++
+	if p.Status == "" {
+		p.Status = "pending"
+	}
+	p.CreatedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	p.UpdatedAt = p.CreatedAt
+	s.payments[p.ID] = clonePayment(p)
+	return p, nil
+}
+
+func (s *InMemoryStore) ListPayments(ctx context.Context, appointmentID int64) ([]*models.Payment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*models.Payment, 0)
+	for _, p := range s.payments {
+		if p.AppointmentID == appointmentID {
+			out = append(out, clonePayment(p))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *InMemoryStore) GetPaymentByRef(ctx context.Context, provider, providerRef string) (*models.Payment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p := s.paymentByRef(provider, providerRef); p != nil {
+		return clonePayment(p), nil
+	}
+	return nil, notFound("get payment")
+}
+
+// paymentByRef finds a payment by its provider reference. Callers hold s.mu.
+func (s *InMemoryStore) paymentByRef(provider, providerRef string) *models.Payment {
+	for _, p := range s.payments {
+		if p.Provider == provider && p.ProviderRef == providerRef {
+			return p
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) SettlePayment(ctx context.Context, provider, providerRef, status, reason string) (*models.Payment, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.paymentByRef(provider, providerRef)
+	if p == nil {
+		return nil, false, notFound("settle payment")
+	}
+	if p.Status != "pending" {
+		return clonePayment(p), false, nil
+	}
+	p.Status, p.FailureReason = status, reason
+	p.UpdatedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+
+	confirmed := false
+	a, ok := s.appts[p.AppointmentID]
+	if status == "succeeded" && ok && !s.isDeleted(TrashAppointments, a.ID) && isCancelledStatus(a.Status) {
+		// The cancellation has already settled what was paid.
+		s.addRefund(a.ID, p, p.AmountCents)
+	}
+	if status == "succeeded" && ok && !s.isDeleted(TrashAppointments, a.ID) && a.Status == "pending" && a.DepositCents > 0 {
+		var paid int64
+		for _, other := range s.payments {
+			if other.AppointmentID == a.ID && other.Status == "succeeded" {
+				paid += other.AmountCents
+			}
+		}
+		// A full day leaves the booking for the salon to reschedule.
+		if paid >= a.DepositCents && s.reserveAppointmentDay(a.Date, a.ID) == nil {
+			a.Status = "confirmed"
+			confirmed = true
+		}
+	}
+	return clonePayment(p), confirmed, nil
+}
+
+// --- Refund Operations ---
+
+func cloneRefund(r *models.Refund) *models.Refund {
+	cp := *r
+	return &cp
+}
+
+func (s *InMemoryStore) ListRefunds(ctx context.Context, f RefundFilter, offset, limit int) ([]*models.Refund, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*models.Refund, 0)
+	for _, r := range s.refunds {
+		if f.AppointmentID != 0 && r.AppointmentID != f.AppointmentID {
+			continue
+		}
+		if f.Status != "" && r.Status != f.Status {
+			continue
+		}
+		out = append(out, cloneRefund(r))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	start, end := page(len(out), offset, limit)
+	return out[start:end], len(out), nil
+}
+
+func (s *InMemoryStore) MarkRefundPaid(ctx context.Context, id int64) (*models.Refund, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.refunds[id]
+	if !ok {
+		return nil, notFound("mark refund paid")
+	}
+	if r.Status != "pending" {
+		return nil, conflict("mark refund paid", "refund is "+r.Status)
+	}
+	r.Status = "paid"
+	r.PaidAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	return cloneRefund(r), nil
+}
+
+// --- Invoice Operations ---
+
+func cloneInvoice(inv *models.Invoice) *models.Invoice {
+	cp := *inv
+	return &cp
+}
+
+func (s *InMemoryStore) IssueInvoice(ctx context.Context, inv *models.Invoice) (*models.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.appts[inv.AppointmentID]; !ok || s.isDeleted(TrashAppointments, inv.AppointmentID) {
+		return nil, notFound("issue invoice")
+	}
+	for _, existing := range s.invoices {
+		if existing.AppointmentID == inv.AppointmentID {
+			return cloneInvoice(existing), nil
+		}
+	}
+	inv.ID = s.nextInvoice
+	s.nextInvoice++
+	inv.Number = invoiceNumber(inv.ID)
+	inv.IssuedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	s.invoices[inv.ID] = cloneInvoice(inv)
+	return inv, nil
+}
+
+// --- Voucher Operations ---
+
+func cloneVoucher(v *models.Voucher) *models.Voucher {
+	cp := *v
+	return &cp
+}
+
+// voucherRedeemable reports whether a booking made at now may redeem v.
+func voucherRedeemable(v *models.Voucher, now time.Time) bool {
+	if !v.Active || (v.MaxUses > 0 && v.Uses >= v.MaxUses) {
+		return false
+	}
+	if v.ExpiresAt == "" {
+		return true
+	}
+	expires, err := time.Parse(time.RFC3339, v.ExpiresAt)
+	return err == nil && now.Before(expires)
+}
+
+// voucherCodeTaken reports whether another voucher than id has code.
+// Callers hold s.mu.
+func (s *InMemoryStore) voucherCodeTaken(code string, id int64) bool {
+	for _, v := range s.vouchers {
+		if v.Code == code && v.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *InMemoryStore) CreateVoucher(ctx context.Context, v *models.Voucher) (*models.Voucher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.voucherCodeTaken(v.Code, 0) {
+		return nil, conflict("create voucher", "code already exists")
+	}
+	v.ID = s.nextVoucher
+	s.nextVoucher++
+	v.Uses = 0
+	v.CreatedAt = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	s.vouchers[v.ID] = cloneVoucher(v)
+	return v, nil
+}
+
+func (s *InMemoryStore) GetVoucher(ctx context.Context, id int64) (*models.Voucher, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if v, ok := s.vouchers[id]; ok {
+		return cloneVoucher(v), nil
+	}
+	return nil, notFound("get voucher")
+}
+
+func (s *InMemoryStore) GetVoucherByCode(ctx context.Context, code string) (*models.Voucher, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, v := range s.vouchers {
+		if v.Code == code {
+			return cloneVoucher(v), nil
+		}
+	}
+	return nil, notFound("get voucher")
+}
+
+func (s *InMemoryStore) ListVouchers(ctx context.Context, offset, limit int) ([]*models.Voucher, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*models.Voucher, 0, len(s.vouchers))
+	for _, v := range s.vouchers {
+		out = append(out, cloneVoucher(v))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	start, end := page(len(out), offset, limit)
+	return out[start:end], len(out), nil
+}
+
+func (s *InMemoryStore) UpdateVoucher(ctx context.Context, id int64, upd *models.Voucher) (*models.Voucher, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.vouchers[id]
+	if !ok {
+		return nil, notFound("update voucher")
+	}
+	v.Kind, v.Value, v.Currency = upd.Kind, upd.Value, upd.Currency
+	v.ExpiresAt, v.MaxUses, v.Active, v.Note = upd.ExpiresAt, upd.MaxUses, upd.Active, upd.Note
+	return cloneVoucher(v), nil
+}
+
+func (s *InMemoryStore) DeleteVoucher(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.vouchers[id]; !ok {
+		return notFound("delete voucher")
+	}
+	// Mirror the foreign key from appointments, trashed or not.
+	for _, a := range s.appts {
+		if a.VoucherID == id {
+			return conflict("delete voucher", "voucher has been redeemed")
+		}
+	}
+	delete(s.vouchers, id)
+	return nil
+}
+
+// --- Loyalty Operations ---
+
+func cloneLoyaltyEntry(e *models.LoyaltyEntry) *models.LoyaltyEntry {
+	cp := *e
+	if e.AppointmentID != nil {
+		id := *e.AppointmentID
+		cp.AppointmentID = &id
+	}
+	return &cp
+}
+
+// loyaltyBalance sums the points of the customer with email. Callers hold
+// s.mu.
+func (s *InMemoryStore) loyaltyBalance(email string) int64 {
+	var sum int64
+	for _, e := range s.loyaltyEntries {
+		if e.CustomerEmail == email {
+			sum += e.Points
+		}
+	}
+	return sum
+}
+
+// addLoyaltyEntry records a change to a customer's points. Callers hold
+// s.mu for writing.
+func (s *InMemoryStore) addLoyaltyEntry(email string, appointmentID int64, kind string, points int64) *models.LoyaltyEntry {
+	e := &models.LoyaltyEntry{
+		ID:            s.nextLoyaltyEntry,
+		CustomerEmail: email,
+		AppointmentID: &appointmentID,
+		Kind:          kind,
+		Points:        points,
+		CreatedAt:     time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	s.nextLoyaltyEntry++
+	s.loyaltyEntries[e.ID] = e
+	return cloneLoyaltyEntry(e)
+}
+
+func (s *InMemoryStore) GetLoyaltySettings(ctx context.Context) (*models.LoyaltySettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cp := s.loyalty
+	return &cp, nil
+}
+
+func (s *InMemoryStore) UpdateLoyaltySettings(ctx context.Context, upd *models.LoyaltySettings) (*models.LoyaltySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loyalty = *upd
+	cp := s.loyalty
+	return &cp, nil
+}
+
+func (s *InMemoryStore) EarnLoyaltyPoints(ctx context.Context, appointmentID, points int64) (*models.LoyaltyEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.appts[appointmentID]
+	if !ok || s.isDeleted(TrashAppointments, appointmentID) {
+		return nil, notFound("earn loyalty points")
+	}
+	for _, e := range s.loyaltyEntries {
+		if e.Kind == "earned" && e.AppointmentID != nil && *e.AppointmentID == appointmentID {
+			return cloneLoyaltyEntry(e), nil
+		}
+	}
+	return s.addLoyaltyEntry(loyaltyEmail(a.CustomerEmail), appointmentID, "earned", points), nil
+}
+
+func (s *InMemoryStore) LoyaltyBalance(ctx context.Context, email string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loyaltyBalance(loyaltyEmail(email)), nil
+}
+
+func (s *InMemoryStore) ListLoyaltyEntries(ctx context.Context, email string, offset, limit int) ([]*models.LoyaltyEntry, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	email = loyaltyEmail(email)
+	out := make([]*models.LoyaltyEntry, 0)
+	for _, e := range s.loyaltyEntries {
+		if e.CustomerEmail == email {
+			out = append(out, cloneLoyaltyEntry(e))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	start, end := page(len(out), offset, limit)
+	return out[start:end], len(out), nil
+}
+
+// --- Report Operations ---
+
+// reportGroup returns the key and label of the group a falls in. Callers
+// hold s.mu.
+func (s *InMemoryStore) reportGroup(a *models.Appointment, by ReportGrouping) (key, label string, err error) {
+	switch by {
+	case ReportTotal:
+		return "", "", nil
+	case ReportByDay:
+		return a.Date, a.Date, nil
+	case ReportByWeek, ReportByMonth:
+		d, err := time.Parse("2006-01-02", a.Date)
+		if err != nil {
+			return "", "", err
+		}
+		if by == ReportByMonth {
+			return d.Format("2006-01"), d.Format("2006-01"), nil
+		}
+		monday := d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7)).Format("2006-01-02")
+		return monday, monday, nil
+	case ReportByService:
+		name := ""
+		if svc, ok := s.services[a.ServiceID]; ok {
+			name = svc.Name
+		}
+		return fmt.Sprint(a.ServiceID), name, nil
+	case ReportByCategory:
+		slug := ""
+		if svc, ok := s.services[a.ServiceID]; ok {
+			slug = svc.Service
+		}
+		label := slug
+		if cat, ok := s.categories[slug]; ok {
+			label = cat.Name
+		}
+		return slug, label, nil
+	case ReportByStaff:
+		if a.StaffName == "" {
+			return "", "Unassigned", nil
+		}
+		return a.StaffName, a.StaffName, nil
+	case ReportByHour:
+		hour, _, _ := strings.Cut(a.Time, ":")
+		return hour, hour + ":00", nil
+	}
+	return "", "", fmt.Errorf("storage: unknown report grouping %q", by)
+}
+
+func (s *InMemoryStore) ReportAppointments(ctx context.Context, f ReportFilter, by ReportGrouping) ([]*models.ReportRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	type groupKey struct{ key, currency string }
+	groups := make(map[groupKey]*models.ReportRow)
+	out := make([]*models.ReportRow, 0)
+	for _, a := range s.appts {
+		if s.isDeleted(TrashAppointments, a.ID) || (f.From != "" && a.Date < f.From) || (f.To != "" && a.Date > f.To) {
+			continue
+		}
+		key, label, err := s.reportGroup(a, by)
+		if err != nil {
+			return nil, err
+		}
+		row, ok := groups[groupKey{key, a.Currency}]
+		if !ok {
+			row = &models.ReportRow{Key: key, Label: label, Currency: a.Currency}
+			groups[groupKey{key, a.Currency}] = row
+			out = append(out, row)
+		}
+		row.Bookings++
+		switch a.Status {
+		case "completed":
+			row.Completed++
+			row.RevenueCents += a.PriceCents
+		case "cancelled":
+			row.Cancelled++
+			row.FeesCents += a.CancellationFeeCents
+		case "no_show":
+			row.NoShows++
+			row.FeesCents += a.CancellationFeeCents
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		x, y := out[i], out[j]
+		if !by.chronological() {
+			if x.RevenueCents != y.RevenueCents {
+				return x.RevenueCents > y.RevenueCents
+			}
+			if x.Bookings != y.Bookings {
+				return x.Bookings > y.Bookings
+			}
+		}
+		if x.Key != y.Key {
+			return x.Key < y.Key
+		}
+		return x.Currency < y.Currency
+	})
+	return out, nil
+}
+
+// --- Customer Operations ---
+
+func (s *InMemoryStore) EachCustomer(ctx context.Context, f ReportFilter, fn func(*models.Customer) error) error {
+	s.mu.RLock()
+	customers := make(map[string]*models.Customer)
+	latest := make(map[string]*models.Appointment)
+	for _, a := range s.appts {
+		if s.isDeleted(TrashAppointments, a.ID) || (f.From != "" && a.Date < f.From) || (f.To != "" && a.Date > f.To) {
+			continue
+		}
+		email := loyaltyEmail(a.CustomerEmail)
+		c, ok := customers[email]
+		if !ok {
+			c = &models.Customer{Email: email, FirstVisit: a.Date, LastVisit: a.Date, SpentCents: map[string]int64{}}
+			customers[email] = c
+		}
+		c.Bookings++
+		switch a.Status {
+		case "completed":
+			c.Completed++
+			c.SpentCents[a.Currency] += a.PriceCents
+		case "cancelled":
+			c.Cancelled++
+		case "no_show":
+			c.NoShows++
+		}
+		c.FirstVisit, c.LastVisit = min(c.FirstVisit, a.Date), max(c.LastVisit, a.Date)
+		if l := latest[email]; l == nil || a.Date > l.Date || (a.Date == l.Date && a.ID > l.ID) {
+			latest[email] = a
+		}
+	}
+	out := make([]*models.Customer, 0, len(customers))
+	for email, c := range customers {
+		c.Name, c.Phone = latest[email].CustomerName, latest[email].CustomerPhone
+		c.LoyaltyPoints = s.loyaltyBalance(email)
+		out = append(out, c)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Email < out[j].Email })
+	for _, c := range out {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Trash Operations ---
+
+// trashItem describes a trashed record, or returns nil if it is not in the
+// trash. Callers hold s.mu.
+func (s *InMemoryStore) trashItem(kind TrashKind, id int64) *models.TrashItem {
+	deletedAt, ok := s.deleted[kind][id]
+	if !ok {
+		return nil
+	}
+	it := &models.TrashItem{
+		Type:      string(kind),
+		ID:        id,
+		DeletedAt: deletedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	switch kind {
+	case TrashAppointments:
+		a := s.appts[id]
+		it.Label = a.CustomerName + " on " + a.Date
+	case TrashServices:
+		it.Label = s.services[id].Name
+	case TrashPortfolio:
+		p := s.portfolio[id]
+		it.Label = p.Style
+		it.Images = normalizeImagePaths(append([]string(nil), p.Images...))
+	case TrashMenuItems:
+		it.Label = s.menuItems[id].Name
+	}
+	return it
+}
+
+// ListTrash returns trashed records of kind (or of every kind if kind is
+// empty), most recently deleted first.
+func (s *InMemoryStore) ListTrash(ctx context.Context, kind TrashKind, offset, limit int) ([]*models.TrashItem, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*models.TrashItem, 0)
+	for _, k := range TrashKinds {
+		if kind != "" && k != kind {
+			continue
+		}
+		for id := range s.deleted[k] {
+			out = append(out, s.trashItem(k, id))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DeletedAt != out[j].DeletedAt {
+			return out[i].DeletedAt > out[j].DeletedAt
+		}
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].ID > out[j].ID
+	})
+
+	total := len(out)
+	start, end := page(total, offset, limit)
+	return out[start:end], total, nil
+}
+
+// RestoreFromTrash makes a trashed record live again. Restoring a confirmed
+// appointment fails with ErrSlotUnavailable if its day has filled up since.
+func (s *InMemoryStore) RestoreFromTrash(ctx context.Context, kind TrashKind, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isDeleted(kind, id) {
+		return notFound("restore " + string(kind))
+	}
+	if a := s.appts[id]; kind == TrashAppointments && a.Status == "confirmed" {
+		if err := s.reserveAppointmentDay(a.Date, id); err != nil {
+			return err
+		}
+	}
+	if kind == TrashMenuItems {
+		if err := s.checkMenuItemService("restore "+string(kind), s.menuItems[id]); err != nil {
+			return err
+		}
+	}
+	delete(s.deleted[kind], id)
+	return nil
+}
+
+// PurgeFromTrash permanently deletes a trashed record and returns what was
+// removed. A service that bookings still reference cannot be purged.
+func (s *InMemoryStore) PurgeFromTrash(ctx context.Context, kind TrashKind, id int64) (*models.TrashItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	it := s.trashItem(kind, id)
+	if it == nil {
+		return nil, notFound("purge " + string(kind))
+	}
+	switch kind {
+	case TrashAppointments:
+		// Mirror the foreign keys from review links, payments, refunds and
+		// invoices (cascade) and reviews and loyalty entries (set null), and
+		// the cancel link column.
+		for hash, inv := range s.reviewInvites {
+			if inv.appointmentID == id {
+				delete(s.reviewInvites, hash)
+			}
+		}
+		for _, r := range s.reviews {
+			if r.AppointmentID != nil && *r.AppointmentID == id {
+				r.AppointmentID = nil
+			}
+		}
+		for pid, p := range s.payments {
+			if p.AppointmentID == id {
+				delete(s.payments, pid)
+			}
+		}
+		for rid, r := range s.refunds {
+			if r.AppointmentID == id {
+				delete(s.refunds, rid)
+			}
+		}
+		for hash, apptID := range s.cancelTokens {
+			if apptID == id {
+				delete(s.cancelTokens, hash)
+			}
+		}
+		for iid, inv := range s.invoices {
+			if inv.AppointmentID == id {
+				delete(s.invoices, iid)
+			}
+		}
+		for _, e := range s.loyaltyEntries {
+			if e.AppointmentID != nil && *e.AppointmentID == id {
+				e.AppointmentID = nil
+			}
+		}
+		delete(s.appts, id)
+	case TrashServices:
+		// Mirror the ON DELETE RESTRICT foreign key from appointments.
+		for _, a := range s.appts {
+			if a.ServiceID == id {
+				return nil, conflict("purge "+string(kind), "service has appointments")
+			}
+		}
+		// Mirror ON DELETE SET NULL from portfolio items.
+		for _, it := range s.portfolio {
+			if it.ServiceItemID != nil && *it.ServiceItemID == id {
+				it.ServiceItemID = nil
+			}
+		}
+		// Mirror ON DELETE CASCADE from reviews and variants.
+		for rid, r := range s.reviews {
+			if r.ServiceID == id {
+				delete(s.reviews, rid)
+			}
+		}
+		for mid, it := range s.menuItems {
+			if it.ServiceItemID != nil && *it.ServiceItemID == id {
+				delete(s.menuItems, mid)
+				delete(s.deleted[TrashMenuItems], mid)
+			}
+		}
+		delete(s.services, id)
+	case TrashPortfolio:
+		delete(s.portfolio, id)
+	case TrashMenuItems:
+		delete(s.menuItems, id)
 	}
-	return filtered[start:end], total
+	delete(s.deleted[kind], id)
+	return it, nil
 }
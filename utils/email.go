@@ -2,8 +2,10 @@ package utils
 
 import (
 	"fmt"
+	"html"
 	"log"
 	"lucys-beauty-parlour-backend/models"
+	"lucys-beauty-parlour-backend/money"
 	"os"
 	"strings"
 	"time"
@@ -11,73 +13,32 @@ import (
 	"github.com/resend/resend-go/v3"
 )
 
+// formatAppointmentTotal renders an amount in minor units of currency, e.g.
+// "UGX 150,000" or "USD 25.50". Stored currencies are validated, so the
+// fallback for an unknown code only keeps old records readable.
 func formatAppointmentTotal(currency string, priceCents int64) string {
-	currency = strings.ToUpper(strings.TrimSpace(currency))
-
-	if isZeroDecimalCurrency(currency) {
-		amount := formatIntWithThousands(priceCents)
-		if currency == "" {
-			return amount
-		}
-		return fmt.Sprintf("%s %s", currency, amount)
-	}
-
-	whole := priceCents / 100
-	fraction := priceCents % 100
-	if fraction < 0 {
-		fraction = -fraction
-	}
-
-	value := fmt.Sprintf("%s.%02d", formatIntWithThousands(whole), fraction)
-	if currency == "" {
-		return value
-	}
-	return fmt.Sprintf("%s %s", currency, value)
-}
-
-func isZeroDecimalCurrency(currency string) bool {
-	switch strings.ToUpper(strings.TrimSpace(currency)) {
-	case "UGX", "KES", "TZS", "RWF", "JPY", "KRW":
-		return true
-	case "":
-		return true
-	default:
-		return false
+	c, err := money.ParseCurrency(currency)
+	if err != nil {
+		return strings.TrimSpace(fmt.Sprintf("%s %d", strings.TrimSpace(currency), priceCents))
 	}
+	return c.Format(priceCents)
 }
 
-func formatIntWithThousands(n int64) string {
-	neg := n < 0
-	if neg {
-		n = -n
-	}
-
-	s := fmt.Sprintf("%d", n)
-	if len(s) <= 3 {
-		if neg {
-			return "-" + s
-		}
-		return s
+// appointmentTotal is what a booking costs, noting any promo code or
+// loyalty points discount already taken off.
+func appointmentTotal(a *models.Appointment) string {
+	total := formatAppointmentTotal(a.Currency, a.PriceCents)
+	if a.DiscountCents <= 0 {
+		return total
 	}
-	var out []byte
-	count := 0
-	for i := len(s) - 1; i >= 0; i-- {
-		out = append(out, s[i])
-		count++
-		if count%3 == 0 && i != 0 {
-			out = append(out, ',')
-		}
-	}
-
-	// Reverse to correct order.
-	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
-		out[i], out[j] = out[j], out[i]
+	var with []string
+	if a.PromoCode != "" {
+		with = append(with, "code "+a.PromoCode)
 	}
-
-	if neg {
-		return "-" + string(out)
+	if a.PointsRedeemed > 0 {
+		with = append(with, fmt.Sprintf("%d loyalty points", a.PointsRedeemed))
 	}
-	return string(out)
+	return fmt.Sprintf("%s (%s off with %s)", total, formatAppointmentTotal(a.Currency, a.DiscountCents), strings.Join(with, " and "))
 }
 
 func formatFullServiceName(serviceName, serviceDescription string) string {
@@ -96,7 +57,7 @@ func formatFullServiceName(serviceName, serviceDescription string) string {
 }
 
 // emailTemplate wraps HTML content with proper MIME headers
-func sendHTMLEmail(to, subject, htmlBody string) error {
+func sendHTMLEmail(to, subject, htmlBody string, attachments ...*resend.Attachment) error {
 	apiKey := os.Getenv("RESEND_API_KEY")
 	senderEmail := os.Getenv("SENDER_EMAIL")
 	if senderEmail == "" {
@@ -109,10 +70,11 @@ func sendHTMLEmail(to, subject, htmlBody string) error {
 
 	client := resend.NewClient(apiKey)
 	params := &resend.SendEmailRequest{
-		From:    senderEmail,
-		To:      []string{to},
-		Subject: subject,
-		Html:    htmlBody,
+		From:        senderEmail,
+		To:          []string{to},
+		Subject:     subject,
+		Html:        htmlBody,
+		Attachments: attachments,
 	}
 
 	sent, err := client.Emails.Send(params)
@@ -258,7 +220,7 @@ func SendPasswordChangeConfirmation(recipientEmail string) error {
 
 // SendNewAppointmentNotificationToAdmin notifies admin of a new appointment booking
 func SendNewAppointmentNotificationToAdmin(appointment *models.Appointment, serviceName string) error {
-	total := formatAppointmentTotal(appointment.Currency, appointment.PriceCents)
+	total := appointmentTotal(appointment)
 	fullServiceName := formatFullServiceName(serviceName, appointment.ServiceDescription)
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -361,7 +323,7 @@ func SendNewAppointmentNotificationToAdmin(appointment *models.Appointment, serv
 
 // SendAppointmentConfirmedEmail notifies user that their appointment was confirmed
 func SendAppointmentConfirmedEmail(appointment *models.Appointment, serviceName string) error {
-	total := formatAppointmentTotal(appointment.Currency, appointment.PriceCents)
+	total := appointmentTotal(appointment)
 	fullServiceName := formatFullServiceName(serviceName, appointment.ServiceDescription)
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -442,10 +404,42 @@ func SendAppointmentConfirmedEmail(appointment *models.Appointment, serviceName
 	return sendHTMLEmail(appointment.CustomerEmail, fmt.Sprintf("Appointment Confirmed - ID: %d", appointment.ID), htmlBody)
 }
 
-// SendAppointmentRejectedEmail notifies user that their appointment was cancelled
-func SendAppointmentRejectedEmail(appointment *models.Appointment, serviceName string) error {
-	total := formatAppointmentTotal(appointment.Currency, appointment.PriceCents)
+// cancellationDetails describes who cancelled a booking, and the refund and
+// fee the cancellation policy settled on, as HTML for the cancellation email.
+func cancellationDetails(appointment *models.Appointment, refundCents int64) (headline, message, money string) {
+	headline = "Appointment Cancelled"
+	message = "We regret to inform you that your appointment has been cancelled. We apologize for any inconvenience this may cause."
+	switch {
+	case appointment.Status == "no_show":
+		headline = "Missed Appointment"
+		message = "We missed you at your appointment, so it has been closed as a no-show."
+	case appointment.CancelledBy == "customer":
+		message = "As you requested, your appointment has been cancelled."
+	}
+	if reason := strings.TrimSpace(appointment.CancellationReason); reason != "" {
+		message += fmt.Sprintf(" Reason: %s", html.EscapeString(reason))
+	}
+
+	if refundCents > 0 {
+		money += fmt.Sprintf("<p><strong>Refund:</strong> %s will be refunded to the account you paid from. Please allow a few working days for it to arrive.</p>",
+			formatAppointmentTotal(appointment.Currency, refundCents))
+	}
+	if fee := appointment.CancellationFeeCents; fee > 0 {
+		label := "Cancellation fee"
+		if appointment.Status == "no_show" {
+			label = "No-show fee"
+		}
+		money += fmt.Sprintf("<p><strong>%s:</strong> %s, under our cancellation policy.</p>", label, formatAppointmentTotal(appointment.Currency, fee))
+	}
+	return headline, message, money
+}
+
+// SendAppointmentRejectedEmail notifies user that their appointment was
+// cancelled, with the refund and any fee due under the cancellation policy
+func SendAppointmentRejectedEmail(appointment *models.Appointment, serviceName string, refundCents int64) error {
+	total := appointmentTotal(appointment)
 	fullServiceName := formatFullServiceName(serviceName, appointment.ServiceDescription)
+	headline, message, money := cancellationDetails(appointment, refundCents)
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
 <html>
@@ -472,13 +466,14 @@ func SendAppointmentRejectedEmail(appointment *models.Appointment, serviceName s
 		<div class="content">
 			<h2>Appointment Update</h2>
 			<div class="alert">
-				<strong>Appointment Cancelled:</strong> Your appointment (ID: #%d) has been cancelled.
+				<strong>%s:</strong> Your appointment (ID: #%d) on %s at %s.
 			</div>
 			<p>Hello %s,</p>
 			<p><strong>Service:</strong> %s</p>
 			<p><strong>Description:</strong> %s</p>
 			<p><strong>Total:</strong> %s</p>
-			<p>We regret to inform you that your appointment has been cancelled. We apologize for any inconvenience this may cause.</p>
+			<p>%s</p>
+			%s
 			<p>If you would like to reschedule or have any questions, please feel free to:</p>
 			<ul>
 				<li>Book another appointment on our website</li>
@@ -498,14 +493,14 @@ func SendAppointmentRejectedEmail(appointment *models.Appointment, serviceName s
 	</div>
 </body>
 </html>
-`, appointment.ID, appointment.CustomerName, fullServiceName, appointment.ServiceDescription, total)
+`, headline, appointment.ID, appointment.Date, appointment.Time, appointment.CustomerName, fullServiceName, appointment.ServiceDescription, total, message, money)
 
-	return sendHTMLEmail(appointment.CustomerEmail, fmt.Sprintf("Appointment Cancelled - ID: %d", appointment.ID), htmlBody)
+	return sendHTMLEmail(appointment.CustomerEmail, fmt.Sprintf("%s - ID: %d", headline, appointment.ID), htmlBody)
 }
 
 // SendAppointmentUpdatedEmail notifies user about appointment changes
 func SendAppointmentUpdatedEmail(appointment *models.Appointment, serviceName string) error {
-	total := formatAppointmentTotal(appointment.Currency, appointment.PriceCents)
+	total := appointmentTotal(appointment)
 	fullServiceName := formatFullServiceName(serviceName, appointment.ServiceDescription)
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -587,3 +582,110 @@ func SendAppointmentUpdatedEmail(appointment *models.Appointment, serviceName st
 
 	return sendHTMLEmail(appointment.CustomerEmail, fmt.Sprintf("Appointment Updated - ID: %d", appointment.ID), htmlBody)
 }
+
+// CancelLink returns the public page where a customer cancels their booking.
+func CancelLink(token string) string {
+	return fmt.Sprintf("https://lucysbeautyparlour.com/cancel?token=%s", token)
+}
+
+// ReviewLink returns the public page where a customer redeems a review token.
+func ReviewLink(token string) string {
+	return fmt.Sprintf("https://lucysbeautyparlour.com/review?token=%s", token)
+}
+
+// SendReviewRequestEmail invites the customer to review a completed appointment
+func SendReviewRequestEmail(appointment *models.Appointment, serviceName, reviewToken string) error {
+	fullServiceName := formatFullServiceName(serviceName, appointment.ServiceDescription)
+	reviewLink := ReviewLink(reviewToken)
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<style>
+		body { font-family: 'Arial', sans-serif; line-height: 1.6; color: #333; }
+		.container { max-width: 600px; margin: 0 auto; background: #f9f9f9; padding: 20px; border-radius: 8px; }
+		.header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; border-radius: 8px 8px 0 0; }
+		.header h1 { margin: 0; font-size: 28px; }
+		.content { background: white; padding: 30px; border-radius: 0 0 8px 8px; }
+		.button { display: inline-block; background: #667eea; color: white; padding: 12px 30px; text-decoration: none; border-radius: 4px; margin: 20px 0; font-weight: bold; }
+		.button:hover { background: #764ba2; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; border-top: 1px solid #eee; margin-top: 20px; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>✨ Lucy's Beauty Parlour</h1>
+		</div>
+		<div class="content">
+			<h2>How Did We Do?</h2>
+			<p>Hello %s,</p>
+			<p>Thank you for visiting us on <strong>%s</strong> for your <strong>%s</strong>. We'd love to hear what you thought!</p>
+			<p>It only takes a minute to rate your service:</p>
+			<center>
+				<a href="%s" class="button">Leave a Review</a>
+			</center>
+			<p><strong>Or copy this link:</strong></p>
+			<p style="word-break: break-all; background: #f5f5f5; padding: 10px; border-radius: 4px;">%s</p>
+			<p>This link can be used once and expires in 30 days.</p>
+			<p>Best regards,<br><strong>Lucy's Beauty Parlour Team</strong></p>
+		</div>
+		<div class="footer">
+			<p>&copy; 2025 Lucy's Beauty Parlour. All rights reserved.</p>
+			<p>Contact: info@lucysbeautyparlour.com | +256-755897061</p>
+		</div>
+	</div>
+</body>
+</html>
+`, appointment.CustomerName, appointment.Date, fullServiceName, reviewLink, reviewLink)
+
+	return sendHTMLEmail(appointment.CustomerEmail, fmt.Sprintf("How was your appointment? - ID: %d", appointment.ID), htmlBody)
+}
+
+// SendReceiptEmail sends the customer their receipt, attached as a PDF
+func SendReceiptEmail(inv *models.Invoice, receiptPDF []byte) error {
+	fullServiceName := formatFullServiceName(inv.ServiceName, inv.ServiceDescription)
+	total := formatAppointmentTotal(inv.Currency, inv.TotalCents)
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0">
+	<style>
+		body { font-family: 'Arial', sans-serif; line-height: 1.6; color: #333; }
+		.container { max-width: 600px; margin: 0 auto; background: #f9f9f9; padding: 20px; border-radius: 8px; }
+		.header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; border-radius: 8px 8px 0 0; }
+		.header h1 { margin: 0; font-size: 28px; }
+		.content { background: white; padding: 30px; border-radius: 0 0 8px 8px; }
+		.footer { text-align: center; padding: 20px; color: #666; font-size: 12px; border-top: 1px solid #eee; margin-top: 20px; }
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>✨ Lucy's Beauty Parlour</h1>
+		</div>
+		<div class="content">
+			<h2>Your Receipt</h2>
+			<p>Hello %s,</p>
+			<p>Thank you for visiting us on <strong>%s</strong>. Your receipt <strong>%s</strong> for <strong>%s</strong> (%s) is attached.</p>
+			<p>Best regards,<br><strong>Lucy's Beauty Parlour Team</strong></p>
+		</div>
+		<div class="footer">
+			<p>&copy; 2025 Lucy's Beauty Parlour. All rights reserved.</p>
+			<p>Contact: info@lucysbeautyparlour.com | +256-755897061</p>
+		</div>
+	</div>
+</body>
+</html>
+`, inv.CustomerName, inv.AppointmentDate, inv.Number, fullServiceName, total)
+
+	return sendHTMLEmail(inv.CustomerEmail, fmt.Sprintf("Your receipt %s", inv.Number), htmlBody, &resend.Attachment{
+		Content:     receiptPDF,
+		Filename:    inv.Number + ".pdf",
+		ContentType: "application/pdf",
+	})
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"lucys-beauty-parlour-backend/money"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// TableWriter writes a table a row at a time. Cells are strings, integers or
+// money.Money amounts, which are written in their currency's decimal places.
+// Close must be called to finish the table.
+type TableWriter interface {
+	WriteRow(cells ...any) error
+	Close() error
+}
+
+// csvWriter writes each row straight through to w.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter returns a TableWriter that writes CSV to w. Amounts are plain
+// decimals, e.g. "150000" for UGX or "25.50" for USD, so spreadsheets read
+// them as numbers. Text that a spreadsheet would take for a formula, such as
+// a customer named "=HYPERLINK(...)", is written with a leading apostrophe,
+// which keeps it text; so is a phone number like "+256...".
+func NewCSVWriter(w io.Writer) TableWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// formulaPrefixes are the characters a spreadsheet starts a formula with.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeFormula prefixes text a spreadsheet would evaluate with an apostrophe.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func (cw *csvWriter) WriteRow(cells ...any) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		switch v := cell.(type) {
+		case string:
+			record[i] = escapeFormula(v)
+		case int:
+			record[i] = strconv.Itoa(v)
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case money.Money:
+			record[i] = v.Currency.Decimal(v.Amount)
+		default:
+			record[i] = escapeFormula(fmt.Sprint(v))
+		}
+	}
+	if err := cw.w.Write(record); err != nil {
+		return err
+	}
+	// Flush row by row so a long export reaches the client as it is read.
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// xlsxWriter streams rows into a single worksheet and writes the workbook
+// to w on Close.
+type xlsxWriter struct {
+	w      io.Writer
+	file   *excelize.File
+	sheet  *excelize.StreamWriter
+	row    int
+	header int
+	// styles caches a number format style per number of decimal places.
+	styles map[int]int
+}
+
+// NewXLSXWriter returns a TableWriter that writes an Excel workbook with one
+// sheet to w. The first row is bold, and amounts are numbers formatted to
+// their currency's decimal places. Text is written as string cells, which
+// Excel never evaluates, so it needs no escaping.
+func NewXLSXWriter(w io.Writer, sheet string) (TableWriter, error) {
+	f := excelize.NewFile()
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		f.Close()
+		return nil, err
+	}
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	header, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &xlsxWriter{w: w, file: f, sheet: sw, header: header, styles: map[int]int{}}, nil
+}
+
+// amountStyle returns the style for amounts with the given decimal places.
+func (xw *xlsxWriter) amountStyle(places int) (int, error) {
+	if id, ok := xw.styles[places]; ok {
+		return id, nil
+	}
+	format := "#,##0"
+	if places > 0 {
+		format += "." + strings.Repeat("0", places)
+	}
+	id, err := xw.file.NewStyle(&excelize.Style{CustomNumFmt: &format})
+	if err != nil {
+		return 0, err
+	}
+	xw.styles[places] = id
+	return id, nil
+}
+
+func (xw *xlsxWriter) WriteRow(cells ...any) error {
+	xw.row++
+	values := make([]any, len(cells))
+	for i, cell := range cells {
+		switch v := cell.(type) {
+		case money.Money:
+			amount, err := strconv.ParseFloat(v.Currency.Decimal(v.Amount), 64)
+			if err != nil {
+				return err
+			}
+			style, err := xw.amountStyle(v.Currency.MinorUnits)
+			if err != nil {
+				return err
+			}
+			values[i] = excelize.Cell{StyleID: style, Value: amount}
+		default:
+			if xw.row == 1 {
+				values[i] = excelize.Cell{StyleID: xw.header, Value: v}
+			} else {
+				values[i] = v
+			}
+		}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, xw.row)
+	if err != nil {
+		return err
+	}
+	return xw.sheet.SetRow(cell, values)
+}
+
+func (xw *xlsxWriter) Close() error {
+	defer xw.file.Close()
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	_, err := xw.file.WriteTo(xw.w)
+	return err
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"slices"
+	"testing"
+
+	"lucys-beauty-parlour-backend/money"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	fee, err := money.New(-2550, "USD")
+	if err != nil {
+		t.Fatalf("money.New: %v", err)
+	}
+	if err := w.WriteRow(`=HYPERLINK("http://evil.example","x")`, "+256700000000", "-1+1", "@SUM(A1)", "\tx", "Amina", 42, int64(-7), fee); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	got, err := csv.NewReader(&buf).Read()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := []string{`'=HYPERLINK("http://evil.example","x")`, "'+256700000000", "'-1+1", "'@SUM(A1)", "'\tx", "Amina", "42", "-7", "-25.50"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("row = %q; want %q", got, want)
+	}
+}
+
+func TestXLSXWriterWritesTextAsStrings(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf, "customers")
+	if err != nil {
+		t.Fatalf("NewXLSXWriter: %v", err)
+	}
+	price, err := money.New(150000, "UGX")
+	if err != nil {
+		t.Fatalf("money.New: %v", err)
+	}
+	for _, row := range [][]any{
+		{"Name", "Phone", "Price"},
+		{`=HYPERLINK("http://evil.example","x")`, "+256700000000", price},
+	} {
+		if err := w.WriteRow(row...); err != nil {
+			t.Fatalf("WriteRow: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := excelize.OpenReader(&buf)
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	defer f.Close()
+	for cell, want := range map[string]string{"A2": `=HYPERLINK("http://evil.example","x")`, "B2": "+256700000000"} {
+		if formula, _ := f.GetCellFormula("customers", cell); formula != "" {
+			t.Errorf("%s has formula %q", cell, formula)
+		}
+		if typ, _ := f.GetCellType("customers", cell); typ != excelize.CellTypeInlineString {
+			t.Errorf("%s has type %v, want an inline string", cell, typ)
+		}
+		if got, _ := f.GetCellValue("customers", cell); got != want {
+			t.Errorf("%s = %q, want %q", cell, got, want)
+		}
+	}
+	if typ, _ := f.GetCellType("customers", "C2"); typ != excelize.CellTypeNumber && typ != excelize.CellTypeUnset {
+		t.Errorf("C2 has type %v, want a number", typ)
+	}
+}
@@ -2,17 +2,19 @@ package utils
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"golang.org/x/image/draw"
+	"github.com/HugoSmits86/nativewebp"
 )
 
 // MaxImageBytes is the maximum allowed decoded image size (default 5MB)
@@ -35,75 +37,23 @@ func decodeBase64Image(b64 string) ([]byte, error) {
 	}
 
 	if len(data) > MaxImageBytes {
-		return nil, fmt.Errorf("image exceeds max size of %d bytes", MaxImageBytes)
+		return nil, ErrImageTooLarge
 	}
 
 	return data, nil
 }
 
-// Base64ImageToDataURI normalizes a base64 image into a canonical data URI string.
-func Base64ImageToDataURI(b64 string) (string, error) {
-	data, err := decodeBase64Image(b64)
-	if err != nil {
-		return "", err
-	}
-
-	ext := detectImageExt(data)
-	if ext == "" || ext == ".bin" {
-		return "", errors.New("unsupported image format")
-	}
-
-	mime := "image/jpeg"
+// imageMIME returns the content type for an extension from detectImageExt.
+func imageMIME(ext string) string {
 	switch ext {
 	case ".png":
-		mime = "image/png"
+		return "image/png"
 	case ".gif":
-		mime = "image/gif"
+		return "image/gif"
 	case ".webp":
-		mime = "image/webp"
+		return "image/webp"
 	}
-
-	return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data)), nil
-}
-
-// SaveBase64Image decodes a base64 image string (optionally with data URI prefix)
-// and writes it to the local uploads directory. Returns the relative path.
-func SaveBase64Image(b64 string) (string, error) {
-	data, err := decodeBase64Image(b64)
-	if err != nil {
-		return "", err
-	}
-
-	// Simple MIME detection by magic numbers
-	ext := detectImageExt(data)
-	if ext == "" {
-		// default to .bin to avoid incorrect assumptions
-		ext = ".bin"
-	}
-
-	// Use SHA-256 hash of content for filename to deduplicate
-	sum := sha256.Sum256(data)
-	name := fmt.Sprintf("%x%s", sum[:], ext)
-
-	// Ensure uploads directory exists (relative to project root)
-	uploadsDir := filepath.Join(".", "uploads")
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create uploads directory: %w", err)
-	}
-
-	// Write original file
-	relPath := filepath.Join("uploads", name)
-	absPath := filepath.Clean(filepath.Join(".", relPath))
-	if err := os.WriteFile(absPath, data, 0644); err != nil {
-		return "", fmt.Errorf("failed to write image: %w", err)
-	}
-
-	// Generate thumbnail (max width 400px, preserve aspect ratio)
-	_ = generateThumbnail(data, uploadsDir, name, ext)
-
-	// Return path with forward slashes and leading slash for URL compatibility
-	urlPath := "/" + strings.ReplaceAll(relPath, "\\", "/")
-	return urlPath, nil
+	return "image/jpeg"
 }
 
 // detectImageExt attempts to detect common image formats by signature
@@ -130,53 +80,6 @@ func detectImageExt(data []byte) string {
 	return ""
 }
 
-// generateThumbnail creates a smaller version of the image next to the original
-func generateThumbnail(data []byte, uploadsDir, name, ext string) error {
-	img, format, err := image.Decode(bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-	// Determine target size (max width 400)
-	b := img.Bounds()
-	w := b.Dx()
-	h := b.Dy()
-	if w <= 0 || h <= 0 {
-		return errors.New("invalid image dimensions")
-	}
-	maxW := 400
-	if w <= maxW {
-		// No need to resize; still create a copy as thumbnail
-		maxW = w
-	}
-	newW := maxW
-	newH := int(float64(h) * (float64(newW) / float64(w)))
-	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
-	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
-
-	// Thumb filename
-	thumbName := strings.TrimSuffix(name, ext) + "_thumb" + ".jpg"
-	relThumb := filepath.Join("uploads", thumbName)
-	absThumb := filepath.Clean(filepath.Join(".", relThumb))
-
-	// Always encode thumbnail as JPEG to save space
-	f, err := os.Create(absThumb)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	// Use medium quality
-	if format == "png" || format == "gif" || format == "jpeg" {
-		if err := jpeg.Encode(f, dst, &jpeg.Options{Quality: 80}); err != nil {
-			return err
-		}
-	} else {
-		if err := jpeg.Encode(f, dst, &jpeg.Options{Quality: 80}); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // DeleteImageAndThumbnail removes an image file and its derived thumbnail
 func DeleteImageAndThumbnail(relPath string) error {
 	abs := filepath.Clean(filepath.Join(".", relPath))
@@ -190,3 +93,157 @@ func DeleteImageAndThumbnail(relPath string) error {
 	_ = os.Remove(filepath.Clean(filepath.Join(".", thumb)))
 	return nil
 }
+
+// Limits that keep a small, highly compressed file from expanding into an
+// enormous bitmap when decoded (a "decompression bomb").
+const (
+	MaxImageDimension = 10000
+	MaxImagePixels    = 40_000_000
+)
+
+// ErrImageDimensions is returned for images wider, taller or larger in area
+// than the decode limits allow.
+var ErrImageDimensions = fmt.Errorf("image dimensions exceed %dpx per side or %d pixels", MaxImageDimension, MaxImagePixels)
+
+// SanitizeImage fully decodes an uploaded image and re-encodes it in the same
+// format, which validates the content rather than trusting its magic bytes and
+// drops all metadata such as EXIF GPS coordinates. JPEGs are rotated upright
+// according to their EXIF orientation first. The dimensions are checked
+// before any pixels are decoded.
+func SanitizeImage(data []byte) ([]byte, error) {
+	ext := detectImageExt(data)
+	if ext == "" {
+		return nil, ErrUnsupportedImage
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("%w: invalid image dimensions", ErrUnsupportedImage)
+	}
+	if cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension || cfg.Width*cfg.Height > MaxImagePixels {
+		return nil, ErrImageDimensions
+	}
+
+	// GIFs keep only their first frame: the frame count is unbounded, so
+	// decoding every frame could still exhaust memory.
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedImage, err)
+	}
+	var buf bytes.Buffer
+	switch ext {
+	case ".jpg":
+		img = applyOrientation(img, jpegOrientation(data))
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	case ".png":
+		err = png.Encode(&buf, img)
+	case ".gif":
+		err = gif.Encode(&buf, img, nil)
+	case ".webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if buf.Len() > MaxImageBytes {
+		return nil, ErrImageTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when it
+// has none or the metadata cannot be read.
+func jpegOrientation(data []byte) int {
+	// Walk the segments before the image data looking for APP1 "Exif".
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			break
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if size < 2 || i+2+size > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation reads the Orientation tag from IFD0 of a TIFF header.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < entries; n++ {
+		e := ifd + 2 + n*12
+		if e+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[e:e+2]) == 0x0112 { // Orientation, a SHORT
+			if o := int(order.Uint16(tiff[e+8 : e+10])); o >= 1 && o <= 8 {
+				return o
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// applyOrientation transforms img so that an image tagged with EXIF
+// orientation o displays upright without the tag.
+func applyOrientation(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	// Orientations 5-8 swap width and height.
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
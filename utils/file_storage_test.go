@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// exifTIFF returns a TIFF header in order whose IFD0 holds only an
+// Orientation tag of o.
+func exifTIFF(order binary.ByteOrder, o uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8) // IFD0 follows the header
+	order.PutUint16(tiff[8:], 1) // one entry
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3) // SHORT
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], o)
+	return tiff
+}
+
+// withAPP1 inserts an APP1 segment holding payload right after the JPEG's
+// start of image marker.
+func withAPP1(jpg, payload []byte) []byte {
+	seg := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, seg...)
+	out = append(out, payload...)
+	return append(out, jpg[2:]...)
+}
+
+// halvesJPEG encodes a w×h JPEG whose left half is red and right half blue.
+func halvesJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x < w/2 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("encode JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// hasAPP1 reports whether a JPEG has an APP1 (EXIF or XMP) segment.
+func hasAPP1(data []byte) bool {
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		if data[i+1] == 0xDA {
+			break
+		}
+		if data[i+1] == 0xE1 {
+			return true
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+	}
+	return false
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func isBlue(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return b > 0xC000 && r < 0x4000 && g < 0x4000
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	jpg := halvesJPEG(t, 16, 8)
+	cases := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"no EXIF", jpg, 1},
+		{"big-endian", withAPP1(jpg, append([]byte("Exif\x00\x00"), exifTIFF(binary.BigEndian, 6)...)), 6},
+		{"little-endian", withAPP1(jpg, append([]byte("Exif\x00\x00"), exifTIFF(binary.LittleEndian, 8)...)), 8},
+		{"out of range", withAPP1(jpg, append([]byte("Exif\x00\x00"), exifTIFF(binary.BigEndian, 9)...)), 1},
+		{"not EXIF", withAPP1(jpg, []byte("http://ns.adobe.com/xap/1.0/\x00")), 1},
+		{"bad byte order", withAPP1(jpg, append([]byte("Exif\x00\x00XX"), exifTIFF(binary.BigEndian, 6)[2:]...)), 1},
+		{"IFD past the end", withAPP1(jpg, append([]byte("Exif\x00\x00"), exifTIFF(binary.BigEndian, 6)[:10]...)), 1},
+		{"segment past the end", withAPP1(jpg, []byte("Exif\x00\x00"))[:8], 1},
+	}
+	for _, tc := range cases {
+		if got := jpegOrientation(tc.data); got != tc.want {
+			t.Errorf("%s: jpegOrientation = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSanitizeImageRotatesAndStripsEXIF(t *testing.T) {
+	// Orientation 6 means the camera was turned a quarter clockwise, so the
+	// stored picture must be rotated clockwise to display upright.
+	data := withAPP1(halvesJPEG(t, 16, 8), append([]byte("Exif\x00\x00"), exifTIFF(binary.BigEndian, 6)...))
+	out, err := SanitizeImage(data)
+	if err != nil {
+		t.Fatalf("SanitizeImage: %v", err)
+	}
+	if hasAPP1(out) {
+		t.Fatal("sanitised JPEG still has an APP1 segment")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode sanitised JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 16 {
+		t.Fatalf("sanitised size = %dx%d, want 8x16", b.Dx(), b.Dy())
+	}
+	// The red left half ends up on top.
+	if c := img.At(4, 3); !isRed(c) {
+		t.Errorf("top = %v, want red", c)
+	}
+	if c := img.At(4, 12); !isBlue(c) {
+		t.Errorf("bottom = %v, want blue", c)
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// A 2x1 image: red on the left, blue on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+	cases := []struct {
+		o          int
+		w, h       int
+		redX, redY int
+	}{
+		{1, 2, 1, 0, 0},
+		{2, 2, 1, 1, 0},
+		{3, 2, 1, 1, 0},
+		{4, 2, 1, 0, 0},
+		{5, 1, 2, 0, 0},
+		{6, 1, 2, 0, 0},
+		{7, 1, 2, 0, 1},
+		{8, 1, 2, 0, 1},
+	}
+	for _, tc := range cases {
+		got := applyOrientation(src, tc.o)
+		if b := got.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tc.o, b.Dx(), b.Dy(), tc.w, tc.h)
+			continue
+		}
+		if c := got.At(tc.redX, tc.redY); !isRed(c) {
+			t.Errorf("orientation %d: (%d,%d) = %v, want red", tc.o, tc.redX, tc.redY, c)
+		}
+	}
+}
+
+// pngHeader returns the start of a PNG claiming to be w×h, with no pixels.
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], w)
+	binary.BigEndian.PutUint32(ihdr[8:], h)
+	ihdr[12], ihdr[13] = 8, 2 // 8-bit RGB
+	out := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0d")
+	out = append(out, ihdr...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestSanitizeImageRejectsOversizedDimensions(t *testing.T) {
+	cases := []struct {
+		name string
+		w, h uint32
+	}{
+		{"too wide", MaxImageDimension + 1, 1},
+		{"too tall", 1, MaxImageDimension + 1},
+		{"too many pixels", 7000, 7000},
+	}
+	for _, tc := range cases {
+		if _, err := SanitizeImage(pngHeader(tc.w, tc.h)); !errors.Is(err, ErrImageDimensions) {
+			t.Errorf("%s: got %v, want ErrImageDimensions", tc.name, err)
+		}
+	}
+}
+
+func TestSanitizeImageRejectsBadData(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatalf("encode PNG: %v", err)
+	}
+	full := buf.Bytes()
+	jpg := halvesJPEG(t, 16, 8)
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"JPEG magic then garbage", append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte("garbage"), 8)...)},
+		{"PNG magic then garbage", append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("garbage"), 8)...)},
+		{"GIF screen then garbage", append([]byte("GIF89a\x01\x00\x01\x00"), bytes.Repeat([]byte("garbage"), 8)...)},
+		{"WebP magic then garbage", append([]byte("RIFF\x00\x00\x00\x00WEBP"), bytes.Repeat([]byte("garbage"), 8)...)},
+		{"truncated PNG", full[:len(full)/2]},
+		{"PNG header only", pngHeader(64, 64)},
+		{"truncated JPEG", jpg[:len(jpg)/2]},
+		{"no magic", bytes.Repeat([]byte("garbage"), 8)},
+	}
+	for _, tc := range cases {
+		if _, err := SanitizeImage(tc.data); !errors.Is(err, ErrUnsupportedImage) {
+			t.Errorf("%s: got %v, want ErrUnsupportedImage", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"strings"
+
+	"lucys-beauty-parlour-backend/blobstore"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// ErrUnsupportedImage is returned for data that is not a JPEG, PNG, GIF or WebP image.
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	// ErrImageTooLarge is returned for images over MaxImageBytes.
+	ErrImageTooLarge = fmt.Errorf("image exceeds max size of %d bytes", MaxImageBytes)
+)
+
+// ImageKeyPrefix is the blob key prefix shared by originals and derived images.
+const ImageKeyPrefix = "images/"
+
+// ImageStore saves images to a BlobStore under the SHA-256 of their content,
+// so uploading the same picture twice stores it once. Records keep only the
+// returned URL.
+type ImageStore struct {
+	blobs   blobstore.BlobStore
+	cfg     ImageConfig
+	renders singleflight.Group
+}
+
+func NewImageStore(blobs blobstore.BlobStore, cfg ImageConfig) *ImageStore {
+	return &ImageStore{blobs: blobs, cfg: cfg}
+}
+
+// IsDataURI reports whether s is an inline data:image/... reference.
+func IsDataURI(s string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(s)), "data:image/")
+}
+
+// ParseBase64Image decodes a base64 image (optionally a data URI) and checks
+// that it is in a supported format and within MaxImageBytes.
+func ParseBase64Image(b64 string) ([]byte, error) {
+	data, err := decodeBase64Image(b64)
+	if err != nil {
+		return nil, err
+	}
+	if detectImageExt(data) == "" {
+		return nil, ErrUnsupportedImage
+	}
+	return data, nil
+}
+
+// ReadImage reads an uploaded image from r without buffering more than
+// MaxImageBytes. It sniffs the leading bytes first so that non-images are
+// rejected before the rest of the stream is read.
+func ReadImage(r io.Reader) ([]byte, error) {
+	head := make([]byte, 12)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if detectImageExt(head[:n]) == "" {
+		return nil, ErrUnsupportedImage
+	}
+	data, err := io.ReadAll(io.LimitReader(io.MultiReader(bytes.NewReader(head[:n]), r), MaxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageBytes {
+		return nil, ErrImageTooLarge
+	}
+	return data, nil
+}
+
+// SaveBase64 decodes a base64 image (optionally a data URI) and saves it.
+func (s *ImageStore) SaveBase64(ctx context.Context, b64 string) (string, error) {
+	data, err := ParseBase64Image(b64)
+	if err != nil {
+		return "", err
+	}
+	return s.Save(ctx, data)
+}
+
+// Save sanitises the image (see SanitizeImage), stores it and its configured
+// variants if they are not stored already and returns the URL of the original.
+func (s *ImageStore) Save(ctx context.Context, data []byte) (string, error) {
+	if len(data) > MaxImageBytes {
+		return "", ErrImageTooLarge
+	}
+	data, err := SanitizeImage(data)
+	if err != nil {
+		return "", err
+	}
+	hash, ext, err := imageHash(data)
+	if err != nil {
+		return "", err
+	}
+	key := ImageKeyPrefix + hash + ext
+
+	if err := s.putOnce(ctx, key, data, imageMIME(ext)); err != nil {
+		return "", err
+	}
+	// Missing variants should not fail the upload; GET /images renders them on demand.
+	if img, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		log.Printf("variants for %s: %v", key, err)
+	} else if err := s.saveVariants(ctx, hash, img); err != nil {
+		log.Printf("variants for %s: %v", key, err)
+	}
+	return s.blobs.URL(key), nil
+}
+
+// URLFor returns the URL Save would return for data, without storing it.
+func (s *ImageStore) URLFor(data []byte) (string, error) {
+	data, err := SanitizeImage(data)
+	if err != nil {
+		return "", err
+	}
+	hash, ext, err := imageHash(data)
+	if err != nil {
+		return "", err
+	}
+	return s.blobs.URL(ImageKeyPrefix + hash + ext), nil
+}
+
+// imageHash returns the hex SHA-256 of data and its file extension.
+func imageHash(data []byte) (hash, ext string, err error) {
+	ext = detectImageExt(data)
+	if ext == "" {
+		return "", "", ErrUnsupportedImage
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), ext, nil
+}
+
+// putOnce writes data under key unless an object is already there. Keys are
+// content hashes, so an existing object already holds the same bytes.
+func (s *ImageStore) putOnce(ctx context.Context, key string, data []byte, contentType string) error {
+	exists, err := s.blobs.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return s.blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// Owns reports whether url points at an image saved by this store.
+func (s *ImageStore) Owns(url string) bool {
+	key, ok := s.blobs.Key(url)
+	return ok && strings.HasPrefix(key, ImageKeyPrefix)
+}
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lucys-beauty-parlour-backend/blobstore"
+	"lucys-beauty-parlour-backend/models"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageVariant is a named rendition width, e.g. thumb at 400px.
+type ImageVariant struct {
+	Name  string
+	Width int
+}
+
+// ImageConfig lists the renditions generated for every saved image.
+type ImageConfig struct {
+	Variants []ImageVariant // ordered by width
+	Formats  []string       // formats stored on upload; only "jpeg" is supported
+	Quality  int            // JPEG quality, 1-100
+}
+
+// DefaultImageConfig is used when IMAGE_VARIANTS, IMAGE_FORMATS and
+// IMAGE_QUALITY are unset.
+var DefaultImageConfig = ImageConfig{
+	Variants: []ImageVariant{{"thumb", 400}, {"medium", 800}, {"large", 1600}},
+	Formats:  []string{"jpeg"},
+	Quality:  80,
+}
+
+// ImageConfigFromEnv reads IMAGE_VARIANTS ("thumb:400,medium:800,..."),
+// IMAGE_FORMATS ("jpeg") and IMAGE_QUALITY ("80"), falling back to
+// DefaultImageConfig.
+func ImageConfigFromEnv() (ImageConfig, error) {
+	cfg := DefaultImageConfig
+	if raw := strings.TrimSpace(os.Getenv("IMAGE_VARIANTS")); raw != "" {
+		cfg.Variants = nil
+		for _, part := range strings.Split(raw, ",") {
+			name, width, ok := strings.Cut(strings.TrimSpace(part), ":")
+			w, err := strconv.Atoi(width)
+			if !ok || name == "" || err != nil || w <= 0 {
+				return cfg, fmt.Errorf("invalid IMAGE_VARIANTS entry %q (want name:width)", part)
+			}
+			cfg.Variants = append(cfg.Variants, ImageVariant{Name: name, Width: w})
+		}
+		sort.Slice(cfg.Variants, func(i, j int) bool { return cfg.Variants[i].Width < cfg.Variants[j].Width })
+	}
+	if raw := strings.TrimSpace(os.Getenv("IMAGE_FORMATS")); raw != "" {
+		cfg.Formats = nil
+		for _, part := range strings.Split(raw, ",") {
+			f, ok := NormalizeImageFormat(part)
+			if !ok || f == "" {
+				return cfg, fmt.Errorf("invalid IMAGE_FORMATS entry %q (use jpeg)", part)
+			}
+			if !slices.Contains(cfg.Formats, f) {
+				cfg.Formats = append(cfg.Formats, f)
+			}
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("IMAGE_QUALITY")); raw != "" {
+		q, err := strconv.Atoi(raw)
+		if err != nil || q < 1 || q > 100 {
+			return cfg, fmt.Errorf("invalid IMAGE_QUALITY %q (want 1-100)", raw)
+		}
+		cfg.Quality = q
+	}
+	return cfg, nil
+}
+
+// NormalizeImageFormat maps a requested output format onto "jpeg". Empty
+// stays empty, meaning the original format. WebP is not offered: the only
+// WebP encoder available in pure Go is lossless, and its output is usually
+// larger than the JPEG.
+func NormalizeImageFormat(f string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(f)) {
+	case "":
+		return "", true
+	case "jpeg", "jpg":
+		return "jpeg", true
+	}
+	return "", false
+}
+
+// Config returns the renditions the store generates.
+func (s *ImageStore) Config() ImageConfig { return s.cfg }
+
+// SnapWidth rounds a requested width up to the nearest configured variant so
+// that arbitrary widths cannot fill the cache; 0 means full size.
+func (c ImageConfig) SnapWidth(w int) int {
+	if w <= 0 || len(c.Variants) == 0 {
+		return 0
+	}
+	for _, v := range c.Variants {
+		if v.Width >= w {
+			return v.Width
+		}
+	}
+	return c.Variants[len(c.Variants)-1].Width
+}
+
+// IsImageHash reports whether s looks like the hex SHA-256 an image is stored under.
+func IsImageHash(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// variantKey is where the JPEG rendition of hash at width (0 = full size) is cached.
+func variantKey(hash string, width int) string {
+	size := "full"
+	if width > 0 {
+		size = "w" + strconv.Itoa(width)
+	}
+	return ImageKeyPrefix + hash + "/" + size + ".jpg"
+}
+
+// resizeToWidth scales img down to at most maxW pixels wide, preserving its
+// aspect ratio. Images already narrow enough are returned unchanged.
+func resizeToWidth(img image.Image, maxW int) image.Image {
+	b := img.Bounds()
+	if maxW <= 0 || b.Dx() <= maxW {
+		return img
+	}
+	newH := int(float64(b.Dy()) * (float64(maxW) / float64(b.Dx())))
+	if newH < 1 {
+		newH = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, maxW, newH))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// encodeImage encodes img in format; JPEGs use the configured quality.
+func (s *ImageStore) encodeImage(img image.Image, format string) ([]byte, error) {
+	if format != "jpeg" {
+		return nil, fmt.Errorf("encode %s: %w", format, ErrUnsupportedImage)
+	}
+	quality := s.cfg.Quality
+	if quality <= 0 {
+		quality = DefaultImageConfig.Quality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// saveVariants renders and stores every configured variant of an image.
+func (s *ImageStore) saveVariants(ctx context.Context, hash string, img image.Image) error {
+	for _, v := range s.cfg.Variants {
+		resized := resizeToWidth(img, v.Width)
+		for _, f := range s.cfg.Formats {
+			data, err := s.encodeImage(resized, f)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", v.Name, f, err)
+			}
+			if err := s.putOnce(ctx, variantKey(hash, v.Width), data, "image/"+f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findOriginal returns the key of the original image stored under hash.
+func (s *ImageStore) findOriginal(ctx context.Context, hash string) (string, error) {
+	for _, ext := range []string{".jpg", ".png", ".webp", ".gif"} {
+		key := ImageKeyPrefix + hash + ext
+		ok, err := s.blobs.Exists(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("image %s: %w", hash, blobstore.ErrNotExist)
+}
+
+// Open returns the image stored under hash, scaled to at most width pixels
+// wide (0 keeps the full size) and encoded as format ("" keeps the original
+// file). Renditions are rendered once and cached in the blob store; concurrent
+// requests for the same rendition share one render. Missing images return an
+// error wrapping blobstore.ErrNotExist.
+func (s *ImageStore) Open(ctx context.Context, hash string, width int, format string) (io.ReadCloser, string, error) {
+	orig, err := s.findOriginal(ctx, hash)
+	if err != nil {
+		return nil, "", err
+	}
+	if width <= 0 && format == "" {
+		rc, err := s.blobs.Get(ctx, orig)
+		return rc, imageMIME(orig[strings.LastIndex(orig, "."):]), err
+	}
+	if format == "" {
+		format = "jpeg"
+	}
+	if format != "jpeg" {
+		return nil, "", fmt.Errorf("image format %q: %w", format, ErrUnsupportedImage)
+	}
+
+	key := variantKey(hash, width)
+	if rc, err := s.blobs.Get(ctx, key); err == nil {
+		return rc, "image/" + format, nil
+	} else if !errors.Is(err, blobstore.ErrNotExist) {
+		return nil, "", err
+	}
+
+	// The render is shared, so one client going away must not cancel it for the rest.
+	renderCtx := context.WithoutCancel(ctx)
+	v, err, _ := s.renders.Do(key, func() (any, error) {
+		rc, err := s.blobs.Get(renderCtx, orig)
+		if err != nil {
+			return nil, err
+		}
+		src, err := io.ReadAll(io.LimitReader(rc, MaxImageBytes+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		// Originals are sanitised on upload, but check again before decoding
+		// anything that reached the store another way.
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(src))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", orig, err)
+		}
+		if cfg.Width > MaxImageDimension || cfg.Height > MaxImageDimension || cfg.Width*cfg.Height > MaxImagePixels {
+			return nil, fmt.Errorf("decode %s: %w", orig, ErrImageDimensions)
+		}
+		img, _, err := image.Decode(bytes.NewReader(src))
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", orig, err)
+		}
+		data, err := s.encodeImage(resizeToWidth(img, width), format)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.blobs.Put(renderCtx, key, bytes.NewReader(data), int64(len(data)), "image/"+format); err != nil {
+			return nil, err
+		}
+		return data, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(bytes.NewReader(v.([]byte))), "image/" + format, nil
+}
+
+// imageEndpoint is where GET /images/:hash serves renditions from.
+const imageEndpoint = "/images/"
+
+// ImageSets describes the responsive renditions of each image URL. Images
+// not held by this store, such as external URLs, get only a Src.
+func (s *ImageStore) ImageSets(urls []string) []models.ImageSet {
+	sets := make([]models.ImageSet, 0, len(urls))
+	for _, u := range urls {
+		set := models.ImageSet{Src: u}
+		if hash, ok := s.HashOf(u); ok && len(s.cfg.Variants) > 0 {
+			set.Thumb = variantURL(hash, s.cfg.Variants[0].Width, "jpeg")
+			parts := make([]string, 0, len(s.cfg.Variants))
+			for _, v := range s.cfg.Variants {
+				parts = append(parts, fmt.Sprintf("%s %dw", variantURL(hash, v.Width, "jpeg"), v.Width))
+			}
+			set.Srcset = strings.Join(parts, ", ")
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+func variantURL(hash string, width int, format string) string {
+	return fmt.Sprintf("%s%s?w=%d&format=%s", imageEndpoint, hash, width, format)
+}
+
+// HashOf extracts the content hash from the URL of an image saved by this store.
+func (s *ImageStore) HashOf(url string) (string, bool) {
+	key, ok := s.blobs.Key(url)
+	if !ok {
+		return "", false
+	}
+	return ImageHashFromKey(key)
+}
+
+// ImageHashFromKey returns the content hash a blob key belongs to, for both
+// originals (images/<hash>.<ext>) and renditions (images/<hash>/...).
+func ImageHashFromKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, ImageKeyPrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(key, ImageKeyPrefix)
+	if i := strings.IndexAny(name, "./"); i >= 0 {
+		name = name[:i]
+	}
+	return name, IsImageHash(name)
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"lucys-beauty-parlour-backend/blobstore"
+)
+
+func TestImageConfigFromEnv(t *testing.T) {
+	cases := []struct {
+		name, formats, quality string
+		wantFormats            []string
+		wantQuality            int
+		wantErr                bool
+	}{
+		{name: "defaults", wantFormats: []string{"jpeg"}, wantQuality: 80},
+		{name: "duplicates dropped", formats: "jpeg, jpg,JPEG", quality: "70", wantFormats: []string{"jpeg"}, wantQuality: 70},
+		{name: "webp", formats: "jpeg,webp", wantErr: true},
+		{name: "bad format", formats: "avif", wantErr: true},
+		{name: "quality too low", quality: "0", wantErr: true},
+		{name: "quality too high", quality: "101", wantErr: true},
+		{name: "quality not a number", quality: "high", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Setenv("IMAGE_VARIANTS", "")
+		t.Setenv("IMAGE_FORMATS", tc.formats)
+		t.Setenv("IMAGE_QUALITY", tc.quality)
+		cfg, err := ImageConfigFromEnv()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !slices.Equal(cfg.Formats, tc.wantFormats) || cfg.Quality != tc.wantQuality {
+			t.Errorf("%s: formats %q quality %d; want %q quality %d", tc.name, cfg.Formats, cfg.Quality, tc.wantFormats, tc.wantQuality)
+		}
+	}
+}
+
+// noisyPNG encodes a w×h PNG with enough detail that JPEG quality shows in
+// the size of the output.
+func noisyPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x*7 ^ y*13), G: uint8(x*y + y), B: uint8(x ^ y*3), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func newTestImageStore(t *testing.T, cfg ImageConfig) (*ImageStore, string) {
+	t.Helper()
+	dir := t.TempDir()
+	blobs, err := blobstore.NewLocal(dir, "/uploads")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	return NewImageStore(blobs, cfg), dir
+}
+
+func TestImageVariantsAreJPEG(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newTestImageStore(t, ImageConfig{
+		Variants: []ImageVariant{{"thumb", 100}},
+		Formats:  []string{"jpeg"},
+		Quality:  80,
+	})
+	url, err := s.Save(ctx, noisyPNG(t, 200, 100))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	hash, ok := s.HashOf(url)
+	if !ok {
+		t.Fatalf("HashOf(%q) failed", url)
+	}
+
+	variants, err := filepath.Glob(filepath.Join(dir, "images", hash, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 1 || filepath.Base(variants[0]) != "w100.jpg" {
+		t.Errorf("variants = %q; want only w100.jpg", variants)
+	}
+
+	set := s.ImageSets([]string{url})[0]
+	want := "/images/" + hash + "?w=100&format=jpeg 100w"
+	if set.Srcset != want {
+		t.Errorf("srcset = %q; want %q", set.Srcset, want)
+	}
+
+	for _, format := range []string{"jpeg", ""} {
+		rc, contentType, err := s.Open(ctx, hash, 100, format)
+		if err != nil {
+			t.Fatalf("Open %q: %v", format, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if contentType != "image/jpeg" {
+			t.Errorf("Open %q: content type %q; want image/jpeg", format, contentType)
+		}
+		if _, kind, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || kind != "jpeg" {
+			t.Errorf("Open %q: decoded as %q (%v); want jpeg", format, kind, err)
+		}
+	}
+	if _, _, err := s.Open(ctx, hash, 100, "webp"); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("Open webp: %v; want ErrUnsupportedImage", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "images", hash, "w100.webp")); !os.IsNotExist(err) {
+		t.Errorf("a .webp rendition was cached: %v", err)
+	}
+}
+
+func TestImageQuality(t *testing.T) {
+	src := noisyPNG(t, 400, 300)
+	size := func(quality int) int {
+		s, _ := newTestImageStore(t, ImageConfig{Formats: []string{"jpeg"}, Quality: quality})
+		url, err := s.Save(context.Background(), src)
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		hash, _ := s.HashOf(url)
+		rc, _, err := s.Open(context.Background(), hash, 200, "jpeg")
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		return len(data)
+	}
+	if low, high := size(40), size(95); low >= high {
+		t.Errorf("quality 40 gave %d bytes, quality 95 gave %d; want fewer at 40", low, high)
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"lucys-beauty-parlour-backend/models"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// RenderReceiptPDF renders an invoice as a one-page A4 receipt. The same
+// invoice always renders to the same bytes.
+func RenderReceiptPDF(inv *models.Invoice) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Receipt "+inv.Number, true)
+	pdf.SetAuthor("Lucy's Beauty Parlour", true)
+	// Fonts are kept in a map; sort them so the output doesn't vary.
+	pdf.SetCatalogSort(true)
+	if issued, err := time.Parse("2006-01-02T15:04:05Z", inv.IssuedAt); err == nil {
+		pdf.SetCreationDate(issued)
+		pdf.SetModificationDate(issued)
+	}
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+	// The core fonts are Windows-1252; translate names like "Zoë".
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	width, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	content := width - left - right
+
+	pdf.SetTextColor(102, 126, 234)
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(content/2, 10, tr("Lucy's Beauty Parlour"), "", 0, "L", false, 0, "")
+	pdf.SetTextColor(51, 51, 51)
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(content/2, 10, "RECEIPT", "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(content, 5, "info@lucysbeautyparlour.com | +256-755897061", "", 1, "L", false, 0, "")
+	pdf.Ln(8)
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, row := range [][2]string{
+		{"Receipt number", inv.Number},
+		{"Issued", strings.SplitN(inv.IssuedAt, "T", 2)[0]},
+		{"Appointment", fmt.Sprintf("#%d on %s", inv.AppointmentID, inv.AppointmentDate)},
+		{"Billed to", tr(inv.CustomerName)},
+		{"Email", tr(inv.CustomerEmail)},
+	} {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, 6, row[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(content-40, 6, row[1], "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	amountWidth := 45.0
+	pdf.SetFillColor(245, 245, 245)
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(content-amountWidth, 8, "Description", "B", 0, "L", true, 0, "")
+	pdf.CellFormat(amountWidth, 8, "Amount", "B", 1, "R", true, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	description := formatFullServiceName(inv.ServiceName, inv.ServiceDescription)
+	y := pdf.GetY()
+	pdf.MultiCell(content-amountWidth, 7, tr(description), "", "L", false)
+	end := pdf.GetY()
+	pdf.SetXY(left+content-amountWidth, y)
+	pdf.CellFormat(amountWidth, 7, formatAppointmentTotal(inv.Currency, inv.TotalCents+inv.DiscountCents), "", 1, "R", false, 0, "")
+	pdf.SetY(end)
+	pdf.Line(left, end+1, left+content, end+1)
+	pdf.Ln(4)
+
+	rows, paidInFull := receiptTotals(inv)
+	for _, row := range rows {
+		style := ""
+		if row.bold {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 10)
+		pdf.CellFormat(content-amountWidth, 7, tr(row.label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountWidth, 7, row.amount, "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(12)
+
+	footer := "Thank you for choosing Lucy's Beauty Parlour!"
+	if paidInFull {
+		footer = "Paid in full. " + footer
+	}
+	pdf.SetFont("Helvetica", "I", 10)
+	pdf.CellFormat(content, 6, footer, "", 1, "C", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("render receipt %s: %w", inv.Number, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// receiptRow is a line under a receipt's items.
+type receiptRow struct {
+	label, amount string
+	bold          bool
+}
+
+// receiptTotals lists the price, any discount, the total, the deposit asked
+// for and what was paid online, and reports whether that paid the total.
+func receiptTotals(inv *models.Invoice) (rows []receiptRow, paidInFull bool) {
+	amount := func(cents int64) string { return formatAppointmentTotal(inv.Currency, cents) }
+	if inv.DiscountCents > 0 {
+		var with []string
+		if inv.PromoCode != "" {
+			with = append(with, "code "+inv.PromoCode)
+		}
+		if inv.PointsRedeemed > 0 {
+			with = append(with, fmt.Sprintf("%d loyalty points", inv.PointsRedeemed))
+		}
+		label := "Discount"
+		if len(with) > 0 {
+			label += " (" + strings.Join(with, " and ") + ")"
+		}
+		rows = append(rows,
+			receiptRow{label: "Price", amount: amount(inv.TotalCents + inv.DiscountCents)},
+			receiptRow{label: label, amount: "-" + amount(inv.DiscountCents)},
+		)
+	}
+	rows = append(rows, receiptRow{label: "Total", amount: amount(inv.TotalCents), bold: true})
+	if inv.DepositCents > 0 {
+		rows = append(rows, receiptRow{label: "Deposit", amount: amount(inv.DepositCents)})
+	}
+	rows = append(rows, receiptRow{label: "Paid online", amount: amount(inv.DepositPaidCents)})
+	if balance := inv.TotalCents - inv.DepositPaidCents; balance > 0 {
+		rows = append(rows, receiptRow{label: "Balance due", amount: amount(balance)})
+	}
+	return rows, inv.DepositPaidCents >= inv.TotalCents
+}
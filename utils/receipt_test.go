@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"lucys-beauty-parlour-backend/models"
+)
+
+// pdfText returns the content streams of a PDF, inflated, so the text the
+// pages show can be searched.
+func pdfText(t *testing.T, pdf []byte) string {
+	t.Helper()
+	var out strings.Builder
+	for {
+		start := bytes.Index(pdf, []byte("stream\n"))
+		if start < 0 {
+			break
+		}
+		pdf = pdf[start+len("stream\n"):]
+		end := bytes.Index(pdf, []byte("endstream"))
+		if end < 0 {
+			t.Fatal("unterminated PDF stream")
+		}
+		if r, err := zlib.NewReader(bytes.NewReader(pdf[:end])); err == nil {
+			text, _ := io.ReadAll(r)
+			out.Write(text)
+		}
+		pdf = pdf[end+len("endstream"):]
+	}
+	return out.String()
+}
+
+func TestRenderReceiptPDFAmounts(t *testing.T) {
+	base := models.Invoice{
+		Number:          "INV-000042",
+		AppointmentID:   7,
+		CustomerName:    "Amina N.",
+		CustomerEmail:   "amina@example.com",
+		ServiceName:     "Braids",
+		AppointmentDate: "2026-06-01",
+		Currency:        "UGX",
+		IssuedAt:        "2026-06-01T15:00:00Z",
+	}
+	cases := []struct {
+		name    string
+		edit    func(inv *models.Invoice)
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "discounted, deposit paid",
+			edit: func(inv *models.Invoice) {
+				inv.TotalCents, inv.DiscountCents, inv.PromoCode, inv.PointsRedeemed = 130000, 20000, "SPRING10", 40
+				inv.DepositCents, inv.DepositPaidCents = 50000, 50000
+			},
+			want: []string{
+				"(UGX 150,000)", "(Price)",
+				"(Discount \\(code SPRING10 and 40 loyalty points\\))", "(-UGX 20,000)",
+				"(Total)", "(UGX 130,000)",
+				"(Deposit)", "(Paid online)", "(UGX 50,000)",
+				"(Balance due)", "(UGX 80,000)",
+			},
+			notWant: []string{"Paid in full"},
+		},
+		{
+			name: "paid in full online",
+			edit: func(inv *models.Invoice) {
+				inv.TotalCents, inv.DepositPaidCents = 150000, 150000
+			},
+			want:    []string{"(Total)", "(UGX 150,000)", "(Paid online)", "Paid in full"},
+			notWant: []string{"Discount", "(Deposit)", "Balance due"},
+		},
+		{
+			name: "nothing paid online",
+			edit: func(inv *models.Invoice) {
+				inv.TotalCents = 150000
+			},
+			want:    []string{"(Paid online)", "(UGX 0)", "(Balance due)", "(UGX 150,000)"},
+			notWant: []string{"Paid in full"},
+		},
+	}
+	for _, tc := range cases {
+		inv := base
+		tc.edit(&inv)
+		pdf, err := RenderReceiptPDF(&inv)
+		if err != nil {
+			t.Fatalf("%s: RenderReceiptPDF: %v", tc.name, err)
+		}
+		text := pdfText(t, pdf)
+		for _, s := range tc.want {
+			if !strings.Contains(text, s) {
+				t.Errorf("%s: receipt lacks %s", tc.name, s)
+			}
+		}
+		for _, s := range tc.notWant {
+			if strings.Contains(text, s) {
+				t.Errorf("%s: receipt shows %s", tc.name, s)
+			}
+		}
+		// The same invoice always renders the same.
+		if again, _ := RenderReceiptPDF(&inv); !bytes.Equal(again, pdf) {
+			t.Errorf("%s: rendering twice gave different PDFs", tc.name)
+		}
+	}
+}